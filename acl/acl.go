@@ -0,0 +1,245 @@
+// Package acl restricts routes to callers holding a role, bearing a token or
+// connecting from a network, as listed in configuration rather than code.
+package acl
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+var ErrDenied = errors.New("access denied by the access control list")
+
+// Rule selects routes by tag or pattern and lists who may reach them. A
+// caller is let through by holding any of Roles, bearing any of Tokens or
+// connecting from any of CIDRs; a rule listing none of them denies all.
+type Rule struct {
+	// Tags selects the routes carrying any of these tags, see Route.Tag.
+	Tags []string `mapstructure:"tags"`
+	// Patterns selects routes by the pattern they were registered with,
+	// e.g. "GET:/users/{id}", "/admin/*" for /admin and every route below
+	// it, "*:/reports" or "/reports" for every method. A mount is selected
+	// for the requests to the paths below it that a pattern names.
+	Patterns []string `mapstructure:"patterns"`
+
+	Roles []string `mapstructure:"roles"`
+	// Tokens are accepted as "Authorization: Bearer <token>".
+	Tokens []string `mapstructure:"tokens"`
+	// CIDRs are matched against router.ClientIP: 10.0.0.0/8 or a bare
+	// address.
+	CIDRs []string `mapstructure:"cidrs"`
+}
+
+type pattern struct {
+	method string
+	path   string
+	// folded is path with its literal segments lower-cased, compared on
+	// routers matching case-insensitively.
+	folded string
+	prefix bool
+}
+
+type rule struct {
+	tags     []string
+	patterns []pattern
+	roles    []string
+	tokens   [][]byte
+	networks []netip.Prefix
+}
+
+// List is the set of rules currently enforced. It is a
+// router.AccessPolicy: a route selected by several rules must satisfy each
+// of them, and routes no rule selects are left alone.
+type List struct {
+	roles func(r *http.Request) []string
+	rules atomic.Pointer[[]rule]
+}
+
+// New returns an empty List. roles returns the roles held by the caller,
+// e.g. from the claims of the signed-in user; nil grants none.
+func New(roles func(r *http.Request) []string) *List {
+	if roles == nil {
+		roles = func(*http.Request) []string { return nil }
+	}
+	return &List{roles: roles}
+}
+
+// Load replaces the rules. On error the previous rules stay in force. It is
+// safe to call while serving requests.
+func (l *List) Load(rules []Rule) error {
+	compiled := make([]rule, 0, len(rules))
+	for i, r := range rules {
+		c, err := compile(r)
+		if err != nil {
+			return fmt.Errorf("acl: rule %d: %w", i, err)
+		}
+		compiled = append(compiled, c)
+	}
+	l.rules.Store(&compiled)
+	return nil
+}
+
+func compile(r Rule) (rule, error) {
+	if len(r.Tags) == 0 && len(r.Patterns) == 0 {
+		return rule{}, errors.New("selects no route, set tags or patterns")
+	}
+	c := rule{tags: r.Tags, roles: r.Roles}
+	for _, p := range r.Patterns {
+		method, path, ok := strings.Cut(p, ":")
+		if !ok {
+			method, path = "*", p
+		}
+		if !strings.HasPrefix(path, "/") {
+			return rule{}, fmt.Errorf("pattern %q: path must start with /", p)
+		}
+		path, prefix := strings.CutSuffix(path, "/*")
+		path = "/" + strings.Trim(path, "/")
+		c.patterns = append(c.patterns, pattern{
+			method: strings.ToUpper(method),
+			path:   path,
+			folded: foldCase(path),
+			prefix: prefix,
+		})
+	}
+	for _, token := range r.Tokens {
+		if token == "" {
+			return rule{}, errors.New("empty token")
+		}
+		c.tokens = append(c.tokens, []byte(token))
+	}
+	for _, cidr := range r.CIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(cidr)
+			if aerr != nil {
+				return rule{}, fmt.Errorf("cidr %q: %w", cidr, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		c.networks = append(c.networks, prefix.Masked())
+	}
+	return c, nil
+}
+
+func (l *List) Allow(route *router.Route, r *http.Request) error {
+	rules := l.rules.Load()
+	if rules == nil {
+		return nil
+	}
+	var roles []string
+	for i := range *rules {
+		rule := &(*rules)[i]
+		if !rule.selects(route, r) {
+			continue
+		}
+		if roles == nil {
+			roles = l.roles(r)
+		}
+		if !rule.admits(r, roles) {
+			return ErrDenied
+		}
+	}
+	return nil
+}
+
+func (rl *rule) selects(route *router.Route, r *http.Request) bool {
+	for _, tag := range route.Tags() {
+		if slices.Contains(rl.tags, tag) {
+			return true
+		}
+	}
+	fold := router.FoldsCase(r)
+	path := "/" + strings.Trim(route.Path(), "/")
+	// A mount serves every path below its own, so patterns naming one of
+	// those select it for the requests to them.
+	var below string
+	if route.Mounted() {
+		below = "/" + strings.Trim(router.OriginalPath(r), "/")
+		if fold {
+			below = strings.ToLower(below)
+		}
+	}
+	for _, p := range rl.patterns {
+		pp := p.path
+		if fold {
+			pp = p.folded
+		}
+		if p.method == "*" || route.Mounted() || p.method == route.Method() {
+			if path == pp || p.prefix && (pp == "/" || strings.HasPrefix(path, pp+"/")) {
+				return true
+			}
+		}
+		if route.Mounted() && (p.method == "*" || p.method == r.Method) && covers(pp, p.prefix, below) {
+			return true
+		}
+	}
+	return false
+}
+
+// covers reports whether the request path matches pattern, whose
+// parameters match any segment, or any below it too when prefix is set.
+func covers(pattern string, prefix bool, path string) bool {
+	if prefix && pattern == "/" {
+		return true
+	}
+	want := strings.Split(strings.Trim(pattern, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+	for i, s := range want {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "...}") {
+			return true
+		}
+		if i == len(got) {
+			// Only an optional parameter may be missing, at the end.
+			return i == len(want)-1 && strings.HasSuffix(s, "?}")
+		}
+		if s != got[i] && !strings.HasPrefix(s, "{") {
+			return false
+		}
+	}
+	return prefix || len(got) == len(want)
+}
+
+// foldCase lower-cases the literal segments of path, as the router does for
+// the routes of a CaseInsensitive router.
+func foldCase(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+			segments[i] = strings.ToLower(s)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func (rl *rule) admits(r *http.Request, roles []string) bool {
+	for _, role := range rl.roles {
+		if slices.Contains(roles, role) {
+			return true
+		}
+	}
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		for _, token := range rl.tokens {
+			if subtle.ConstantTimeCompare([]byte(bearer), token) == 1 {
+				return true
+			}
+		}
+	}
+	if len(rl.networks) > 0 {
+		if ip := router.ClientIP(r); ip.IsValid() {
+			ip = ip.Unmap()
+			for _, network := range rl.networks {
+				if network.Contains(ip) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
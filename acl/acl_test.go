@@ -0,0 +1,120 @@
+package acl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+func TestList(t *testing.T) {
+	list := New(func(r *http.Request) []string {
+		if v := r.Header.Get("X-Roles"); v != "" {
+			return strings.Split(v, ",")
+		}
+		return nil
+	})
+	err := list.Load([]Rule{
+		{Patterns: []string{"/admin/*"}, Roles: []string{"admin"}},
+		{Patterns: []string{"DELETE:/files/{name}"}, Tokens: []string{"deploy-token"}},
+		{Patterns: []string{"/files/private/*"}, Roles: []string{"admin"}},
+		{Tags: []string{"internal"}, CIDRs: []string{"10.0.0.0/8", "192.0.2.7"}},
+		// Listing no one denies everyone.
+		{Patterns: []string{"*:/locked"}},
+		{Patterns: []string{"GET:/users/{id}"}, Roles: []string{"support"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {})
+	for name, opts := range map[string][]router.Option{
+		"": {router.WithMatcher(router.NewTrieMatcher())},
+		// Rules are written in lower case.
+		"case-insensitive ": {router.WithMatcher(router.NewTrieMatcher()), router.CaseInsensitive()},
+	} {
+		r := router.New(opts...)
+		r.SetAccessPolicy(list)
+		r.Mount("/admin", ok)
+		r.Mount("/files", ok)
+		r.Handle("GET:/users/{id}", ok)
+		r.Handle("GET:/metrics", ok).Tag("internal")
+		r.Handle("GET:/locked", ok)
+		r.Handle("GET:/public", ok)
+
+		for _, tt := range []struct {
+			method, path string
+			header       [2]string
+			remote       string
+			status       int
+		}{
+			{"GET", "/public", [2]string{}, "", 200},
+			{"GET", "/admin", [2]string{}, "", 403},
+			{"GET", "/admin/users/1", [2]string{}, "", 403},
+			{"POST", "/admin/users", [2]string{"X-Roles", "viewer"}, "", 403},
+			{"GET", "/admin/users/1", [2]string{"X-Roles", "viewer,admin"}, "", 200},
+			// Below the /files mount, only deletes of a single file are
+			// guarded, and the private directory by role.
+			{"GET", "/files/report.pdf", [2]string{}, "", 200},
+			{"DELETE", "/files/report.pdf", [2]string{}, "", 403},
+			{"DELETE", "/files/report.pdf", [2]string{"Authorization", "Bearer wrong"}, "", 403},
+			{"DELETE", "/files/report.pdf", [2]string{"Authorization", "Bearer deploy-token"}, "", 200},
+			{"DELETE", "/files/a/b", [2]string{}, "", 200},
+			{"GET", "/files/private", [2]string{}, "", 403},
+			{"GET", "/files/private/key.pem", [2]string{}, "", 403},
+			{"GET", "/files/private/key.pem", [2]string{"X-Roles", "admin"}, "", 200},
+			{"GET", "/files/privateer", [2]string{}, "", 200},
+			{"GET", "/metrics", [2]string{}, "203.0.113.1:1234", 403},
+			{"GET", "/metrics", [2]string{}, "10.1.2.3:1234", 200},
+			{"GET", "/metrics", [2]string{}, "192.0.2.7:1234", 200},
+			{"GET", "/locked", [2]string{"X-Roles", "admin"}, "", 403},
+			{"GET", "/users/7", [2]string{}, "", 403},
+			{"GET", "/users/7", [2]string{"X-Roles", "support"}, "", 200},
+		} {
+			path := tt.path
+			if name != "" {
+				path = strings.ToUpper(path)
+			}
+			rr := httptest.NewRequest(tt.method, path, nil)
+			if tt.header[0] != "" {
+				rr.Header.Set(tt.header[0], tt.header[1])
+			}
+			if tt.remote != "" {
+				rr.RemoteAddr = tt.remote
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, rr)
+			if rec.Code != tt.status {
+				t.Errorf("%s%s %s %v = %d, want %d", name, tt.method, path, tt.header, rec.Code, tt.status)
+			}
+		}
+	}
+}
+
+func TestLoadKeepsRulesOnError(t *testing.T) {
+	list := New(nil)
+	if err := list.Load([]Rule{{Patterns: []string{"/admin/*"}}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, rules := range [][]Rule{
+		{{Roles: []string{"admin"}}},
+		{{Patterns: []string{"admin"}}},
+		{{Patterns: []string{"/a"}, Tokens: []string{""}}},
+		{{Patterns: []string{"/a"}, CIDRs: []string{"10.0.0.0/33"}}},
+	} {
+		if err := list.Load(rules); err == nil {
+			t.Errorf("Load(%+v) succeeded, want an error", rules)
+		}
+	}
+
+	r := router.New()
+	r.SetAccessPolicy(list)
+	r.Mount("/admin", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/admin", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("after failed loads: %d, want the first rules still denying", rec.Code)
+	}
+}
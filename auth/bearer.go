@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var ErrInvalidToken = errors.New("auth: token failed validation")
+
+type BearerConfig struct {
+	// JWKSURL serves the keys the tokens are signed with.
+	JWKSURL string
+	// Issuer and Audience, when set, must match the iss and aud claims.
+	Issuer   string
+	Audience string
+}
+
+// Bearer verifies the JWTs sent as "Authorization: Bearer <token>" and
+// attaches their claims to the request, where ClaimsFrom finds them, e.g.
+// for a router.RoleAuthorizer to grant permissions from. It never rejects
+// requests: one without a valid token carries no claims, so routes
+// requiring permissions deny it.
+func Bearer(config BearerConfig) func(http.Handler) http.Handler {
+	keys := &keySet{url: config.JWKSURL, client: &http.Client{Timeout: 10 * time.Second}}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if token, ok := bearerToken(r); ok {
+				claims, err := keys.verify(r.Context(), token)
+				if err == nil {
+					err = config.validate(claims)
+				}
+				if err == nil {
+					r = withClaims(r, claims)
+				}
+			}
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(h[7:]), true
+}
+
+func (c BearerConfig) validate(claims Claims) error {
+	if c.Issuer != "" && claims.String("iss") != c.Issuer {
+		return fmt.Errorf("%w: issuer %q", ErrInvalidToken, claims.String("iss"))
+	}
+	if c.Audience != "" && !contains(claims.Strings("aud"), c.Audience) {
+		return fmt.Errorf("%w: audience %v", ErrInvalidToken, claims.Strings("aud"))
+	}
+	now := time.Now()
+	if now.After(claims.time("exp")) {
+		return fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if _, ok := claims["nbf"]; ok && now.Before(claims.time("nbf")) {
+		return fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
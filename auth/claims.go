@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Claims are the claims of the caller's token: its bearer token or, when
+// signed in, its ID token.
+type Claims map[string]interface{}
+
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns a claim that may be a single string or a list of strings,
+// as "aud", "groups" and "roles" commonly are.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+func (c Claims) time(name string) time.Time {
+	f, _ := c[name].(float64)
+	return time.Unix(int64(f), 0)
+}
+
+type claimsKey struct{}
+
+// ClaimsFrom returns the claims of the caller, or nil when the request
+// carries no valid token or session.
+func ClaimsFrom(r *http.Request) Claims {
+	c, _ := r.Context().Value(claimsKey{}).(Claims)
+	return c
+}
+
+func withClaims(r *http.Request, c Claims) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), claimsKey{}, c))
+}
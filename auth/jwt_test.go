@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// issuerKeys are the signing keys of a fake issuer, served as a JWKS.
+type issuerKeys struct {
+	rsa     *rsa.PrivateKey
+	ec      *ecdsa.PrivateKey
+	fetches atomic.Int32
+}
+
+func newIssuerKeys(t *testing.T) (*issuerKeys, string) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &issuerKeys{rsa: rsaKey, ec: ecKey}
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	jwks := map[string][]jwk{"keys": {
+		{Kty: "RSA", Kid: "rsa", N: b64(rsaKey.N.Bytes()), E: b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{Kty: "EC", Kid: "ec", Crv: "P-256", X: b64(ecKey.X.FillBytes(make([]byte, 32))), Y: b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+	}}
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		k.fetches.Add(1)
+		json.NewEncoder(rw).Encode(jwks)
+	}))
+	t.Cleanup(srv.Close)
+	return k, srv.URL
+}
+
+// sign returns a compact JWS of claims with the given header, signed as alg
+// says: RS256 and ES256 with the issuer's keys, HS256 with the RSA public
+// key as the secret as in the classic key confusion attack, none unsigned.
+func (k *issuerKeys) sign(t *testing.T, alg, kid string, claims Claims) string {
+	t.Helper()
+	enc := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	input := enc(map[string]string{"alg": alg, "kid": kid}) + "." + enc(claims)
+	digest := sha256.Sum256([]byte(input))
+
+	var sig []byte
+	switch alg {
+	case "RS256":
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, k.ec, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case "HS256":
+		mac := hmac.New(sha256.New, x509.MarshalPKCS1PublicKey(&k.rsa.PublicKey))
+		mac.Write([]byte(input))
+		sig = mac.Sum(nil)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func validClaims() Claims {
+	return Claims{
+		"sub": "ada",
+		"iss": "https://issuer.example",
+		"aud": []any{"api", "other"},
+		"exp": float64(time.Now().Add(time.Hour).Unix()),
+	}
+}
+
+func with(c Claims, kv ...any) Claims {
+	for i := 0; i < len(kv); i += 2 {
+		if kv[i+1] == nil {
+			delete(c, kv[i].(string))
+			continue
+		}
+		c[kv[i].(string)] = kv[i+1]
+	}
+	return c
+}
+
+func TestVerify(t *testing.T) {
+	k, url := newIssuerKeys(t)
+	keys := &keySet{url: url, client: http.DefaultClient}
+
+	valid := k.sign(t, "RS256", "rsa", validClaims())
+	parts := strings.Split(valid, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`))
+
+	for _, tt := range []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"RS256", valid, nil},
+		{"ES256", k.sign(t, "ES256", "ec", validClaims()), nil},
+		{"alg none", k.sign(t, "none", "rsa", validClaims()), ErrBadSignature},
+		{"HS256 keyed with the public key", k.sign(t, "HS256", "rsa", validClaims()), ErrBadSignature},
+		{"ES256 header on the RSA key", k.sign(t, "ES256", "rsa", validClaims()), ErrBadSignature},
+		{"RS256 header on the EC key", k.sign(t, "RS256", "ec", validClaims()), ErrBadSignature},
+		{"payload swapped", parts[0] + "." + forged + "." + parts[2], ErrBadSignature},
+		{"signature stripped", parts[0] + "." + parts[1] + ".", ErrBadSignature},
+		{"unknown key", k.sign(t, "RS256", "gone", validClaims()), ErrUnknownKey},
+		{"two parts", parts[0] + "." + parts[1], ErrMalformedToken},
+		{"bad header", "x." + parts[1] + "." + parts[2], ErrMalformedToken},
+	} {
+		claims, err := keys.verify(context.Background(), tt.token)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+		if tt.want == nil && claims.Subject() != "ada" {
+			t.Errorf("%s: claims %v, want the token's", tt.name, claims)
+		}
+	}
+
+	// Unknown key ids refetch the keys at most once a minute, so forged
+	// tokens cannot hammer the issuer.
+	if n := k.fetches.Load(); n != 1 {
+		t.Errorf("keys fetched %d times, want once", n)
+	}
+}
+
+func TestBearer(t *testing.T) {
+	k, url := newIssuerKeys(t)
+	mw := Bearer(BearerConfig{JWKSURL: url, Issuer: "https://issuer.example", Audience: "api"})
+	hour := float64(time.Hour / time.Second)
+	now := float64(time.Now().Unix())
+
+	for _, tt := range []struct {
+		name   string
+		header string
+		ok     bool
+	}{
+		{"valid", "Bearer " + k.sign(t, "RS256", "rsa", validClaims()), true},
+		{"lower-case scheme", "bearer " + k.sign(t, "RS256", "rsa", validClaims()), true},
+		{"single audience", "Bearer " + k.sign(t, "RS256", "rsa", with(validClaims(), "aud", "api")), true},
+		{"expired", "Bearer " + k.sign(t, "RS256", "rsa", with(validClaims(), "exp", now-hour)), false},
+		{"no expiry", "Bearer " + k.sign(t, "RS256", "rsa", with(validClaims(), "exp", nil)), false},
+		{"not valid yet", "Bearer " + k.sign(t, "RS256", "rsa", with(validClaims(), "nbf", now+hour)), false},
+		{"other issuer", "Bearer " + k.sign(t, "RS256", "rsa", with(validClaims(), "iss", "https://evil.example")), false},
+		{"other audience", "Bearer " + k.sign(t, "RS256", "rsa", with(validClaims(), "aud", "web")), false},
+		{"alg none", "Bearer " + k.sign(t, "none", "rsa", validClaims()), false},
+		{"basic", "Basic YWRhOnNlY3JldA==", false},
+	} {
+		var claims Claims
+		h := mw(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			claims = ClaimsFrom(r)
+		}))
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", tt.header)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		if (claims != nil) != tt.ok {
+			t.Errorf("%s: claims %v, want accepted %v", tt.name, claims, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+const (
+	sessionCookie = "session"
+	flowCookie    = "oidc_flow"
+	flowTTL       = 10 * time.Minute
+)
+
+var (
+	ErrNoSessionSecret = errors.New("auth: a session secret of at least 32 bytes is required")
+	ErrStateMismatch   = errors.New("auth: login state does not match")
+)
+
+type Config struct {
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string // absolute URL of the Callback handler
+	Scopes        []string
+	LoginPath     string // path of the Login handler, defaults to /auth/login
+	PostLogoutURL string // where Logout sends the user, defaults to /
+	SessionSecret []byte
+	SessionTTL    time.Duration
+}
+
+// Provider implements the OpenID Connect authorization-code flow (with PKCE)
+// against a single issuer and keeps the signed-in user's ID token claims in
+// a signed session cookie.
+type Provider struct {
+	config  Config
+	client  *http.Client
+	meta    metadata
+	keys    *keySet
+	cookies *cookieCodec
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+type flow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	ReturnTo string `json:"return_to"`
+}
+
+// New discovers the issuer's endpoints and signing keys.
+func New(ctx context.Context, config Config) (*Provider, error) {
+	if len(config.SessionSecret) < 32 {
+		return nil, ErrNoSessionSecret
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	}
+	if config.LoginPath == "" {
+		config.LoginPath = "/auth/login"
+	}
+	if config.PostLogoutURL == "" {
+		config.PostLogoutURL = "/"
+	}
+	if config.SessionTTL <= 0 {
+		config.SessionTTL = 8 * time.Hour
+	}
+
+	p := &Provider{
+		config:  config,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		cookies: &cookieCodec{secret: config.SessionSecret, secure: strings.HasPrefix(config.RedirectURL, "https://")},
+	}
+
+	discovery := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(ctx, p.client, discovery, &p.meta); err != nil {
+		return nil, err
+	}
+	if p.meta.Issuer != config.Issuer {
+		return nil, fmt.Errorf("auth: discovery returned issuer %q, want %q", p.meta.Issuer, config.Issuer)
+	}
+
+	p.keys = &keySet{url: p.meta.JWKSURI, client: p.client}
+	if err := p.keys.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Login redirects to the issuer. The return_to query parameter, a local
+// path, is where the user lands after a successful callback.
+func (p *Provider) Login(rw http.ResponseWriter, r *http.Request) {
+	f := flow{
+		State:    randomString(),
+		Nonce:    randomString(),
+		Verifier: randomString(),
+		ReturnTo: localPath(r.URL.Query().Get("return_to")),
+	}
+	if err := p.cookies.set(rw, flowCookie, f, flowTTL); err != nil {
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(f.Verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {f.State},
+		"nonce":                 {f.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	http.Redirect(rw, r, p.meta.AuthorizationEndpoint+"?"+q.Encode(), http.StatusFound)
+}
+
+// Callback completes the flow: it exchanges the code, validates the ID token
+// and starts the session.
+func (p *Provider) Callback(rw http.ResponseWriter, r *http.Request) {
+	var f flow
+	if err := p.cookies.get(r, flowCookie, &f); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.cookies.clear(rw, flowCookie)
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		http.Error(rw, "login failed: "+e, http.StatusUnauthorized)
+		return
+	}
+	if q.Get("state") != f.State {
+		http.Error(rw, ErrStateMismatch.Error(), http.StatusBadRequest)
+		return
+	}
+
+	claims, err := p.exchange(r.Context(), q.Get("code"), f)
+	if err != nil {
+		router.Logger(r).Warn("auth: callback", "err", err)
+		http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	if err := p.cookies.set(rw, sessionCookie, claims, p.config.SessionTTL); err != nil {
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(rw, r, f.ReturnTo, http.StatusFound)
+}
+
+// Logout ends the local session and, when the issuer supports RP-initiated
+// logout, the session at the issuer too.
+func (p *Provider) Logout(rw http.ResponseWriter, r *http.Request) {
+	p.cookies.clear(rw, sessionCookie)
+
+	target := p.config.PostLogoutURL
+	if p.meta.EndSessionEndpoint != "" {
+		q := url.Values{"client_id": {p.config.ClientID}}
+		if strings.Contains(target, "://") {
+			q.Set("post_logout_redirect_uri", target)
+		}
+		target = p.meta.EndSessionEndpoint + "?" + q.Encode()
+	}
+	http.Redirect(rw, r, target, http.StatusFound)
+}
+
+// Authenticate attaches the session's claims to the request when there is a
+// valid session. It never rejects requests; see RequireLogin.
+func (p *Provider) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var claims Claims
+		if err := p.cookies.get(r, sessionCookie, &claims); err == nil {
+			r = withClaims(r, claims)
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// RequireLogin sends browsers without a session to the login page and
+// answers other clients with 401 Unauthorized.
+func (p *Provider) RequireLogin(next http.Handler) http.Handler {
+	return p.Authenticate(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if ClaimsFrom(r) != nil {
+			next.ServeHTTP(rw, r)
+			return
+		}
+		if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			q := url.Values{"return_to": {r.URL.RequestURI()}}
+			http.Redirect(rw, r, p.config.LoginPath+"?"+q.Encode(), http.StatusFound)
+			return
+		}
+		http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	}))
+}
+
+func (p *Provider) exchange(ctx context.Context, code string, f flow) (Claims, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {f.Verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("auth: token endpoint: %s", res.Status)
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+
+	claims, err := p.keys.verify(ctx, token.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.validate(claims, f.Nonce); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (p *Provider) validate(c Claims, nonce string) error {
+	if c.String("iss") != p.meta.Issuer {
+		return fmt.Errorf("%w: issuer %q", ErrInvalidToken, c.String("iss"))
+	}
+	if !contains(c.Strings("aud"), p.config.ClientID) {
+		return fmt.Errorf("%w: audience %v", ErrInvalidToken, c.Strings("aud"))
+	}
+	if time.Now().After(c.time("exp")) {
+		return fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if c.String("nonce") != nonce {
+		return fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	return nil
+}
+
+// localPath guards against open redirects through return_to.
+func localPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return "/"
+	}
+	return p
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeIssuer is an OpenID provider whose token endpoint answers with the ID
+// token idToken makes for the nonce of the login.
+type fakeIssuer struct {
+	*httptest.Server
+	keys    *issuerKeys
+	idToken func(nonce string) Claims
+	nonce   string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	keys, jwksURL := newIssuerKeys(t)
+	f := &fakeIssuer{keys: keys}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(rw http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(rw).Encode(metadata{
+			Issuer:                f.URL,
+			AuthorizationEndpoint: f.URL + "/authorize",
+			TokenEndpoint:         f.URL + "/token",
+			JWKSURI:               jwksURL,
+		})
+	})
+	mux.HandleFunc("/token", func(rw http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" || r.FormValue("code_verifier") == "" {
+			http.Error(rw, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(rw).Encode(map[string]string{"id_token": keys.sign(t, "RS256", "rsa", f.idToken(f.nonce))})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	f.idToken = func(nonce string) Claims {
+		return Claims{"sub": "ada", "iss": f.URL, "aud": "client", "nonce": nonce, "exp": float64(time.Now().Add(time.Hour).Unix())}
+	}
+	return f
+}
+
+func newProvider(t *testing.T, issuer *fakeIssuer) *Provider {
+	t.Helper()
+	p, err := New(context.Background(), Config{
+		Issuer:        issuer.URL,
+		ClientID:      "client",
+		RedirectURL:   "https://app.example/auth/callback",
+		SessionSecret: []byte(strings.Repeat("s", 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// login starts a flow, returning the flow cookie and the state sent to
+// the issuer, whose nonce the issuer then signs into its ID token.
+func login(t *testing.T, p *Provider, issuer *fakeIssuer, returnTo string) (*http.Cookie, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	p.Login(rec, httptest.NewRequest("GET", "/auth/login?return_to="+url.QueryEscape(returnTo), nil))
+	loc, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(loc.String(), issuer.URL+"/authorize") {
+		t.Fatalf("login redirected to %q", rec.Header().Get("Location"))
+	}
+	q := loc.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Errorf("login without PKCE: %v", q)
+	}
+	issuer.nonce = q.Get("nonce")
+	return rec.Result().Cookies()[0], q.Get("state")
+}
+
+func callback(p *Provider, flow *http.Cookie, query string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", "/auth/callback?"+query, nil)
+	if flow != nil {
+		r.AddCookie(flow)
+	}
+	rec := httptest.NewRecorder()
+	p.Callback(rec, r)
+	return rec
+}
+
+func session(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sessionCookie && c.MaxAge > 0 {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestCallback(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	p := newProvider(t, issuer)
+	valid := issuer.idToken
+
+	for _, tt := range []struct {
+		name     string
+		returnTo string
+		query    func(state string) string
+		idToken  func(nonce string) Claims
+		status   int
+		location string
+	}{
+		{name: "valid", returnTo: "/reports?y=1", status: http.StatusFound, location: "/reports?y=1"},
+		{name: "open redirect", returnTo: "//evil.example/", status: http.StatusFound, location: "/"},
+		{name: "backslash redirect", returnTo: "/\\evil.example", status: http.StatusFound, location: "/"},
+		{name: "state mismatch", query: func(string) string { return "code=good-code&state=forged" }, status: http.StatusBadRequest},
+		{name: "issuer error", query: func(state string) string { return "error=access_denied&state=" + state }, status: http.StatusUnauthorized},
+		{name: "bad code", query: func(state string) string { return "code=bad&state=" + state }, status: http.StatusUnauthorized},
+		{name: "nonce replayed", idToken: func(string) Claims { return valid("an-older-nonce") }, status: http.StatusUnauthorized},
+		{name: "other audience", idToken: func(n string) Claims { return with(valid(n), "aud", "another-client") }, status: http.StatusUnauthorized},
+		{name: "other issuer", idToken: func(n string) Claims { return with(valid(n), "iss", "https://evil.example") }, status: http.StatusUnauthorized},
+		{name: "expired", idToken: func(n string) Claims { return with(valid(n), "exp", float64(time.Now().Add(-time.Minute).Unix())) }, status: http.StatusUnauthorized},
+	} {
+		issuer.idToken = valid
+		if tt.idToken != nil {
+			issuer.idToken = tt.idToken
+		}
+		flow, state := login(t, p, issuer, tt.returnTo)
+		query := "code=good-code&state=" + state
+		if tt.query != nil {
+			query = tt.query(state)
+		}
+		rec := callback(p, flow, query)
+		if rec.Code != tt.status || tt.location != "" && rec.Header().Get("Location") != tt.location {
+			t.Errorf("%s: %d to %q, want %d to %q", tt.name, rec.Code, rec.Header().Get("Location"), tt.status, tt.location)
+		}
+		if (session(rec) != nil) != (tt.status == http.StatusFound) {
+			t.Errorf("%s: session cookie %v", tt.name, session(rec))
+		}
+	}
+
+	// A callback without the flow cookie of a login cannot be forged.
+	_, state := login(t, p, issuer, "/")
+	if rec := callback(p, nil, "code=good-code&state="+state); rec.Code != http.StatusBadRequest || session(rec) != nil {
+		t.Errorf("callback without a flow cookie: %d, want 400 and no session", rec.Code)
+	}
+}
+
+func TestSessionCookie(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	p := newProvider(t, issuer)
+	flow, state := login(t, p, issuer, "/")
+	cookie := session(callback(p, flow, "code=good-code&state="+state))
+	if cookie == nil {
+		t.Fatal("no session started")
+	}
+
+	encoded, sig, _ := strings.Cut(cookie.Value, ".")
+	payload, _ := base64.RawURLEncoding.DecodeString(encoded)
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(payload), `"ada"`, `"eve"`, 1)))
+	other := &cookieCodec{secret: []byte(strings.Repeat("x", 32))}
+	expired := httptest.NewRecorder()
+	p.cookies.set(expired, sessionCookie, Claims{"sub": "ada"}, -time.Minute)
+	fromOther := httptest.NewRecorder()
+	other.set(fromOther, sessionCookie, Claims{"sub": "ada"}, time.Hour)
+
+	for _, tt := range []struct {
+		name   string
+		cookie *http.Cookie
+		sub    string
+	}{
+		{"valid", cookie, "ada"},
+		{"tampered", &http.Cookie{Name: sessionCookie, Value: tampered + "." + sig}, ""},
+		{"unsigned", &http.Cookie{Name: sessionCookie, Value: encoded}, ""},
+		{"other secret", fromOther.Result().Cookies()[0], ""},
+		{"expired", &http.Cookie{Name: sessionCookie, Value: expired.Result().Cookies()[0].Value}, ""},
+		// The flow cookie is signed for its own name.
+		{"flow cookie renamed", &http.Cookie{Name: sessionCookie, Value: flow.Value}, ""},
+	} {
+		var sub string
+		h := p.Authenticate(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			sub = ClaimsFrom(r).Subject()
+		}))
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(tt.cookie)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		if sub != tt.sub {
+			t.Errorf("%s: subject %q, want %q", tt.name, sub, tt.sub)
+		}
+	}
+}
+
+func TestRequireLogin(t *testing.T) {
+	p := newProvider(t, newFakeIssuer(t))
+	h := p.RequireLogin(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+
+	browser := httptest.NewRequest("GET", "/reports?y=1", nil)
+	browser.Header.Set("Accept", "text/html")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, browser)
+	if want := "/auth/login?return_to=%2Freports%3Fy%3D1"; rec.Code != http.StatusFound || rec.Header().Get("Location") != want {
+		t.Errorf("browser: %d to %q, want 302 to %q", rec.Code, rec.Header().Get("Location"), want)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/reports", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("API client: %d, want 401", rec.Code)
+	}
+}
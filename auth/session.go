@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCookie = errors.New("auth: invalid or expired cookie")
+
+// cookieCodec stores values in HMAC-signed cookies so the server keeps no
+// session state.
+type cookieCodec struct {
+	secret []byte
+	secure bool
+}
+
+type envelope struct {
+	Value   json.RawMessage `json:"v"`
+	Expires int64           `json:"exp"`
+}
+
+func (c *cookieCodec) set(rw http.ResponseWriter, name string, value interface{}, ttl time.Duration) error {
+	v, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(envelope{v, time.Now().Add(ttl).Unix()})
+	if err != nil {
+		return err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	http.SetCookie(rw, &http.Cookie{
+		Name:     name,
+		Value:    encoded + "." + c.sign(name, encoded),
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   c.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func (c *cookieCodec) get(r *http.Request, name string, value interface{}) error {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ErrInvalidCookie
+	}
+
+	i := strings.LastIndexByte(cookie.Value, '.')
+	if i < 0 {
+		return ErrInvalidCookie
+	}
+	encoded, sig := cookie.Value[:i], cookie.Value[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(c.sign(name, encoded))) {
+		return ErrInvalidCookie
+	}
+
+	var env envelope
+	if err := decodeSegment(encoded, &env); err != nil {
+		return ErrInvalidCookie
+	}
+	if time.Now().Unix() > env.Expires {
+		return ErrInvalidCookie
+	}
+	return json.Unmarshal(env.Value, value)
+}
+
+func (c *cookieCodec) clear(rw http.ResponseWriter, name string) {
+	http.SetCookie(rw, &http.Cookie{
+		Name:     name,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   c.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// sign binds the signature to the cookie name so one cookie cannot be
+// replayed as another.
+func (c *cookieCodec) sign(name, value string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(name + "=" + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,54 @@
+package bind
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/ritego/build-a-router-with-go/codec"
+)
+
+// MaxBodySize caps the request body Body will read.
+var MaxBodySize int64 = 10 << 20
+
+var (
+	ErrUnsupportedMediaType = errors.New("bind: unsupported content type")
+	ErrBodyTooLarge         = errors.New("bind: request body too large")
+	ErrEmptyBody            = errors.New("bind: request body is empty")
+)
+
+// Body decodes the request body into v with the codec registered for the
+// request's Content-Type. A missing Content-Type is treated as JSON.
+func Body(r *http.Request, v interface{}) error {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	c, ok := codec.ForContentType(contentType)
+	if !ok {
+		return ErrUnsupportedMediaType
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, MaxBodySize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > MaxBodySize {
+		return ErrBodyTooLarge
+	}
+	if len(data) == 0 {
+		return ErrEmptyBody
+	}
+	return c.Unmarshal(data, v)
+}
+
+// Status maps bind errors to the response status a handler should send.
+func Status(err error) int {
+	switch {
+	case errors.Is(err, ErrUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,240 @@
+package bind
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// FieldError reports a request value that could not be converted to the
+// type of the struct field it binds to.
+type FieldError struct {
+	Field string
+	// Source is the tag the value came from: query, form, path or header.
+	Source string
+	Name   string
+	Value  string
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("bind: %s %q: cannot use %q as %s: %v", e.Source, e.Name, e.Value, e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// sources are the struct tags Values reads, in order: a field tagged with
+// several takes the last one present in the request.
+var sources = []string{"query", "form", "path", "header"}
+
+// Values fills the fields of the struct v points to from the request,
+// following their tags:
+//
+//	type ListParams struct {
+//		Page   int       `query:"page" default:"1"`
+//		Tags   []string  `query:"tag"`
+//		Since  time.Time `query:"since"`
+//		ID     string    `path:"id"`
+//		Token  string    `header:"X-Token"`
+//		Title  string    `form:"title"`
+//	}
+//
+// Fields take their default when the request lacks the value. Strings,
+// booleans, numbers, time.Duration, time.Time (RFC 3339), pointers, slices of
+// repeated values and encoding.TextUnmarshaler are converted; a value of the
+// wrong type fails with a *FieldError, which error pages answer with 400.
+// Form values are read from the body only for form content types.
+func Values(r *http.Request, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("bind: Values needs a pointer to a struct")
+	}
+	if hasTag(rv.Elem().Type(), "form") {
+		if err := r.ParseMultipartForm(MaxBodySize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+			return err
+		}
+	}
+	return bindStruct(r, rv.Elem())
+}
+
+func hasTag(t reflect.Type, tag string) bool {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if _, ok := f.Tag.Lookup(tag); ok {
+			return true
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && hasTag(f.Type, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func bindStruct(r *http.Request, rv reflect.Value) error {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if err := bindStruct(r, rv.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var values []string
+		source, name := "", ""
+		for _, s := range sources {
+			tag, ok := f.Tag.Lookup(s)
+			if !ok {
+				continue
+			}
+			if found := lookup(r, s, tag); len(found) > 0 {
+				values, source, name = found, s, tag
+			} else if source == "" {
+				source, name = s, tag
+			}
+		}
+		if source == "" {
+			continue
+		}
+		if len(values) == 0 {
+			def, ok := f.Tag.Lookup("default")
+			if !ok {
+				continue
+			}
+			values = strings.Split(def, ",")
+		}
+
+		if err := setField(rv.Field(i), values); err != nil {
+			return &FieldError{Field: f.Name, Source: source, Name: name, Value: strings.Join(values, ","), Err: err}
+		}
+	}
+	return nil
+}
+
+func lookup(r *http.Request, source, name string) []string {
+	switch source {
+	case "query":
+		return r.URL.Query()[name]
+	case "form":
+		if r.PostForm != nil {
+			if v := r.PostForm[name]; len(v) > 0 {
+				return v
+			}
+		}
+		if r.MultipartForm != nil {
+			return r.MultipartForm.Value[name]
+		}
+	case "path":
+		if v := router.Param(r, name); v != "" {
+			return []string{v}
+		}
+	case "header":
+		return r.Header.Values(name)
+	}
+	return nil
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func setField(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() != reflect.Uint8 && !field.Addr().Type().Implements(textUnmarshalerType) {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, s := range values {
+			if err := setValue(slice.Index(i), s); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+	return setValue(field, values[0])
+}
+
+func setValue(field reflect.Value, s string) error {
+	if field.Kind() == reflect.Pointer {
+		ptr := reflect.New(field.Type().Elem())
+		if err := setValue(ptr.Elem(), s); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	switch field.Type() {
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	case timeType:
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, field.Type().Bits())
+		if err != nil {
+			return unwrapNum(err)
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, field.Type().Bits())
+		if err != nil {
+			return unwrapNum(err)
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, field.Type().Bits())
+		if err != nil {
+			return unwrapNum(err)
+		}
+		field.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// unwrapNum drops strconv's repetition of the input from its errors.
+func unwrapNum(err error) error {
+	var nerr *strconv.NumError
+	if errors.As(err, &nerr) {
+		return nerr.Err
+	}
+	return err
+}
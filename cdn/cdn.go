@@ -0,0 +1,145 @@
+// Package cdn invalidates cached responses at a CDN, by surrogate key or by
+// URL, for the keys routes tag their responses with (router.CachePolicy).
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Purger invalidates cached responses.
+type Purger interface {
+	PurgeKeys(ctx context.Context, keys []string) error
+	PurgeURLs(ctx context.Context, urls []string) error
+}
+
+// Fastly purges through the Fastly API, keys matching the Surrogate-Key
+// header.
+type Fastly struct {
+	ServiceID string
+	Token     string
+	// Soft marks content stale instead of evicting it, so it can still be
+	// served while the origin is down.
+	Soft   bool
+	Client *http.Client
+}
+
+func (f *Fastly) PurgeKeys(ctx context.Context, keys []string) error {
+	header := http.Header{"Surrogate-Key": {strings.Join(keys, " ")}}
+	return f.post(ctx, "https://api.fastly.com/service/"+url.PathEscape(f.ServiceID)+"/purge", header)
+}
+
+func (f *Fastly) PurgeURLs(ctx context.Context, urls []string) error {
+	for _, u := range urls {
+		target := strings.TrimPrefix(strings.TrimPrefix(u, "https://"), "http://")
+		if err := f.post(ctx, "https://api.fastly.com/purge/"+target, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *Fastly) post(ctx context.Context, u string, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Fastly-Key", f.Token)
+	if f.Soft {
+		req.Header.Set("Fastly-Soft-Purge", "1")
+	}
+	return do(f.Client, req, "fastly")
+}
+
+// Cloudflare purges through the Cloudflare API, keys matching the
+// Cache-Tag header.
+type Cloudflare struct {
+	ZoneID string
+	// Token is an API token with the Cache Purge permission.
+	Token  string
+	Client *http.Client
+}
+
+func (c *Cloudflare) PurgeKeys(ctx context.Context, keys []string) error {
+	return c.purge(ctx, map[string][]string{"tags": keys})
+}
+
+func (c *Cloudflare) PurgeURLs(ctx context.Context, urls []string) error {
+	return c.purge(ctx, map[string][]string{"files": urls})
+}
+
+func (c *Cloudflare) purge(ctx context.Context, body map[string][]string) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	u := "https://api.cloudflare.com/client/v4/zones/" + url.PathEscape(c.ZoneID) + "/purge_cache"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+	return do(c.Client, req, "cloudflare")
+}
+
+func do(c *http.Client, req *http.Request, provider string) error {
+	if c == nil {
+		c = http.DefaultClient
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("cdn: %s: %w", provider, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("cdn: %s purge failed: %s: %s", provider, res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// PurgeRequest is the body accepted by Handler.
+type PurgeRequest struct {
+	Keys []string `json:"keys"`
+	URLs []string `json:"urls"`
+}
+
+// Handler purges the keys and URLs of a JSON PurgeRequest, answering 204 once
+// the CDN has accepted the invalidation and 502 when it has not. It is meant
+// for an admin route.
+func Handler(p Purger) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var body PurgeRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&body); err != nil {
+			http.Error(rw, "invalid purge request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(body.Keys) == 0 && len(body.URLs) == 0 {
+			http.Error(rw, "nothing to purge, want keys or urls", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		if len(body.Keys) > 0 {
+			err = p.PurgeKeys(r.Context(), body.Keys)
+		}
+		if err == nil && len(body.URLs) > 0 {
+			err = p.PurgeURLs(r.Context(), body.URLs)
+		}
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadGateway)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,110 @@
+package codec
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Codec converts values to and from one wire format.
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	mu       sync.RWMutex
+	codecs   = make(map[string]Codec)
+	fallback = Codec(JSON{})
+)
+
+func init() {
+	Register(JSON{}, "text/json")
+	Register(XML{}, "text/xml")
+	Register(Protobuf{}, "application/x-protobuf", "application/vnd.google.protobuf")
+	Register(MsgPack{}, "application/x-msgpack", "application/vnd.msgpack")
+}
+
+// Register makes c available for its content type and any aliases,
+// replacing a codec already registered for them.
+func Register(c Codec, aliases ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	codecs[c.ContentType()] = c
+	for _, a := range aliases {
+		codecs[a] = c
+	}
+}
+
+// ForContentType returns the codec for a Content-Type header value.
+func ForContentType(contentType string) (Codec, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	c, ok := codecs[mediaType]
+	if !ok && strings.HasSuffix(mediaType, "+json") {
+		c, ok = codecs["application/json"]
+	}
+	return c, ok
+}
+
+// Negotiate picks the codec best matching an Accept header, honouring
+// quality values. JSON is used when the header is empty or accepts anything.
+func Negotiate(accept string) (Codec, bool) {
+	if accept == "" {
+		return fallback, true
+	}
+
+	type candidate struct {
+		mediaType string
+		q         float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, _ = strconv.ParseFloat(v, 64)
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{mediaType, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	for _, c := range candidates {
+		if c.mediaType == "*/*" || c.mediaType == "application/*" {
+			return fallback, true
+		}
+		if codec, ok := ForContentType(c.mediaType); ok {
+			return codec, true
+		}
+	}
+	return nil, false
+}
+
+type JSON struct{}
+
+func (JSON) ContentType() string                        { return "application/json" }
+func (JSON) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (JSON) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type XML struct{}
+
+func (XML) ContentType() string                        { return "application/xml" }
+func (XML) Marshal(v interface{}) ([]byte, error)      { return xml.Marshal(v) }
+func (XML) Unmarshal(data []byte, v interface{}) error { return xml.Unmarshal(data, v) }
@@ -0,0 +1,29 @@
+package codec
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MsgPack encodes values as MessagePack. Struct fields use their json tags,
+// so the same types serve both formats.
+type MsgPack struct{}
+
+func (MsgPack) ContentType() string { return "application/msgpack" }
+
+func (MsgPack) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (MsgPack) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
@@ -0,0 +1,30 @@
+package codec
+
+import (
+	"errors"
+
+	"google.golang.org/protobuf/proto"
+)
+
+var ErrNotProtoMessage = errors.New("codec: value is not a proto.Message")
+
+// Protobuf encodes generated protobuf messages in the binary wire format.
+type Protobuf struct{}
+
+func (Protobuf) ContentType() string { return "application/protobuf" }
+
+func (Protobuf) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrNotProtoMessage
+	}
+	return proto.Marshal(m)
+}
+
+func (Protobuf) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return ErrNotProtoMessage
+	}
+	return proto.Unmarshal(data, m)
+}
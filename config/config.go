@@ -0,0 +1,281 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// Config is the typed view of the settings the server needs at startup.
+// Keys keep the flat upper-case names used in config.yaml and the
+// environment.
+type Config struct {
+	Version     string `mapstructure:"VERSION"`
+	Environment string `mapstructure:"ENVIRONMENT"`
+	Server      Server `mapstructure:",squash"`
+	Log         Log    `mapstructure:",squash"`
+
+	// Defaulted lists the keys that were not configured anywhere and fell
+	// back to their default, worth a warning for settings such as timeouts.
+	Defaulted []string `mapstructure:"-"`
+
+	settings map[string]interface{}
+}
+
+// Unlimited is the value that turns a timeout off, e.g.
+// SERVER_WRITE_TIMEOUT: unlimited for a server streaming long responses.
+// 0 is rejected so that a timeout cannot be disabled by accident; once
+// loaded, an unlimited timeout reads as a negative duration, which
+// net/http and server.Server take as none. 0 would not do: net/http falls
+// back to ReadTimeout for a zero IdleTimeout or ReadHeaderTimeout.
+const Unlimited = "unlimited"
+
+// unlimited stands for Unlimited while the configuration is validated.
+const unlimited time.Duration = math.MinInt64
+
+type Server struct {
+	Port                string        `mapstructure:"SERVER_PORT"`
+	ReadTimeout         time.Duration `mapstructure:"SERVER_READ_TIMEOUT"`
+	WriteTimeout        time.Duration `mapstructure:"SERVER_WRITE_TIMEOUT"`
+	ReadHeaderTimeout   time.Duration `mapstructure:"SERVER_READ_HEADER_TIMEOUT"`
+	IdleTimeout         time.Duration `mapstructure:"SERVER_IDLE_TIMEOUT"`
+	ShutdownTimeout     time.Duration `mapstructure:"SERVER_SHUTDOWN_TIMEOUT"`
+	StopTimeout         time.Duration `mapstructure:"SERVER_STOP_TIMEOUT"`
+	MaxHeaderBytes      int           `mapstructure:"SERVER_MAX_HEADER_BYTES"`
+	MaxConnections      int           `mapstructure:"SERVER_MAX_CONNECTIONS"`
+	MaxConnectionsPerIP int           `mapstructure:"SERVER_MAX_CONNECTIONS_PER_IP"`
+	MinReadRate         int           `mapstructure:"SERVER_MIN_READ_RATE"`
+	MinWriteRate        int           `mapstructure:"SERVER_MIN_WRITE_RATE"`
+	SlowClientGrace     time.Duration `mapstructure:"SERVER_SLOW_CLIENT_GRACE"`
+	H2C                 bool          `mapstructure:"SERVER_H2C"`
+}
+
+type Log struct {
+	Level  string `mapstructure:"LOG_LEVEL"`
+	Format string `mapstructure:"LOG_FORMAT"`
+}
+
+// SlogLevel returns Level as a slog.Level. Load has already validated it.
+func (l Log) SlogLevel() slog.Level {
+	var level slog.Level
+	level.UnmarshalText([]byte(l.Level))
+	return level
+}
+
+// NewHandler returns a text or JSON handler, according to Format, writing
+// to w at level.
+func (l Log) NewHandler(w io.Writer, level slog.Leveler) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+	if strings.EqualFold(l.Format, "json") {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+var defaults = map[string]interface{}{
+	"ENVIRONMENT":                   "production",
+	"SERVER_READ_TIMEOUT":           15 * time.Second,
+	"SERVER_WRITE_TIMEOUT":          15 * time.Second,
+	"SERVER_READ_HEADER_TIMEOUT":    5 * time.Second,
+	"SERVER_IDLE_TIMEOUT":           60 * time.Second,
+	"SERVER_SHUTDOWN_TIMEOUT":       15 * time.Second,
+	"SERVER_STOP_TIMEOUT":           10 * time.Second,
+	"SERVER_MAX_HEADER_BYTES":       64 << 10,
+	"SERVER_MAX_CONNECTIONS":        1024,
+	"SERVER_MAX_CONNECTIONS_PER_IP": 0,
+	"SERVER_MIN_READ_RATE":          512,
+	"SERVER_MIN_WRITE_RATE":         512,
+	"SERVER_SLOW_CLIENT_GRACE":      10 * time.Second,
+	"SERVER_H2C":                    false,
+	"LOG_LEVEL":                     "info",
+	"LOG_FORMAT":                    "text",
+	"ACCESS_LOG_SAMPLE":             1.0,
+	"ACCESS_LOG_ERROR_SAMPLE":       1.0,
+	"RECORD_REDACT_HEADERS":         []string{"Authorization", "Cookie", "Proxy-Authorization", "X-Api-Key"},
+}
+
+// warnDefaulted keys are logged when they fall back to their default: a
+// deployment missing them may not run with the limits it was tested with.
+var warnDefaulted = []string{
+	"SERVER_READ_TIMEOUT",
+	"SERVER_WRITE_TIMEOUT",
+	"SERVER_READ_HEADER_TIMEOUT",
+	"SERVER_IDLE_TIMEOUT",
+	"SERVER_SHUTDOWN_TIMEOUT",
+}
+
+// required keys have no sensible default and must be configured.
+var required = []string{"SERVER_PORT"}
+
+// SetDefaults registers the default of every optional key on v.
+func SetDefaults(v *viper.Viper) {
+	for k, d := range defaults {
+		v.SetDefault(k, d)
+	}
+}
+
+// Load decodes and validates the configuration held by v.
+func Load(v *viper.Viper) (*Config, error) {
+	errs := &ValidationError{}
+	for _, k := range required {
+		if !v.IsSet(k) || v.GetString(k) == "" {
+			errs.add(k, "is required")
+		}
+	}
+
+	var c Config
+	if err := v.Unmarshal(&c, decodeUnlimited); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	c.validate(errs)
+	c.settings = v.AllSettings()
+	for _, k := range warnDefaulted {
+		if !configured(v, k) {
+			c.Defaulted = append(c.Defaulted, k)
+		}
+	}
+	for _, d := range []*time.Duration{
+		&c.Server.ReadTimeout, &c.Server.WriteTimeout, &c.Server.ReadHeaderTimeout,
+		&c.Server.IdleTimeout, &c.Server.ShutdownTimeout, &c.Server.StopTimeout,
+	} {
+		if *d == unlimited {
+			*d = -1
+		}
+	}
+
+	if len(errs.Keys) > 0 {
+		return nil, errs
+	}
+	return &c, nil
+}
+
+// configured reports whether key was set other than by its default: in a
+// config file, by a <KEY>_FILE secret or in the environment, under
+// whichever name v reads it from. v is asked with the default lifted.
+func configured(v *viper.Viper, key string) bool {
+	v.SetDefault(key, nil)
+	set := v.Get(key) != nil
+	if d, ok := defaults[key]; ok {
+		v.SetDefault(key, d)
+	}
+	return set
+}
+
+// decodeUnlimited decodes Unlimited durations as unlimited, ahead of
+// viper's own hooks.
+func decodeUnlimited(dc *mapstructure.DecoderConfig) {
+	durationType := reflect.TypeOf(time.Duration(0))
+	dc.DecodeHook = mapstructure.ComposeDecodeHookFunc(
+		func(from, to reflect.Type, data interface{}) (interface{}, error) {
+			if s, ok := data.(string); ok && to == durationType && strings.EqualFold(strings.TrimSpace(s), Unlimited) {
+				return unlimited, nil
+			}
+			return data, nil
+		},
+		dc.DecodeHook,
+	)
+}
+
+func (c *Config) validate(errs *ValidationError) {
+	s := c.Server
+	if s.Port != "" {
+		checkAddr(errs, "SERVER_PORT", s.Port)
+	}
+
+	checkTimeout(errs, "SERVER_READ_TIMEOUT", s.ReadTimeout, time.Hour)
+	checkTimeout(errs, "SERVER_WRITE_TIMEOUT", s.WriteTimeout, time.Hour)
+	checkTimeout(errs, "SERVER_READ_HEADER_TIMEOUT", s.ReadHeaderTimeout, 5*time.Minute)
+	checkTimeout(errs, "SERVER_IDLE_TIMEOUT", s.IdleTimeout, time.Hour)
+	checkTimeout(errs, "SERVER_SHUTDOWN_TIMEOUT", s.ShutdownTimeout, 10*time.Minute)
+	checkTimeout(errs, "SERVER_STOP_TIMEOUT", s.StopTimeout, 10*time.Minute)
+
+	checkInt(errs, "SERVER_MAX_HEADER_BYTES", s.MaxHeaderBytes, 1<<10, 16<<20)
+	checkInt(errs, "SERVER_MAX_CONNECTIONS", s.MaxConnections, 1, 1<<20)
+	checkInt(errs, "SERVER_MAX_CONNECTIONS_PER_IP", s.MaxConnectionsPerIP, 0, 1<<20)
+	checkInt(errs, "SERVER_MIN_READ_RATE", s.MinReadRate, 0, 1<<30)
+	checkInt(errs, "SERVER_MIN_WRITE_RATE", s.MinWriteRate, 0, 1<<30)
+	checkDuration(errs, "SERVER_SLOW_CLIENT_GRACE", s.SlowClientGrace, time.Second, 10*time.Minute)
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs.add("LOG_LEVEL", fmt.Sprintf("%q must be one of debug, info, warn or error", c.Log.Level))
+	}
+	if f := strings.ToLower(c.Log.Format); f != "text" && f != "json" {
+		errs.add("LOG_FORMAT", fmt.Sprintf("%q must be text or json", c.Log.Format))
+	}
+}
+
+func checkAddr(errs *ValidationError, key, addr string) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		errs.add(key, fmt.Sprintf("%q must be in host:port form, e.g. \":7777\"", addr))
+		return
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		errs.add(key, fmt.Sprintf("%q has an invalid port", addr))
+	}
+}
+
+func checkDuration(errs *ValidationError, key string, d, min, max time.Duration) {
+	if d < min || d > max {
+		errs.add(key, fmt.Sprintf("must be between %s and %s, got %s", min, max, d))
+	}
+}
+
+// checkTimeout is checkDuration from 1ms to max, also accepting Unlimited.
+func checkTimeout(errs *ValidationError, key string, d, max time.Duration) {
+	if d == unlimited {
+		return
+	}
+	if d == 0 {
+		errs.add(key, fmt.Sprintf("must be between %s and %s, or %q for no timeout, got 0", time.Millisecond, max, Unlimited))
+		return
+	}
+	checkDuration(errs, key, d, time.Millisecond, max)
+}
+
+func checkInt(errs *ValidationError, key string, n, min, max int) {
+	if n < min || n > max {
+		errs.add(key, fmt.Sprintf("must be between %d and %d, got %d", min, max, n))
+	}
+}
+
+// ValidationError lists every invalid key, so a broken deployment can be
+// fixed in one go.
+type ValidationError struct {
+	Keys map[string]string
+}
+
+func (e *ValidationError) add(key, problem string) {
+	if e.Keys == nil {
+		e.Keys = make(map[string]string)
+	}
+	if _, ok := e.Keys[key]; !ok {
+		e.Keys[key] = problem
+	}
+}
+
+func (e *ValidationError) Error() string {
+	keys := make([]string, 0, len(e.Keys))
+	for k := range e.Keys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("invalid configuration:")
+	for _, k := range keys {
+		b.WriteString("\n  " + k + ": " + e.Keys[k])
+	}
+	return b.String()
+}
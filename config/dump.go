@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+const redacted = "[redacted]"
+
+// secretMarkers flag keys whose values must not leave the process, at any
+// depth: HEADERS covers header maps such as those of OTLP_HEADERS or of an
+// access log sink, which typically carry credentials.
+var secretMarkers = []string{
+	"SECRET", "PASSWORD", "TOKEN", "CREDENTIAL", "PRIVATE_KEY", "API_KEY",
+	"DSN", "HEADERS", "AUTHORIZATION", "COOKIE",
+}
+
+// Dump returns every setting the configuration was loaded from, keyed by
+// its upper-case name, with secret values redacted: those of keys named like
+// secrets, also within lists and maps, and those resolved by ResolveSecrets.
+func (c *Config) Dump() map[string]interface{} {
+	out := make(map[string]interface{}, len(c.settings))
+	for k, v := range c.settings {
+		k = strings.ToUpper(k)
+		_, fromSecret := resolved.Load(k)
+		if (fromSecret || isSecret(k)) && !empty(v) {
+			v = redacted
+		}
+		out[k] = redact(v)
+	}
+	return out
+}
+
+// redact copies v with the values of secret keys in nested maps redacted.
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			out[k] = redactKey(k, val)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := make(map[interface{}]interface{}, len(v))
+		for k, val := range v {
+			out[k] = redactKey(fmt.Sprint(k), val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, val := range v {
+			out[i] = redact(val)
+		}
+		return out
+	}
+	return v
+}
+
+func redactKey(key string, v interface{}) interface{} {
+	if isSecret(strings.ToUpper(key)) && !empty(v) {
+		return redacted
+	}
+	return redact(v)
+}
+
+func empty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case map[string]interface{}:
+		return len(v) == 0
+	case map[interface{}]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+func isSecret(key string) bool {
+	for _, m := range secretMarkers {
+		if strings.Contains(key, m) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Read loads the configuration in order of increasing precedence:
+//
+//  1. defaults registered with SetDefaults
+//  2. the base file, config.yaml
+//  3. the environment file, config.<env>.yaml, when it exists
+//  4. environment variables named after the keys
+//
+// The environment is taken from APP_ENV, falling back to the ENVIRONMENT
+// key.
+func Read(v *viper.Viper) error {
+	v.BindEnv("ENVIRONMENT", "APP_ENV", "ENVIRONMENT")
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+	if err := MergeEnvironment(v); err != nil {
+		return err
+	}
+	v.AutomaticEnv()
+	return nil
+}
+
+// MergeEnvironment merges the environment file over the base file. viper
+// re-reads only the base file when it changes, so call this again after
+// every reload.
+func MergeEnvironment(v *viper.Viper) error {
+	path := EnvironmentFile(v)
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return v.MergeConfig(f)
+}
+
+// EnvironmentFile returns the path of the environment file next to the base
+// file, whether or not it exists.
+func EnvironmentFile(v *viper.Viper) string {
+	env := v.GetString("ENVIRONMENT")
+	base := v.ConfigFileUsed()
+	if env == "" || base == "" {
+		return ""
+	}
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "." + env + ext
+}
@@ -0,0 +1,235 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// SecretProvider resolves secret references of one scheme. In a config value
+// "${vault:kv/app#api_key}" the vault provider is asked for "kv/app#api_key".
+type SecretProvider interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+type SecretProviderFunc func(ctx context.Context, ref string) (string, error)
+
+func (f SecretProviderFunc) Resolve(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+var secretRef = regexp.MustCompile(`\$\{([a-z]+):([^}]+)\}`)
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]SecretProvider{
+		"file":  SecretProviderFunc(readSecretFile),
+		"env":   SecretProviderFunc(func(_ context.Context, name string) (string, error) { return os.Getenv(name), nil }),
+		"vault": Vault{},
+	}
+
+	// resolved remembers which keys hold resolved secrets so Dump can
+	// redact them whatever their name.
+	resolved sync.Map
+
+	// overridden holds the keys ResolveSecrets set, by lower-case name.
+	overridden sync.Map
+)
+
+func RegisterSecretProvider(scheme string, p SecretProvider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	providers[scheme] = p
+}
+
+// ResolveSecrets replaces secret references in v with their values. Two
+// forms are supported: "${scheme:ref}" anywhere in a string value, and the
+// _FILE convention, where KEY_FILE (a key or environment variable) names a
+// file whose contents become KEY. KEY must be a key of the configuration,
+// set in a config file or defaulted, so that unrelated environment
+// variables such as SSL_CERT_FILE are left alone. References are always
+// read from the config files and environment afresh, so it is safe to call
+// after every reload: a key that no longer holds a reference gets its
+// configured value back.
+func ResolveSecrets(v *viper.Viper) error {
+	raw := viper.New()
+	if file := v.ConfigFileUsed(); file != "" {
+		raw.SetConfigFile(file)
+		if err := raw.ReadInConfig(); err != nil {
+			return err
+		}
+		raw.Set("ENVIRONMENT", v.GetString("ENVIRONMENT"))
+		if err := MergeEnvironment(raw); err != nil {
+			return err
+		}
+	}
+	raw.AutomaticEnv()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var errs []error
+	// Keys that failed keep their previous value.
+	current := make(map[string]bool)
+	for _, key := range raw.AllKeys() {
+		value, ok := raw.Get(key).(string)
+		if !ok || !strings.Contains(value, "${") {
+			continue
+		}
+		current[key] = true
+		out, err := expand(ctx, value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", strings.ToUpper(key), err))
+			continue
+		}
+		v.Set(key, out)
+		resolved.Store(strings.ToUpper(key), true)
+	}
+
+	for key, path := range fileKeys(raw, v) {
+		current[key] = true
+		out, err := readSecretFile(ctx, path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s_FILE: %w", strings.ToUpper(key), err))
+			continue
+		}
+		v.Set(key, out)
+		resolved.Store(strings.ToUpper(key), true)
+	}
+
+	// An override outlives reloads, so one left on a key that is no longer
+	// a reference would hide its configured value for good; a nil override
+	// lets the configured value through again.
+	overridden.Range(func(k, _ interface{}) bool {
+		if key := k.(string); !current[key] {
+			v.Set(key, nil)
+			resolved.Delete(strings.ToUpper(key))
+			overridden.Delete(key)
+		}
+		return true
+	})
+	for key := range current {
+		overridden.Store(key, true)
+	}
+
+	return errors.Join(errs...)
+}
+
+func expand(ctx context.Context, value string) (string, error) {
+	var firstErr error
+	out := secretRef.ReplaceAllStringFunc(value, func(m string) string {
+		parts := secretRef.FindStringSubmatch(m)
+		providersMu.RLock()
+		p, ok := providers[parts[1]]
+		providersMu.RUnlock()
+		if !ok {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("unknown secret provider %q", parts[1])
+			}
+			return m
+		}
+		s, err := p.Resolve(ctx, parts[2])
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return s
+	})
+	return out, firstErr
+}
+
+// fileKeys collects key -> path for every KEY_FILE setting, from the config
+// files as well as the environment, whose KEY is a key of v. Keys are in
+// lower case, as viper has them.
+func fileKeys(raw, v *viper.Viper) map[string]string {
+	known := make(map[string]bool)
+	for _, k := range v.AllKeys() {
+		known[k] = true
+	}
+	keys := make(map[string]string)
+	for _, k := range raw.AllKeys() {
+		if key, ok := strings.CutSuffix(k, "_file"); ok && known[key] {
+			if path := raw.GetString(k); path != "" {
+				keys[key] = path
+			}
+		}
+	}
+	for _, kv := range os.Environ() {
+		name, path, _ := strings.Cut(kv, "=")
+		if key, ok := strings.CutSuffix(name, "_FILE"); ok && path != "" && known[strings.ToLower(key)] {
+			keys[strings.ToLower(key)] = path
+		}
+	}
+	return keys
+}
+
+func readSecretFile(_ context.Context, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Vault reads secrets from a HashiCorp Vault KV version 2 engine, using the
+// standard VAULT_ADDR and VAULT_TOKEN environment variables. References
+// take the form "<mount>/<path>#<field>", e.g. "kv/app#api_key".
+type Vault struct {
+	Client *http.Client
+}
+
+func (vault Vault) Resolve(ctx context.Context, ref string) (string, error) {
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return "", errors.New("vault: VAULT_ADDR and VAULT_TOKEN must be set")
+	}
+
+	parts := strings.SplitN(ref, "#", 2)
+	location := strings.SplitN(parts[0], "/", 2)
+	if len(parts) != 2 || len(location) != 2 {
+		return "", fmt.Errorf("vault: reference %q must look like mount/path#field", ref)
+	}
+
+	url := strings.TrimSuffix(addr, "/") + "/v1/" + location[0] + "/data/" + location[1]
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	client := vault.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault: %s: %s", parts[0], res.Status)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	value, ok := body.Data.Data[parts[1]]
+	if !ok {
+		return "", fmt.Errorf("vault: %s has no field %q", parts[0], parts[1])
+	}
+	return fmt.Sprint(value), nil
+}
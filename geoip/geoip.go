@@ -0,0 +1,231 @@
+// Package geoip annotates requests with the location of the client, looked
+// up in a MaxMind GeoIP2 or GeoLite2 database, and routes or blocks them by
+// country.
+package geoip
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// Location is where a client address is. Codes are upper case ISO 3166
+// codes; fields the database does not know are empty.
+type Location struct {
+	Country   string `json:"country,omitempty"`
+	Continent string `json:"continent,omitempty"`
+	// Region is the most general subdivision, e.g. a state or province.
+	Region string `json:"region,omitempty"`
+	City   string `json:"city,omitempty"`
+}
+
+// DB is an open MaxMind database, safe for concurrent lookups.
+type DB struct {
+	db *mmdb
+}
+
+// Open reads the database at path, e.g. GeoLite2-City.mmdb or
+// GeoLite2-Country.mmdb, into memory.
+func Open(path string) (*DB, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := parseMMDB(buf)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{db: db}, nil
+}
+
+// Lookup returns the location of ip; ok is false when the database has no
+// record for it.
+func (d *DB) Lookup(ip netip.Addr) (loc Location, ok bool, err error) {
+	v, err := d.db.lookup(ip)
+	if err != nil || v == nil {
+		return Location{}, false, err
+	}
+	record, _ := v.(map[string]interface{})
+
+	loc.Country = str(record, "country", "iso_code")
+	if loc.Country == "" {
+		loc.Country = str(record, "registered_country", "iso_code")
+	}
+	loc.Continent = str(record, "continent", "code")
+	if subs, _ := record["subdivisions"].([]interface{}); len(subs) > 0 {
+		sub, _ := subs[0].(map[string]interface{})
+		loc.Region = str(sub, "iso_code")
+	}
+	loc.City = str(record, "city", "names", "en")
+	return loc, true, nil
+}
+
+func str(m map[string]interface{}, path ...string) string {
+	for _, key := range path[:len(path)-1] {
+		m, _ = m[key].(map[string]interface{})
+	}
+	s, _ := m[path[len(path)-1]].(string)
+	return s
+}
+
+// Locator looks up request locations in a database file, reloading it when
+// the file is replaced.
+type Locator struct {
+	path    string
+	db      atomic.Pointer[DB]
+	modTime time.Time
+}
+
+func NewLocator(path string) (*Locator, error) {
+	l := &Locator{path: path}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload reopens the database file. Lookups keep using the previous
+// database until the new one has been read, and for good if it is invalid.
+func (l *Locator) Reload() error {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return err
+	}
+	db, err := Open(l.path)
+	if err != nil {
+		return err
+	}
+	l.db.Store(db)
+	l.modTime = info.ModTime()
+	return nil
+}
+
+// Watch reloads the database whenever its file changes, checking every
+// interval until ctx is done. It is meant to run as a server task, picking
+// up the updates written by geoipupdate.
+func (l *Locator) Watch(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(l.path)
+		if err != nil || info.ModTime().Equal(l.modTime) {
+			continue
+		}
+		if err := l.Reload(); err != nil {
+			slog.Warn("geoip: reload failed, keeping the current database", "path", l.path, "err", err)
+			continue
+		}
+		slog.Info("geoip: database reloaded", "path", l.path)
+	}
+}
+
+// Lookup returns the location of ip, or the zero Location when it is
+// unknown.
+func (l *Locator) Lookup(ip netip.Addr) Location {
+	loc, _, err := l.db.Load().Lookup(ip)
+	if err != nil {
+		slog.Warn("geoip: lookup failed", "ip", ip, "err", err)
+	}
+	return loc
+}
+
+type locationKey struct{}
+
+// Middleware looks up the client of each request, as resolved by
+// router.ClientIP, and stores the location for From.
+func (l *Locator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var loc Location
+		if ip := router.ClientIP(r); ip.IsValid() {
+			loc = l.Lookup(ip)
+		}
+		r = r.WithContext(context.WithValue(r.Context(), locationKey{}, loc))
+		if loc.Country != "" {
+			router.Logger(r).Debug("geoip: client located", "country", loc.Country, "region", loc.Region)
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// From returns the location stored by Locator's middleware, or the zero
+// Location.
+func From(r *http.Request) Location {
+	loc, _ := r.Context().Value(locationKey{}).(Location)
+	return loc
+}
+
+// Matches reports whether the location is in one of codes, each a country
+// code ("DE"), a country and region ("US-CA") or a continent prefixed with
+// "continent:" ("continent:EU"). Codes are case-insensitive.
+func (loc Location) Matches(codes ...string) bool {
+	if loc.Country == "" {
+		return false
+	}
+	for _, code := range codes {
+		code = strings.ToUpper(code)
+		switch {
+		case strings.HasPrefix(code, "CONTINENT:"):
+			if code[len("CONTINENT:"):] == loc.Continent {
+				return true
+			}
+		case strings.Contains(code, "-"):
+			if code == loc.Country+"-"+loc.Region {
+				return true
+			}
+		case code == loc.Country:
+			return true
+		}
+	}
+	return false
+}
+
+// Block refuses requests from the given locations, in the format of
+// Matches, with 403. Clients that could not be located are let through.
+func Block(codes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if loc := From(r); loc.Matches(codes...) {
+				router.Logger(r).Info("geoip: request blocked", "country", loc.Country, "region", loc.Region)
+				http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// Region routes a request to the first handler whose codes, in the format
+// of Matches, match the client's location.
+type Region struct {
+	Codes   []string
+	Handler http.Handler
+}
+
+// ByLocation serves each request with the handler of the first region the
+// client is in, or with fallback, e.g. to send clients to the closest
+// regional upstreams.
+func ByLocation(regions []Region, fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		loc := From(r)
+		for _, region := range regions {
+			if loc.Matches(region.Codes...) {
+				region.Handler.ServeHTTP(rw, r)
+				return
+			}
+		}
+		fallback.ServeHTTP(rw, r)
+	})
+}
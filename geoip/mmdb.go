@@ -0,0 +1,306 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+)
+
+// This file reads MaxMind DB files, the format of GeoIP2 and GeoLite2
+// databases: a binary search tree over the address bits whose leaves point
+// into a data section of typed, JSON-like values.
+// See https://maxmind.github.io/MaxMind-DB/.
+
+var (
+	ErrInvalidDatabase = errors.New("geoip: invalid MaxMind database")
+	metadataMarker     = []byte("\xAB\xCD\xEFMaxMind.com")
+)
+
+type mmdb struct {
+	buf        []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+	dbType     string
+}
+
+func parseMMDB(buf []byte) (*mmdb, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, ErrInvalidDatabase
+	}
+	meta := buf[i+len(metadataMarker):]
+	v, _, err := (&decoder{data: meta}).decode(0)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidDatabase
+	}
+
+	db := &mmdb{buf: buf}
+	db.nodeCount = uint(asUint(m["node_count"]))
+	db.recordSize = uint(asUint(m["record_size"]))
+	db.ipVersion = uint(asUint(m["ip_version"]))
+	db.dbType, _ = m["database_type"].(string)
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("geoip: unsupported record size %d", db.recordSize)
+	}
+
+	treeSize := db.recordSize * 2 / 8 * db.nodeCount
+	if treeSize+16 > uint(i) {
+		return nil, ErrInvalidDatabase
+	}
+	db.data = buf[treeSize+16 : i]
+
+	// IPv4 addresses live under ::/96 in IPv6 databases.
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for j := 0; j < 96 && node < db.nodeCount; j++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+func (db *mmdb) record(node, bit uint) uint {
+	b := db.buf[node*db.recordSize*2/8:]
+	switch db.recordSize {
+	case 24:
+		if bit == 0 {
+			return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3])<<16 | uint(b[4])<<8 | uint(b[5])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		if bit == 0 {
+			return uint(binary.BigEndian.Uint32(b))
+		}
+		return uint(binary.BigEndian.Uint32(b[4:]))
+	}
+}
+
+// lookup returns the record for addr, or nil when the database has none.
+func (db *mmdb) lookup(addr netip.Addr) (interface{}, error) {
+	var bits []byte
+	node := uint(0)
+	if addr.Is4() || addr.Is4In6() {
+		a := addr.Unmap().As4()
+		bits = a[:]
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+	} else {
+		if db.ipVersion == 4 {
+			return nil, nil
+		}
+		a := addr.As16()
+		bits = a[:]
+	}
+
+	for i := 0; i < len(bits)*8 && node < db.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-i%8)) & 1
+		node = db.record(node, bit)
+	}
+	if node == db.nodeCount {
+		return nil, nil
+	}
+	if node < db.nodeCount {
+		return nil, ErrInvalidDatabase
+	}
+
+	offset := node - db.nodeCount - 16
+	v, _, err := (&decoder{data: db.data}).decode(offset)
+	return v, err
+}
+
+// maxDepth bounds how deeply maps, arrays and pointers nest, far beyond
+// what GeoIP2 records need, so a malformed or hostile file whose data
+// points back into itself cannot recurse without end.
+const maxDepth = 32
+
+type decoder struct {
+	data  []byte
+	depth int
+}
+
+func (d *decoder) decode(offset uint) (interface{}, uint, error) {
+	if d.depth >= maxDepth {
+		return nil, 0, fmt.Errorf("%w: data nested more than %d deep", ErrInvalidDatabase, maxDepth)
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return d.value(typ, size, offset)
+}
+
+// control reads a field's control byte(s), returning its type, its size and
+// the offset of its payload.
+func (d *decoder) control(offset uint) (uint, uint, uint, error) {
+	if offset >= uint(len(d.data)) {
+		return 0, 0, 0, ErrInvalidDatabase
+	}
+	ctrl := d.data[offset]
+	offset++
+
+	typ := uint(ctrl >> 5)
+	if typ == 0 {
+		if offset >= uint(len(d.data)) {
+			return 0, 0, 0, ErrInvalidDatabase
+		}
+		typ = 7 + uint(d.data[offset])
+		offset++
+	}
+	if typ == 1 {
+		// Pointers encode their size differently; the caller decodes them
+		// from the control byte itself.
+		return typ, uint(ctrl & 0x1F), offset, nil
+	}
+
+	size := uint(ctrl & 0x1F)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.data)) {
+			return 0, 0, 0, ErrInvalidDatabase
+		}
+		extra := uint(0)
+		for _, b := range d.data[offset : offset+n] {
+			extra = extra<<8 | uint(b)
+		}
+		offset += n
+		switch size {
+		case 29:
+			size = 29 + extra
+		case 30:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+	return typ, size, offset, nil
+}
+
+func (d *decoder) value(typ, size, offset uint) (interface{}, uint, error) {
+	payload := func() ([]byte, error) {
+		if offset+size > uint(len(d.data)) {
+			return nil, ErrInvalidDatabase
+		}
+		return d.data[offset : offset+size], nil
+	}
+
+	switch typ {
+	case 1: // pointer
+		ss, vvv := size>>3&3, size&7
+		n := ss + 1
+		if offset+n > uint(len(d.data)) {
+			return nil, 0, ErrInvalidDatabase
+		}
+		p := uint(0)
+		if ss < 3 {
+			p = vvv
+		}
+		for _, b := range d.data[offset : offset+n] {
+			p = p<<8 | uint(b)
+		}
+		p += [4]uint{0, 2048, 526336, 0}[ss]
+		// The format forbids pointers to pointers.
+		if typ, _, _, err := d.control(p); err != nil || typ == 1 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		v, _, err := d.decode(p)
+		return v, offset + n, err
+	case 2: // string
+		b, err := payload()
+		return string(b), offset + size, err
+	case 3: // double
+		b, err := payload()
+		if err != nil || size != 8 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset + size, nil
+	case 4: // bytes
+		b, err := payload()
+		return append([]byte(nil), b...), offset + size, err
+	case 5, 6, 9, 10: // uint16, uint32, uint64, uint128 (kept as its low 64 bits)
+		b, err := payload()
+		if err != nil {
+			return nil, 0, err
+		}
+		n := uint64(0)
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, offset + size, nil
+	case 7: // map
+		// Every entry takes at least a byte, which bounds what a bogus
+		// size can make us allocate.
+		m := make(map[string]interface{}, min(size, uint(len(d.data))-offset))
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, ErrInvalidDatabase
+			}
+			v, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case 8: // int32
+		b, err := payload()
+		if err != nil {
+			return nil, 0, err
+		}
+		n := uint32(0)
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int64(int32(n)), offset + size, nil
+	case 11: // array
+		a := make([]interface{}, 0, min(size, uint(len(d.data))-offset))
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case 14: // boolean, its value held in the size
+		return size != 0, offset, nil
+	case 15: // float
+		b, err := payload()
+		if err != nil || size != 4 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset + size, nil
+	}
+	return nil, 0, fmt.Errorf("geoip: unsupported data type %d", typ)
+}
+
+func asUint(v interface{}) uint64 {
+	n, _ := v.(uint64)
+	return n
+}
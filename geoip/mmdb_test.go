@@ -0,0 +1,102 @@
+package geoip
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+// Helpers encoding the few MaxMind DB types the fixtures need.
+
+func mmdbString(s string) []byte {
+	return append([]byte{2<<5 | byte(len(s))}, s...)
+}
+
+func mmdbUint16(n uint16) []byte {
+	return []byte{5<<5 | 2, byte(n >> 8), byte(n)}
+}
+
+func mmdbPointer(to uint) []byte {
+	return []byte{1<<5 | byte(to>>8&7), byte(to)}
+}
+
+func mmdbMap(kv ...[]byte) []byte {
+	b := []byte{7<<5 | byte(len(kv)/2)}
+	for _, v := range kv {
+		b = append(b, v...)
+	}
+	return b
+}
+
+// fixture returns an IPv4 database of one node: addresses in 0.0.0.0/1
+// have no record, those in 128.0.0.0/1 the one at the start of data.
+func fixture(data []byte) []byte {
+	const nodeCount = 1
+	b := []byte{0, 0, nodeCount, 0, 0, nodeCount + 16}
+	b = append(b, make([]byte, 16)...)
+	b = append(b, data...)
+	b = append(b, metadataMarker...)
+	return append(b, mmdbMap(
+		mmdbString("node_count"), mmdbUint16(nodeCount),
+		mmdbString("record_size"), mmdbUint16(24),
+		mmdbString("ip_version"), mmdbUint16(4),
+		mmdbString("database_type"), mmdbString("Test-Country"),
+	)...)
+}
+
+func TestLookup(t *testing.T) {
+	country := mmdbMap(mmdbString("iso_code"), mmdbString("DE"))
+	record := mmdbMap(mmdbString("country"), country, mmdbString("continent"), mmdbMap(mmdbString("code"), mmdbString("EU")))
+	db, err := parseMMDB(fixture(record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &DB{db: db}
+
+	loc, ok, err := d.Lookup(netip.MustParseAddr("200.1.2.3"))
+	if err != nil || !ok || loc.Country != "DE" || loc.Continent != "EU" {
+		t.Errorf("Lookup(200.1.2.3) = %+v, %v, %v; want DE in EU", loc, ok, err)
+	}
+	if _, ok, err := d.Lookup(netip.MustParseAddr("::ffff:200.1.2.3")); err != nil || !ok {
+		t.Errorf("Lookup of the mapped address = %v, %v", ok, err)
+	}
+	if _, ok, err := d.Lookup(netip.MustParseAddr("10.0.0.1")); err != nil || ok {
+		t.Errorf("Lookup(10.0.0.1) = %v, %v; want no record", ok, err)
+	}
+}
+
+func TestLookupMalformed(t *testing.T) {
+	for name, data := range map[string][]byte{
+		// A map whose value points back at the map.
+		"pointer loop": mmdbMap(mmdbString("a"), mmdbPointer(0)),
+		// Two pointers pointing at each other.
+		"pointer to pointer": append(mmdbPointer(2), mmdbPointer(0)...),
+		// A map claiming millions of entries in a few bytes.
+		"oversized map": {7<<5 | 31, 0xFF, 0xFF, 0xFF},
+		// A map entry missing its value.
+		"truncated": append([]byte{7<<5 | 1}, mmdbString("a")...),
+	} {
+		db, err := parseMMDB(fixture(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := db.lookup(netip.MustParseAddr("200.1.2.3")); !errors.Is(err, ErrInvalidDatabase) {
+			t.Errorf("%s: err = %v, want ErrInvalidDatabase", name, err)
+		}
+	}
+}
+
+func TestParseMMDBRejectsGarbage(t *testing.T) {
+	for name, buf := range map[string][]byte{
+		"empty":       nil,
+		"no metadata": make([]byte, 64),
+		"tree past metadata": append(metadataMarker, mmdbMap(
+			mmdbString("node_count"), mmdbUint16(1000),
+			mmdbString("record_size"), mmdbUint16(24),
+		)...),
+	} {
+		if _, err := parseMMDB(buf); err == nil {
+			t.Errorf("%s: parsed", name)
+		}
+	}
+}
@@ -1,5 +1,28 @@
 module github.com/ritego/build-a-router-with-go
 
-go 1.16
+go 1.24
 
-require github.com/spf13/viper v1.9.0
+require (
+	github.com/fsnotify/fsnotify v1.5.1
+	github.com/mitchellh/mapstructure v1.4.2
+	github.com/spf13/viper v1.9.0
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/net v0.38.0
+	google.golang.org/protobuf v1.27.1
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require (
+	github.com/hashicorp/hcl v1.0.0 // indirect
+	github.com/magiconair/properties v1.8.5 // indirect
+	github.com/pelletier/go-toml v1.9.4 // indirect
+	github.com/spf13/afero v1.6.0 // indirect
+	github.com/spf13/cast v1.4.1 // indirect
+	github.com/spf13/jwalterweatherman v1.1.0 // indirect
+	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/subosito/gotenv v1.2.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	golang.org/x/sys v0.31.0 // indirect
+	golang.org/x/text v0.23.0 // indirect
+	gopkg.in/ini.v1 v1.63.2 // indirect
+)
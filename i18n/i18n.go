@@ -0,0 +1,208 @@
+// Package i18n picks the locale of each request and translates messages
+// from a catalog of per-locale files.
+package i18n
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+type Options struct {
+	// Locales are the supported locales, e.g. "en", "fr", "pt-BR". The
+	// first is used when nothing else matches.
+	Locales []string
+	// Cookie names a cookie holding the locale chosen by the user, which
+	// wins over Accept-Language.
+	Cookie string
+	// PathPrefix takes the locale from a leading path segment, "/fr/docs",
+	// which wins over everything else and is stripped before routing, so
+	// routes are registered once as "/docs".
+	PathPrefix bool
+	// Catalog translates messages for T and localized error pages.
+	Catalog *Catalog
+}
+
+type localeKey struct{}
+
+type locale struct {
+	tag     string
+	catalog *Catalog
+}
+
+// Middleware stores the locale of each request for Locale and T, and sets
+// Content-Language. Pass it to Router.Use so path prefixes are stripped
+// before matching.
+func Middleware(opts Options) func(http.Handler) http.Handler {
+	if len(opts.Locales) == 0 {
+		opts.Locales = []string{"en"}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			tag := ""
+			if opts.PathPrefix {
+				if t, rest, ok := pathLocale(r.URL.Path, opts.Locales); ok {
+					tag = t
+					r = r.Clone(r.Context())
+					r.URL.Path, r.URL.RawPath = rest, ""
+				}
+			}
+			if tag == "" && opts.Cookie != "" {
+				if c, err := r.Cookie(opts.Cookie); err == nil {
+					tag = supported(c.Value, opts.Locales)
+				}
+			}
+			if tag == "" {
+				tag = Negotiate(r.Header.Get("Accept-Language"), opts.Locales)
+			}
+
+			rw.Header().Set("Content-Language", tag)
+			rw.Header().Add("Vary", "Accept-Language")
+			ctx := context.WithValue(r.Context(), localeKey{}, locale{tag: tag, catalog: opts.Catalog})
+			next.ServeHTTP(rw, r.WithContext(ctx))
+		})
+	}
+}
+
+// Locale returns the locale of the request, or "" outside of Middleware.
+func Locale(r *http.Request) string {
+	l, _ := r.Context().Value(localeKey{}).(locale)
+	return l.tag
+}
+
+// T translates key into the request's locale with the middleware's
+// catalog, formatting args into it like fmt.Sprintf. Untranslated keys are
+// returned as they are.
+func T(r *http.Request, key string, args ...any) string {
+	l, _ := r.Context().Value(localeKey{}).(locale)
+	if l.catalog == nil {
+		return format(key, args)
+	}
+	return l.catalog.T(l.tag, key, args...)
+}
+
+func pathLocale(path string, locales []string) (tag, rest string, ok bool) {
+	segment, rest, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	for _, l := range locales {
+		if strings.EqualFold(segment, l) {
+			return l, "/" + rest, true
+		}
+	}
+	return "", "", false
+}
+
+// supported returns the supported locale matching tag exactly or by its
+// base language ("en-GB" matches "en"), or "".
+func supported(tag string, locales []string) string {
+	for _, l := range locales {
+		if strings.EqualFold(tag, l) {
+			return l
+		}
+	}
+	base, _, _ := strings.Cut(tag, "-")
+	for _, l := range locales {
+		if strings.EqualFold(base, l) {
+			return l
+		}
+	}
+	return ""
+}
+
+// Negotiate picks the supported locale the Accept-Language header prefers,
+// or the first one.
+func Negotiate(header string, locales []string) string {
+	type choice struct {
+		tag string
+		q   float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if tag != "" && q > 0 {
+			choices = append(choices, choice{tag, q})
+		}
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+
+	for _, c := range choices {
+		if c.tag == "*" {
+			break
+		}
+		if l := supported(c.tag, locales); l != "" {
+			return l
+		}
+	}
+	return locales[0]
+}
+
+// Catalog holds the translated messages of each locale.
+type Catalog struct {
+	messages map[string]map[string]string
+	fallback string
+}
+
+// LoadCatalog reads <locale>.json, .yaml or .yml files from dir, each a flat
+// map of message keys to translations, e.g. fr.json holding
+// {"Not Found": "Introuvable"}. Keys missing from a locale fall back to
+// fallback's translation, then to the key itself.
+func LoadCatalog(dir, fallback string) (*Catalog, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Catalog{messages: make(map[string]map[string]string), fallback: strings.ToLower(fallback)}
+	for _, f := range files {
+		ext := filepath.Ext(f.Name())
+		if f.IsDir() || (ext != ".json" && ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		messages := make(map[string]string)
+		if ext == ".json" {
+			err = json.Unmarshal(data, &messages)
+		} else {
+			err = yaml.Unmarshal(data, &messages)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("i18n: %s: %w", f.Name(), err)
+		}
+		c.messages[strings.ToLower(strings.TrimSuffix(f.Name(), ext))] = messages
+	}
+	return c, nil
+}
+
+func (c *Catalog) T(locale, key string, args ...any) string {
+	tag := strings.ToLower(locale)
+	base, _, _ := strings.Cut(tag, "-")
+	for _, l := range []string{tag, base, c.fallback} {
+		if msg, ok := c.messages[l][key]; ok {
+			return format(msg, args)
+		}
+	}
+	return format(key, args)
+}
+
+func format(msg string, args []any) string {
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
@@ -0,0 +1,151 @@
+package logsink
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileOptions control when a File rotates.
+type FileOptions struct {
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+}
+
+// File appends to a file, rotating it once it grows past MaxSize or the
+// wall clock passes a multiple of MaxAge since the zero time, in UTC, e.g.
+// every midnight for 24h: the file is renamed with the time of rotation,
+// e.g. access.log.20240102T150405, and a new one started. Rotating on the
+// clock rather than after MaxAge of writing holds across restarts, which a
+// file's age could not: its creation time is not kept.
+type File struct {
+	path string
+	opts FileOptions
+
+	// now is time.Now, but for tests.
+	now func() time.Time
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	// period is when the MaxAge period the file's lines belong to began.
+	period  time.Time
+	rotated time.Time
+}
+
+func OpenFile(path string, opts FileOptions) (*File, error) {
+	return openFile(path, opts, time.Now)
+}
+
+func openFile(path string, opts FileOptions, now func() time.Time) (*File, error) {
+	f := &File{path: path, opts: opts, now: now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the file for appending. A file written to before belongs to
+// the period of its last write, so the first write of a later period
+// rotates it.
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.period = file, info.Size(), f.periodOf(f.now())
+	if info.Size() > 0 {
+		f.period = f.periodOf(info.ModTime())
+	}
+	return nil
+}
+
+// periodOf returns when the MaxAge period t falls in began.
+func (f *File) periodOf(t time.Time) time.Time {
+	if f.opts.MaxAge <= 0 {
+		return time.Time{}
+	}
+	return t.UTC().Truncate(f.opts.MaxAge)
+}
+
+// Write writes one line, rotating the file first when it is due.
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	full := f.opts.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.opts.MaxSize
+	old := f.opts.MaxAge > 0 && f.periodOf(f.now()).After(f.period)
+	if full || old {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate renames the file and opens a new one. f.mu must be held.
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	now := f.now()
+	// Two rotations within a second would take the same name.
+	if now.Truncate(time.Second).Equal(f.rotated.Truncate(time.Second)) {
+		now = f.rotated.Add(time.Second)
+	}
+	f.rotated = now
+	if err := os.Rename(f.path, f.path+"."+now.UTC().Format("20060102T150405")); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.prune()
+	return nil
+}
+
+// prune removes the oldest rotated files beyond MaxBackups.
+func (f *File) prune() {
+	if f.opts.MaxBackups <= 0 {
+		return
+	}
+	backups, _ := filepath.Glob(f.path + ".*")
+	backups = slices.DeleteFunc(backups, func(name string) bool {
+		_, err := time.Parse("20060102T150405", strings.TrimPrefix(name, f.path+"."))
+		return err != nil
+	})
+	// The timestamps sort in time order.
+	sort.Strings(backups)
+	for len(backups) > f.opts.MaxBackups {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
+
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,139 @@
+package logsink
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clock is a fake time.Now that moves only when set.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+// backups returns the rotated files next to path, oldest first, with their
+// contents.
+func backups(t *testing.T, path string) (names, contents []string) {
+	t.Helper()
+	matches, _ := filepath.Glob(path + ".*")
+	slices.Sort(matches)
+	for _, m := range matches {
+		b, err := os.ReadFile(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, strings.TrimPrefix(m, path+"."))
+		contents = append(contents, string(b))
+	}
+	return names, contents
+}
+
+func write(t *testing.T, f *File, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if _, err := f.Write([]byte(line + "\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFileRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	c := &clock{time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)}
+	f, err := openFile(path, FileOptions{MaxSize: 10}, c.now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	write(t, f, "aaaa", "bbbb", "cccc", "dddd")
+	// A line longer than MaxSize still goes into a file of its own.
+	write(t, f, "eeeeeeeeeeee")
+
+	names, contents := backups(t, path)
+	// The second rotation within the same second takes the next one.
+	if want := []string{"20240102T150405", "20240102T150406"}; !slices.Equal(names, want) {
+		t.Errorf("backups %q, want %q", names, want)
+	}
+	if want := []string{"aaaa\nbbbb\n", "cccc\ndddd\n"}; !slices.Equal(contents, want) {
+		t.Errorf("backups hold %q, want %q", contents, want)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "eeeeeeeeeeee\n" {
+		t.Errorf("file holds %q, want the long line", b)
+	}
+}
+
+func TestFileRotatesOnTheClock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	c := &clock{time.Date(2024, 1, 2, 23, 30, 0, 0, time.UTC)}
+	f, err := openFile(path, FileOptions{MaxAge: 24 * time.Hour}, c.now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(t, f, "before midnight")
+	c.t = c.t.Add(29 * time.Minute)
+	write(t, f, "still before")
+	c.t = c.t.Add(2 * time.Minute)
+	write(t, f, "after midnight")
+	f.Close()
+
+	names, contents := backups(t, path)
+	if !slices.Equal(names, []string{"20240103T000100"}) || contents[0] != "before midnight\nstill before\n" {
+		t.Fatalf("backups %q holding %q, want one rotated at 00:01", names, contents)
+	}
+
+	// A file last written the day before is rotated by the first write
+	// after a restart, however recently it was opened.
+	yesterday := time.Now().Add(-24 * time.Hour)
+	if err := os.Chtimes(path, yesterday, yesterday); err != nil {
+		t.Fatal(err)
+	}
+	f, err = OpenFile(path, FileOptions{MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	write(t, f, "today")
+	if names, _ := backups(t, path); len(names) != 2 {
+		t.Errorf("backups %q, want the reopened file rotated too", names)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "today\n" {
+		t.Errorf("file holds %q, want only today's line", b)
+	}
+}
+
+func TestFilePrunesBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	// Files that are not backups of this one are left alone.
+	for _, name := range []string{"access.log.old", "access.log2.20200101T000000"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &clock{time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}
+	f, err := openFile(path, FileOptions{MaxSize: 1, MaxBackups: 2}, c.now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, line := range []string{"1", "2", "3", "4", "5"} {
+		write(t, f, line)
+		c.t = c.t.Add(time.Hour)
+	}
+
+	names, contents := backups(t, path)
+	if want := []string{"20240102T030000", "20240102T040000", "old"}; !slices.Equal(names, want) {
+		t.Errorf("backups %q, want %q", names, want)
+	}
+	if want := []string{"3\n", "4\n"}; !slices.Equal(contents[:2], want) {
+		t.Errorf("backups hold %q, want the newest lines %q", contents[:2], want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "access.log2.20200101T000000")); err != nil {
+		t.Errorf("another file's backup was pruned: %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+// Package logsink provides destinations for log lines besides stderr:
+// rotating files, syslog and a batching HTTP shipper, so the router can
+// keep its access log without an agent collecting it.
+package logsink
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var ErrUnsupported = errors.New("logsink: not supported on this platform")
+
+// Spec is one configured sink. Type selects the sink and which other
+// fields apply.
+type Spec struct {
+	// Type is file, syslog or http.
+	Type string
+
+	// Path is the file written, for file.
+	Path string
+	// MaxSize is the size in bytes a file reaches before it is rotated, 0
+	// for no limit.
+	MaxSize int64 `mapstructure:"max_size"`
+	// MaxAge is the period files are rotated at, counted on the wall clock
+	// in UTC; 24h rotates at midnight. 0 for no limit.
+	MaxAge time.Duration `mapstructure:"max_age"`
+	// MaxBackups is how many rotated files are kept, 0 to keep them all.
+	MaxBackups int `mapstructure:"max_backups"`
+
+	// Network and Addr locate the syslog daemon, e.g. udp and
+	// localhost:514; both empty for the local one.
+	Network string
+	Addr    string
+	// Tag names the program in syslog messages, "router" by default.
+	Tag string
+
+	// URL receives batches of lines, for http.
+	URL     string
+	Headers map[string]string
+	// BatchSize is how many lines are sent at most per request, 500 by
+	// default.
+	BatchSize int `mapstructure:"batch_size"`
+	// FlushInterval bounds how long lines wait for a batch to fill, 1s by
+	// default.
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+}
+
+// Open returns the sink spec describes. Closing it flushes and releases
+// it.
+func Open(spec Spec) (io.WriteCloser, error) {
+	switch spec.Type {
+	case "file":
+		f, err := OpenFile(spec.Path, FileOptions{MaxSize: spec.MaxSize, MaxAge: spec.MaxAge, MaxBackups: spec.MaxBackups})
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	case "syslog":
+		return DialSyslog(spec.Network, spec.Addr, spec.Tag)
+	case "http":
+		s, err := NewShipper(spec.URL, ShipperOptions{
+			Headers:       spec.Headers,
+			BatchSize:     spec.BatchSize,
+			FlushInterval: spec.FlushInterval,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("logsink: unknown type %q, want file, syslog or http", spec.Type)
+	}
+}
+
+// Tee writes every line to each writer, unlike io.MultiWriter going on
+// past a failing one, and returns the first error.
+func Tee(writers ...io.Writer) io.Writer {
+	return tee(writers)
+}
+
+type tee []io.Writer
+
+func (t tee) Write(p []byte) (int, error) {
+	var first error
+	for _, w := range t {
+		if _, err := w.Write(p); err != nil && first == nil {
+			first = err
+		}
+	}
+	return len(p), first
+}
+
+// OpenAll opens every sink, closing those already open when one fails.
+func OpenAll(specs []Spec) ([]io.WriteCloser, error) {
+	sinks := make([]io.WriteCloser, 0, len(specs))
+	for i, spec := range specs {
+		sink, err := Open(spec)
+		if err != nil {
+			for _, s := range sinks {
+				s.Close()
+			}
+			return nil, fmt.Errorf("sink %d: %w", i, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
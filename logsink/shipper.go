@@ -0,0 +1,171 @@
+package logsink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// ShipperOptions configure a Shipper.
+type ShipperOptions struct {
+	Headers       map[string]string
+	BatchSize     int
+	FlushInterval time.Duration
+	// MaxPending bounds the lines waiting to be sent, 10 batches by default;
+	// lines beyond it are dropped while the endpoint is slow or down.
+	MaxPending int
+	// Client sends the batches, with a 10s timeout by default.
+	Client *http.Client
+}
+
+// Shipper posts the lines written to it in batches, as newline-delimited
+// JSON or text depending on what is written, to an HTTP endpoint such as a
+// log ingestion API. Writes never wait for the endpoint.
+type Shipper struct {
+	url  string
+	opts ShipperOptions
+
+	mu      sync.Mutex
+	pending [][]byte
+	dropped int
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	close   sync.Once
+}
+
+func NewShipper(endpoint string, opts ShipperOptions) (*Shipper, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("logsink: url %q: want an http or https URL", endpoint)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.MaxPending <= 0 {
+		opts.MaxPending = 10 * opts.BatchSize
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	s := &Shipper{
+		url:     endpoint,
+		opts:    opts,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Write queues one line.
+func (s *Shipper) Write(p []byte) (int, error) {
+	line := bytes.TrimRight(p, "\n")
+	if len(line) == 0 {
+		return len(p), nil
+	}
+
+	s.mu.Lock()
+	if len(s.pending) >= s.opts.MaxPending {
+		s.dropped++
+	} else {
+		s.pending = append(s.pending, bytes.Clone(line))
+	}
+	full := len(s.pending) >= s.opts.BatchSize
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+func (s *Shipper) run() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.wake:
+		case <-s.done:
+			s.flush()
+			return
+		}
+		s.flush()
+	}
+}
+
+// flush sends the pending lines, a batch at a time.
+func (s *Shipper) flush() {
+	for {
+		s.mu.Lock()
+		n := min(len(s.pending), s.opts.BatchSize)
+		batch := s.pending[:n:n]
+		s.pending = s.pending[n:]
+		dropped := s.dropped
+		s.dropped = 0
+		s.mu.Unlock()
+
+		if dropped > 0 {
+			// Logging through slog could feed the lines into this very
+			// shipper, so the warning goes straight to stderr.
+			fmt.Fprintf(os.Stderr, "logsink: %s: %d lines dropped\n", s.url, dropped)
+		}
+		if n == 0 {
+			return
+		}
+		if err := s.post(batch); err != nil {
+			fmt.Fprintf(os.Stderr, "logsink: %s: %d lines lost: %v\n", s.url, n, err)
+		}
+	}
+}
+
+func (s *Shipper) post(batch [][]byte) error {
+	body := bytes.Join(batch, []byte("\n"))
+	body = append(body, '\n')
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.Client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	contentType := "text/plain; charset=utf-8"
+	if body[0] == '{' {
+		contentType = "application/x-ndjson"
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range s.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := s.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("%s", res.Status)
+	}
+	return nil
+}
+
+// Close sends the pending lines and stops the shipper.
+func (s *Shipper) Close() error {
+	s.close.Do(func() { close(s.done) })
+	<-s.stopped
+	return nil
+}
@@ -0,0 +1,114 @@
+package logsink
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// endpoint collects the batches posted to it.
+type endpoint struct {
+	mu      sync.Mutex
+	batches []string
+	types   []string
+	posted  chan struct{}
+}
+
+func newEndpoint(t *testing.T) (*endpoint, string) {
+	e := &endpoint{posted: make(chan struct{}, 100)}
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		e.mu.Lock()
+		e.batches = append(e.batches, string(b))
+		e.types = append(e.types, r.Header.Get("Content-Type"))
+		e.mu.Unlock()
+		e.posted <- struct{}{}
+	}))
+	t.Cleanup(srv.Close)
+	return e, srv.URL
+}
+
+func (e *endpoint) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-e.posted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no batch posted")
+	}
+}
+
+func TestShipperBatches(t *testing.T) {
+	e, url := newEndpoint(t)
+	// The interval never passes: only full batches and Close send.
+	s, err := NewShipper(url, ShipperOptions{BatchSize: 3, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for i := range 7 {
+		line := fmt.Sprintf(`{"n":%d}`, i)
+		want = append(want, line)
+		s.Write([]byte(line + "\n"))
+	}
+	// Blank lines are not sent.
+	s.Write([]byte("\n"))
+	e.wait(t)
+	s.Close()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var got []string
+	for i, batch := range e.batches {
+		lines := strings.Split(strings.TrimSuffix(batch, "\n"), "\n")
+		if len(lines) > 3 {
+			t.Errorf("batch %d has %d lines, want at most 3", i, len(lines))
+		}
+		if e.types[i] != "application/x-ndjson" {
+			t.Errorf("batch %d sent as %q, want application/x-ndjson", i, e.types[i])
+		}
+		got = append(got, lines...)
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("lines sent %q, want %q", got, want)
+	}
+}
+
+func TestShipperFlushesOnInterval(t *testing.T) {
+	e, url := newEndpoint(t)
+	s, err := NewShipper(url, ShipperOptions{BatchSize: 100, FlushInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.Write([]byte("GET / 200\n"))
+	e.wait(t)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.batches[0] != "GET / 200\n" || !strings.HasPrefix(e.types[0], "text/plain") {
+		t.Errorf("posted %q as %q, want the text line", e.batches[0], e.types[0])
+	}
+}
+
+func TestShipperDropsBeyondMaxPending(t *testing.T) {
+	e, url := newEndpoint(t)
+	s, err := NewShipper(url, ShipperOptions{BatchSize: 10, MaxPending: 2, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"a", "b", "c", "d"} {
+		s.Write([]byte(line + "\n"))
+	}
+	s.Close()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.batches) != 1 || e.batches[0] != "a\nb\n" {
+		t.Errorf("posted %q, want only the first two lines", e.batches)
+	}
+}
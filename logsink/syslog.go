@@ -0,0 +1,22 @@
+//go:build !windows && !plan9
+
+package logsink
+
+import (
+	"io"
+	"log/syslog"
+)
+
+// DialSyslog connects to the syslog daemon at addr over network, or to the
+// local one when both are empty, and sends each line written as one
+// message at the info priority of the local0 facility.
+func DialSyslog(network, addr, tag string) (io.WriteCloser, error) {
+	if tag == "" {
+		tag = "router"
+	}
+	w, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_LOCAL0, tag)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package logsink
+
+import "io"
+
+// DialSyslog fails, as the platform has no log/syslog.
+func DialSyslog(network, addr, tag string) (io.WriteCloser, error) {
+	return nil, ErrUnsupported
+}
@@ -1,65 +1,1238 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
+	"github.com/ritego/build-a-router-with-go/acl"
+	"github.com/ritego/build-a-router-with-go/auth"
+	"github.com/ritego/build-a-router-with-go/cdn"
+	"github.com/ritego/build-a-router-with-go/config"
+	"github.com/ritego/build-a-router-with-go/geoip"
+	"github.com/ritego/build-a-router-with-go/i18n"
+	"github.com/ritego/build-a-router-with-go/logsink"
+	"github.com/ritego/build-a-router-with-go/middleware"
+	"github.com/ritego/build-a-router-with-go/openapi"
+	"github.com/ritego/build-a-router-with-go/otlp"
+	"github.com/ritego/build-a-router-with-go/plugins"
+	"github.com/ritego/build-a-router-with-go/proxy"
+	"github.com/ritego/build-a-router-with-go/render"
+	"github.com/ritego/build-a-router-with-go/replay"
 	"github.com/ritego/build-a-router-with-go/router"
+	"github.com/ritego/build-a-router-with-go/script"
+	"github.com/ritego/build-a-router-with-go/sentry"
+	"github.com/ritego/build-a-router-with-go/server"
+	"github.com/ritego/build-a-router-with-go/statsd"
+	"github.com/ritego/build-a-router-with-go/stub"
+	"github.com/ritego/build-a-router-with-go/tenant"
 	"github.com/spf13/viper"
 )
 
 var rr = router.New()
 
+var cfg *config.Config
+
+var logger = slog.Default()
+
+// command is the subcommand run instead of the server, if any: "replay",
+// "routes" or "openapi-gen".
+var command string
+
 func main() {
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	if command == "openapi-gen" {
+		generateRoutes(os.Args[2:])
+		return
+	}
 	initConfig()
 	setupRouter()
-	startServer()
+	switch command {
+	case "replay":
+		replayRequests(os.Args[2:])
+	case "routes":
+		printRoutes(os.Args[2:])
+	default:
+		startServer()
+	}
 }
 
 func initConfig() {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".")
-	err := viper.ReadInConfig()
+	config.SetDefaults(viper.GetViper())
+	err := config.Read(viper.GetViper())
 	if err != nil {
 		panic(fmt.Errorf("fatal error reading env file: %w", err))
 	}
-	viper.AutomaticEnv()
+	if err := config.ResolveSecrets(viper.GetViper()); err != nil {
+		fatal("Config Secrets Failed", err)
+	}
+	cfg, err = config.Load(viper.GetViper())
+	if err != nil {
+		fatal("Config Invalid", err)
+	}
+
+	logLevel.Set(cfg.Log.SlogLevel())
+	logger = slog.New(cfg.Log.NewHandler(os.Stderr, &logLevel))
+	if endpoint := viper.GetString("OTLP_ENDPOINT"); endpoint != "" {
+		setupOTLP(endpoint)
+	}
+	slog.SetDefault(logger)
+
+	viper.OnConfigChange(func(fsnotify.Event) {
+		if err := config.MergeEnvironment(viper.GetViper()); err != nil {
+			logger.Error("Config Reload Failed", "err", err)
+			return
+		}
+		if err := config.ResolveSecrets(viper.GetViper()); err != nil {
+			logger.Error("Config Reload Failed", "err", err)
+			return
+		}
+		for _, reload := range reloaders {
+			reload()
+		}
+		logger.Info("Config Reloaded")
+	})
 	viper.WatchConfig()
-	log.Println("Config Loaded")
+	onReload(loadLogLevel)
+	for _, key := range cfg.Defaulted {
+		logger.Warn("Config Key Missing, Using Default", "key", key, "default", viper.Get(key))
+	}
+	logger.Info("Config Loaded", "environment", cfg.Environment)
+}
+
+// exporter sends metrics and logs to OTLP_ENDPOINT, if set.
+var exporter *otlp.Exporter
+
+// setupOTLP exports logs, and request metrics once the router is set up,
+// to an OpenTelemetry collector.
+func setupOTLP(endpoint string) {
+	resource := map[string]string{
+		"service.version":        cfg.Version,
+		"deployment.environment": cfg.Environment,
+	}
+	for k, v := range viper.GetStringMapString("OTLP_RESOURCE") {
+		resource[k] = v
+	}
+	var err error
+	exporter, err = otlp.New(otlp.Options{
+		Endpoint: endpoint,
+		Headers:  viper.GetStringMapString("OTLP_HEADERS"),
+		Resource: resource,
+		Interval: viper.GetDuration("OTLP_INTERVAL"),
+	})
+	if err != nil {
+		fatal("OTLP Config Invalid", err)
+	}
+	logger = slog.New(exporter.Handler(logger.Handler()))
+	tasks = append(tasks, exporter.Run)
+}
+
+// logLevel can be changed at runtime through LOG_LEVEL; the format is fixed
+// at startup.
+var logLevel slog.LevelVar
+
+func loadLogLevel() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(viper.GetString("LOG_LEVEL"))); err != nil {
+		logger.Error("invalid LOG_LEVEL", "err", err)
+		return
+	}
+	logLevel.Set(level)
+}
+
+func fatal(msg string, err error) {
+	logger.Error(msg, "err", err)
+	os.Exit(1)
+}
+
+// reloaders run, in registration order, whenever the config file changes.
+var reloaders []func()
+
+func onReload(reload func()) {
+	reloaders = append(reloaders, reload)
+	reload()
 }
 
 func setupRouter() {
+	pages, err := render.NewErrorPages(viper.GetString("ERROR_PAGES"))
+	if err != nil {
+		panic(fmt.Errorf("fatal error loading error pages: %w", err))
+	}
+	rr.SetErrorHandler(pages)
+	rr.SetLogger(logger)
+	if dsn := viper.GetString("SENTRY_DSN"); dsn != "" {
+		setupSentry(dsn)
+	}
+	if viper.GetBool("ROUTER_STRICT") {
+		rr.Strict()
+	}
+	rr.CacheMatches(viper.GetInt("ROUTER_MATCH_CACHE"))
+	onReload(func() { rr.AllowHosts(viper.GetStringSlice("ALLOWED_HOSTS")...) })
+	if err := rr.TrustProxies(viper.GetStringSlice("TRUSTED_PROXIES")...); err != nil {
+		panic(fmt.Errorf("fatal error reading TRUSTED_PROXIES: %w", err))
+	}
+	rr.Provide("config", cfg)
+	rr.Use(router.AccessLog(router.AccessLogOptions{
+		Sample:      viper.GetFloat64("ACCESS_LOG_SAMPLE"),
+		ErrorSample: viper.GetFloat64("ACCESS_LOG_ERROR_SAMPLE"),
+		Exclude:     viper.GetStringSlice("ACCESS_LOG_EXCLUDE"),
+		Logger:      accessLogger(),
+	}))
+	if viper.GetBool("STRICT_REQUESTS") {
+		rr.Use(middleware.StrictRequests(middleware.StrictOptions{
+			MaxHeaders:     viper.GetInt("STRICT_MAX_HEADERS"),
+			MaxHeaderValue: viper.GetInt("STRICT_MAX_HEADER_VALUE"),
+		}))
+	}
+	if viper.GetBool("REQUEST_DECOMPRESSION") {
+		rr.Use(middleware.Decompress(middleware.DecompressOptions{
+			MaxSize: viper.GetInt64("REQUEST_DECOMPRESSED_MAX_SIZE"),
+		}))
+	}
+	if viper.GetBool("METHOD_OVERRIDE") {
+		rr.Use(middleware.MethodOverride)
+	}
+	if encodings := viper.GetStringSlice("COMPRESSION"); len(encodings) > 0 {
+		levels := make(map[string]int)
+		for name := range viper.GetStringMap("COMPRESSION_LEVELS") {
+			levels[name] = viper.GetInt("COMPRESSION_LEVELS." + name)
+		}
+		compressor, err := middleware.NewCompressor(middleware.CompressOptions{
+			Encodings: encodings,
+			Levels:    levels,
+			MinSize:   viper.GetInt("COMPRESSION_MIN_SIZE"),
+		})
+		if err != nil {
+			panic(fmt.Errorf("fatal error configuring COMPRESSION: %w", err))
+		}
+		rr.Use(compressor.Middleware)
+	}
+	inflight = middleware.NewInflight(middleware.InflightOptions{
+		PerClient: viper.GetInt("INFLIGHT_PER_CLIENT"),
+		Global:    viper.GetInt("INFLIGHT_MAX"),
+	})
+	rr.Use(inflight.Middleware)
+	if limit := viper.GetInt("ADMISSION_MAX_CONCURRENT"); limit > 0 {
+		rr.Use(admission(limit))
+	}
+	if threshold := viper.GetDuration("SLOW_REQUEST_THRESHOLD"); threshold > 0 {
+		rr.Use(router.SlowRequests(router.SlowRequestOptions{
+			Threshold:  threshold,
+			Goroutines: viper.GetBool("SLOW_REQUEST_GOROUTINES"),
+			TraceDir:   viper.GetString("SLOW_REQUEST_TRACE_DIR"),
+		}))
+	}
+	if db := viper.GetString("GEOIP_DATABASE"); db != "" {
+		setupGeoIP(db)
+	}
+	if viper.GetBool("BOT_FILTER") {
+		setupBots()
+	}
+	if path := viper.GetString("AUDIT_LOG"); path != "" {
+		setupAudit(path)
+	}
+	if locales := viper.GetStringSlice("LOCALES"); len(locales) > 0 {
+		setupLocales(locales)
+	}
+	setupScripts()
 
-	rr.HandleFunc("GET:/", func(rw http.ResponseWriter, r *http.Request) {
+	root := rr.HandleFunc("GET:/", func(rw http.ResponseWriter, r *http.Request) {
 		rw.Write([]byte("Root - Hello World!"))
 	})
+	// A CDN would serve the page to everyone once cached, whatever
+	// middleware decided per client, so it is only cached when asked to.
+	if viper.GetBool("CACHE_ROOT") {
+		root.Cache(router.CachePolicy{
+			CacheControl:     "public, max-age=60",
+			SurrogateControl: "max-age=3600",
+			SurrogateKeys:    []string{"root"},
+		})
+	}
+
+	setupBoilerplate()
 
-	rr.HandleFunc("GET:/path-one", func(rw http.ResponseWriter, r *http.Request) {
+	one := rr.Group("/path-one").WithValue("feature", "path-one")
+	one.Use(concurrencyLimit("PATH_ONE"))
+
+	one.HandleFunc("GET:/", func(rw http.ResponseWriter, r *http.Request) {
 		rw.Write([]byte("Path One - Hello World!"))
 	})
 
-	rr.HandleFunc("GET:/path-one/path-two", func(rw http.ResponseWriter, r *http.Request) {
+	one.HandleFunc("GET:/path-two", func(rw http.ResponseWriter, r *http.Request) {
 		rw.Write([]byte("Path Two - Hello World!"))
 	})
 
-	log.Println("Router Loaded")
+	setupProxies()
+	if path := viper.GetString("RECORD_REQUESTS"); path != "" && command == "" {
+		setupRecording(path)
+	}
+	setupThrottles()
+	setupStubs()
+	if viper.GetBool("CHAOS") {
+		setupChaos()
+	}
+
+	onReload(loadResponseHeaders)
+
+	if spec := viper.GetString("OPENAPI_SPEC"); spec != "" {
+		doc, err := openapi.ParseFile(spec)
+		if err != nil {
+			panic(fmt.Errorf("fatal error loading OpenAPI spec: %w", err))
+		}
+		rr.Use(openapi.NewValidator(doc).Middleware)
+		if viper.GetBool("OPENAPI_STUBS") {
+			if err := doc.RegisterStubs(rr); err != nil {
+				logger.Warn("OpenAPI operations without stubs", "err", err)
+			}
+		}
+	}
+
+	if viper.GetString("JWT_JWKS_URL") != "" {
+		rr.Use(auth.Bearer(auth.BearerConfig{
+			JWKSURL:  viper.GetString("JWT_JWKS_URL"),
+			Issuer:   viper.GetString("JWT_ISSUER"),
+			Audience: viper.GetString("JWT_AUDIENCE"),
+		}))
+	}
+
+	if viper.GetString("OIDC_ISSUER") != "" {
+		setupAuth()
+	}
+
+	if resolver := viper.GetString("TENANT_RESOLVER"); resolver != "" {
+		setupTenants(resolver)
+	}
+
+	setupPlugins()
+
+	rr.SetAuthorizer(&router.RoleAuthorizer{Grants: grants})
+	setupACL()
+
+	setupAdmin()
+
+	if err := rr.Validate(); err != nil {
+		fatal("invalid routes", err)
+	}
+	if err := rr.Build(); err != nil {
+		fatal("building handlers failed", err)
+	}
+	logger.Info("Router Loaded")
+}
+
+// accessLogger writes the access log to the ACCESS_LOG_SINKS, or returns nil
+// to log it with the router's logger.
+func accessLogger() *slog.Logger {
+	var specs []logsink.Spec
+	if err := viper.UnmarshalKey("ACCESS_LOG_SINKS", &specs); err != nil {
+		panic(fmt.Errorf("fatal error reading ACCESS_LOG_SINKS: %w", err))
+	}
+	if len(specs) == 0 {
+		return nil
+	}
+	sinks, err := logsink.OpenAll(specs)
+	if err != nil {
+		panic(fmt.Errorf("fatal error opening ACCESS_LOG_SINKS: %w", err))
+	}
+	writers := make([]io.Writer, len(sinks))
+	for i, sink := range sinks {
+		writers[i] = sink
+	}
+	rr.OnShutdown(func(context.Context) error {
+		var errs []error
+		for _, sink := range sinks {
+			errs = append(errs, sink.Close())
+		}
+		return errors.Join(errs...)
+	})
+
+	format := cfg.Log
+	if f := viper.GetString("ACCESS_LOG_FORMAT"); f != "" {
+		format.Format = f
+	}
+	return slog.New(format.NewHandler(logsink.Tee(writers...), slog.LevelInfo))
+}
+
+// setupSentry reports server errors and panics to the Sentry project of
+// dsn.
+func setupSentry(dsn string) {
+	client, err := sentry.New(sentry.Options{
+		DSN:         dsn,
+		Environment: cfg.Environment,
+		Release:     cfg.Version,
+	})
+	if err != nil {
+		panic(fmt.Errorf("fatal error in SENTRY_DSN: %w", err))
+	}
+	rr.SetErrorReporter(client)
+	tasks = append(tasks, client.Run)
+}
+
+// setupGeoIP locates every client in the GEOIP_DATABASE, reloading it when
+// the file changes, and refuses those in GEOIP_BLOCK.
+func setupGeoIP(path string) {
+	locator, err := geoip.NewLocator(path)
+	if err != nil {
+		panic(fmt.Errorf("fatal error opening GEOIP_DATABASE: %w", err))
+	}
+	rr.Use(locator.Middleware)
+	if block := viper.GetStringSlice("GEOIP_BLOCK"); len(block) > 0 {
+		rr.Use(geoip.Block(block...))
+	}
+
+	interval := viper.GetDuration("GEOIP_RELOAD_INTERVAL")
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	tasks = append(tasks, func(ctx context.Context) error {
+		return locator.Watch(ctx, interval)
+	})
+}
+
+var bots *middleware.BotFilter
+
+// inflight counts the requests being served, per client and in total.
+var inflight *middleware.Inflight
+
+// setupBots classifies clients by user agent, refusing BOT_DENY, serving
+// BOT_ALLOW crawlers verified by BOT_ALLOW_DOMAINS or BOT_ALLOW_NETWORKS and
+// challenging suspected bots under BOT_CHALLENGE.
+func setupBots() {
+	var err error
+	bots, err = middleware.NewBotFilter(middleware.BotOptions{
+		Allow:         viper.GetStringSlice("BOT_ALLOW"),
+		Deny:          viper.GetStringSlice("BOT_DENY"),
+		AllowDomains:  viper.GetStringSlice("BOT_ALLOW_DOMAINS"),
+		AllowNetworks: viper.GetStringSlice("BOT_ALLOW_NETWORKS"),
+		Challenge:     viper.GetStringSlice("BOT_CHALLENGE"),
+		Secret:        []byte(viper.GetString("BOT_CHALLENGE_SECRET")),
+		ChallengeTTL:  viper.GetDuration("BOT_CHALLENGE_TTL"),
+	})
+	if err != nil {
+		panic(fmt.Errorf("fatal error configuring the bot filter: %w", err))
+	}
+	rr.Use(bots.Middleware)
+}
+
+// setupBoilerplate serves ROBOTS_TXT, FAVICON and the WELL_KNOWN files.
+func setupBoilerplate() {
+	b := router.Boilerplate{Robots: viper.GetString("ROBOTS_TXT")}
+	if path := viper.GetString("FAVICON"); path != "" {
+		favicon, err := os.ReadFile(path)
+		if err != nil {
+			panic(fmt.Errorf("fatal error reading FAVICON: %w", err))
+		}
+		b.Favicon = favicon
+	}
+	if files := viper.GetStringMapString("WELL_KNOWN"); len(files) > 0 {
+		b.WellKnown = make(map[string]http.Handler, len(files))
+		for name, file := range files {
+			file := file
+			b.WellKnown[name] = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				http.ServeFile(rw, r, file)
+			})
+		}
+	}
+	rr.HandleBoilerplate(b)
+}
+
+// setupAudit appends the requests served by routes marked Audit() to the
+// AUDIT_LOG file.
+func setupAudit(path string) {
+	sink, err := router.OpenAuditFile(path)
+	if err != nil {
+		panic(fmt.Errorf("fatal error opening AUDIT_LOG: %w", err))
+	}
+	rr.OnShutdown(func(context.Context) error { return sink.Close() })
+	rr.Use(router.Audit(router.AuditOptions{Sink: sink, Actor: actor}))
+}
+
+// actor identifies the caller for the audit log: the signed-in user, or
+// "admin-token" for requests bearing ADMIN_TOKEN.
+func actor(r *http.Request) string {
+	if subject := auth.ClaimsFrom(r).Subject(); subject != "" {
+		return subject
+	}
+	if adminToken(r) {
+		return "admin-token"
+	}
+	return ""
+}
+
+// setupLocales picks the locale of every request among LOCALES and
+// translates error pages with the LOCALE_MESSAGES catalog.
+func setupLocales(locales []string) {
+	opts := i18n.Options{
+		Locales:    locales,
+		Cookie:     viper.GetString("LOCALE_COOKIE"),
+		PathPrefix: viper.GetBool("LOCALE_PATH_PREFIX"),
+	}
+	if dir := viper.GetString("LOCALE_MESSAGES"); dir != "" {
+		catalog, err := i18n.LoadCatalog(dir, locales[0])
+		if err != nil {
+			panic(fmt.Errorf("fatal error loading LOCALE_MESSAGES: %w", err))
+		}
+		opts.Catalog = catalog
+	}
+	rr.Use(i18n.Middleware(opts))
+}
+
+// setupScripts rewrites request headers with the REQUEST_SCRIPTS, in
+// order. An expression failing to compile is fatal.
+func setupScripts() {
+	var specs []struct {
+		When          string
+		SetHeaders    map[string]string `mapstructure:"set_headers"`
+		RemoveHeaders []string          `mapstructure:"remove_headers"`
+	}
+	if err := viper.UnmarshalKey("REQUEST_SCRIPTS", &specs); err != nil {
+		panic(fmt.Errorf("fatal error reading REQUEST_SCRIPTS: %w", err))
+	}
+	if len(specs) == 0 {
+		return
+	}
+	transforms := make([]script.Transform, 0, len(specs))
+	for _, spec := range specs {
+		t, err := script.NewTransform(spec.When, spec.SetHeaders, spec.RemoveHeaders)
+		if err != nil {
+			panic(fmt.Errorf("fatal error in REQUEST_SCRIPTS: %w", err))
+		}
+		transforms = append(transforms, t)
+	}
+	rr.Use(script.Transforms(transforms...))
+}
+
+// setupAuth enables OpenID Connect login. Route permissions are then granted
+// from the ROLES_CLAIM claim of the signed-in user.
+func setupAuth() {
+	provider, err := auth.New(context.Background(), auth.Config{
+		Issuer:        viper.GetString("OIDC_ISSUER"),
+		ClientID:      viper.GetString("OIDC_CLIENT_ID"),
+		ClientSecret:  viper.GetString("OIDC_CLIENT_SECRET"),
+		RedirectURL:   viper.GetString("OIDC_REDIRECT_URL"),
+		Scopes:        viper.GetStringSlice("OIDC_SCOPES"),
+		SessionSecret: []byte(viper.GetString("SESSION_SECRET")),
+		SessionTTL:    viper.GetDuration("SESSION_TTL"),
+	})
+	if err != nil {
+		panic(fmt.Errorf("fatal error configuring auth: %w", err))
+	}
+
+	rr.HandleFunc("GET:/auth/login", provider.Login)
+	rr.HandleFunc("GET:/auth/callback", provider.Callback)
+	rr.HandleFunc("GET:/auth/logout", provider.Logout)
+	rr.Use(provider.Authenticate)
+}
+
+var tenants *tenant.Manager
+
+// setupTenants resolves the tenant of every request as TENANT_RESOLVER says
+// and enforces the limits of the TENANTS list, reloaded on change.
+func setupTenants(resolver string) {
+	var resolve tenant.Resolver
+	switch kind, arg, _ := strings.Cut(resolver, ":"); kind {
+	case "subdomain":
+		resolve = tenant.FromSubdomain(arg)
+	case "header":
+		resolve = tenant.FromHeader(arg)
+	case "claim":
+		resolve = tenant.FromClaim(arg)
+	default:
+		panic(fmt.Errorf("fatal error in TENANT_RESOLVER: %q, want subdomain:<domain>, header:<name> or claim:<name>", resolver))
+	}
+
+	tenants = tenant.NewManager(resolve, viper.GetBool("TENANT_REQUIRED"))
+	onReload(func() {
+		var list []tenant.Tenant
+		if err := viper.UnmarshalKey("TENANTS", &list); err != nil {
+			logger.Error("invalid TENANTS", "err", err)
+			return
+		}
+		tenants.SetTenants(list)
+	})
+	rr.Use(tenants.Middleware)
+}
+
+// setupPlugins loads the PLUGINS, in order. A plugin failing to load is
+// fatal.
+func setupPlugins() {
+	var specs []plugins.Spec
+	if err := viper.UnmarshalKey("PLUGINS", &specs); err != nil {
+		panic(fmt.Errorf("fatal error reading PLUGINS: %w", err))
+	}
+	loaded, err := plugins.LoadAll(rr, specs)
+	if err != nil {
+		panic(fmt.Errorf("fatal error loading PLUGINS: %w", err))
+	}
+	for _, p := range loaded {
+		logger.Info("Plugin Loaded", "path", p.Path)
+	}
+}
+
+// setupACL enforces the ACL rules, reloaded on change. Invalid rules are
+// fatal at startup; on reload they are logged and the previous rules kept.
+func setupACL() {
+	list := acl.New(grants)
+	load := func() error {
+		var rules []acl.Rule
+		if err := viper.UnmarshalKey("ACL", &rules); err != nil {
+			return err
+		}
+		return list.Load(rules)
+	}
+	if err := load(); err != nil {
+		panic(fmt.Errorf("fatal error reading ACL: %w", err))
+	}
+	onReload(func() {
+		if err := load(); err != nil {
+			logger.Error("invalid ACL, keeping the previous rules", "err", err)
+		}
+	})
+	rr.SetAccessPolicy(list)
+}
+
+// grants returns the roles of the caller: those in the ROLES_CLAIM claim of
+// its token or signed-in user, plus "admin" for requests bearing
+// ADMIN_TOKEN.
+func grants(r *http.Request) []string {
+	roles := auth.ClaimsFrom(r).Strings(viper.GetString("ROLES_CLAIM"))
+
+	if adminToken(r) {
+		roles = append(roles, "admin")
+	}
+	return roles
+}
+
+// adminToken reports whether r bears ADMIN_TOKEN.
+func adminToken(r *http.Request) bool {
+	token := viper.GetString("ADMIN_TOKEN")
+	bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token != "" && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1
+}
+
+// setupAdmin registers the operational endpoints under /admin, restricted to
+// the "admin" role.
+func setupAdmin() {
+	admin := rr.Group("/admin").Tag("admin").SetErrorHandler(render.Problems)
+
+	if tenants != nil {
+		admin.Handle("GET:/tenants", tenants).Require("admin")
+	}
+	if bots != nil {
+		admin.Handle("GET:/bots", bots).Require("admin")
+	}
+	admin.Handle("GET:/inflight", inflight).Require("admin")
+	if chaos != nil {
+		admin.Handle("GET:/chaos", chaos).Require("admin")
+		admin.Handle("PUT:/chaos", chaos).Require("admin").Audit()
+	}
+	if purger := cdnPurger(); purger != nil {
+		admin.Handle("POST:/cache/purge", cdn.Handler(purger)).Require("admin").Audit()
+	}
+
+	recent := router.NewRecent(viper.GetInt("RECENT_REQUESTS"))
+	rr.Use(recent.Middleware)
+	admin.Handle("GET:/requests", recent).Require("admin")
+	admin.Handle("GET:/requests/dashboard", recent.Dashboard()).Require("admin")
+
+	if viper.GetBool("METRICS") {
+		setupMetrics(admin)
+	}
+
+	if viper.GetBool("DEBUG_CAPTURE") {
+		capture := middleware.NewBodyCapture(middleware.CaptureOptions{
+			MaxBody:      viper.GetInt("DEBUG_CAPTURE_MAX_BODY"),
+			Size:         viper.GetInt("DEBUG_CAPTURE_SIZE"),
+			RedactFields: viper.GetStringSlice("DEBUG_CAPTURE_REDACT_FIELDS"),
+			Log:          viper.GetBool("DEBUG_CAPTURE_LOG"),
+			Exclude:      []string{"/admin"},
+		})
+		rr.Use(capture.Middleware)
+		admin.Handle("GET:/captures", capture).Require("admin").Audit()
+	}
+
+	admin.HandleFuncE("GET:/routes", func(rw http.ResponseWriter, r *http.Request) error {
+		return render.JSON(rw, http.StatusOK, rr.Routes())
+	}).Require("admin")
+
+	admin.HandleFuncE("GET:/routes/tree", func(rw http.ResponseWriter, r *http.Request) error {
+		format, contentType := router.TreeText, "text/plain; charset=utf-8"
+		switch r.URL.Query().Get("format") {
+		case "json":
+			format, contentType = router.TreeJSON, "application/json"
+		case "dot":
+			format, contentType = router.TreeDOT, "text/vnd.graphviz"
+		}
+		rw.Header().Set("Content-Type", contentType)
+		return rr.DumpTree(rw, format)
+	}).Require("admin")
+
+	if viper.GetBool("ROUTE_COVERAGE") {
+		coverage := router.NewCoverage(rr)
+		rr.Use(coverage.Middleware)
+		admin.HandleFuncE("GET:/routes/coverage", func(rw http.ResponseWriter, r *http.Request) error {
+			if r.URL.Query().Get("format") == "text" {
+				rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				return coverage.Report().WriteText(rw)
+			}
+			coverage.ServeHTTP(rw, r)
+			return nil
+		}).Require("admin")
+	}
+
+	admin.HandleF("GET:/config", func(deps router.Deps) http.Handler {
+		cfg := router.Dep[*config.Config](deps, "config")
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			render.JSON(rw, http.StatusOK, cfg.Dump())
+		})
+	}).Require("admin").Audit()
+}
+
+// setupMetrics records request metrics in the METRICS_SINK.
+func setupMetrics(admin *router.Group) {
+	switch sink := viper.GetString("METRICS_SINK"); sink {
+	case "", "prometheus":
+		var buckets []float64
+		if err := viper.UnmarshalKey("METRICS_BUCKETS", &buckets); err != nil {
+			panic(fmt.Errorf("fatal error reading METRICS_BUCKETS: %w", err))
+		}
+		metrics := router.NewMetrics(router.MetricsOptions{Buckets: buckets})
+		rr.Use(metrics.Middleware)
+		admin.Handle("GET:/metrics", metrics).Require("admin")
+	case "statsd", "dogstatsd":
+		client, err := statsd.New(statsd.Options{
+			Addr:       viper.GetString("STATSD_ADDR"),
+			Prefix:     viper.GetString("STATSD_PREFIX"),
+			Tags:       viper.GetStringSlice("STATSD_TAGS"),
+			DogStatsD:  sink == "dogstatsd",
+			SampleRate: viper.GetFloat64("STATSD_SAMPLE_RATE"),
+		})
+		if err != nil {
+			panic(fmt.Errorf("fatal error configuring METRICS_SINK: %w", err))
+		}
+		rr.Use(router.RecordMetrics(client))
+		tasks = append(tasks, client.Run)
+	default:
+		panic(fmt.Errorf("fatal error in METRICS_SINK: %q, want prometheus, statsd or dogstatsd", sink))
+	}
+	if exporter != nil {
+		rr.Use(router.RecordMetrics(exporter))
+	}
+}
+
+// cdnPurger returns the CDN_PROVIDER client, or nil.
+func cdnPurger() cdn.Purger {
+	id, token := viper.GetString("CDN_SERVICE_ID"), viper.GetString("CDN_API_TOKEN")
+	switch provider := viper.GetString("CDN_PROVIDER"); provider {
+	case "":
+		return nil
+	case "fastly":
+		return &cdn.Fastly{ServiceID: id, Token: token, Soft: viper.GetBool("CDN_SOFT_PURGE")}
+	case "cloudflare":
+		return &cdn.Cloudflare{ZoneID: id, Token: token}
+	default:
+		panic(fmt.Errorf("fatal error in CDN_PROVIDER: %q, want fastly or cloudflare", provider))
+	}
+}
+
+// proxyRoute is one PROXY_ROUTES entry.
+type proxyRoute struct {
+	Prefix    string
+	Upstream  string
+	Upstreams []string
+	Balance   string
+	HashBy    string        `mapstructure:"hash_by"`
+	Sticky    string        `mapstructure:"sticky_cookie"`
+	StickyTTL time.Duration `mapstructure:"sticky_ttl"`
+	// StripPrefix forwards paths relative to Prefix.
+	StripPrefix bool `mapstructure:"strip_prefix"`
+	Transport   proxy.TransportOptions
+	Headers     struct {
+		Allow []string
+		Strip []string
+		Set   map[string]string
+	}
+	// Regions send clients in the given locations to their own upstreams,
+	// sharing the route's other settings.
+	Regions []struct {
+		Codes     []string
+		Upstreams []string
+	}
+	// Rules send the requests their script expression holds for to their
+	// own upstreams, before Regions are considered.
+	Rules []struct {
+		When      string
+		Upstreams []string
+	}
+	Metrics struct {
+		Labels  map[string]string
+		Buckets []float64
+	}
+	Discovery struct {
+		Type      string // dns_srv, consul or kubernetes
+		Service   string
+		Proto     string // dns_srv
+		Name      string // dns_srv
+		Addr      string // consul
+		Token     string // consul
+		Namespace string // kubernetes
+		Port      string // kubernetes
+		Scheme    string
+		Interval  time.Duration
+	}
+}
+
+// tasks run in the background for as long as the server does.
+var tasks []server.Task
+
+// setupProxies mounts a reverse proxy for every PROXY_ROUTES entry.
+func setupProxies() {
+	var routes []proxyRoute
+	if err := viper.UnmarshalKey("PROXY_ROUTES", &routes); err != nil {
+		panic(fmt.Errorf("fatal error reading PROXY_ROUTES: %w", err))
+	}
+
+	for _, route := range routes {
+		p, err := newProxy(route)
+		if err != nil {
+			panic(fmt.Errorf("fatal error configuring proxy for %s: %w", route.Prefix, err))
+		}
+		var handler http.Handler = p
+		if len(route.Regions) > 0 {
+			regions := make([]geoip.Region, 0, len(route.Regions))
+			for _, region := range route.Regions {
+				regional := route
+				regional.Upstream, regional.Upstreams = "", region.Upstreams
+				regional.Discovery.Type = ""
+				rp, err := newProxy(regional)
+				if err != nil {
+					panic(fmt.Errorf("fatal error configuring proxy for %s in %v: %w", route.Prefix, region.Codes, err))
+				}
+				regions = append(regions, geoip.Region{Codes: region.Codes, Handler: rp})
+			}
+			handler = geoip.ByLocation(regions, p)
+		}
+		if len(route.Rules) > 0 {
+			rules := make([]script.Rule, 0, len(route.Rules))
+			for _, rule := range route.Rules {
+				when, err := script.Compile(rule.When)
+				if err != nil {
+					panic(fmt.Errorf("fatal error in rule for %s: %w", route.Prefix, err))
+				}
+				ruled := route
+				ruled.Upstream, ruled.Upstreams = "", rule.Upstreams
+				ruled.Discovery.Type = ""
+				rp, err := newProxy(ruled)
+				if err != nil {
+					panic(fmt.Errorf("fatal error configuring proxy for %s when %s: %w", route.Prefix, rule.When, err))
+				}
+				rules = append(rules, script.Rule{When: when, Handler: rp})
+			}
+			handler = script.Switch(rules, handler)
+		}
+
+		mount := rr.Mount(route.Prefix, handler)
+		if route.StripPrefix {
+			mount.StripPrefix()
+		}
+		for name, value := range route.Metrics.Labels {
+			mount.MetricLabel(name, value)
+		}
+		if len(route.Metrics.Buckets) > 0 {
+			mount.LatencyBuckets(route.Metrics.Buckets...)
+		}
+	}
+}
+
+func newProxy(route proxyRoute) (*proxy.Proxy, error) {
+	transport, err := proxy.NewTransport(route.Transport)
+	if err != nil {
+		return nil, err
+	}
+	options := []proxy.Option{proxy.WithTransport(transport)}
+
+	switch route.Balance {
+	case "":
+		// The proxy hashes by the sticky cookie when there is one.
+	case "round_robin":
+		options = append(options, proxy.WithBalancer(&proxy.RoundRobin{}))
+	case "consistent_hash":
+		var key proxy.HashKey
+		switch kind, name, _ := strings.Cut(route.HashBy, ":"); kind {
+		case "":
+			key = proxy.HashClientIP
+			if route.Sticky != "" {
+				key = proxy.HashCookie(route.Sticky)
+			}
+		case "ip":
+			key = proxy.HashClientIP
+		case "header":
+			key = proxy.HashHeader(name)
+		case "cookie":
+			key = proxy.HashCookie(name)
+		default:
+			return nil, fmt.Errorf("unknown hash_by %q, want ip, header:<name> or cookie:<name>", route.HashBy)
+		}
+		options = append(options, proxy.WithBalancer(proxy.NewConsistentHash(key)))
+	default:
+		return nil, fmt.Errorf("unknown balance %q, want round_robin or consistent_hash", route.Balance)
+	}
+
+	if route.Sticky != "" {
+		options = append(options, proxy.WithStickyCookie(route.Sticky, route.StickyTTL))
+	}
+	if h := route.Headers; h.Allow != nil || h.Strip != nil || h.Set != nil {
+		policy := proxy.HeaderPolicy{Allow: h.Allow, Strip: h.Strip, Set: h.Set}
+		if policy.Set == nil {
+			policy.Set = proxy.DefaultHeaderPolicy.Set
+		}
+		options = append(options, proxy.WithHeaderPolicy(policy))
+	}
+
+	upstreams := route.Upstreams
+	if route.Upstream != "" {
+		upstreams = append([]string{route.Upstream}, upstreams...)
+	}
+
+	d, err := discoverer(route)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return proxy.New(upstreams, options...)
+	}
+
+	if len(upstreams) == 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if upstreams, err = d.Discover(ctx); err != nil {
+			return nil, err
+		}
+	}
+	p, err := proxy.New(upstreams, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Consul and Kubernetes block until the upstreams change, DNS does not.
+	interval := route.Discovery.Interval
+	if interval <= 0 && route.Discovery.Type == "dns_srv" {
+		interval = 30 * time.Second
+	} else if interval <= 0 {
+		interval = time.Second
+	}
+	tasks = append(tasks, func(ctx context.Context) error {
+		return p.Discover(ctx, d, interval)
+	})
+	return p, nil
+}
+
+// discoverer returns the upstream discovery configured for route, or nil.
+func discoverer(route proxyRoute) (proxy.Discoverer, error) {
+	c := route.Discovery
+	switch c.Type {
+	case "":
+		return nil, nil
+	case "dns_srv":
+		return &proxy.DNSSRV{Service: c.Service, Proto: c.Proto, Name: c.Name, Scheme: c.Scheme}, nil
+	case "consul":
+		return &proxy.Consul{Addr: c.Addr, Service: c.Service, Token: c.Token, Scheme: c.Scheme}, nil
+	case "kubernetes":
+		return &proxy.Kubernetes{Namespace: c.Namespace, Service: c.Service, Port: c.Port, Scheme: c.Scheme}, nil
+	}
+	return nil, fmt.Errorf("unknown discovery type %q, want dns_srv, consul or kubernetes", c.Type)
+}
+
+func loadResponseHeaders() {
+	var rules []struct {
+		Path    string
+		Headers map[string]string
+	}
+	if err := viper.UnmarshalKey("RESPONSE_HEADERS", &rules); err != nil {
+		logger.Error("invalid RESPONSE_HEADERS", "err", err)
+		return
+	}
+
+	table := make(map[string]http.Header, len(rules))
+	for _, rule := range rules {
+		header := make(http.Header, len(rule.Headers))
+		for k, v := range rule.Headers {
+			header.Set(k, v)
+		}
+		table[rule.Path] = header
+	}
+	rr.SetHeaders(table)
+}
+
+// setupThrottles limits response bandwidth under the path prefixes listed in
+// THROTTLE.
+func setupThrottles() {
+	var rules []struct {
+		Path          string
+		Rate          int
+		PerConnection int `mapstructure:"per_connection"`
+		Burst         int
+	}
+	if err := viper.UnmarshalKey("THROTTLE", &rules); err != nil {
+		panic(fmt.Errorf("fatal error reading THROTTLE: %w", err))
+	}
+
+	for _, rule := range rules {
+		throttle := middleware.Throttle(middleware.ThrottleOptions{
+			Rate:          rule.Rate,
+			PerConnection: rule.PerConnection,
+			Burst:         rule.Burst,
+		})
+		prefix := strings.TrimSuffix(rule.Path, "/")
+		rr.Use(func(next http.Handler) http.Handler {
+			throttled := throttle(next)
+			return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix+"/") {
+					throttled.ServeHTTP(rw, r)
+					return
+				}
+				next.ServeHTTP(rw, r)
+			})
+		})
+	}
+}
+
+// setupStubs registers the canned routes listed in STUBS.
+func setupStubs() {
+	var stubs []stub.Stub
+	if err := viper.UnmarshalKey("STUBS", &stubs); err != nil {
+		panic(fmt.Errorf("fatal error reading STUBS: %w", err))
+	}
+	if len(stubs) > 0 && cfg.Environment == "production" {
+		logger.Warn("serving STUBS in production", "stubs", len(stubs))
+	}
+	routes, err := stub.Routes(stubs)
+	if err != nil {
+		panic(fmt.Errorf("fatal error in STUBS: %w", err))
+	}
+	rr.Register(routes)
+}
+
+// printRoutes implements "router routes [-diff snapshot]": it prints the
+// route table as JSON, to keep as a snapshot, or the routes added, removed
+// and changed since the snapshot.
+func printRoutes(args []string) {
+	flags := flag.NewFlagSet("routes", flag.ExitOnError)
+	snapshot := flags.String("diff", "", "route table printed by an earlier build")
+	asJSON := flags.Bool("json", false, "print the diff as JSON")
+	flags.Parse(args)
+
+	if *snapshot == "" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(rr.Routes())
+		return
+	}
+
+	data, err := os.ReadFile(*snapshot)
+	if err != nil {
+		fatal("Route Diff Failed", err)
+	}
+	var old []router.RouteInfo
+	if err := json.Unmarshal(data, &old); err != nil {
+		fatal("Route Diff Failed", fmt.Errorf("%s: %w", *snapshot, err))
+	}
+	diff := router.Diff(old, rr.Routes())
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(diff)
+		return
+	}
+	diff.WriteText(os.Stdout)
+}
+
+// generateRoutes implements "router openapi-gen [-package name] <spec>": it
+// prints Go code registering a handler for every operation of the OpenAPI
+// document.
+func generateRoutes(args []string) {
+	flags := flag.NewFlagSet("openapi-gen", flag.ExitOnError)
+	pkg := flags.String("package", "api", "package of the generated code")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: router openapi-gen [-package name] <spec>")
+		os.Exit(2)
+	}
+
+	doc, err := openapi.ParseFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := openapi.Generate(os.Stdout, doc, *pkg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// setupRecording appends every request outside /admin to the
+// RECORD_REQUESTS file, for "router replay" to send again.
+func setupRecording(path string) {
+	recorder, err := replay.Create(path, replay.RecordOptions{
+		MaxBody: viper.GetInt("RECORD_MAX_BODY"),
+		Redact:  viper.GetStringSlice("RECORD_REDACT_HEADERS"),
+		Exclude: []string{"/admin"},
+	})
+	if err != nil {
+		panic(fmt.Errorf("fatal error opening RECORD_REQUESTS: %w", err))
+	}
+	rr.OnShutdown(func(context.Context) error { return recorder.Close() })
+	rr.Use(recorder.Middleware)
+}
+
+// replayRequests implements "router replay [flags] <recording>": it sends
+// the recorded requests through the router, without starting the server,
+// and prints how the responses compare with the recorded ones as JSON.
+func replayRequests(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	rate := flags.Float64("rate", 0, "requests per second")
+	speed := flags.Float64("speed", 0, "replay the recorded pace, 2 being twice as fast")
+	concurrency := flags.Int("concurrency", 8, "requests in flight at once")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: router replay [-rate n | -speed x] [-concurrency n] <recording>")
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fatal("Replay Failed", err)
+	}
+	exchanges, err := replay.Read(f)
+	f.Close()
+	if err != nil {
+		fatal("Replay Failed", err)
+	}
+
+	ctx := context.Background()
+	if err := rr.Start(ctx); err != nil {
+		fatal("Replay Failed", err)
+	}
+	defer rr.Stop(ctx)
+
+	report, err := replay.Replay(ctx, rr, exchanges, replay.Options{Rate: *rate, Speed: *speed, Concurrency: *concurrency})
+	if err != nil {
+		fatal("Replay Failed", err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+}
+
+var chaos *middleware.Chaos
+
+// setupChaos injects the CHAOS_FAULTS, reloaded on change, into every
+// request outside /admin. PUT /admin/chaos changes them until the next
+// reload.
+func setupChaos() {
+	chaos = middleware.NewChaos("/admin")
+	chaos.Enable(true)
+	onReload(func() {
+		var faults []middleware.Fault
+		if err := viper.UnmarshalKey("CHAOS_FAULTS", &faults); err != nil {
+			logger.Error("invalid CHAOS_FAULTS", "err", err)
+			return
+		}
+		if err := chaos.SetFaults(faults); err != nil {
+			logger.Error("invalid CHAOS_FAULTS", "err", err)
+			return
+		}
+	})
+	logger.Warn("fault injection is enabled, see CHAOS")
+	rr.Use(chaos.Middleware)
+}
+
+// admission sheds load beyond ADMISSION_MAX_CONCURRENT requests in flight
+// and ADMISSION_QUEUE waiting, admitting waiters by the priority
+// ADMISSION_PRIORITIES gives their path prefix.
+func admission(limit int) router.Middleware {
+	priorities := make(map[string]middleware.Priority)
+	for prefix, name := range viper.GetStringMapString("ADMISSION_PRIORITIES") {
+		p, ok := middleware.ParsePriority(name)
+		if !ok {
+			panic(fmt.Errorf("fatal error in ADMISSION_PRIORITIES: %s: unknown priority %q", prefix, name))
+		}
+		priorities[prefix] = p
+	}
+
+	a := middleware.NewAdmission(
+		limit,
+		viper.GetInt("ADMISSION_QUEUE"),
+		viper.GetDuration("ADMISSION_QUEUE_TIMEOUT"),
+		viper.GetDuration("ADMISSION_RETRY_AFTER"),
+	)
+	return a.Middleware(middleware.PriorityByPrefix(priorities, middleware.PriorityNormal))
+}
+
+// concurrencyLimit reads the concurrency settings of a route group from the
+// <GROUP>_MAX_CONCURRENT, <GROUP>_QUEUE and <GROUP>_QUEUE_TIMEOUT keys. With
+// <GROUP>_ADAPTIVE the limit follows observed latency instead, never
+// exceeding <GROUP>_MAX_CONCURRENT.
+func concurrencyLimit(group string) router.Middleware {
+	if viper.GetBool(group + "_ADAPTIVE") {
+		return middleware.AdaptiveConcurrency(middleware.AdaptiveOptions{
+			MaxLimit: viper.GetInt(group + "_MAX_CONCURRENT"),
+		})
+	}
+	return middleware.Concurrency(
+		viper.GetInt(group+"_MAX_CONCURRENT"),
+		viper.GetInt(group+"_QUEUE"),
+		viper.GetDuration(group+"_QUEUE_TIMEOUT"),
+	)
 }
 
 func startServer() {
-	addr := viper.GetString("SERVER_PORT")
+	addr := cfg.Server.Port
 
-	srv := &http.Server{
-		Handler:      rr,
-		Addr:         addr,
-		WriteTimeout: viper.GetDuration("SERVER_WRITE_TIMEOUT"),
-		ReadTimeout:  viper.GetDuration("SERVER_READ_TIMEOUT"),
+	srv := server.New(&http.Server{
+		Handler:           rr,
+		Addr:              addr,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+		ConnContext:       middleware.ConnContext,
+	})
+	if cfg.Server.H2C {
+		server.EnableH2C(srv.Server)
+	}
+	srv.ShutdownTimeout = cfg.Server.ShutdownTimeout
+	srv.StopTimeout = cfg.Server.StopTimeout
+	srv.MaxConnections = cfg.Server.MaxConnections
+	srv.ClientLimits = server.ClientLimits{
+		MinReadRate:  cfg.Server.MinReadRate,
+		MinWriteRate: cfg.Server.MinWriteRate,
+		Grace:        cfg.Server.SlowClientGrace,
+		MaxPerIP:     cfg.Server.MaxConnectionsPerIP,
+	}
+	srv.Logger = logger
+	for _, task := range tasks {
+		srv.Go(task)
 	}
 
-	log.Printf("Server running on: %s", addr)
+	logger.Info("Server running", "addr", addr)
 
 	if err := srv.ListenAndServe(); err != nil {
-		log.Fatal(err)
+		fatal("Server Failed", err)
 	}
 }
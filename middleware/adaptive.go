@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AdaptiveOptions configure AdaptiveConcurrency. Zero values pick the
+// defaults.
+type AdaptiveOptions struct {
+	// InitialLimit is the limit before any latency is observed, 20 by
+	// default, clamped to the bounds. The limit then moves between MinLimit
+	// (1) and MaxLimit (1000).
+	InitialLimit int
+	MinLimit     int
+	MaxLimit     int
+	// Tolerance is how much the recent latency may exceed the long-term
+	// latency before the limit shrinks, 1.5 by default.
+	Tolerance float64
+	// Smoothing is the weight of each adjustment, 0.2 by default.
+	Smoothing float64
+	// Window is how often the limit is adjusted, one second by default.
+	Window time.Duration
+}
+
+// AdaptiveConcurrency limits the requests served at once by the wrapped
+// handler like Concurrency, but adjusts the limit to the latency it
+// observes, following Netflix's gradient algorithm: while recent latency
+// stays near the long-term average the limit grows, and once requests start
+// queueing downstream and latency rises it shrinks. Requests beyond the
+// limit are rejected with 503 Service Unavailable.
+func AdaptiveConcurrency(opts AdaptiveOptions) func(http.Handler) http.Handler {
+	l := newGradientLimiter(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if !l.acquire() {
+				unavailable(rw, r)
+				return
+			}
+			start := time.Now()
+			defer func() { l.release(time.Since(start)) }()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+type gradientLimiter struct {
+	opts AdaptiveOptions
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+
+	longRTT     float64
+	windowStart time.Time
+	windowSum   float64
+	windowCount int
+}
+
+func newGradientLimiter(opts AdaptiveOptions) *gradientLimiter {
+	if opts.InitialLimit <= 0 {
+		opts.InitialLimit = 20
+	}
+	if opts.MinLimit <= 0 {
+		opts.MinLimit = 1
+	}
+	if opts.MaxLimit <= 0 {
+		opts.MaxLimit = 1000
+	}
+	if opts.Tolerance <= 0 {
+		opts.Tolerance = 1.5
+	}
+	if opts.Smoothing <= 0 || opts.Smoothing > 1 {
+		opts.Smoothing = 0.2
+	}
+	if opts.Window <= 0 {
+		opts.Window = time.Second
+	}
+	// The bounds win, so a MaxLimit below the default InitialLimit holds
+	// from the first request.
+	opts.MinLimit = min(opts.MinLimit, opts.MaxLimit)
+	opts.InitialLimit = max(opts.MinLimit, min(opts.InitialLimit, opts.MaxLimit))
+	return &gradientLimiter{opts: opts, limit: float64(opts.InitialLimit), windowStart: time.Now()}
+}
+
+func (l *gradientLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if float64(l.inflight) >= math.Floor(l.limit) {
+		return false
+	}
+	l.inflight++
+	return true
+}
+
+func (l *gradientLimiter) release(rtt time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inflight--
+	l.windowSum += float64(rtt)
+	l.windowCount++
+	if time.Since(l.windowStart) >= l.opts.Window {
+		l.adjust()
+	}
+}
+
+// adjust moves the limit by the gradient between the long-term and the
+// recent latency. l.mu must be held.
+func (l *gradientLimiter) adjust() {
+	shortRTT := l.windowSum / float64(l.windowCount)
+	l.windowStart, l.windowSum, l.windowCount = time.Now(), 0, 0
+
+	if l.longRTT == 0 {
+		l.longRTT = shortRTT
+		return
+	}
+	// The long-term latency drops quickly but rises very slowly, over
+	// minutes, so that sustained overload is not mistaken for a new normal
+	// while a genuinely slower backend is eventually accepted.
+	if shortRTT < l.longRTT {
+		l.longRTT = l.longRTT*0.9 + shortRTT*0.1
+	} else {
+		l.longRTT = l.longRTT*0.998 + shortRTT*0.002
+	}
+
+	gradient := math.Max(0.5, math.Min(1, l.opts.Tolerance*l.longRTT/shortRTT))
+	// The square root headroom lets the limit probe upwards while latency
+	// holds.
+	target := l.limit*gradient + math.Sqrt(l.limit)
+	l.limit = l.limit*(1-l.opts.Smoothing) + target*l.opts.Smoothing
+	l.limit = math.Max(float64(l.opts.MinLimit), math.Min(float64(l.opts.MaxLimit), l.limit))
+}
@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Priority orders requests waiting for admission: when a slot frees up
+// higher priorities are served first, and when the queue is full the lowest
+// priority waiter is shed to make room.
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+
+	priorities = 3
+)
+
+func ParsePriority(s string) (Priority, bool) {
+	switch strings.ToLower(s) {
+	case "low":
+		return PriorityLow, true
+	case "normal", "":
+		return PriorityNormal, true
+	case "high":
+		return PriorityHigh, true
+	}
+	return PriorityNormal, false
+}
+
+// Admission bounds the requests served at once across everything it wraps,
+// queueing up to queue more for at most timeout. Requests that cannot be
+// queued are shed with 503 Service Unavailable and a Retry-After header, so
+// latency stays bounded under overload instead of growing with the backlog.
+type Admission struct {
+	limit      int
+	queue      int
+	timeout    time.Duration
+	retryAfter time.Duration
+
+	mu      sync.Mutex
+	active  int
+	waiting int
+	waiters [priorities]list.List
+}
+
+// NewAdmission returns an admission controller. A timeout of zero waits
+// until the client goes away; retryAfter is rounded up to whole seconds.
+func NewAdmission(limit, queue int, timeout, retryAfter time.Duration) *Admission {
+	return &Admission{limit: limit, queue: queue, timeout: timeout, retryAfter: retryAfter}
+}
+
+// Middleware admits requests, ranking them with classify. A nil classify
+// treats every request as PriorityNormal.
+func (a *Admission) Middleware(classify func(*http.Request) Priority) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			priority := PriorityNormal
+			if classify != nil {
+				priority = classify(r)
+			}
+			if !a.acquire(r, priority) {
+				a.shed(rw, r)
+				return
+			}
+			defer a.release()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// PriorityByPrefix classifies requests by the longest matching path prefix.
+func PriorityByPrefix(prefixes map[string]Priority, fallback Priority) func(*http.Request) Priority {
+	return func(r *http.Request) Priority {
+		best, priority := -1, fallback
+		for prefix, p := range prefixes {
+			trimmed := strings.TrimSuffix(prefix, "/")
+			if len(trimmed) > best && (r.URL.Path == trimmed || trimmed == "" || strings.HasPrefix(r.URL.Path, trimmed+"/")) {
+				best, priority = len(trimmed), p
+			}
+		}
+		return priority
+	}
+}
+
+// waiter is granted a slot with true, or shed with false.
+type waiter chan bool
+
+func (a *Admission) acquire(r *http.Request, priority Priority) bool {
+	a.mu.Lock()
+	if a.active < a.limit {
+		a.active++
+		a.mu.Unlock()
+		return true
+	}
+	if a.waiting >= a.queue && !a.evictBelow(priority) {
+		a.mu.Unlock()
+		return false
+	}
+	w := make(waiter, 1)
+	elem := a.waiters[priority].PushBack(w)
+	a.waiting++
+	a.mu.Unlock()
+
+	var expired <-chan time.Time
+	if a.timeout > 0 {
+		timer := time.NewTimer(a.timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case granted := <-w:
+		return granted
+	case <-expired:
+	case <-r.Context().Done():
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case granted := <-w:
+		// Granted or shed while giving up: a granted slot must be returned.
+		if granted {
+			a.handOff()
+		}
+		return false
+	default:
+		a.waiters[priority].Remove(elem)
+		a.waiting--
+		return false
+	}
+}
+
+// evictBelow sheds the most recent waiter with a priority lower than p,
+// reporting whether there was one. a.mu must be held.
+func (a *Admission) evictBelow(p Priority) bool {
+	for q := PriorityLow; q < p; q++ {
+		if back := a.waiters[q].Back(); back != nil {
+			a.waiters[q].Remove(back)
+			a.waiting--
+			back.Value.(waiter) <- false
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Admission) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.handOff()
+}
+
+// handOff gives a freed slot to the longest waiting request of the highest
+// priority, or returns it. a.mu must be held.
+func (a *Admission) handOff() {
+	for p := PriorityHigh; p >= PriorityLow; p-- {
+		if front := a.waiters[p].Front(); front != nil {
+			a.waiters[p].Remove(front)
+			a.waiting--
+			front.Value.(waiter) <- true
+			return
+		}
+	}
+	a.active--
+}
+
+func (a *Admission) shed(rw http.ResponseWriter, r *http.Request) {
+	if a.retryAfter > 0 {
+		secs := int((a.retryAfter + time.Second - 1) / time.Second)
+		rw.Header().Set("Retry-After", strconv.Itoa(secs))
+	}
+	unavailable(rw, r)
+}
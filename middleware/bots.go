@@ -0,0 +1,389 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"net"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// Agent is the class a BotFilter puts a client in.
+type Agent int
+
+const (
+	AgentHuman Agent = iota
+	// AgentAllowed is a bot matching BotOptions.Allow, such as a search
+	// engine crawler, from a verified address, served like a human.
+	AgentAllowed
+	// AgentSuspected looks automated: no user agent, a known scripting
+	// client or none of the headers browsers send.
+	AgentSuspected
+	AgentDenied
+)
+
+func (a Agent) String() string {
+	return [...]string{"human", "allowed", "suspected", "denied"}[a]
+}
+
+// suspectedAgents matches the user agents of crawlers and HTTP libraries.
+var suspectedAgents = regexp.MustCompile(`(?i)bot|crawl|spider|scrap|slurp|curl|wget|httpie|python|go-http-client|java/|okhttp|libwww|headless|phantomjs|axios|node-fetch`)
+
+type BotOptions struct {
+	// Allow and Deny are regular expressions matched against the
+	// User-Agent; Deny wins. Denied clients get 403. Anyone can claim to
+	// be Googlebot, so a client matching Allow is only served as a human
+	// when its address is verified by AllowDomains or AllowNetworks, and is
+	// suspected otherwise.
+	Allow []string
+	Deny  []string
+	// AllowDomains are the domains allowed crawlers' addresses resolve
+	// into, e.g. googlebot.com. The reverse lookup is confirmed by a
+	// forward one, and the verdict cached for an hour.
+	AllowDomains []string
+	// AllowNetworks are addresses or CIDR prefixes allowed crawlers come
+	// from, for those publishing their ranges.
+	AllowNetworks []string
+	// Resolver makes the lookups, net.DefaultResolver by default.
+	Resolver *net.Resolver
+	// Challenge lists path prefixes where suspected bots must run a script
+	// working out a cookie from a seed signed for their address and user
+	// agent before they are served. Elsewhere they are only counted.
+	Challenge []string
+	// Secret signs the challenge cookie; a random one is generated when
+	// empty, so passed challenges do not survive a restart.
+	Secret []byte
+	// ChallengeTTL is how long a passed challenge lasts, 24 hours by
+	// default.
+	ChallengeTTL time.Duration
+}
+
+// BotStats counts requests by Agent, for the share of bot traffic.
+type BotStats struct {
+	Human      int64   `json:"human"`
+	Allowed    int64   `json:"allowed"`
+	Suspected  int64   `json:"suspected"`
+	Denied     int64   `json:"denied"`
+	Challenged int64   `json:"challenged"`
+	BotShare   float64 `json:"bot_share"`
+}
+
+// BotFilter classifies clients by their User-Agent, refusing denied ones and
+// challenging suspected bots on selected routes.
+type BotFilter struct {
+	allow, deny []*regexp.Regexp
+	domains     []string
+	networks    []netip.Prefix
+	resolver    *net.Resolver
+	challenge   []string
+	secret      []byte
+	ttl         time.Duration
+
+	mu       sync.Mutex
+	verdicts map[netip.Addr]verdict
+
+	counts     [4]atomic.Int64
+	challenged atomic.Int64
+}
+
+type verdict struct {
+	verified bool
+	expires  time.Time
+}
+
+func NewBotFilter(opts BotOptions) (*BotFilter, error) {
+	b := &BotFilter{
+		resolver: opts.Resolver,
+		secret:   opts.Secret,
+		ttl:      opts.ChallengeTTL,
+		verdicts: make(map[netip.Addr]verdict),
+	}
+	for _, p := range opts.Allow {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("bots: allow %q: %w", p, err)
+		}
+		b.allow = append(b.allow, re)
+	}
+	for _, p := range opts.Deny {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("bots: deny %q: %w", p, err)
+		}
+		b.deny = append(b.deny, re)
+	}
+	if len(b.allow) > 0 && len(opts.AllowDomains) == 0 && len(opts.AllowNetworks) == 0 {
+		return nil, errors.New("bots: allow needs allow domains or networks to verify crawlers by")
+	}
+	for _, domain := range opts.AllowDomains {
+		b.domains = append(b.domains, strings.ToLower(strings.Trim(domain, ".")))
+	}
+	for _, cidr := range opts.AllowNetworks {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(cidr)
+			if aerr != nil {
+				return nil, fmt.Errorf("bots: allow network %q: %w", cidr, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		b.networks = append(b.networks, prefix.Masked())
+	}
+	if b.resolver == nil {
+		b.resolver = net.DefaultResolver
+	}
+	for _, prefix := range opts.Challenge {
+		b.challenge = append(b.challenge, strings.TrimSuffix(prefix, "/"))
+	}
+	if len(b.secret) == 0 {
+		b.secret = make([]byte, 32)
+		rand.Read(b.secret)
+	}
+	if b.ttl <= 0 {
+		b.ttl = 24 * time.Hour
+	}
+	return b, nil
+}
+
+// Classify returns the class of the client making r, looking up its address
+// when it claims to be an allowed crawler.
+func (b *BotFilter) Classify(r *http.Request) Agent {
+	ua := r.UserAgent()
+	for _, re := range b.deny {
+		if re.MatchString(ua) {
+			return AgentDenied
+		}
+	}
+	for _, re := range b.allow {
+		if re.MatchString(ua) {
+			if b.verified(r) {
+				return AgentAllowed
+			}
+			return AgentSuspected
+		}
+	}
+	if ua == "" || suspectedAgents.MatchString(ua) || r.Header.Get("Accept-Language") == "" {
+		return AgentSuspected
+	}
+	return AgentHuman
+}
+
+func (b *BotFilter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		agent := b.Classify(r)
+		b.counts[agent].Add(1)
+
+		switch {
+		case agent == AgentDenied:
+			http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		case agent == AgentSuspected && b.challenges(r.URL.Path) && !b.passed(r):
+			b.challenged.Add(1)
+			b.serveChallenge(rw, r)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func (b *BotFilter) challenges(path string) bool {
+	for _, prefix := range b.challenge {
+		if prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// verified reports whether the client's address is in AllowNetworks, or
+// resolves to a name in AllowDomains that resolves back to it.
+func (b *BotFilter) verified(r *http.Request) bool {
+	addr := router.ClientIP(r)
+	if !addr.IsValid() {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range b.networks {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	if len(b.domains) == 0 {
+		return false
+	}
+
+	b.mu.Lock()
+	v, ok := b.verdicts[addr]
+	b.mu.Unlock()
+	if ok && time.Now().Before(v.expires) {
+		return v.verified
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	verified := b.lookup(ctx, addr)
+	if ctx.Err() != nil && !verified {
+		// The lookup was cut short, which says nothing about the address.
+		return false
+	}
+
+	b.mu.Lock()
+	// Clients claiming to be crawlers from many addresses must not grow
+	// the cache without bound.
+	if len(b.verdicts) >= 10000 {
+		clear(b.verdicts)
+	}
+	b.verdicts[addr] = verdict{verified: verified, expires: time.Now().Add(time.Hour)}
+	b.mu.Unlock()
+	return verified
+}
+
+func (b *BotFilter) lookup(ctx context.Context, addr netip.Addr) bool {
+	names, err := b.resolver.LookupAddr(ctx, addr.String())
+	if err != nil {
+		return false
+	}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		if !b.inDomains(name) {
+			continue
+		}
+		addrs, err := b.resolver.LookupNetIP(ctx, "ip", name)
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if a.Unmap() == addr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (b *BotFilter) inDomains(name string) bool {
+	for _, domain := range b.domains {
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+const challengeCookie = "__bot_challenge"
+
+// challengeBits is the work a challenge takes: the cookie's FNV-1a hash
+// must start with as many zero bits, some 65,000 attempts on average,
+// which a browser does in a blink but a scraper must run a script for.
+const challengeBits = 16
+
+// seed signs the client address, user agent and the time the challenge
+// expires, so a cookie cannot be handed to other clients or replayed
+// forever.
+func (b *BotFilter) seed(r *http.Request, expires int64) string {
+	mac := hmac.New(sha256.New, b.secret)
+	fmt.Fprintf(mac, "%d|%s|%s", expires, router.ClientIP(r), r.UserAgent())
+	return fmt.Sprintf("%d.%s", expires, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// passed checks the cookie holds a seed signed for the client followed by
+// a nonce doing the work.
+func (b *BotFilter) passed(r *http.Request) bool {
+	c, err := r.Cookie(challengeCookie)
+	if err != nil {
+		return false
+	}
+	i := strings.LastIndexByte(c.Value, '.')
+	if i < 0 {
+		return false
+	}
+	seed, nonce := c.Value[:i], c.Value[i+1:]
+	expires, err := strconv.ParseInt(seed[:max(strings.IndexByte(seed, '.'), 0)], 10, 64)
+	if err != nil || expires < time.Now().Unix() || !hmac.Equal([]byte(seed), []byte(b.seed(r, expires))) {
+		return false
+	}
+	if _, err := strconv.ParseUint(nonce, 10, 32); err != nil {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(c.Value))
+	return h.Sum32()>>(32-challengeBits) == 0
+}
+
+// challengePage searches for the nonce; its hash is FNV-1a over the
+// cookie's ASCII characters, as in passed.
+var challengePage = template.Must(template.New("challenge").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><title>Checking your browser</title></head>
+<body><noscript>Please enable JavaScript to continue.</noscript>
+<script>
+(function () {
+  var seed = {{.Seed}}, bits = {{.Bits}}, value;
+  for (var n = 0; ; n++) {
+    var h = 0x811c9dc5;
+    value = seed + "." + n;
+    for (var i = 0; i < value.length; i++) {
+      h = Math.imul(h ^ value.charCodeAt(i), 0x01000193);
+    }
+    if ((h >>> 0) >>> (32 - bits) === 0) break;
+  }
+  document.cookie = {{.Name}} + "=" + value + "; path=/; max-age=" + {{.MaxAge}} + "; samesite=lax";
+  location.reload();
+})();
+</script>
+</body></html>
+`))
+
+// serveChallenge answers with a page whose script works out the cookie and
+// reloads, which clients that do not run scripts never get past. Requests
+// other than GET cannot be reloaded and are refused.
+func (b *BotFilter) serveChallenge(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Cache-Control", "no-store")
+	if r.Method != http.MethodGet {
+		http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	expires := time.Now().Add(b.ttl).Unix()
+
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(http.StatusForbidden)
+	challengePage.Execute(rw, struct {
+		Seed, Name   string
+		Bits, MaxAge int
+	}{b.seed(r, expires), challengeCookie, challengeBits, int(b.ttl.Seconds())})
+}
+
+func (b *BotFilter) Stats() BotStats {
+	s := BotStats{
+		Human:      b.counts[AgentHuman].Load(),
+		Allowed:    b.counts[AgentAllowed].Load(),
+		Suspected:  b.counts[AgentSuspected].Load(),
+		Denied:     b.counts[AgentDenied].Load(),
+		Challenged: b.challenged.Load(),
+	}
+	if total := s.Human + s.Allowed + s.Suspected + s.Denied; total > 0 {
+		s.BotShare = float64(s.Allowed+s.Suspected+s.Denied) / float64(total)
+	}
+	return s
+}
+
+// ServeHTTP serves Stats as JSON for an admin route.
+func (b *BotFilter) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(b.Stats())
+}
@@ -0,0 +1,239 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// BufferedWriter holds a response back so middleware can inspect and rewrite
+// it before it is sent. Once the body grows past the limit, or the handler
+// flushes, it gives up and streams the rest unmodified, so large downloads
+// and event streams are never held in memory.
+type BufferedWriter struct {
+	*recorder
+	rw        http.ResponseWriter
+	limit     int
+	streaming bool
+}
+
+// NewBufferedWriter buffers up to limit bytes of body; limit <= 0 means 1 MB.
+// The middleware must call Send once the handler returns.
+func NewBufferedWriter(rw http.ResponseWriter, limit int) *BufferedWriter {
+	if limit <= 0 {
+		limit = 1 << 20
+	}
+	return &BufferedWriter{recorder: newRecorder(), rw: rw, limit: limit}
+}
+
+func (w *BufferedWriter) Header() http.Header {
+	if w.streaming {
+		return w.rw.Header()
+	}
+	return w.header
+}
+
+func (w *BufferedWriter) WriteHeader(status int) {
+	switch {
+	case w.streaming:
+		w.rw.WriteHeader(status)
+	case status < 200:
+		// Informational responses such as early hints are not held back.
+		copyHeader(w.rw.Header(), w.header)
+		w.rw.WriteHeader(status)
+	default:
+		w.recorder.WriteHeader(status)
+	}
+}
+
+func (w *BufferedWriter) Write(b []byte) (int, error) {
+	if w.streaming {
+		return w.rw.Write(b)
+	}
+	if w.body.Len()+len(b) > w.limit {
+		w.stream()
+		return w.rw.Write(b)
+	}
+	return w.recorder.Write(b)
+}
+
+// Flush switches to streaming: a handler flushing wants its output sent now.
+func (w *BufferedWriter) Flush() {
+	if !w.streaming {
+		w.stream()
+	}
+	if f, ok := w.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *BufferedWriter) Unwrap() http.ResponseWriter {
+	return w.rw
+}
+
+// stream sends the buffered response as it is and passes the rest through.
+func (w *BufferedWriter) stream() {
+	w.streaming = true
+	w.replay(w.rw)
+	w.body.Reset()
+}
+
+// Buffered reports whether the whole response is still held back and can be
+// modified with SetBody. It is false once the writer fell back to streaming.
+func (w *BufferedWriter) Buffered() bool {
+	return !w.streaming
+}
+
+// Status is the status written by the handler, 200 if none.
+func (w *BufferedWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Body returns the buffered body. Its bytes are only valid until SetBody.
+func (w *BufferedWriter) Body() []byte {
+	return w.body.Bytes()
+}
+
+// SetBody replaces the buffered body, and the status when status is not 0.
+// The Content-Length header is corrected when Send writes the response.
+func (w *BufferedWriter) SetBody(status int, body []byte) {
+	if w.streaming {
+		return
+	}
+	if status != 0 {
+		w.status = status
+	}
+	w.body.Reset()
+	w.body.Write(body)
+}
+
+// Send writes the buffered response. It does nothing once streaming.
+func (w *BufferedWriter) Send() {
+	if w.streaming {
+		return
+	}
+	w.streaming = true
+	if w.status == 0 && w.body.Len() == 0 && len(w.header) == 0 {
+		return
+	}
+	if w.header.Get("Content-Length") != "" {
+		w.header.Set("Content-Length", strconv.Itoa(w.body.Len()))
+	}
+	w.replay(w.rw)
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, v := range src {
+		dst[k] = append([]string(nil), v...)
+	}
+}
+
+// ResponseRewriter returns the new body of a buffered response, or body
+// itself to leave it unchanged. header may be modified.
+type ResponseRewriter func(header http.Header, status int, body []byte) []byte
+
+// Intercept runs fn on responses of at most limit bytes, e.g. to inject a
+// script into HTML pages or redact JSON fields. Larger and flushed responses
+// stream out untouched. Bodies with a Content-Encoding are passed to fn
+// encoded; Intercept goes inside Compressor so it sees them plain.
+func Intercept(limit int, fn ResponseRewriter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			w := NewBufferedWriter(rw, limit)
+			next.ServeHTTP(w, r)
+			if w.Buffered() && r.Method != http.MethodHead {
+				w.SetBody(0, fn(w.Header(), w.Status(), w.Body()))
+			}
+			w.Send()
+		})
+	}
+}
+
+func mediaType(h http.Header) string {
+	t, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return t
+}
+
+// InjectHTML inserts snippet before the closing </body> tag of HTML
+// responses, e.g. an analytics or live-reload script.
+func InjectHTML(snippet string) ResponseRewriter {
+	return func(h http.Header, status int, body []byte) []byte {
+		if mediaType(h) != "text/html" || h.Get("Content-Encoding") != "" {
+			return body
+		}
+		i := bytes.LastIndex(bytes.ToLower(body), []byte("</body>"))
+		if i < 0 {
+			return body
+		}
+		out := make([]byte, 0, len(body)+len(snippet))
+		out = append(out, body[:i]...)
+		out = append(out, snippet...)
+		return append(out, body[i:]...)
+	}
+}
+
+// RedactJSON replaces the values of the named fields, at any depth of JSON
+// responses, with "[redacted]".
+func RedactJSON(fields ...string) ResponseRewriter {
+	redact := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		redact[f] = true
+	}
+	var walk func(v any) any
+	walk = func(v any) any {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, child := range v {
+				if redact[k] {
+					v[k] = "[redacted]"
+				} else {
+					v[k] = walk(child)
+				}
+			}
+		case []any:
+			for i, child := range v {
+				v[i] = walk(child)
+			}
+		}
+		return v
+	}
+
+	return func(h http.Header, status int, body []byte) []byte {
+		t := mediaType(h)
+		if (t != "application/json" && t != "application/problem+json") || h.Get("Content-Encoding") != "" {
+			return body
+		}
+		// Numbers stay as written, where float64 would round large IDs,
+		// and so do the <, > and & json.Marshal would escape. Bodies of
+		// several values, such as newline-delimited JSON, are redacted
+		// value by value.
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var out bytes.Buffer
+		enc := json.NewEncoder(&out)
+		enc.SetEscapeHTML(false)
+		for {
+			var v any
+			err := dec.Decode(&v)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return body
+			}
+			if err := enc.Encode(walk(v)); err != nil {
+				return body
+			}
+		}
+		if out.Len() == 0 {
+			return body
+		}
+		return bytes.TrimSuffix(out.Bytes(), []byte("\n"))
+	}
+}
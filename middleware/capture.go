@@ -0,0 +1,314 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+var (
+	defaultRedactHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization", "X-Api-Key"}
+	defaultRedactFields  = []string{"password", "secret", "token", "access_token", "refresh_token", "client_secret", "api_key"}
+)
+
+const redacted = "[redacted]"
+
+// CaptureOptions configure a BodyCapture. Zero values pick the defaults.
+type CaptureOptions struct {
+	// MaxBody is how many bytes of each body are kept, 4 KB by default.
+	MaxBody int
+	// Size is how many requests are kept, 100 by default.
+	Size int
+	// RedactHeaders and RedactFields are added to the headers (Authorization,
+	// Cookie, ...) and fields (password, token, ...) always redacted. Fields
+	// match case-insensitively, at any depth in JSON bodies and by name in
+	// form-encoded ones.
+	RedactHeaders []string
+	RedactFields  []string
+	// Log also logs every capture through the request's logger.
+	Log bool
+	// Exclude lists path prefixes that are not captured, such as the
+	// endpoint serving the captures.
+	Exclude []string
+}
+
+// Capture is one recorded exchange.
+type Capture struct {
+	ID                string        `json:"id"`
+	Time              time.Time     `json:"time"`
+	Method            string        `json:"method"`
+	URL               string        `json:"url"`
+	RequestHeader     http.Header   `json:"request_header"`
+	RequestBody       string        `json:"request_body,omitempty"`
+	RequestTruncated  bool          `json:"request_truncated,omitempty"`
+	Status            int           `json:"status"`
+	ResponseHeader    http.Header   `json:"response_header"`
+	ResponseBody      string        `json:"response_body,omitempty"`
+	ResponseTruncated bool          `json:"response_truncated,omitempty"`
+	Duration          time.Duration `json:"duration"`
+}
+
+// BodyCapture records truncated, redacted request and response bodies for
+// debugging. It is meant to be enabled temporarily: bodies are only seen as
+// far as the handler reads them, and everything is held in memory.
+type BodyCapture struct {
+	maxBody int
+	headers map[string]bool
+	fields  map[string]bool
+	field   *regexp.Regexp
+	form    *regexp.Regexp
+	log     bool
+	exclude []string
+
+	mu      sync.Mutex
+	entries []Capture
+	next    int
+	full    bool
+}
+
+func NewBodyCapture(opts CaptureOptions) *BodyCapture {
+	if opts.MaxBody <= 0 {
+		opts.MaxBody = 4 << 10
+	}
+	if opts.Size <= 0 {
+		opts.Size = 100
+	}
+
+	c := &BodyCapture{
+		maxBody: opts.MaxBody,
+		headers: make(map[string]bool),
+		fields:  make(map[string]bool),
+		log:     opts.Log,
+		exclude: opts.Exclude,
+		entries: make([]Capture, opts.Size),
+	}
+	for _, h := range append(defaultRedactHeaders, opts.RedactHeaders...) {
+		c.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	var names []string
+	for _, f := range append(defaultRedactFields, opts.RedactFields...) {
+		c.fields[strings.ToLower(f)] = true
+		names = append(names, regexp.QuoteMeta(f))
+	}
+	// Truncated bodies cannot be parsed, so their fields are redacted
+	// textually.
+	c.field = regexp.MustCompile(`(?i)("(?:` + strings.Join(names, "|") + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`)
+	c.form = regexp.MustCompile(`(?i)((?:^|&)(?:` + strings.Join(names, "|") + `)=)[^&]*`)
+	return c
+}
+
+func (c *BodyCapture) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		for _, prefix := range c.exclude {
+			if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, strings.TrimSuffix(prefix, "/")+"/") {
+				next.ServeHTTP(rw, r)
+				return
+			}
+		}
+
+		start := time.Now()
+		in := &teeBody{ReadCloser: r.Body, limit: c.maxBody}
+		if r.Body != nil {
+			r.Body = in
+		}
+		out := &teeWriter{ResponseWriter: rw, limit: c.maxBody}
+
+		next.ServeHTTP(out, r)
+
+		status := out.status
+		if router.ClientGone(r) {
+			status = router.StatusClientClosedRequest
+		} else if status == 0 {
+			status = http.StatusOK
+		}
+		capture := Capture{
+			ID:                router.RequestID(r),
+			Time:              start,
+			Method:            r.Method,
+			URL:               r.URL.String(),
+			RequestHeader:     c.redactHeader(r.Header),
+			RequestBody:       c.redactBody(r.Header, in.buf.Bytes(), in.truncated),
+			RequestTruncated:  in.truncated,
+			Status:            status,
+			ResponseHeader:    c.redactHeader(rw.Header()),
+			ResponseBody:      c.redactBody(rw.Header(), out.buf.Bytes(), out.truncated),
+			ResponseTruncated: out.truncated,
+			Duration:          time.Since(start),
+		}
+		c.add(capture)
+
+		if c.log {
+			router.Logger(r).Debug("capture",
+				"status", status,
+				"request_body", capture.RequestBody,
+				"response_body", capture.ResponseBody,
+			)
+		}
+	})
+}
+
+// Recent returns the captured exchanges, newest first.
+func (c *BodyCapture) Recent() []Capture {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := c.next
+	if c.full {
+		n = len(c.entries)
+	}
+	out := make([]Capture, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, c.entries[(c.next-i+len(c.entries))%len(c.entries)])
+	}
+	return out
+}
+
+// ServeHTTP serves Recent as JSON, for mounting on an admin route.
+func (c *BodyCapture) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(c.Recent())
+}
+
+func (c *BodyCapture) add(capture Capture) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[c.next] = capture
+	c.next = (c.next + 1) % len(c.entries)
+	if c.next == 0 {
+		c.full = true
+	}
+}
+
+func (c *BodyCapture) redactHeader(h http.Header) http.Header {
+	out := h.Clone()
+	for k := range out {
+		if c.headers[k] {
+			out[k] = []string{redacted}
+		}
+	}
+	return out
+}
+
+func (c *BodyCapture) redactBody(h http.Header, body []byte, truncated bool) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" {
+		return c.redactForm(body, truncated)
+	}
+	if !strings.Contains(h.Get("Content-Type"), "json") {
+		return string(body)
+	}
+	if !truncated {
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err == nil {
+			if out, err := json.Marshal(c.redactValue(v)); err == nil {
+				return string(out)
+			}
+		}
+	}
+	return c.field.ReplaceAllString(string(body), `${1}"`+redacted+`"`)
+}
+
+func (c *BodyCapture) redactForm(body []byte, truncated bool) string {
+	if !truncated {
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			for k := range form {
+				if c.fields[strings.ToLower(k)] {
+					form[k] = []string{redacted}
+				}
+			}
+			return form.Encode()
+		}
+	}
+	return c.form.ReplaceAllString(string(body), "${1}"+url.QueryEscape(redacted))
+}
+
+func (c *BodyCapture) redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if c.fields[strings.ToLower(k)] {
+				v[k] = redacted
+				continue
+			}
+			v[k] = c.redactValue(field)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = c.redactValue(v[i])
+		}
+	}
+	return v
+}
+
+// teeBody keeps the first limit bytes read from a request body.
+type teeBody struct {
+	io.ReadCloser
+	limit     int
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	t.keep(p[:n])
+	return n, err
+}
+
+func (t *teeBody) keep(b []byte) {
+	if room := t.limit - t.buf.Len(); len(b) > room {
+		b = b[:room]
+		t.truncated = true
+	}
+	t.buf.Write(b)
+}
+
+// teeWriter keeps the status and first limit bytes of a response.
+type teeWriter struct {
+	http.ResponseWriter
+	limit     int
+	status    int
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (w *teeWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *teeWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	kept := b
+	if room := w.limit - w.buf.Len(); len(kept) > room {
+		kept = kept[:room]
+		w.truncated = true
+	}
+	w.buf.Write(kept)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *teeWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *teeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
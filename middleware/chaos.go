@@ -0,0 +1,233 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Fault is what Chaos injects into a fraction of the requests below Path.
+// Latency applies first; then at most one of Reset, Status and Truncate, in
+// that order.
+type Fault struct {
+	// Path is a path prefix, "/" for every request.
+	Path string `json:"path" mapstructure:"path"`
+	// Methods restricts the fault to these methods; empty is all.
+	Methods []string `json:"methods,omitempty" mapstructure:"methods"`
+	// Rate is the fraction of matching requests affected, from 0 to 1.
+	Rate float64 `json:"rate" mapstructure:"rate"`
+
+	// Latency delays the request, plus a random part of up to Jitter.
+	Latency time.Duration `json:"latency,omitempty" mapstructure:"latency"`
+	Jitter  time.Duration `json:"jitter,omitempty" mapstructure:"jitter"`
+	// Reset closes the connection without a response.
+	Reset bool `json:"reset,omitempty" mapstructure:"reset"`
+	// Status answers with this error status instead of serving.
+	Status int `json:"status,omitempty" mapstructure:"status"`
+	// Truncate aborts the response after this many body bytes.
+	Truncate int `json:"truncate,omitempty" mapstructure:"truncate"`
+}
+
+// ChaosState is what Chaos serves and accepts on its admin endpoint.
+type ChaosState struct {
+	Enabled  bool             `json:"enabled"`
+	Faults   []Fault          `json:"faults"`
+	Injected map[string]int64 `json:"injected,omitempty"`
+}
+
+// Chaos injects latency, errors, truncated responses and connection resets,
+// to test how clients and upstreams cope. Nothing is injected until it is
+// enabled, and never below the excluded prefixes, so the endpoint turning
+// it off stays reachable.
+type Chaos struct {
+	exclude []string
+	enabled atomic.Bool
+	faults  atomic.Pointer[[]Fault]
+
+	mu       sync.Mutex
+	injected map[string]int64
+}
+
+func NewChaos(exclude ...string) *Chaos {
+	c := &Chaos{exclude: exclude, injected: make(map[string]int64)}
+	c.faults.Store(&[]Fault{})
+	return c
+}
+
+// Enable turns injection on or off. It is safe to call while serving
+// requests.
+func (c *Chaos) Enable(on bool) {
+	c.enabled.Store(on)
+}
+
+// SetFaults replaces the faults, the first matching a request applying. It
+// is safe to call while serving requests.
+func (c *Chaos) SetFaults(faults []Fault) error {
+	for i, f := range faults {
+		if !strings.HasPrefix(f.Path, "/") {
+			return fmt.Errorf("chaos: fault %d: path %q must start with /", i, f.Path)
+		}
+		if f.Rate < 0 || f.Rate > 1 {
+			return fmt.Errorf("chaos: fault %d: rate must be between 0 and 1, got %v", i, f.Rate)
+		}
+		if f.Status != 0 && (f.Status < 400 || f.Status > 599) {
+			return fmt.Errorf("chaos: fault %d: status must be between 400 and 599, got %d", i, f.Status)
+		}
+		if f.Latency < 0 || f.Jitter < 0 || f.Truncate < 0 {
+			return fmt.Errorf("chaos: fault %d: latency, jitter and truncate cannot be negative", i)
+		}
+	}
+	faults = slices.Clone(faults)
+	c.faults.Store(&faults)
+	return nil
+}
+
+func (c *Chaos) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		f := c.pick(r)
+		if f == nil {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		if delay := f.Latency + jitter(f.Jitter); delay > 0 {
+			c.inject(rw, "latency")
+			t := time.NewTimer(delay)
+			select {
+			case <-t.C:
+			case <-r.Context().Done():
+				t.Stop()
+				return
+			}
+		}
+		switch {
+		case f.Reset:
+			c.inject(rw, "reset")
+			reset(rw)
+		case f.Status != 0:
+			c.inject(rw, "status")
+			http.Error(rw, http.StatusText(f.Status), f.Status)
+		case f.Truncate > 0:
+			c.inject(rw, "truncate")
+			next.ServeHTTP(&truncatingWriter{ResponseWriter: rw, left: f.Truncate}, r)
+		default:
+			next.ServeHTTP(rw, r)
+		}
+	})
+}
+
+// pick returns the fault to inject into r, or nil.
+func (c *Chaos) pick(r *http.Request) *Fault {
+	if !c.enabled.Load() {
+		return nil
+	}
+	for _, prefix := range c.exclude {
+		if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, strings.TrimSuffix(prefix, "/")+"/") {
+			return nil
+		}
+	}
+	for _, f := range *c.faults.Load() {
+		prefix := strings.TrimSuffix(f.Path, "/")
+		if r.URL.Path != prefix && !strings.HasPrefix(r.URL.Path, prefix+"/") {
+			continue
+		}
+		if len(f.Methods) > 0 && !slices.ContainsFunc(f.Methods, func(m string) bool { return strings.EqualFold(m, r.Method) }) {
+			continue
+		}
+		if rand.Float64() < f.Rate {
+			return &f
+		}
+		return nil
+	}
+	return nil
+}
+
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return rand.N(max)
+}
+
+// inject counts a fault and names it in the X-Chaos-Fault response header,
+// so test clients can tell injected failures from real ones.
+func (c *Chaos) inject(rw http.ResponseWriter, kind string) {
+	rw.Header().Set("X-Chaos-Fault", kind)
+	c.mu.Lock()
+	c.injected[kind]++
+	c.mu.Unlock()
+}
+
+// reset drops the connection, with an RST where the connection allows it.
+// HTTP/2 streams, which cannot be hijacked, are reset on their own.
+func reset(rw http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(rw).Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// truncatingWriter lets the first left bytes of the body through, then
+// aborts the response so the client sees it cut short.
+type truncatingWriter struct {
+	http.ResponseWriter
+	left int
+}
+
+func (w *truncatingWriter) Write(b []byte) (int, error) {
+	if len(b) <= w.left {
+		w.left -= len(b)
+		return w.ResponseWriter.Write(b)
+	}
+	w.ResponseWriter.Write(b[:w.left])
+	w.left = 0
+	http.NewResponseController(w.ResponseWriter).Flush()
+	panic(http.ErrAbortHandler)
+}
+
+func (w *truncatingWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *truncatingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// ServeHTTP serves the ChaosState on GET and replaces it on PUT; the
+// counters are not reset.
+func (c *Chaos) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		var state ChaosState
+		if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+			http.Error(rw, "invalid chaos state: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := c.SetFaults(state.Faults); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.Enable(state.Enabled)
+	}
+
+	state := ChaosState{Enabled: c.enabled.Load(), Faults: *c.faults.Load()}
+	c.mu.Lock()
+	state.Injected = make(map[string]int64, len(c.injected))
+	for k, v := range c.injected {
+		state.Injected[k] = v
+	}
+	c.mu.Unlock()
+
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(state)
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+type flight struct {
+	done chan struct{}
+	res  *recorder
+	ok   bool
+}
+
+// Coalesce merges identical concurrent GET and HEAD requests into a single
+// call of the wrapped handler and serves its buffered response to every
+// client that was waiting on it. Requests are identical when their method,
+// path, query string and the values of the vary headers match. Responses are
+// buffered in full, so the middleware is not suited to streaming handlers;
+// Upgrade and event-stream requests are passed through uncoalesced.
+//
+// Requests carrying a cookie, an Authorization header or a client
+// certificate are never coalesced, since their responses may be for that
+// client alone, and the waiting clients are not sent the cookies the
+// handler set. The requests are merged across every handler the
+// middleware wraps.
+func Coalesce(vary ...string) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+	flights := make(map[string]*flight)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if (r.Method != http.MethodGet && r.Method != http.MethodHead) || streaming(r) || credentialed(r) {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			key := coalesceKey(r, vary)
+
+			mu.Lock()
+			if f, ok := flights[key]; ok {
+				mu.Unlock()
+				select {
+				case <-f.done:
+				case <-r.Context().Done():
+					return
+				}
+				if !f.ok {
+					next.ServeHTTP(rw, r)
+					return
+				}
+				f.res.replayShared(rw)
+				return
+			}
+			f := &flight{done: make(chan struct{}), res: newRecorder()}
+			flights[key] = f
+			mu.Unlock()
+
+			defer func() {
+				mu.Lock()
+				delete(flights, key)
+				mu.Unlock()
+				close(f.done)
+			}()
+
+			next.ServeHTTP(f.res, r)
+			// A response cut short by the leader's client leaving is not
+			// shared; the waiting clients call the handler themselves.
+			f.ok = !router.ClientGone(r)
+			f.res.replay(rw)
+		})
+	}
+}
+
+func coalesceKey(r *http.Request, vary []string) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte(' ')
+	b.WriteString(r.Host)
+	b.WriteString(r.URL.Path)
+	b.WriteByte('?')
+	b.WriteString(r.URL.RawQuery)
+	for _, h := range vary {
+		b.WriteByte('\n')
+		b.WriteString(strings.Join(r.Header.Values(h), ","))
+	}
+	return b.String()
+}
+
+func credentialed(r *http.Request) bool {
+	for _, h := range []string{"Authorization", "Proxy-Authorization", "Cookie"} {
+		if r.Header.Get(h) != "" {
+			return true
+		}
+	}
+	return r.TLS != nil && len(r.TLS.PeerCertificates) > 0
+}
+
+func streaming(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != "" || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// coalesced sends n concurrent requests made by request through h, a
+// handler blocked until they have all had time to arrive, and returns the
+// responses.
+func coalesced(t *testing.T, h http.Handler, release chan struct{}, request func(i int) *http.Request, n int) []*httptest.ResponseRecorder {
+	t.Helper()
+	recs := make([]*httptest.ResponseRecorder, n)
+	var wg sync.WaitGroup
+	for i := range recs {
+		recs[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.ServeHTTP(recs[i], request(i))
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	return recs
+}
+
+func TestCoalesce(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		header func(i int) (string, string)
+		calls  int32
+	}{
+		{"anonymous", func(int) (string, string) { return "Accept", "*/*" }, 1},
+		{"cookies", func(i int) (string, string) { return "Cookie", "session=" + string(rune('a'+i)) }, 5},
+		{"same cookie", func(int) (string, string) { return "Cookie", "session=a" }, 5},
+		{"bearer tokens", func(i int) (string, string) { return "Authorization", "Bearer " + string(rune('a'+i)) }, 5},
+	} {
+		var calls atomic.Int32
+		release := make(chan struct{})
+		h := Coalesce()(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			<-release
+			http.SetCookie(rw, &http.Cookie{Name: "session", Value: "for-" + r.Header.Get("Cookie")})
+			io.WriteString(rw, "report for "+r.Header.Get("Cookie")+r.Header.Get("Authorization"))
+		}))
+		recs := coalesced(t, h, release, func(i int) *http.Request {
+			r := httptest.NewRequest("GET", "/report", nil)
+			r.Header.Set(tt.header(i))
+			return r
+		}, 5)
+
+		if n := calls.Load(); n != tt.calls {
+			t.Errorf("%s: handler called %d times for 5 requests, want %d", tt.name, n, tt.calls)
+		}
+		cookies := 0
+		for _, rec := range recs {
+			if rec.Code != http.StatusOK {
+				t.Errorf("%s: status %d", tt.name, rec.Code)
+			}
+			cookies += len(rec.Result().Cookies())
+		}
+		// Only the request the response was made for gets its cookies.
+		if want := int(tt.calls); cookies != want {
+			t.Errorf("%s: %d responses set cookies, want %d", tt.name, cookies, want)
+		}
+	}
+}
+
+func TestCoalesceAcrossHandlers(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	mw := Coalesce()
+	handler := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+	})
+	// Like a group's middleware, wrapping each of its routes, here both
+	// serving the same path.
+	routes := []http.Handler{mw(handler), mw(handler)}
+	mux := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		routes[len(r.Header.Get("X-Route"))%2].ServeHTTP(rw, r)
+	})
+	coalesced(t, mux, release, func(i int) *http.Request {
+		r := httptest.NewRequest("GET", "/a", nil)
+		r.Header.Set("X-Route", strings.Repeat("x", i%2))
+		return r
+	}, 6)
+	if n := calls.Load(); n != 1 {
+		t.Errorf("handler called %d times through two routes, want once", n)
+	}
+}
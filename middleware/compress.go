@@ -0,0 +1,337 @@
+package middleware
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Encoder is a reusable compressor for one Content-Encoding. Reset points it
+// at the next response, so encoders are pooled instead of allocated for
+// every request.
+type Encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// NewEncoder creates an Encoder at a compression level. level is -1 for the
+// encoding's default.
+type NewEncoder func(level int) (Encoder, error)
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[string]NewEncoder{
+		"gzip": func(level int) (Encoder, error) {
+			return gzip.NewWriterLevel(nil, level)
+		},
+		"deflate": func(level int) (Encoder, error) {
+			return flate.NewWriter(nil, level)
+		},
+	}
+)
+
+// RegisterEncoder adds or replaces the encoder of a Content-Encoding. The
+// standard library has no Brotli or Zstandard compressor; they are
+// registered from third-party packages:
+//
+//	middleware.RegisterEncoder("zstd", func(level int) (middleware.Encoder, error) {
+//		if level < 0 {
+//			level = int(zstd.SpeedDefault)
+//		}
+//		return zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevel(level)))
+//	})
+func RegisterEncoder(encoding string, fn NewEncoder) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+
+	encoders[strings.ToLower(encoding)] = fn
+}
+
+// compressibleTypes are the media types worth compressing; images, video
+// and archives are compressed already.
+var compressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"application/xhtml+xml",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+type CompressOptions struct {
+	// Encodings are the offered encodings in order of preference, breaking
+	// ties between equal quality values of the client's Accept-Encoding.
+	// Defaults to gzip then deflate; br and zstd need RegisterEncoder.
+	Encodings []string
+	// Levels sets the compression level of an encoding, e.g. {"gzip": 5}.
+	Levels map[string]int
+	// MinSize is the smallest body compressed, 1 KB by default. Smaller
+	// bodies cost more to compress than they save.
+	MinSize int
+	// Types replaces the compressible media types. An entry ending in "/"
+	// matches a whole type, e.g. "text/".
+	Types []string
+}
+
+// Compressor compresses response bodies in the best encoding the client
+// accepts. Responses already encoded, ranges, bodies under MinSize,
+// incompressible types and "Cache-Control: no-transform" are sent as they
+// are. Flush and trailers keep working, so streamed responses are compressed
+// chunk by chunk.
+type Compressor struct {
+	encodings []string
+	pools     map[string]*sync.Pool
+	minSize   int
+	types     []string
+}
+
+func NewCompressor(opts CompressOptions) (*Compressor, error) {
+	c := &Compressor{
+		encodings: append([]string(nil), opts.Encodings...),
+		pools:     make(map[string]*sync.Pool),
+		minSize:   opts.MinSize,
+		types:     opts.Types,
+	}
+	if len(c.encodings) == 0 {
+		c.encodings = []string{"gzip", "deflate"}
+	}
+	if c.minSize <= 0 {
+		c.minSize = 1 << 10
+	}
+	if len(c.types) == 0 {
+		c.types = compressibleTypes
+	}
+
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+
+	for i, name := range c.encodings {
+		name = strings.ToLower(name)
+		c.encodings[i] = name
+		newEncoder, ok := encoders[name]
+		if !ok {
+			return nil, fmt.Errorf("compress: no encoder registered for %q", name)
+		}
+		level, ok := opts.Levels[name]
+		if !ok {
+			level = -1
+		}
+		// Creating one now reports a bad level at startup, not per request.
+		enc, err := newEncoder(level)
+		if err != nil {
+			return nil, fmt.Errorf("compress: %s level %d: %w", name, level, err)
+		}
+		pool := &sync.Pool{New: func() any {
+			enc, _ := newEncoder(level)
+			return enc
+		}}
+		pool.Put(enc)
+		c.pools[name] = pool
+	}
+	return c, nil
+}
+
+func (c *Compressor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		encoding := c.negotiate(r.Header.Get("Accept-Encoding"))
+		if r.Method == http.MethodHead {
+			encoding = ""
+		}
+		w := &compressWriter{ResponseWriter: rw, c: c, encoding: encoding}
+		defer w.close()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// negotiate picks the offered encoding with the highest quality value in an
+// Accept-Encoding header, or "" for none.
+func (c *Compressor) negotiate(header string) string {
+	if header == "" {
+		return ""
+	}
+	quality := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		quality[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, name := range c.encodings {
+		q, ok := quality[name]
+		if !ok {
+			q, ok = quality["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+func (c *Compressor) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.types {
+		if mediaType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter holds back the status and up to MinSize bytes of body
+// until it knows whether the response is worth compressing.
+type compressWriter struct {
+	http.ResponseWriter
+	c        *Compressor
+	encoding string
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     Encoder
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if code < 200 {
+		// Early hints pass through; after a protocol switch the connection
+		// is no longer HTTP.
+		if code == http.StatusSwitchingProtocols {
+			w.decided = true
+		}
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status != 0 || w.decided {
+		return
+	}
+	w.status = code
+	if code == http.StatusNoContent || code == http.StatusNotModified {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 && !w.decided {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) < w.c.minSize {
+		return len(b), nil
+	}
+	w.decide(false)
+	if err := w.flushBuffer(); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// decide sends the status line and headers, compressing when the body is
+// big enough or being streamed.
+func (w *compressWriter) decide(streamed bool) {
+	w.decided = true
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	if w.status != http.StatusNoContent && w.status != http.StatusNotModified && w.c.compressible(h.Get("Content-Type")) {
+		// Whether or not this client got a compressed body, others will.
+		h.Add("Vary", "Accept-Encoding")
+
+		if w.encoding != "" && (streamed || len(w.buf) >= w.c.minSize) && h.Get("Content-Encoding") == "" &&
+			w.status != http.StatusPartialContent && h.Get("Content-Range") == "" &&
+			!strings.Contains(h.Get("Cache-Control"), "no-transform") {
+			h.Set("Content-Encoding", w.encoding)
+			h.Del("Content-Length")
+			h.Del("Accept-Ranges")
+			if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+				h.Set("ETag", "W/"+etag)
+			}
+			w.enc = w.c.pools[w.encoding].Get().(Encoder)
+			w.enc.Reset(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *compressWriter) flushBuffer() error {
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush sends what is buffered, compressing even a short body, since a
+// streamed response cannot wait for MinSize.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.decide(true)
+		w.flushBuffer()
+	}
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) close() {
+	if !w.decided {
+		if w.status == 0 {
+			if len(w.buf) == 0 {
+				return
+			}
+			w.status = http.StatusOK
+		}
+		w.decide(false)
+		w.flushBuffer()
+	}
+	if w.enc != nil {
+		w.enc.Close()
+		w.enc.Reset(io.Discard)
+		w.c.pools[w.encoding].Put(w.enc)
+		w.enc = nil
+	}
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// ErrOverloaded fails the requests shed by Concurrency, AdaptiveConcurrency
+// and Admission with 503 Service Unavailable.
+var ErrOverloaded = errors.New("server is at capacity")
+
+// Concurrency limits the number of requests served at once by the wrapped
+// handler. Up to queue further requests wait at most timeout for a free slot;
+// anything beyond that is rejected with 503 Service Unavailable. A timeout of
+// zero waits until the client goes away; a limit of zero disables the
+// middleware. The limit is shared by every handler the middleware wraps, so
+// a group's routes share one limit.
+func Concurrency(limit, queue int, timeout time.Duration) func(http.Handler) http.Handler {
+	sem := make(chan struct{}, max(limit, 0))
+	var waiting int64
+
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			select {
+			case sem <- struct{}{}:
+			default:
+				if atomic.AddInt64(&waiting, 1) > int64(queue) {
+					atomic.AddInt64(&waiting, -1)
+					unavailable(rw, r)
+					return
+				}
+				acquired := wait(r, sem, timeout)
+				atomic.AddInt64(&waiting, -1)
+				if !acquired {
+					unavailable(rw, r)
+					return
+				}
+			}
+			defer func() { <-sem }()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+func wait(r *http.Request, sem chan struct{}, timeout time.Duration) bool {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-expired:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func unavailable(rw http.ResponseWriter, r *http.Request) {
+	router.ServeError(rw, r, http.StatusServiceUnavailable, ErrOverloaded)
+}
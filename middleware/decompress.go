@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ritego/build-a-router-with-go/bind"
+)
+
+// ErrDecompressedTooLarge is returned by reads of a decompressed body once
+// it grows past DecompressOptions.MaxSize. It wraps bind.ErrBodyTooLarge, so
+// handlers answer 413.
+var ErrDecompressedTooLarge = fmt.Errorf("decompress: %w", bind.ErrBodyTooLarge)
+
+// Decoder wraps a compressed request body in a reader of its content.
+type Decoder func(io.Reader) (io.ReadCloser, error)
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]Decoder{
+		"gzip": func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		// deflate is zlib-wrapped per RFC 9110, though some clients send raw
+		// deflate streams; both are accepted.
+		"deflate": decodeDeflate,
+	}
+)
+
+// RegisterDecoder adds or replaces the decoder of a Content-Encoding, e.g.
+// "zstd" or "br" from a third-party package:
+//
+//	middleware.RegisterDecoder("zstd", func(r io.Reader) (io.ReadCloser, error) {
+//		d, err := zstd.NewReader(r)
+//		return d.IOReadCloser(), err
+//	})
+func RegisterDecoder(encoding string, d Decoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	decoders[strings.ToLower(encoding)] = d
+}
+
+func decoder(encoding string) (Decoder, bool) {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+
+	if encoding == "x-gzip" {
+		encoding = "gzip"
+	}
+	d, ok := decoders[encoding]
+	return d, ok
+}
+
+// acceptedEncodings lists the registered decoders for the Accept-Encoding
+// header of a 415 response.
+func acceptedEncodings() string {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+
+	names := make([]string, 0, len(decoders))
+	for name := range decoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+type DecompressOptions struct {
+	// MaxSize caps the decompressed body, 10 MB by default, so a small
+	// compressed payload cannot expand into gigabytes.
+	MaxSize int64
+}
+
+// Decompress decodes request bodies sent with a Content-Encoding before
+// handlers read them, removing the header and the now wrong Content-Length.
+// Encodings without a registered decoder are refused with 415 Unsupported
+// Media Type, listing the supported ones in Accept-Encoding.
+func Decompress(opts DecompressOptions) func(http.Handler) http.Handler {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = 10 << 20
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			if encoding == "" || encoding == "identity" || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(rw, r)
+				return
+			}
+			// Stacked encodings are rare enough to refuse.
+			d, ok := decoder(encoding)
+			if !ok || strings.Contains(encoding, ",") {
+				rw.Header().Set("Accept-Encoding", acceptedEncodings())
+				http.Error(rw, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+				return
+			}
+
+			body, err := d(r.Body)
+			if err != nil {
+				http.Error(rw, "malformed "+encoding+" body", http.StatusBadRequest)
+				return
+			}
+
+			r = r.Clone(r.Context())
+			r.Body = &limitedBody{r: body, body: r.Body, left: opts.MaxSize}
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// limitedBody reads at most left decompressed bytes, then fails with
+// ErrDecompressedTooLarge rather than truncating silently.
+type limitedBody struct {
+	r    io.ReadCloser
+	body io.Closer
+	left int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.left < 0 {
+		return 0, ErrDecompressedTooLarge
+	}
+	if int64(len(p)) > b.left+1 {
+		p = p[:b.left+1]
+	}
+	n, err := b.r.Read(p)
+	b.left -= int64(n)
+	if b.left < 0 {
+		return n - 1, ErrDecompressedTooLarge
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	b.r.Close()
+	return b.body.Close()
+}
+
+func decodeDeflate(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	if h, err := br.Peek(2); err == nil && h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
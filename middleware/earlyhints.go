@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Preload describes an asset announced to the client ahead of the response.
+type Preload struct {
+	Path string
+	As   string // e.g. "style", "script", "font", "image"
+	Push bool   // also push the asset when the connection supports HTTP/2 push
+}
+
+func (p Preload) link() string {
+	if p.As == "" {
+		return fmt.Sprintf("<%s>; rel=preload", p.Path)
+	}
+	return fmt.Sprintf("<%s>; rel=preload; as=%s", p.Path, p.As)
+}
+
+// EarlyHints announces assets before the wrapped handler runs by sending a
+// 103 Early Hints response with Link preload headers. The same headers are
+// kept on the final response for clients that ignore informational
+// responses.
+func EarlyHints(assets ...Preload) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			WriteEarlyHints(rw, r, assets...)
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// WriteEarlyHints sends a 103 Early Hints response for assets and pushes the
+// ones marked Push where HTTP/2 push is available. It must be called before
+// the handler writes its final status.
+func WriteEarlyHints(rw http.ResponseWriter, r *http.Request, assets ...Preload) {
+	if len(assets) == 0 {
+		return
+	}
+
+	pusher, canPush := rw.(http.Pusher)
+	for _, a := range assets {
+		rw.Header().Add("Link", a.link())
+		if a.Push && canPush {
+			if err := pusher.Push(a.Path, nil); err == http.ErrNotSupported {
+				canPush = false
+			}
+		}
+	}
+
+	if r.ProtoAtLeast(1, 1) {
+		rw.WriteHeader(http.StatusEarlyHints)
+	}
+}
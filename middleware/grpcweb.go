@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// grpcTrailerFlag marks the frame carrying trailers in a gRPC-Web body.
+const grpcTrailerFlag = 0x80
+
+// GRPCWeb lets browsers call a gRPC handler through the router. gRPC-Web
+// requests (application/grpc-web and application/grpc-web-text) are
+// rewritten into gRPC requests for next, and since browsers cannot read HTTP
+// trailers, the gRPC status trailers are moved into a final body frame of the
+// response. Other requests pass through untouched.
+func GRPCWeb(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		contentType := r.Header.Get("Content-Type")
+		if !strings.HasPrefix(contentType, "application/grpc-web") {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		text := strings.HasPrefix(contentType, "application/grpc-web-text")
+		subtype := strings.TrimPrefix(strings.TrimPrefix(contentType, "application/grpc-web-text"), "application/grpc-web")
+
+		req := r.Clone(r.Context())
+		req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2.0"
+		req.Header.Set("Content-Type", "application/grpc"+subtype)
+		req.Header.Set("Te", "trailers")
+		req.Header.Del("Content-Length")
+		req.ContentLength = -1
+		if text {
+			req.Body = io.NopCloser(base64.NewDecoder(base64.StdEncoding, r.Body))
+		}
+
+		w := &grpcWebWriter{rw: rw, header: make(http.Header), text: text, contentType: contentType}
+		next.ServeHTTP(w, req)
+		w.finish()
+	})
+}
+
+type grpcWebWriter struct {
+	rw          http.ResponseWriter
+	header      http.Header
+	text        bool
+	contentType string
+	wroteHeader bool
+	trailers    []string
+}
+
+func (w *grpcWebWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *grpcWebWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	for _, t := range w.header.Values("Trailer") {
+		for _, name := range strings.Split(t, ",") {
+			w.trailers = append(w.trailers, http.CanonicalHeaderKey(strings.TrimSpace(name)))
+		}
+	}
+
+	out := w.rw.Header()
+	for k, v := range w.header {
+		if k == "Trailer" || k == "Content-Length" || w.isTrailer(k) {
+			continue
+		}
+		out[k] = v
+	}
+	out.Set("Content-Type", w.contentType)
+	w.rw.WriteHeader(status)
+}
+
+func (w *grpcWebWriter) isTrailer(key string) bool {
+	if strings.HasPrefix(key, http.TrailerPrefix) {
+		return true
+	}
+	for _, t := range w.trailers {
+		if t == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *grpcWebWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if w.text {
+		// Each chunk is encoded on its own, padding included, so chunks can
+		// be flushed to the client as they are produced.
+		if _, err := io.WriteString(w.rw, base64.StdEncoding.EncodeToString(b)); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	return w.rw.Write(b)
+}
+
+func (w *grpcWebWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+	if f, ok := w.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish writes the trailers frame. A handler that never wrote a body sent
+// a trailers-only response, which gRPC-Web carries in the headers instead.
+func (w *grpcWebWriter) finish() {
+	if !w.wroteHeader {
+		out := w.rw.Header()
+		for k, v := range w.header {
+			if k != "Trailer" && k != "Content-Length" {
+				out[strings.TrimPrefix(k, http.TrailerPrefix)] = v
+			}
+		}
+		out.Set("Content-Type", w.contentType)
+		w.rw.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var keys []string
+	for k := range w.header {
+		if w.isTrailer(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		name := strings.ToLower(strings.TrimPrefix(k, http.TrailerPrefix))
+		for _, v := range w.header[k] {
+			b.WriteString(name + ": " + v + "\r\n")
+		}
+	}
+
+	frame := make([]byte, 5+b.Len())
+	frame[0] = grpcTrailerFlag
+	binary.BigEndian.PutUint32(frame[1:5], uint32(b.Len()))
+	copy(frame[5:], b.String())
+	w.Write(frame)
+}
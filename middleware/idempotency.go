@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	ErrIdempotencyConflict = errors.New("a request with this idempotency key is already in progress")
+	ErrIdempotencyMismatch = errors.New("idempotency key reused with a different request body")
+)
+
+// CachedResponse is a response recorded for an idempotency key.
+type CachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	// RequestHash is the SHA-256 of the request body answered, in hex.
+	RequestHash string
+}
+
+// IdempotencyStore keeps responses by idempotency key. Begin reserves a key
+// and returns the recorded response when the key has already completed, or
+// ErrIdempotencyConflict while another request holds it. Every successful
+// Begin is followed by Complete or, when the response must not be replayed,
+// Abort.
+type IdempotencyStore interface {
+	Begin(key string) (*CachedResponse, error)
+	Complete(key string, res *CachedResponse, ttl time.Duration) error
+	Abort(key string) error
+}
+
+// Idempotency replays the recorded response of an earlier request carrying
+// the same Idempotency-Key header, so clients can safely retry unsafe
+// requests. Keys are scoped to the method, the path and the caller, as
+// scope names it, e.g. by the subject of its token; a nil scope tells
+// callers apart by their Authorization and Cookie headers, which suits
+// clients whose credentials do not change between retries. A key reused
+// with another request body is answered with 422 Unprocessable Entity.
+// Server errors are not recorded, leaving the client free to retry them.
+// Request bodies are read in full before the handler runs.
+func Idempotency(store IdempotencyStore, ttl time.Duration, scope func(*http.Request) string) func(http.Handler) http.Handler {
+	if scope == nil {
+		scope = credentials
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(rw, r)
+				return
+			}
+			key = r.Method + " " + r.URL.Path + " " + digest([]byte(scope(r))) + " " + key
+
+			var body []byte
+			if r.Body != nil && r.Body != http.NoBody {
+				var err error
+				if body, err = io.ReadAll(r.Body); err != nil {
+					http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+					return
+				}
+				r.Body = readCloser{bytes.NewReader(body), r.Body}
+			}
+			hash := digest(body)
+
+			cached, err := store.Begin(key)
+			if errors.Is(err, ErrIdempotencyConflict) {
+				http.Error(rw, err.Error(), http.StatusConflict)
+				return
+			}
+			if err != nil {
+				http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if cached != nil && cached.RequestHash != hash {
+				http.Error(rw, ErrIdempotencyMismatch.Error(), http.StatusUnprocessableEntity)
+				return
+			}
+			if cached != nil {
+				rw.Header().Set("Idempotent-Replayed", "true")
+				(&recorder{header: cached.Header, status: cached.Status}).replayBody(rw, cached.Body)
+				return
+			}
+
+			rec := newRecorder()
+			completed := false
+			defer func() {
+				if !completed {
+					store.Abort(key)
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+
+			if rec.status < http.StatusInternalServerError {
+				store.Complete(key, &CachedResponse{
+					Status:      rec.status,
+					Header:      rec.header.Clone(),
+					Body:        append([]byte(nil), rec.body.Bytes()...),
+					RequestHash: hash,
+				}, ttl)
+				completed = true
+			}
+			rec.replay(rw)
+		})
+	}
+}
+
+// credentials is the default scope of idempotency keys.
+func credentials(r *http.Request) string {
+	return r.Header.Get("Authorization") + "\n" + r.Header.Get("Cookie")
+}
+
+func digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+type memoryEntry struct {
+	res     *CachedResponse
+	expires time.Time
+}
+
+// MemoryStore is an in-process IdempotencyStore, suitable for a single
+// instance. Expired keys are dropped lazily.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	swept   time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+func (s *MemoryStore) Begin(key string) (*CachedResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if e, ok := s.entries[key]; ok {
+		if e.res == nil {
+			return nil, ErrIdempotencyConflict
+		}
+		if now.Before(e.expires) {
+			return e.res, nil
+		}
+	}
+	s.evict(now)
+	s.entries[key] = &memoryEntry{}
+	return nil, nil
+}
+
+func (s *MemoryStore) Complete(key string, res *CachedResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = &memoryEntry{res: res, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Abort(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) evict(now time.Time) {
+	if now.Sub(s.swept) < time.Minute {
+		return
+	}
+	s.swept = now
+	for k, e := range s.entries {
+		if e.res != nil && now.After(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotency(t *testing.T) {
+	var calls atomic.Int32
+	status := http.StatusCreated
+	h := Idempotency(NewMemoryStore(), time.Hour, nil)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		b, _ := io.ReadAll(r.Body)
+		http.SetCookie(rw, &http.Cookie{Name: "receipt", Value: string(b)})
+		rw.WriteHeader(status)
+		io.WriteString(rw, "charge "+string(rune('0'+n)))
+	}))
+	send := func(method, key, auth, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/charges", strings.NewReader(body))
+		if key != "" {
+			r.Header.Set("Idempotency-Key", key)
+		}
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	first := send("POST", "k1", "Bearer alice", "amount=10")
+	if first.Code != http.StatusCreated || first.Body.String() != "charge 1" {
+		t.Fatalf("first request: %d %q", first.Code, first.Body)
+	}
+
+	for _, tt := range []struct {
+		name, method, key, auth, body string
+		status                        int
+		response                      string
+		replayed                      bool
+	}{
+		{"retry", "POST", "k1", "Bearer alice", "amount=10", http.StatusCreated, "charge 1", true},
+		{"another caller with the key", "POST", "k1", "Bearer mallory", "amount=10", http.StatusCreated, "charge 2", false},
+		{"body changed", "POST", "k1", "Bearer alice", "amount=1000", http.StatusUnprocessableEntity, ErrIdempotencyMismatch.Error() + "\n", false},
+		{"another method", "PUT", "k1", "Bearer alice", "amount=10", http.StatusCreated, "charge 3", false},
+		{"no key", "POST", "", "Bearer alice", "amount=10", http.StatusCreated, "charge 4", false},
+	} {
+		rec := send(tt.method, tt.key, tt.auth, tt.body)
+		if rec.Code != tt.status || rec.Body.String() != tt.response || (rec.Header().Get("Idempotent-Replayed") == "true") != tt.replayed {
+			t.Errorf("%s: %d %q replayed %q, want %d %q replayed %v", tt.name, rec.Code, rec.Body, rec.Header().Get("Idempotent-Replayed"), tt.status, tt.response, tt.replayed)
+		}
+	}
+
+	// The replay is the first caller's own, cookies included.
+	if c := send("POST", "k1", "Bearer alice", "amount=10").Result().Cookies(); len(c) != 1 || c[0].Value != "amount=10" {
+		t.Errorf("replayed cookies %v, want the first response's", c)
+	}
+
+	// Server errors are not recorded, so the client may retry them.
+	status = http.StatusBadGateway
+	send("POST", "k2", "Bearer alice", "amount=10")
+	status = http.StatusCreated
+	if rec := send("POST", "k2", "Bearer alice", "amount=10"); rec.Code != http.StatusCreated || rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("retry after a 502: %d, replayed %q; want the handler called again", rec.Code, rec.Header().Get("Idempotent-Replayed"))
+	}
+}
+
+func TestIdempotencyConcurrentDuplicate(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	h := Idempotency(NewMemoryStore(), time.Hour, func(r *http.Request) string { return r.Header.Get("X-User") })(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	}))
+	send := func(user string) int {
+		r := httptest.NewRequest("POST", "/charges", strings.NewReader("amount=10"))
+		r.Header.Set("Idempotency-Key", "k1")
+		r.Header.Set("X-User", user)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	done := make(chan int)
+	go func() { done <- send("alice") }()
+	<-entered
+	if code := send("alice"); code != http.StatusConflict {
+		t.Errorf("duplicate while the first is in flight: %d, want 409", code)
+	}
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("first request: %d, want 200", code)
+	}
+	if code := send("alice"); code != http.StatusOK {
+		t.Errorf("retry once the first completed: %d, want the replayed 200", code)
+	}
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+type InflightOptions struct {
+	// PerClient caps the requests one client address, resolved by
+	// router.ClientIP, has in flight; more get 429 Too Many Requests.
+	PerClient int
+	// Global caps all requests in flight; more get 503.
+	Global int
+	// Top is how many of the busiest clients Stats lists, 10 by default.
+	Top int
+}
+
+// InflightStats is a snapshot of the requests in flight.
+type InflightStats struct {
+	Inflight int              `json:"inflight"`
+	Peak     int              `json:"peak"`
+	Clients  int              `json:"clients"`
+	Rejected int64            `json:"rejected"`
+	Top      []ClientInflight `json:"top,omitempty"`
+}
+
+type ClientInflight struct {
+	IP       string `json:"ip"`
+	Inflight int    `json:"inflight"`
+}
+
+// Inflight counts the requests being served, in total and per client, so
+// one client cannot take every worker.
+type Inflight struct {
+	opts InflightOptions
+
+	mu       sync.Mutex
+	total    int
+	peak     int
+	clients  map[string]int
+	rejected int64
+}
+
+func NewInflight(opts InflightOptions) *Inflight {
+	if opts.Top <= 0 {
+		opts.Top = 10
+	}
+	return &Inflight{opts: opts, clients: make(map[string]int)}
+}
+
+func (f *Inflight) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ip := r.RemoteAddr
+		if addr := router.ClientIP(r); addr.IsValid() {
+			ip = addr.String()
+		}
+		if status := f.acquire(ip); status != 0 {
+			if status == http.StatusTooManyRequests {
+				rw.Header().Set("Retry-After", "1")
+			}
+			http.Error(rw, http.StatusText(status), status)
+			return
+		}
+		defer f.release(ip)
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// acquire counts a request in, or returns the status refusing it.
+func (f *Inflight) acquire(ip string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.opts.Global > 0 && f.total >= f.opts.Global {
+		f.rejected++
+		return http.StatusServiceUnavailable
+	}
+	if f.opts.PerClient > 0 && f.clients[ip] >= f.opts.PerClient {
+		f.rejected++
+		return http.StatusTooManyRequests
+	}
+	f.total++
+	f.peak = max(f.peak, f.total)
+	f.clients[ip]++
+	return 0
+}
+
+func (f *Inflight) release(ip string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.total--
+	if f.clients[ip]--; f.clients[ip] <= 0 {
+		delete(f.clients, ip)
+	}
+}
+
+func (f *Inflight) Stats() InflightStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := InflightStats{Inflight: f.total, Peak: f.peak, Clients: len(f.clients), Rejected: f.rejected}
+	for ip, n := range f.clients {
+		s.Top = append(s.Top, ClientInflight{IP: ip, Inflight: n})
+	}
+	sort.Slice(s.Top, func(i, j int) bool {
+		if s.Top[i].Inflight != s.Top[j].Inflight {
+			return s.Top[i].Inflight > s.Top[j].Inflight
+		}
+		return s.Top[i].IP < s.Top[j].IP
+	})
+	if len(s.Top) > f.opts.Top {
+		s.Top = s.Top[:f.opts.Top]
+	}
+	return s
+}
+
+// ServeHTTP serves Stats as JSON for an admin route.
+func (f *Inflight) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(f.Stats())
+}
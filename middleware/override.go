@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const MethodOverrideHeader = "X-HTTP-Method-Override"
+
+// overridable are the methods a POST may be turned into. Safe methods are
+// left out so a form cannot be replayed as a cacheable GET.
+var overridable = map[string]bool{
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// maxOverrideForm bounds the form bodies searched for a "_method" field.
+// Longer ones are left as they are and keep their method.
+const maxOverrideForm = 64 << 10
+
+// MethodOverride lets HTML forms and clients limited to GET and POST reach
+// PUT, PATCH and DELETE routes. A POST carrying the X-HTTP-Method-Override
+// header, or a "_method" field in its urlencoded form body or query, such
+// as <input type="hidden" name="_method" value="DELETE">, is served as that
+// method. A form body read to find the field is put back for the handler.
+// It must run before matching, as router middleware passed to Use.
+func MethodOverride(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		method := r.Header.Get(MethodOverrideHeader)
+		if method == "" {
+			method = formMethod(r)
+		}
+		if method == "" {
+			method = r.URL.Query().Get("_method")
+		}
+		if method = strings.ToUpper(method); overridable[method] {
+			r = r.Clone(r.Context())
+			r.Method = method
+			r.Header.Del(MethodOverrideHeader)
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// formMethod returns the "_method" field of an urlencoded form body,
+// putting back what it read.
+func formMethod(r *http.Request) string {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/x-www-form-urlencoded" {
+		return ""
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return ""
+	}
+	head, err := io.ReadAll(io.LimitReader(r.Body, maxOverrideForm+1))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+	if err != nil || len(head) > maxOverrideForm {
+		return ""
+	}
+	form, err := url.ParseQuery(string(head))
+	if err != nil {
+		return ""
+	}
+	return form.Get("_method")
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMethodOverride(t *testing.T) {
+	for _, tt := range []struct {
+		name, method, target, contentType, body, header string
+		want                                            string
+	}{
+		{"header", "POST", "/", "", "", "patch", "PATCH"},
+		{"form field", "POST", "/", "application/x-www-form-urlencoded", "a=1&_method=DELETE", "", "DELETE"},
+		{"form with charset", "POST", "/", "application/x-www-form-urlencoded; charset=utf-8", "_method=put", "", "PUT"},
+		{"query", "POST", "/?_method=DELETE", "", "", "", "DELETE"},
+		{"header before form", "POST", "/", "application/x-www-form-urlencoded", "_method=DELETE", "PUT", "PUT"},
+		{"JSON body", "POST", "/", "application/json", `{"_method":"DELETE"}`, "", "POST"},
+		{"form too long", "POST", "/", "application/x-www-form-urlencoded", "_method=DELETE&a=" + strings.Repeat("a", maxOverrideForm), "", "POST"},
+		{"safe method", "POST", "/", "", "", "GET", "POST"},
+		{"not a POST", "PUT", "/?_method=DELETE", "", "", "PATCH", "PUT"},
+	} {
+		var method, body string
+		h := MethodOverride(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			method = r.Method
+			b, _ := io.ReadAll(r.Body)
+			body = string(b)
+		}))
+		r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		if tt.header != "" {
+			r.Header.Set(MethodOverrideHeader, tt.header)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		if method != tt.want || body != tt.body {
+			t.Errorf("%s: served as %s with body %.40q, want %s with the body unchanged", tt.name, method, body, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+// recorder buffers a response so it can be replayed to other clients.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newRecorder() *recorder {
+	return &recorder{header: make(http.Header)}
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) WriteHeader(status int) {
+	// Informational responses such as 103 Early Hints precede the real one.
+	if r.status == 0 && (status >= 200 || status == http.StatusSwitchingProtocols) {
+		r.status = status
+	}
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(b)
+}
+
+func (r *recorder) replay(rw http.ResponseWriter) {
+	r.replayBody(rw, r.body.Bytes())
+}
+
+// replayShared replays the response to a client other than the one it was
+// made for, without the cookies set for that one.
+func (r *recorder) replayShared(rw http.ResponseWriter) {
+	shared := &recorder{header: r.header.Clone(), status: r.status}
+	shared.header.Del("Set-Cookie")
+	shared.replayBody(rw, r.body.Bytes())
+}
+
+func (r *recorder) replayBody(rw http.ResponseWriter, body []byte) {
+	header := rw.Header()
+	trailers := make(map[string][]string)
+	for k, v := range r.header {
+		if r.isTrailer(k) {
+			trailers[k] = v
+			continue
+		}
+		header[k] = append([]string(nil), v...)
+	}
+	status := r.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	rw.WriteHeader(status)
+	rw.Write(body)
+
+	// Trailers set once the headers are sent go out after the body.
+	for k, v := range trailers {
+		header[k] = append([]string(nil), v...)
+	}
+}
+
+func (r *recorder) isTrailer(key string) bool {
+	if strings.HasPrefix(key, http.TrailerPrefix) {
+		return true
+	}
+	for _, t := range r.header.Values("Trailer") {
+		for _, name := range strings.Split(t, ",") {
+			if http.CanonicalHeaderKey(strings.TrimSpace(name)) == key {
+				return true
+			}
+		}
+	}
+	return false
+}
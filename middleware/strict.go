@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// StrictOptions configure StrictRequests.
+type StrictOptions struct {
+	// MaxHeaders caps the number of header fields, 100 by default.
+	MaxHeaders int
+	// MaxHeaderValue caps the length of one header value, 8 KB by default.
+	// The whole header block is capped by http.Server.MaxHeaderBytes.
+	MaxHeaderValue int
+}
+
+// singletons are headers whose repetition with different values means the
+// request can be read two ways.
+var singletons = []string{"Content-Type", "Authorization", "Expect", "Upgrade"}
+
+// StrictRequests refuses requests that servers and proxies may frame or
+// route differently, the raw material of request smuggling and cache
+// poisoning, with 400 and a closed connection. net/http already rejects
+// conflicting Content-Length headers, transfer codings other than chunked
+// and control characters in header values, and drops the Content-Length
+// of chunked requests as RFC 9112 asks; requests forwarded by the proxy
+// are re-framed from scratch. On top of that it refuses:
+//
+//   - a body on GET or HEAD, which some servers ignore and leave to be read
+//     as the next request;
+//   - header names with underscores, which some servers treat as dashes, so
+//     X_Forwarded_For would become X-Forwarded-For behind the proxy;
+//   - repeated Content-Type, Authorization, Expect or Upgrade headers with
+//     different values;
+//   - more than MaxHeaders headers or values over MaxHeaderValue;
+//   - "." and ".." path segments, which reach different resources
+//     depending on whether a server resolves them.
+//
+// A proxy in front may have framed a chunked HTTP/1 request by a
+// Content-Length net/http dropped, so the connection is closed after
+// answering one: whatever follows its body is never read as another
+// request.
+func StrictRequests(opts StrictOptions) func(http.Handler) http.Handler {
+	if opts.MaxHeaders <= 0 {
+		opts.MaxHeaders = 100
+	}
+	if opts.MaxHeaderValue <= 0 {
+		opts.MaxHeaderValue = 8 << 10
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if reason := opts.check(r); reason != "" {
+				rw.Header().Set("Connection", "close")
+				http.Error(rw, "Bad Request: "+reason, http.StatusBadRequest)
+				return
+			}
+			if r.ProtoMajor == 1 && slices.Contains(r.TransferEncoding, "chunked") {
+				rw.Header().Set("Connection", "close")
+			}
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// check returns why r is refused, or "".
+func (opts StrictOptions) check(r *http.Request) string {
+	if (r.Method == http.MethodGet || r.Method == http.MethodHead) && r.ContentLength != 0 {
+		return "body not allowed on " + r.Method
+	}
+
+	count := 0
+	for name, values := range r.Header {
+		if strings.IndexByte(name, '_') >= 0 {
+			return "underscore in header name " + name
+		}
+		count += len(values)
+		for _, v := range values {
+			if len(v) > opts.MaxHeaderValue {
+				return "header " + name + " too long"
+			}
+		}
+	}
+	if count > opts.MaxHeaders {
+		return "too many headers"
+	}
+
+	for _, name := range singletons {
+		values := r.Header.Values(name)
+		for _, v := range values[min(1, len(values)):] {
+			if v != values[0] {
+				return "conflicting " + name + " headers"
+			}
+		}
+	}
+
+	for _, segment := range strings.Split(r.URL.Path, "/") {
+		if segment == "." || segment == ".." {
+			return "dot segment in path"
+		}
+	}
+	return ""
+}
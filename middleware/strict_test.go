@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestStrictRequestsSmuggling sends the classic request smuggling shapes
+// over one connection each, checking what answers come back and which
+// requests reach the handler: never a second, smuggled one.
+func TestStrictRequestsSmuggling(t *testing.T) {
+	var mu sync.Mutex
+	var served []string
+	srv := httptest.NewServer(StrictRequests(StrictOptions{})(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		mu.Lock()
+		served = append(served, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+	})))
+	defer srv.Close()
+
+	// The connection closes after the smuggled request, if it is served.
+	const smuggled = "GET /smuggled HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n"
+	for _, tt := range []struct {
+		name     string
+		raw      string
+		statuses []int
+		served   []string
+	}{
+		{
+			name:     "plain",
+			raw:      "GET / HTTP/1.1\r\nHost: x\r\n\r\n" + smuggled,
+			statuses: []int{200, 200},
+			served:   []string{"GET /", "GET /smuggled"},
+		},
+		{
+			name:     "CL.TE",
+			raw:      "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 40\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n" + smuggled,
+			statuses: []int{200},
+			served:   []string{"POST /"},
+		},
+		{
+			name:     "TE.CL",
+			raw:      "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\nContent-Length: 3\r\n\r\n5\r\nhello\r\n0\r\n\r\n" + smuggled,
+			statuses: []int{200},
+			served:   []string{"POST /"},
+		},
+		{
+			name:     "duplicate CL",
+			raw:      "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nContent-Length: 41\r\n\r\nhello" + smuggled,
+			statuses: []int{400},
+		},
+		{
+			name:     "CL list",
+			raw:      "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 5, 41\r\n\r\nhello" + smuggled,
+			statuses: []int{400},
+		},
+		{
+			name:     "signed CL",
+			raw:      "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: +5\r\n\r\nhello" + smuggled,
+			statuses: []int{400},
+		},
+		{
+			name:     "obfuscated TE",
+			raw:      "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: xchunked\r\n\r\n0\r\n\r\n" + smuggled,
+			statuses: []int{501},
+		},
+		{
+			name:     "TE with space before colon",
+			raw:      "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding : chunked\r\n\r\n0\r\n\r\n" + smuggled,
+			statuses: []int{400},
+		},
+		{
+			name:     "TE twice",
+			raw:      "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: identity\r\n\r\n0\r\n\r\n" + smuggled,
+			statuses: []int{501},
+		},
+		{
+			// net/http unfolds the continuation, so there is no header a
+			// proxy could have read differently left to refuse.
+			name:     "obs-fold",
+			raw:      "GET / HTTP/1.1\r\nHost: x\r\nConnection: close\r\nX-A: a\r\n b\r\n\r\n",
+			statuses: []int{200},
+			served:   []string{"GET /"},
+		},
+		{
+			name:     "control character",
+			raw:      "GET / HTTP/1.1\r\nHost: x\r\nX-A: a\x01b\r\n\r\n" + smuggled,
+			statuses: []int{400},
+		},
+		{
+			name:     "body on GET",
+			raw:      "GET / HTTP/1.1\r\nHost: x\r\nContent-Length: 41\r\n\r\n" + smuggled,
+			statuses: []int{400},
+		},
+		{
+			name:     "underscore",
+			raw:      "GET / HTTP/1.1\r\nHost: x\r\nX_Forwarded_For: 10.0.0.1\r\n\r\n" + smuggled,
+			statuses: []int{400},
+		},
+		{
+			name:     "conflicting Authorization",
+			raw:      "GET / HTTP/1.1\r\nHost: x\r\nAuthorization: a\r\nAuthorization: b\r\n\r\n" + smuggled,
+			statuses: []int{400},
+		},
+		{
+			name:     "dot segment",
+			raw:      "GET /public/../admin HTTP/1.1\r\nHost: x\r\n\r\n" + smuggled,
+			statuses: []int{400},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			served = nil
+			mu.Unlock()
+
+			conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			io.WriteString(conn, tt.raw)
+
+			var statuses []int
+			br := bufio.NewReader(conn)
+			for {
+				res, err := http.ReadResponse(br, nil)
+				if err != nil {
+					break
+				}
+				io.Copy(io.Discard, res.Body)
+				res.Body.Close()
+				statuses = append(statuses, res.StatusCode)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !slices.Equal(statuses, tt.statuses) {
+				t.Errorf("statuses = %v, want %v", statuses, tt.statuses)
+			}
+			if !slices.Equal(served, tt.served) {
+				t.Errorf("served %q, want %q", served, tt.served)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ThrottleOptions configure Throttle. Rates are in bytes per second; zero
+// leaves that limit off.
+type ThrottleOptions struct {
+	// Rate is shared by every response the middleware wraps, e.g. all
+	// downloads of a route together.
+	Rate int
+	// PerConnection applies to each client connection on its own, so one
+	// client cannot take the whole Rate. It needs ConnContext set on the
+	// http.Server; without it the limit applies to each response.
+	PerConnection int
+	// Burst is how many bytes may be sent at once, 32 KB by default.
+	Burst int
+}
+
+// Throttle limits the bandwidth of response bodies with token buckets on
+// the writer: writes block until the buckets allow them, which in turn
+// slows the handler producing them.
+func Throttle(opts ThrottleOptions) func(http.Handler) http.Handler {
+	if opts.Burst <= 0 {
+		opts.Burst = 32 << 10
+	}
+	var shared *bucket
+	if opts.Rate > 0 {
+		shared = newBucket(opts.Rate, opts.Burst)
+	}
+
+	return func(next http.Handler) http.Handler {
+		if opts.Rate <= 0 && opts.PerConnection <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			var buckets []*bucket
+			if shared != nil {
+				buckets = append(buckets, shared)
+			}
+			if opts.PerConnection > 0 {
+				buckets = append(buckets, connBucket(r.Context(), opts.PerConnection, opts.Burst))
+			}
+			next.ServeHTTP(&throttledWriter{ResponseWriter: rw, ctx: r.Context(), buckets: buckets, burst: opts.Burst}, r)
+		})
+	}
+}
+
+type connKey struct{}
+
+// connState holds what is shared by the requests of one connection.
+type connState struct {
+	mu      sync.Mutex
+	buckets map[int]*bucket
+}
+
+// ConnContext is meant for http.Server.ConnContext. It gives each
+// connection the state Throttle's per-connection limits live in.
+func ConnContext(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, &connState{buckets: make(map[int]*bucket)})
+}
+
+func connBucket(ctx context.Context, rate, burst int) *bucket {
+	s, ok := ctx.Value(connKey{}).(*connState)
+	if !ok {
+		return newBucket(rate, burst)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[rate]
+	if !ok {
+		b = newBucket(rate, burst)
+		s.buckets[rate] = b
+	}
+	return b
+}
+
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate, burst int) *bucket {
+	return &bucket{rate: float64(rate), burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// reserve takes n tokens, going into debt if needed, and returns how long
+// the caller must wait for that debt to be paid off.
+func (b *bucket) reserve(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	buckets []*bucket
+	burst   int
+}
+
+func (w *throttledWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > w.burst {
+			chunk = chunk[:w.burst]
+		}
+
+		var delay time.Duration
+		for _, bucket := range w.buckets {
+			delay = max(delay, bucket.reserve(len(chunk)))
+		}
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-w.ctx.Done():
+				timer.Stop()
+				return written, w.ctx.Err()
+			}
+		}
+
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
+
+func (w *throttledWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *throttledWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// maxWebhookBody caps the payload buffered for signature verification.
+const maxWebhookBody = 10 << 20
+
+var (
+	ErrMissingSignature = errors.New("webhook: missing signature")
+	ErrInvalidSignature = errors.New("webhook: signature does not match payload")
+	ErrStaleSignature   = errors.New("webhook: signature timestamp outside the allowed window")
+)
+
+// SignatureScheme checks a webhook payload against the signature headers of
+// r. tolerance bounds how far the signed timestamp may be from now, for
+// schemes that sign one.
+type SignatureScheme func(r *http.Request, body, secret []byte, tolerance time.Duration) error
+
+// VerifySignature rejects webhook deliveries whose signature does not match
+// with 401 Unauthorized. The handler still sees the raw, unmodified body.
+func VerifySignature(scheme SignatureScheme, secret []byte, tolerance time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			body, err := router.PreserveBody(r, maxWebhookBody)
+			if errors.Is(err, router.ErrBodyTooLarge) {
+				http.Error(rw, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+
+			if err := scheme(r, body, secret, tolerance); err != nil {
+				http.Error(rw, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// GitHubSignature verifies the X-Hub-Signature-256 header. GitHub does not
+// sign a timestamp, so tolerance is ignored.
+func GitHubSignature(r *http.Request, body, secret []byte, tolerance time.Duration) error {
+	sig := r.Header.Get("X-Hub-Signature-256")
+	if !strings.HasPrefix(sig, "sha256=") {
+		return ErrMissingSignature
+	}
+	return compareHex(strings.TrimPrefix(sig, "sha256="), sign(secret, body))
+}
+
+// StripeSignature verifies the Stripe-Signature header, accepting any of its
+// v1 signatures so secrets can be rolled.
+func StripeSignature(r *http.Request, body, secret []byte, tolerance time.Duration) error {
+	var ts string
+	var sigs []string
+	for _, part := range strings.Split(r.Header.Get("Stripe-Signature"), ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case "v1":
+			sigs = append(sigs, kv[1])
+		}
+	}
+	if ts == "" || len(sigs) == 0 {
+		return ErrMissingSignature
+	}
+	if err := checkTimestamp(ts, tolerance); err != nil {
+		return err
+	}
+
+	expected := sign(secret, []byte(ts+"."), body)
+	for _, sig := range sigs {
+		if compareHex(sig, expected) == nil {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// SlackSignature verifies the X-Slack-Signature and
+// X-Slack-Request-Timestamp headers.
+func SlackSignature(r *http.Request, body, secret []byte, tolerance time.Duration) error {
+	sig := r.Header.Get("X-Slack-Signature")
+	ts := r.Header.Get("X-Slack-Request-Timestamp")
+	if !strings.HasPrefix(sig, "v0=") || ts == "" {
+		return ErrMissingSignature
+	}
+	if err := checkTimestamp(ts, tolerance); err != nil {
+		return err
+	}
+	return compareHex(strings.TrimPrefix(sig, "v0="), sign(secret, []byte("v0:"+ts+":"), body))
+}
+
+func sign(secret []byte, parts ...[]byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	for _, p := range parts {
+		mac.Write(p)
+	}
+	return mac.Sum(nil)
+}
+
+func compareHex(sig string, expected []byte) error {
+	got, err := hex.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, expected) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func checkTimestamp(ts string, tolerance time.Duration) error {
+	if tolerance <= 0 {
+		return nil
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrMissingSignature
+	}
+	d := time.Since(time.Unix(sec, 0))
+	if d > tolerance || d < -tolerance {
+		return ErrStaleSignature
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignatureSchemes(t *testing.T) {
+	secret, body := []byte("s3cret"), []byte(`{"event":"paid"}`)
+	hexSign := func(secret []byte, parts ...string) string {
+		b := make([][]byte, len(parts))
+		for i, p := range parts {
+			b[i] = []byte(p)
+		}
+		return hex.EncodeToString(sign(secret, b...))
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(10*time.Minute).Unix(), 10)
+	stripe := func(ts string, sigs ...string) map[string]string {
+		v := "t=" + ts
+		for _, s := range sigs {
+			v += ",v1=" + s
+		}
+		return map[string]string{"Stripe-Signature": v}
+	}
+	slack := func(ts, sig string) map[string]string {
+		return map[string]string{"X-Slack-Request-Timestamp": ts, "X-Slack-Signature": "v0=" + sig}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		scheme  SignatureScheme
+		headers map[string]string
+		body    string
+		want    error
+	}{
+		{"GitHub", GitHubSignature, map[string]string{"X-Hub-Signature-256": "sha256=" + hexSign(secret, string(body))}, "", nil},
+		{"GitHub other secret", GitHubSignature, map[string]string{"X-Hub-Signature-256": "sha256=" + hexSign([]byte("guess"), string(body))}, "", ErrInvalidSignature},
+		{"GitHub tampered body", GitHubSignature, map[string]string{"X-Hub-Signature-256": "sha256=" + hexSign(secret, string(body))}, `{"event":"refunded"}`, ErrInvalidSignature},
+		{"GitHub SHA-1 header", GitHubSignature, map[string]string{"X-Hub-Signature": "sha1=00"}, "", ErrMissingSignature},
+		{"GitHub not hex", GitHubSignature, map[string]string{"X-Hub-Signature-256": "sha256=zz"}, "", ErrInvalidSignature},
+		{"GitHub truncated", GitHubSignature, map[string]string{"X-Hub-Signature-256": "sha256=" + hexSign(secret, string(body))[:32]}, "", ErrInvalidSignature},
+
+		{"Stripe", StripeSignature, stripe(now, hexSign(secret, now+".", string(body))), "", nil},
+		{"Stripe rolled secret", StripeSignature, stripe(now, hexSign([]byte("old"), now+".", string(body)), hexSign(secret, now+".", string(body))), "", nil},
+		{"Stripe other secret", StripeSignature, stripe(now, hexSign([]byte("guess"), now+".", string(body))), "", ErrInvalidSignature},
+		{"Stripe timestamp swapped", StripeSignature, stripe(now, hexSign(secret, old+".", string(body))), "", ErrInvalidSignature},
+		{"Stripe replayed", StripeSignature, stripe(old, hexSign(secret, old+".", string(body))), "", ErrStaleSignature},
+		{"Stripe from the future", StripeSignature, stripe(future, hexSign(secret, future+".", string(body))), "", ErrStaleSignature},
+		{"Stripe bad timestamp", StripeSignature, stripe("soon", hexSign(secret, "soon.", string(body))), "", ErrMissingSignature},
+		{"Stripe no v1", StripeSignature, map[string]string{"Stripe-Signature": "t=" + now + ",v0=" + hexSign(secret, now+".", string(body))}, "", ErrMissingSignature},
+		{"Stripe missing", StripeSignature, nil, "", ErrMissingSignature},
+
+		{"Slack", SlackSignature, slack(now, hexSign(secret, "v0:"+now+":", string(body))), "", nil},
+		{"Slack tampered body", SlackSignature, slack(now, hexSign(secret, "v0:"+now+":", string(body))), "{}", ErrInvalidSignature},
+		{"Slack replayed", SlackSignature, slack(old, hexSign(secret, "v0:"+old+":", string(body))), "", ErrStaleSignature},
+		{"Slack missing timestamp", SlackSignature, map[string]string{"X-Slack-Signature": "v0=" + hexSign(secret, string(body))}, "", ErrMissingSignature},
+	} {
+		r := httptest.NewRequest("POST", "/hook", nil)
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		sent := body
+		if tt.body != "" {
+			sent = []byte(tt.body)
+		}
+		if err := tt.scheme(r, sent, secret, 5*time.Minute); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	secret := []byte("s3cret")
+	var got string
+	h := VerifySignature(GitHubSignature, secret, 0)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+	}))
+	post := func(body, sig string) int {
+		r := httptest.NewRequest("POST", "/hook", strings.NewReader(body))
+		r.Header.Set("X-Hub-Signature-256", "sha256="+sig)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	body := `{"action":"opened"}`
+	if code := post(body, hex.EncodeToString(sign(secret, []byte(body)))); code != http.StatusOK || got != body {
+		t.Errorf("signed delivery: %d with body %q, want 200 and the raw body", code, got)
+	}
+	got = ""
+	if code := post(body, "00"); code != http.StatusUnauthorized || got != "" {
+		t.Errorf("unsigned delivery: %d, handler saw %q; want 401 before the handler", code, got)
+	}
+	large := strings.Repeat("a", maxWebhookBody+1)
+	if code := post(large, fmt.Sprintf("%x", sign(secret, []byte(large)))); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized delivery: %d, want 413", code)
+	}
+}
@@ -0,0 +1,223 @@
+package openapi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ritego/build-a-router-with-go/render"
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// ErrUnroutable is reported for the operations skipped because the router
+// does not route their method.
+var ErrUnroutable = errors.New("method not routed by the router")
+
+// routable are the methods route patterns accept.
+var routable = map[string]bool{"GET": true, "PUT": true, "PATCH": true, "POST": true, "DELETE": true, "OPTIONS": true, "HEAD": true}
+
+// unroutable splits ops into those the router can route and an error
+// naming the others.
+func unroutable(ops []OperationInfo) ([]OperationInfo, error) {
+	var kept []OperationInfo
+	var errs []error
+	for _, op := range ops {
+		if !routable[op.Method] {
+			errs = append(errs, fmt.Errorf("openapi: %s skipped: %w", op.Pattern(), ErrUnroutable))
+			continue
+		}
+		kept = append(kept, op)
+	}
+	return kept, errors.Join(errs...)
+}
+
+// OperationInfo describes one operation of a document as a route.
+type OperationInfo struct {
+	Method string
+	Path   string
+	// Name is the Go name of the handler, from the operationId or, without
+	// one, the method and path: GetUsersID for GET /users/{id}.
+	Name    string
+	Summary string
+
+	op *Operation
+}
+
+// Pattern is the route pattern of the operation, e.g. "GET:/users/{id}".
+func (o OperationInfo) Pattern() string {
+	return o.Method + ":" + o.Path
+}
+
+// Operations lists the operations of the document sorted by path, then
+// method, so generated code is stable.
+func (d *Document) Operations() []OperationInfo {
+	var ops []OperationInfo
+	for path, item := range d.Paths {
+		for method, op := range item.operations() {
+			if op == nil {
+				continue
+			}
+			name := goName(op.OperationID)
+			if name == "" {
+				name = goName(strings.ToLower(method) + " " + path)
+			}
+			ops = append(ops, OperationInfo{Method: method, Path: path, Name: name, Summary: op.Summary, op: op})
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Path != ops[j].Path {
+			return ops[i].Path < ops[j].Path
+		}
+		return ops[i].Method < ops[j].Method
+	})
+	return ops
+}
+
+// goName turns an operationId or path into an exported Go identifier:
+// "list-users" and "get /users/{id}" become ListUsers and GetUsersID.
+func goName(s string) string {
+	words := strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	var b strings.Builder
+	for _, w := range words {
+		if strings.EqualFold(w, "id") {
+			b.WriteString("ID")
+			continue
+		}
+		first, size := utf8.DecodeRuneInString(w)
+		b.WriteRune(unicode.ToUpper(first))
+		b.WriteString(w[size:])
+	}
+	name := b.String()
+	if name != "" && unicode.IsDigit(rune(name[0])) {
+		name = "Op" + name
+	}
+	return name
+}
+
+// Generate writes Go source for package pkg declaring a Handlers interface,
+// with one method per operation, and a Register function adding them to a
+// router:
+//
+//	type Handlers interface {
+//		// List the users.
+//		ListUsers(rw http.ResponseWriter, r *http.Request) error
+//	}
+//
+//	func Register(rr *router.Router, h Handlers) {
+//		rr.HandleFuncE("GET:/users", h.ListUsers)
+//	}
+//
+// Operations the router cannot route are left out of the code, which is
+// still written, and reported in an error wrapping ErrUnroutable.
+func Generate(w io.Writer, d *Document, pkg string) error {
+	ops, skipped := unroutable(d.Operations())
+	seen := make(map[string]string, len(ops))
+	for _, op := range ops {
+		if other, ok := seen[op.Name]; ok {
+			return fmt.Errorf("openapi: %s and %s both generate %s, set distinct operationIds", other, op.Pattern(), op.Name)
+		}
+		seen[op.Name] = op.Pattern()
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated from an OpenAPI document. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	b.WriteString("import (\n\t\"net/http\"\n\n\t\"github.com/ritego/build-a-router-with-go/router\"\n)\n\n")
+	b.WriteString("// Handlers serves the operations of the API.\ntype Handlers interface {\n")
+	for _, op := range ops {
+		if op.Summary != "" {
+			fmt.Fprintf(&b, "\t// %s\n", strings.Join(strings.Fields(op.Summary), " "))
+		}
+		fmt.Fprintf(&b, "\t%s(rw http.ResponseWriter, r *http.Request) error\n", op.Name)
+	}
+	b.WriteString("}\n\n// Register registers every operation of the API on rr.\nfunc Register(rr *router.Router, h Handlers) {\n")
+	for _, op := range ops {
+		fmt.Fprintf(&b, "\trr.HandleFuncE(%s, h.%s)\n", strconv.Quote(op.Pattern()), op.Name)
+	}
+	b.WriteString("}\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return fmt.Errorf("openapi: generated invalid code: %w", err)
+	}
+	if _, err := w.Write(src); err != nil {
+		return err
+	}
+	return skipped
+}
+
+// RegisterStubs registers a stub handler on rr for every operation of the
+// document not already routed. Stubs answer with the example of the first
+// 2xx response that has one, or 501 Not Implemented. Operations the router
+// cannot route are skipped and reported in an error wrapping ErrUnroutable,
+// or the router's reason, such as router.ErrParamsUnsupported for paths
+// with parameters on a matcher without them.
+func (d *Document) RegisterStubs(rr *router.Router) error {
+	routed := make(map[string]bool)
+	for _, route := range rr.Routes() {
+		routed[route.Pattern] = true
+	}
+	ops, skipped := unroutable(d.Operations())
+	errs := []error{skipped}
+	for _, op := range ops {
+		if !routed[op.Pattern()] {
+			errs = append(errs, registerStub(rr, op))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// registerStub registers the stub of op, returning the error Handle panics
+// with when the router refuses the route.
+func registerStub(rr *router.Router, op OperationInfo) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			refused, ok := v.(error)
+			if !ok {
+				panic(v)
+			}
+			err = fmt.Errorf("openapi: %s skipped: %w", op.Pattern(), refused)
+		}
+	}()
+	rr.HandleFuncE(op.Pattern(), stubHandler(op)).WithValue("stub", true)
+	return nil
+}
+
+func stubHandler(op OperationInfo) router.HandlerFuncE {
+	codes := make([]string, 0, len(op.op.Responses))
+	for code := range op.op.Responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		status, err := strconv.Atoi(code)
+		if err != nil || status < 200 || status > 299 {
+			continue
+		}
+		resp := op.op.Responses[code]
+		if resp == nil {
+			continue
+		}
+		if media := resp.Content["application/json"]; media != nil && media.Example != nil {
+			return func(rw http.ResponseWriter, r *http.Request) error {
+				return render.JSON(rw, status, media.Example)
+			}
+		}
+		if len(resp.Content) == 0 && status == http.StatusNoContent {
+			return func(rw http.ResponseWriter, r *http.Request) error {
+				rw.WriteHeader(status)
+				return nil
+			}
+		}
+	}
+	return func(rw http.ResponseWriter, r *http.Request) error {
+		return render.WriteProblem(rw, render.NewProblem(http.StatusNotImplemented, op.Pattern()+" is not implemented yet"))
+	}
+}
@@ -0,0 +1,220 @@
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// FieldError describes one way in which a request departs from the spec.
+type FieldError struct {
+	In      string `json:"in"`
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+}
+
+// validate checks a decoded JSON value against s and appends any problems
+// to errs, using path to point at the offending field.
+func (d *Document) validate(s *Schema, v interface{}, in, path string, errs *[]FieldError) {
+	d.check(s, v, in, path, errs, nil)
+}
+
+// check is validate, with applied holding the schemas already being
+// checked against v, so that a schema composing itself through $ref, e.g.
+// in its allOf, ends the recursion instead of looping forever.
+func (d *Document) check(s *Schema, v interface{}, in, path string, errs *[]FieldError, applied map[*Schema]bool) {
+	s = d.schema(s)
+	if s == nil || applied[s] {
+		return
+	}
+	if len(s.AllOf)+len(s.AnyOf)+len(s.OneOf) > 0 {
+		next := make(map[*Schema]bool, len(applied)+1)
+		for k := range applied {
+			next[k] = true
+		}
+		next[s] = true
+		applied = next
+	}
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, FieldError{In: in, Name: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, sub := range s.AllOf {
+		d.check(sub, v, in, path, errs, applied)
+	}
+	if len(s.AnyOf) > 0 && d.matches(s.AnyOf, v, applied) == 0 {
+		fail("does not match any allowed schema")
+	}
+	if len(s.OneOf) > 0 {
+		switch n := d.matches(s.OneOf, v, applied); {
+		case n == 0:
+			fail("does not match any allowed schema")
+		case n > 1:
+			fail("matches %d schemas, want exactly one", n)
+		}
+	}
+
+	if v == nil {
+		if !s.Nullable && s.Type != "" {
+			fail("must not be null")
+		}
+		return
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		fail("must be one of %v", s.Enum)
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			fail("must be an object")
+			return
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			prop, ok := s.Properties[k]
+			if !ok {
+				if extra, isSchema := s.AdditionalProperties.(map[string]interface{}); isSchema && len(extra) > 0 {
+					continue
+				}
+				if s.AdditionalProperties == false {
+					fail("unknown property %q", k)
+				}
+				continue
+			}
+			d.check(prop, obj[k], in, path+"/"+k, errs, nil)
+		}
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			fail("must be an array")
+			return
+		}
+		if s.MinItems != nil && len(arr) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(arr) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		for i, item := range arr {
+			d.check(s.Items, item, in, path+"/"+strconv.Itoa(i), errs, nil)
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			fail("must be a string")
+			return
+		}
+		n := len([]rune(str))
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("must be at most %d characters", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(str) {
+			fail("must match pattern %s", s.Pattern)
+		}
+	case "integer", "number":
+		num, ok := v.(float64)
+		if !ok {
+			fail("must be a %s", s.Type)
+			return
+		}
+		if s.Type == "integer" && num != math.Trunc(num) {
+			fail("must be an integer")
+		}
+		if s.Minimum != nil && num < *s.Minimum {
+			fail("must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && num > *s.Maximum {
+			fail("must be <= %v", *s.Maximum)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			fail("must be a boolean")
+		}
+	}
+}
+
+// matches returns how many of schemas v is valid against.
+func (d *Document) matches(schemas []*Schema, v interface{}, applied map[*Schema]bool) int {
+	n := 0
+	for _, s := range schemas {
+		var errs []FieldError
+		d.check(s, v, "", "", &errs, applied)
+		if len(errs) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if reflect.DeepEqual(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// coerce converts a raw path, query or header value to the JSON type its
+// schema expects so it can go through validate like body values do.
+func (d *Document) coerce(s *Schema, raw []string) (interface{}, error) {
+	s = d.schema(s)
+	if s == nil || len(raw) == 0 {
+		return first(raw), nil
+	}
+
+	switch s.Type {
+	case "array":
+		// Parameters have no nested arrays, and a self-referencing item
+		// schema would recurse forever.
+		if items := d.schema(s.Items); items != nil && items.Type == "array" {
+			return raw[0], nil
+		}
+		items := make([]interface{}, 0, len(raw))
+		for _, r := range raw {
+			item, err := d.coerce(s.Items, []string{r})
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case "integer", "number":
+		f, err := strconv.ParseFloat(raw[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a %s", s.Type)
+		}
+		return f, nil
+	case "boolean":
+		b, err := strconv.ParseBool(raw[0])
+		if err != nil {
+			return nil, fmt.Errorf("must be a boolean")
+		}
+		return b, nil
+	}
+	return raw[0], nil
+}
+
+func first(raw []string) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return raw[0]
+}
@@ -0,0 +1,248 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Document is the subset of an OpenAPI 3 document needed to validate
+// requests and scaffold routes.
+type Document struct {
+	Paths      map[string]*PathItem `json:"paths"`
+	Components struct {
+		Schemas    map[string]*Schema    `json:"schemas"`
+		Parameters map[string]*Parameter `json:"parameters"`
+	} `json:"components"`
+}
+
+type PathItem struct {
+	Parameters []*Parameter `json:"parameters"`
+	Get        *Operation   `json:"get"`
+	Put        *Operation   `json:"put"`
+	Post       *Operation   `json:"post"`
+	Delete     *Operation   `json:"delete"`
+	Options    *Operation   `json:"options"`
+	Head       *Operation   `json:"head"`
+	Patch      *Operation   `json:"patch"`
+}
+
+func (p *PathItem) operations() map[string]*Operation {
+	return map[string]*Operation{
+		"GET": p.Get, "PUT": p.Put, "POST": p.Post, "DELETE": p.Delete,
+		"OPTIONS": p.Options, "HEAD": p.Head, "PATCH": p.Patch,
+	}
+}
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	Parameters  []*Parameter         `json:"parameters"`
+	RequestBody *RequestBody         `json:"requestBody"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema  *Schema     `json:"schema"`
+	Example interface{} `json:"example"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Nullable             bool               `json:"nullable"`
+	Enum                 []interface{}      `json:"enum"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties interface{}        `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	AllOf                []*Schema          `json:"allOf"`
+	AnyOf                []*Schema          `json:"anyOf"`
+	OneOf                []*Schema          `json:"oneOf"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	Pattern              string             `json:"pattern"`
+
+	// pattern is Pattern compiled, by Parse.
+	pattern *regexp.Regexp
+}
+
+// Parse reads a JSON or YAML OpenAPI document.
+func Parse(data []byte) (*Document, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(stringKeys(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if err := doc.compilePatterns(); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// compilePatterns compiles the pattern of every schema once, rather than
+// for every request validated.
+func (d *Document) compilePatterns() error {
+	var schemas []*Schema
+	for _, s := range d.Components.Schemas {
+		schemas = append(schemas, s)
+	}
+	params := func(list []*Parameter) {
+		for _, p := range list {
+			if p != nil {
+				schemas = append(schemas, p.Schema)
+			}
+		}
+	}
+	content := func(media map[string]*MediaType) {
+		for _, m := range media {
+			if m != nil {
+				schemas = append(schemas, m.Schema)
+			}
+		}
+	}
+	for _, p := range d.Components.Parameters {
+		params([]*Parameter{p})
+	}
+	for _, item := range d.Paths {
+		if item == nil {
+			continue
+		}
+		params(item.Parameters)
+		for _, op := range item.operations() {
+			if op == nil {
+				continue
+			}
+			params(op.Parameters)
+			if op.RequestBody != nil {
+				content(op.RequestBody.Content)
+			}
+			for _, res := range op.Responses {
+				if res != nil {
+					content(res.Content)
+				}
+			}
+		}
+	}
+
+	for len(schemas) > 0 {
+		s := schemas[len(schemas)-1]
+		schemas = schemas[:len(schemas)-1]
+		if s == nil {
+			continue
+		}
+		if s.Pattern != "" && s.pattern == nil {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", s.Pattern, err)
+			}
+			s.pattern = re
+		}
+		for _, prop := range s.Properties {
+			schemas = append(schemas, prop)
+		}
+		schemas = append(schemas, s.Items)
+		schemas = append(schemas, s.AllOf...)
+		schemas = append(schemas, s.AnyOf...)
+		schemas = append(schemas, s.OneOf...)
+	}
+	return nil
+}
+
+func ParseFile(path string) (*Document, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("openapi: %s: %w", filepath.Base(path), err)
+	}
+	return doc, nil
+}
+
+// stringKeys converts the map[interface{}]interface{} values produced by
+// yaml.v2 into JSON-compatible maps.
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = stringKeys(val)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = stringKeys(v[i])
+		}
+	}
+	return v
+}
+
+// schema follows the $ref of s, if any, to the schema it names. A cycle of
+// references resolves to nil.
+func (d *Document) schema(s *Schema) *Schema {
+	var seen map[string]bool
+	for s != nil && s.Ref != "" {
+		if seen[s.Ref] {
+			return nil
+		}
+		if seen == nil {
+			seen = make(map[string]bool)
+		}
+		seen[s.Ref] = true
+		s = d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	return s
+}
+
+func (d *Document) parameter(p *Parameter) *Parameter {
+	var seen map[string]bool
+	for p != nil && p.Ref != "" {
+		if seen[p.Ref] {
+			return nil
+		}
+		if seen == nil {
+			seen = make(map[string]bool)
+		}
+		seen[p.Ref] = true
+		p = d.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+	}
+	return p
+}
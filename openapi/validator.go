@@ -0,0 +1,223 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ritego/build-a-router-with-go/render"
+)
+
+// maxBody caps the request body buffered for validation.
+const maxBody = 10 << 20
+
+type operation struct {
+	segments   []string
+	method     string
+	parameters []*Parameter
+	body       *RequestBody
+}
+
+// Validator checks requests against the operations of an OpenAPI document.
+// Requests for paths or methods the document does not describe are passed
+// through untouched and left to the router.
+type Validator struct {
+	doc        *Document
+	operations []*operation
+}
+
+func NewValidator(doc *Document) *Validator {
+	v := &Validator{doc: doc}
+	for template, item := range doc.Paths {
+		for method, op := range item.operations() {
+			if op == nil {
+				continue
+			}
+			v.operations = append(v.operations, &operation{
+				segments:   strings.Split(strings.Trim(template, "/"), "/"),
+				method:     method,
+				parameters: v.mergeParameters(item.Parameters, op.Parameters),
+				body:       op.RequestBody,
+			})
+		}
+	}
+
+	// Concrete paths take precedence over templated ones.
+	sort.SliceStable(v.operations, func(i, j int) bool {
+		return literals(v.operations[i].segments) > literals(v.operations[j].segments)
+	})
+	return v
+}
+
+// mergeParameters lets operation parameters override path-level ones with
+// the same name and location.
+func (v *Validator) mergeParameters(shared, own []*Parameter) []*Parameter {
+	var out []*Parameter
+	seen := make(map[string]bool)
+	for _, p := range own {
+		if p = v.doc.parameter(p); p != nil {
+			seen[p.In+":"+p.Name] = true
+			out = append(out, p)
+		}
+	}
+	for _, p := range shared {
+		if p = v.doc.parameter(p); p != nil && !seen[p.In+":"+p.Name] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func literals(segments []string) int {
+	n := 0
+	for _, s := range segments {
+		if !isTemplate(s) {
+			n++
+		}
+	}
+	return n
+}
+
+func isTemplate(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+func (v *Validator) find(method, path string) (*operation, map[string]string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, op := range v.operations {
+		if op.method != method || len(op.segments) != len(segments) {
+			continue
+		}
+		params := make(map[string]string)
+		matched := true
+		for i, s := range op.segments {
+			if isTemplate(s) {
+				params[s[1:len(s)-1]] = segments[i]
+			} else if s != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return op, params
+		}
+	}
+	return nil, nil
+}
+
+// Middleware rejects requests that do not conform to the document with a
+// 400 problem+json response listing every error found.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		op, pathParams := v.find(r.Method, r.URL.Path)
+		if op == nil {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		errs := v.checkParameters(r, op, pathParams)
+
+		if op.body != nil {
+			status, bodyErrs := v.checkBody(r, op.body)
+			if status == http.StatusUnsupportedMediaType || status == http.StatusRequestEntityTooLarge {
+				http.Error(rw, http.StatusText(status), status)
+				return
+			}
+			errs = append(errs, bodyErrs...)
+		}
+
+		if len(errs) > 0 {
+			p := render.NewProblem(http.StatusBadRequest, "the request does not conform to the API specification")
+			p.Extensions = map[string]interface{}{"errors": errs}
+			render.WriteProblem(rw, p)
+			return
+		}
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func (v *Validator) checkParameters(r *http.Request, op *operation, pathParams map[string]string) []FieldError {
+	var errs []FieldError
+	query := r.URL.Query()
+	for _, p := range op.parameters {
+		var raw []string
+		switch p.In {
+		case "path":
+			raw = []string{pathParams[p.Name]}
+		case "query":
+			raw = query[p.Name]
+		case "header":
+			raw = r.Header.Values(p.Name)
+		case "cookie":
+			if c, err := r.Cookie(p.Name); err == nil {
+				raw = []string{c.Value}
+			}
+		}
+
+		if len(raw) == 0 {
+			if p.Required || p.In == "path" {
+				errs = append(errs, FieldError{In: p.In, Name: p.Name, Message: "is required"})
+			}
+			continue
+		}
+
+		value, err := v.doc.coerce(p.Schema, raw)
+		if err != nil {
+			errs = append(errs, FieldError{In: p.In, Name: p.Name, Message: err.Error()})
+			continue
+		}
+		var perrs []FieldError
+		v.doc.validate(p.Schema, value, p.In, "", &perrs)
+		for _, e := range perrs {
+			e.Name = p.Name + e.Name
+			errs = append(errs, e)
+		}
+	}
+	return errs
+}
+
+// checkBody validates JSON bodies and leaves the body readable for the
+// handler. Media types other than JSON are only checked for being declared.
+func (v *Validator) checkBody(r *http.Request, spec *RequestBody) (int, []FieldError) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return http.StatusBadRequest, []FieldError{{In: "body", Message: "could not be read"}}
+	}
+	if len(data) > maxBody {
+		return http.StatusRequestEntityTooLarge, nil
+	}
+
+	if len(data) == 0 {
+		if spec.Required {
+			return http.StatusBadRequest, []FieldError{{In: "body", Message: "is required"}}
+		}
+		return http.StatusOK, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	content, ok := spec.Content[mediaType]
+	if !ok {
+		content, ok = spec.Content["*/*"]
+	}
+	if !ok {
+		return http.StatusUnsupportedMediaType, nil
+	}
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return http.StatusOK, nil
+	}
+
+	var body interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return http.StatusBadRequest, []FieldError{{In: "body", Message: "is not valid JSON"}}
+	}
+	var errs []FieldError
+	v.doc.validate(content.Schema, body, "body", "", &errs)
+	return http.StatusBadRequest, errs
+}
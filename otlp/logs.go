@@ -0,0 +1,159 @@
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Handler returns a slog.Handler passing records to next and queueing
+// those next is enabled for to be exported as OTLP logs, with their
+// attributes flattened into dotted keys.
+func (e *Exporter) Handler(next slog.Handler) slog.Handler {
+	return &logHandler{exporter: e, next: next}
+}
+
+type logHandler struct {
+	exporter *Exporter
+	next     slog.Handler
+	attrs    []attribute
+	group    string
+}
+
+func (h *logHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *logHandler) Handle(ctx context.Context, r slog.Record) error {
+	attrs := append([]attribute(nil), h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = appendAttr(attrs, h.group, a)
+		return true
+	})
+	number, text := severity(r.Level)
+	h.exporter.queue(newLogRecord(r.Time, number, text, r.Message, attrs))
+	return h.next.Handle(ctx, r)
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.next = h.next.WithAttrs(attrs)
+	c.attrs = append([]attribute(nil), h.attrs...)
+	for _, a := range attrs {
+		c.attrs = appendAttr(c.attrs, h.group, a)
+	}
+	return &c
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.next = h.next.WithGroup(name)
+	c.group = h.group + name + "."
+	return &c
+}
+
+func (e *Exporter) queue(r logRecord) {
+	e.logsMu.Lock()
+	defer e.logsMu.Unlock()
+
+	if len(e.logs) >= e.opts.MaxQueue {
+		e.dropped++
+		return
+	}
+	e.logs = append(e.logs, r)
+}
+
+// appendAttr appends a, with groups flattened into "group.key" keys.
+func appendAttr(attrs []attribute, prefix string, a slog.Attr) []attribute {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range v.Group() {
+			attrs = appendAttr(attrs, prefix, ga)
+		}
+		return attrs
+	}
+	if a.Key == "" {
+		return attrs
+	}
+
+	key := prefix + a.Key
+	switch v.Kind() {
+	case slog.KindInt64:
+		return append(attrs, intAttribute(key, v.Int64()))
+	case slog.KindUint64:
+		s := strconv.FormatUint(v.Uint64(), 10)
+		return append(attrs, attribute{Key: key, Value: value{IntValue: &s}})
+	case slog.KindFloat64:
+		f := v.Float64()
+		return append(attrs, attribute{Key: key, Value: value{DoubleValue: &f}})
+	case slog.KindBool:
+		b := v.Bool()
+		return append(attrs, attribute{Key: key, Value: value{BoolValue: &b}})
+	case slog.KindDuration:
+		// Durations are nanoseconds, as in the JSON handler.
+		return append(attrs, intAttribute(key, int64(v.Duration())))
+	case slog.KindTime:
+		return append(attrs, stringAttribute(key, v.Time().Format(time.RFC3339Nano)))
+	}
+	return append(attrs, stringAttribute(key, fmt.Sprint(v.Any())))
+}
+
+// OTel severity numbers of the slog levels; the levels in between map to
+// the numbers in between, e.g. slog.LevelInfo+1 to INFO2.
+const (
+	severityDebug = 5
+	severityInfo  = 9
+	severityWarn  = 13
+	severityError = 17
+)
+
+func severity(level slog.Level) (int, string) {
+	switch {
+	case level < slog.LevelDebug:
+		return 1, "TRACE"
+	case level < slog.LevelInfo:
+		return severityDebug + min(int(level-slog.LevelDebug), 3), "DEBUG"
+	case level < slog.LevelWarn:
+		return severityInfo + min(int(level-slog.LevelInfo), 3), "INFO"
+	case level < slog.LevelError:
+		return severityWarn + min(int(level-slog.LevelWarn), 3), "WARN"
+	}
+	return severityError + min(int(level-slog.LevelError), 3), "ERROR"
+}
+
+type exportLogs struct {
+	ResourceLogs []resourceLogs `json:"resourceLogs"`
+}
+
+type resourceLogs struct {
+	Resource  resource    `json:"resource"`
+	ScopeLogs []scopeLogs `json:"scopeLogs"`
+}
+
+type scopeLogs struct {
+	Scope      instrumentationScope `json:"scope"`
+	LogRecords []logRecord          `json:"logRecords"`
+}
+
+type logRecord struct {
+	TimeUnixNano   string      `json:"timeUnixNano"`
+	SeverityNumber int         `json:"severityNumber"`
+	SeverityText   string      `json:"severityText"`
+	Body           value       `json:"body"`
+	Attributes     []attribute `json:"attributes,omitempty"`
+}
+
+func newLogRecord(t time.Time, number int, text, msg string, attrs []attribute) logRecord {
+	return logRecord{
+		TimeUnixNano:   unixNano(t),
+		SeverityNumber: number,
+		SeverityText:   text,
+		Body:           value{StringValue: &msg},
+		Attributes:     attrs,
+	}
+}
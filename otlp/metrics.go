@@ -0,0 +1,153 @@
+package otlp
+
+import (
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// Record adds a request to the exported metrics: the
+// http.server.request.duration histogram of the OTel HTTP semantic
+// conventions, with the method, route, status and the route's metric
+// labels as attributes.
+func (e *Exporter) Record(m router.RequestMetric) {
+	e.metrics.record(m)
+}
+
+type metrics struct {
+	mu     sync.Mutex
+	series map[seriesKey]*series
+}
+
+type seriesKey struct {
+	route  *router.Route
+	method string
+	status int
+}
+
+// series is cumulative since the exporter started.
+type series struct {
+	attributes []attribute
+	bounds     []float64
+	counts     []uint64
+	sum        float64
+	count      uint64
+}
+
+func (ms *metrics) record(m router.RequestMetric) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	key := seriesKey{m.Route, m.Method, m.Status}
+	s := ms.series[key]
+	if s == nil {
+		s = newSeries(m)
+		ms.series[key] = s
+	}
+	secs := m.Duration.Seconds()
+	i, _ := slices.BinarySearch(s.bounds, secs)
+	s.counts[i]++
+	s.sum += secs
+	s.count++
+}
+
+func newSeries(m router.RequestMetric) *series {
+	attrs := map[string]string{}
+	if m.Route != nil {
+		for k, v := range m.Route.MetricLabels() {
+			attrs[k] = v
+		}
+	}
+	attrs["http.request.method"] = m.Method
+	attrs["http.route"] = m.RouteLabel()
+	attributes := stringAttributes(attrs)
+	attributes = append(attributes, intAttribute("http.response.status_code", int64(m.Status)))
+
+	bounds := m.Buckets
+	if len(bounds) == 0 {
+		bounds = router.DefaultBuckets
+	}
+	// One more count than bounds, for the values above the last.
+	return &series{attributes: attributes, bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+// request returns the export request of every series, or nil when no
+// request was recorded yet.
+func (ms *metrics) request(res resource, start, now time.Time) any {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if len(ms.series) == 0 {
+		return nil
+	}
+	hist := histogramData{AggregationTemporality: temporalityCumulative}
+	for _, s := range ms.series {
+		counts := make([]string, len(s.counts))
+		for i, n := range s.counts {
+			counts[i] = strconv.FormatUint(n, 10)
+		}
+		hist.DataPoints = append(hist.DataPoints, histogramDataPoint{
+			Attributes:        s.attributes,
+			StartTimeUnixNano: unixNano(start),
+			TimeUnixNano:      unixNano(now),
+			Count:             strconv.FormatUint(s.count, 10),
+			Sum:               s.sum,
+			BucketCounts:      counts,
+			ExplicitBounds:    s.bounds,
+		})
+	}
+
+	return exportMetrics{ResourceMetrics: []resourceMetrics{{
+		Resource: res,
+		ScopeMetrics: []scopeMetrics{{
+			Scope: scope,
+			Metrics: []metric{{
+				Name:        "http.server.request.duration",
+				Description: "Time to serve requests.",
+				Unit:        "s",
+				Histogram:   &hist,
+			}},
+		}},
+	}}}
+}
+
+const temporalityCumulative = 2
+
+type exportMetrics struct {
+	ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+}
+
+type resourceMetrics struct {
+	Resource     resource       `json:"resource"`
+	ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+}
+
+type scopeMetrics struct {
+	Scope   instrumentationScope `json:"scope"`
+	Metrics []metric             `json:"metrics"`
+}
+
+type metric struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Unit        string         `json:"unit,omitempty"`
+	Histogram   *histogramData `json:"histogram"`
+}
+
+type histogramData struct {
+	DataPoints             []histogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+}
+
+type histogramDataPoint struct {
+	Attributes        []attribute `json:"attributes"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	TimeUnixNano      string      `json:"timeUnixNano"`
+	Count             string      `json:"count"`
+	Sum               float64     `json:"sum"`
+	BucketCounts      []string    `json:"bucketCounts"`
+	ExplicitBounds    []float64   `json:"explicitBounds"`
+}
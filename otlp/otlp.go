@@ -0,0 +1,207 @@
+// Package otlp exports request metrics and logs to an OpenTelemetry
+// collector with the OTLP/HTTP protocol, in its JSON encoding, so the
+// router needs no agent beside it in OTel-native environments.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configure an Exporter.
+type Options struct {
+	// Endpoint is the collector's base URL, e.g. http://localhost:4318;
+	// metrics go to /v1/metrics and logs to /v1/logs below it.
+	Endpoint string
+	// Headers are sent with every export, e.g. an API key.
+	Headers map[string]string
+	// Resource describes the router, e.g. service.name and
+	// deployment.environment. service.name defaults to "router".
+	Resource map[string]string
+	// Interval is how often metrics and logs are exported, 10s by default.
+	Interval time.Duration
+	// MaxQueue bounds the logs waiting for the next export, 2048 by
+	// default; logs beyond it are dropped.
+	MaxQueue int
+	// Client sends the exports, with a 10s timeout by default.
+	Client *http.Client
+}
+
+// Exporter collects request metrics, as a router.MetricsSink, and logs,
+// through Handler, and exports them every Interval while Run runs.
+type Exporter struct {
+	opts     Options
+	resource resource
+	start    time.Time
+
+	metrics metrics
+
+	logsMu  sync.Mutex
+	logs    []logRecord
+	dropped int
+}
+
+func New(opts Options) (*Exporter, error) {
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("otlp: endpoint: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("otlp: endpoint %q: want an http or https URL", opts.Endpoint)
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if opts.MaxQueue <= 0 {
+		opts.MaxQueue = 2048
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	attrs := map[string]string{"service.name": "router"}
+	for k, v := range opts.Resource {
+		attrs[k] = v
+	}
+	return &Exporter{
+		opts:     opts,
+		resource: resource{Attributes: stringAttributes(attrs)},
+		start:    time.Now(),
+		metrics:  metrics{series: make(map[seriesKey]*series)},
+	}, nil
+}
+
+// Run exports every Interval until ctx is done, then exports what is left.
+// Failed exports are logged, and retried at the next interval for metrics,
+// which are cumulative, but lost for logs. Run it as a server task.
+func (e *Exporter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := e.export(ctx); err != nil {
+				slog.Warn("OTLP Export Failed", "err", err)
+			}
+		case <-ctx.Done():
+			// Shut down with a context of its own, as ctx is done.
+			ctx, cancel := context.WithTimeout(context.Background(), e.opts.Client.Timeout+time.Second)
+			defer cancel()
+			return e.export(ctx)
+		}
+	}
+}
+
+// export sends the metrics and the queued logs.
+func (e *Exporter) export(ctx context.Context) error {
+	var errs []error
+	if body := e.metrics.request(e.resource, e.start, time.Now()); body != nil {
+		errs = append(errs, e.post(ctx, "/v1/metrics", body))
+	}
+
+	e.logsMu.Lock()
+	logs, dropped := e.logs, e.dropped
+	e.logs, e.dropped = nil, 0
+	e.logsMu.Unlock()
+	if dropped > 0 {
+		logs = append(logs, newLogRecord(time.Now(), severityWarn, "WARN", "otlp: log queue full",
+			[]attribute{intAttribute("dropped", int64(dropped))}))
+	}
+	if len(logs) > 0 {
+		errs = append(errs, e.post(ctx, "/v1/logs", exportLogs{ResourceLogs: []resourceLogs{{
+			Resource:  e.resource,
+			ScopeLogs: []scopeLogs{{Scope: scope, LogRecords: logs}},
+		}}}))
+	}
+	return errors.Join(errs...)
+}
+
+func (e *Exporter) post(ctx context.Context, path string, body any) error {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(e.opts.Endpoint, "/")+path, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := e.opts.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("otlp: %s: %w", path, err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp: %s: %s", path, res.Status)
+	}
+	return nil
+}
+
+// The OTLP JSON encoding of the messages sent, see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding.
+// 64-bit integers are strings, as in the protobuf JSON mapping.
+
+type resource struct {
+	Attributes []attribute `json:"attributes"`
+}
+
+type instrumentationScope struct {
+	Name string `json:"name"`
+}
+
+var scope = instrumentationScope{Name: "github.com/ritego/build-a-router-with-go"}
+
+type attribute struct {
+	Key   string `json:"key"`
+	Value value  `json:"value"`
+}
+
+type value struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+func stringAttribute(key, v string) attribute {
+	return attribute{Key: key, Value: value{StringValue: &v}}
+}
+
+func intAttribute(key string, n int64) attribute {
+	s := fmt.Sprint(n)
+	return attribute{Key: key, Value: value{IntValue: &s}}
+}
+
+// stringAttributes returns attrs in key order, so series keep their
+// identity between exports.
+func stringAttributes(attrs map[string]string) []attribute {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]attribute, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, stringAttribute(k, attrs[k]))
+	}
+	return out
+}
+
+func unixNano(t time.Time) string {
+	return fmt.Sprint(t.UnixNano())
+}
@@ -0,0 +1,217 @@
+// Package paginate parses the pagination, sort and filter query parameters
+// shared by list endpoints, and writes the matching Link and X-Total-Count
+// headers.
+//
+//	GET /users?page=2&per_page=50&sort=-created,name&status=active&age[gte]=18
+package paginate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ritego/build-a-router-with-go/bind"
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+var (
+	ErrUnknownSort   = errors.New("field cannot be sorted on")
+	ErrUnknownFilter = errors.New("operator is not supported")
+	ErrUnfilterable  = errors.New("field cannot be filtered on")
+	ErrOutOfRange    = errors.New("out of range")
+)
+
+type Options struct {
+	// DefaultLimit is the page size when per_page is absent, 20 by default.
+	DefaultLimit int
+	// MaxLimit caps per_page, 100 by default.
+	MaxLimit int
+	// Sortable and Filterable list the fields clients may sort and filter
+	// on. Sorting on others, or filtering with an operator as in
+	// "other[gte]=1", is refused rather than ignored, so typos surface;
+	// plain "other=1" parameters cannot be told from the handler's own and
+	// are left to it.
+	Sortable   []string
+	Filterable []string
+}
+
+// Sort is one field of the sort parameter; "-created" sorts descending.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Filter is one condition: "status=active" has Op "eq", "age[gte]=18" has
+// Op "gte" and "id[in]=1,2" has Values ["1", "2"].
+type Filter struct {
+	Field  string
+	Op     string
+	Values []string
+}
+
+var operators = map[string]bool{"eq": true, "ne": true, "lt": true, "lte": true, "gt": true, "gte": true, "in": true}
+
+// Query is a parsed list request.
+type Query struct {
+	Page    int
+	Limit   int
+	Sort    []Sort
+	Filters []Filter
+}
+
+// Offset is the number of items before the requested page.
+func (q Query) Offset() int {
+	return (q.Page - 1) * q.Limit
+}
+
+// Parse reads page, per_page (or limit and offset), sort and filters from the
+// query string. Bad values fail with a *bind.FieldError, which error pages
+// answer with 400.
+func Parse(r *http.Request, opts Options) (Query, error) {
+	if opts.DefaultLimit <= 0 {
+		opts.DefaultLimit = 20
+	}
+	if opts.MaxLimit <= 0 {
+		opts.MaxLimit = 100
+	}
+	values := r.URL.Query()
+	q := Query{Page: 1, Limit: opts.DefaultLimit}
+
+	var err error
+	if q.Limit, err = intParam(values, "per_page", q.Limit, 1, opts.MaxLimit); err != nil {
+		return q, err
+	}
+	if values.Has("limit") {
+		if q.Limit, err = intParam(values, "limit", q.Limit, 1, opts.MaxLimit); err != nil {
+			return q, err
+		}
+	}
+	// Pages beyond maxPage would overflow Offset.
+	maxPage := math.MaxInt / q.Limit
+	if q.Page, err = intParam(values, "page", 1, 1, maxPage); err != nil {
+		return q, err
+	}
+	if values.Has("offset") {
+		offset, err := intParam(values, "offset", 0, 0, 0)
+		if err != nil {
+			return q, err
+		}
+		if offset%q.Limit != 0 {
+			return q, fieldError("offset", values.Get("offset"), fmt.Errorf("must be a multiple of the page size %d", q.Limit))
+		}
+		if offset/q.Limit >= maxPage {
+			return q, fieldError("offset", values.Get("offset"), ErrOutOfRange)
+		}
+		q.Page = offset/q.Limit + 1
+	}
+
+	if order := values.Get("sort"); order != "" {
+		for _, field := range strings.Split(order, ",") {
+			s := Sort{Field: strings.TrimPrefix(field, "-"), Desc: strings.HasPrefix(field, "-")}
+			if !contains(opts.Sortable, s.Field) {
+				return q, fieldError("sort", field, ErrUnknownSort)
+			}
+			q.Sort = append(q.Sort, s)
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		vs := values[name]
+		field, op := name, "eq"
+		i := strings.IndexByte(name, '[')
+		bracketed := i > 0 && strings.HasSuffix(name, "]")
+		if bracketed {
+			field, op = name[:i], name[i+1:len(name)-1]
+		}
+		if !contains(opts.Filterable, field) {
+			if bracketed {
+				return q, fieldError(name, vs[0], ErrUnfilterable)
+			}
+			continue
+		}
+		if !operators[op] {
+			return q, fieldError(name, vs[0], ErrUnknownFilter)
+		}
+		for _, v := range vs {
+			f := Filter{Field: field, Op: op, Values: []string{v}}
+			if op == "in" {
+				f.Values = strings.Split(v, ",")
+			}
+			q.Filters = append(q.Filters, f)
+		}
+	}
+	return q, nil
+}
+
+func intParam(values url.Values, name string, def, lo, hi int) (int, error) {
+	s := values.Get(name)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fieldError(name, s, errors.New("not an integer"))
+	}
+	if n < lo || (hi > 0 && n > hi) {
+		return 0, fieldError(name, s, ErrOutOfRange)
+	}
+	return n, nil
+}
+
+func fieldError(name, value string, err error) error {
+	return &bind.FieldError{Field: name, Source: "query", Name: name, Value: value, Err: err}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SetHeaders writes X-Total-Count and a Link header with the first, prev,
+// next and last pages, keeping the request's other query parameters. The
+// links use the path as the client sent it, before a mount's prefix was
+// stripped. total below zero, for an unknown count, leaves out
+// X-Total-Count and last.
+func (q Query) SetHeaders(rw http.ResponseWriter, r *http.Request, total int) {
+	last := 0
+	if total >= 0 {
+		rw.Header().Set("X-Total-Count", strconv.Itoa(total))
+		last = max(1, (total+q.Limit-1)/q.Limit)
+	}
+
+	link := func(page int, rel string) string {
+		values := r.URL.Query()
+		values.Del("offset")
+		values.Del("limit")
+		values.Set("page", strconv.Itoa(page))
+		values.Set("per_page", strconv.Itoa(q.Limit))
+		u := url.URL{Path: router.OriginalPath(r), RawQuery: values.Encode()}
+		return fmt.Sprintf("<%s>; rel=%q", u.String(), rel)
+	}
+
+	links := []string{link(1, "first")}
+	if q.Page > 1 {
+		links = append(links, link(q.Page-1, "prev"))
+	}
+	if last == 0 || q.Page < last {
+		links = append(links, link(q.Page+1, "next"))
+	}
+	if last > 0 {
+		links = append(links, link(last, "last"))
+	}
+	rw.Header().Set("Link", strings.Join(links, ", "))
+}
@@ -0,0 +1,97 @@
+// Package plugins loads handlers and middleware from Go plugins, shared
+// objects built with -buildmode=plugin, so operators can add custom
+// authentication or transformations without recompiling the router.
+//
+// A plugin is a main package exporting
+//
+//	func New(config map[string]any) (any, error)
+//
+// returning a router.Middleware, wrapping every request, or a
+// router.RouteProvider, whose routes are registered (with its middleware
+// if it is a router.MiddlewareProvider). Plugins must be built with the
+// same Go version and the same version of this module as the router, and
+// are only supported where the plugin package is (Linux, macOS and
+// FreeBSD with cgo). They run in the router's process; a panicking plugin
+// handler is recovered like any other handler.
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"plugin"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// Symbol is the function a plugin exports.
+const Symbol = "New"
+
+var ErrUnsupported = errors.New("plugin returned neither a router.Middleware nor a router.RouteProvider")
+
+// Spec is one plugin to load.
+type Spec struct {
+	Path string `mapstructure:"path"`
+	// Config is passed to the plugin's New.
+	Config map[string]any `mapstructure:"config"`
+}
+
+// Plugin is a loaded plugin.
+type Plugin struct {
+	Path  string
+	Value any
+}
+
+// Load opens the plugin at spec.Path and calls its New. A plugin stays
+// loaded for the life of the process, even when Load fails.
+func Load(spec Spec) (*Plugin, error) {
+	p, err := plugin.Open(spec.Path)
+	if err != nil {
+		return nil, fmt.Errorf("plugins: %w", err)
+	}
+	sym, err := p.Lookup(Symbol)
+	if err != nil {
+		return nil, fmt.Errorf("plugins: %s: %w", spec.Path, err)
+	}
+	newFn, ok := sym.(func(map[string]any) (any, error))
+	if !ok {
+		return nil, fmt.Errorf("plugins: %s: %s is a %T, want func(map[string]any) (any, error)", spec.Path, Symbol, sym)
+	}
+	v, err := newFn(spec.Config)
+	if err != nil {
+		return nil, fmt.Errorf("plugins: %s: %w", spec.Path, err)
+	}
+	return &Plugin{Path: spec.Path, Value: v}, nil
+}
+
+// Install adds the plugin's middleware or routes to rr.
+func (p *Plugin) Install(rr *router.Router) error {
+	switch v := p.Value.(type) {
+	case router.Middleware:
+		rr.Use(v)
+	case func(http.Handler) http.Handler:
+		rr.Use(v)
+	case router.RouteProvider:
+		rr.Register(v)
+	default:
+		return fmt.Errorf("plugins: %s: %w, got %T", p.Path, ErrUnsupported, p.Value)
+	}
+	return nil
+}
+
+// LoadAll loads and installs every plugin in order, stopping at the first
+// failure.
+func LoadAll(rr *router.Router, specs []Spec) ([]*Plugin, error) {
+	loaded := make([]*Plugin, 0, len(specs))
+	for _, spec := range specs {
+		p, err := Load(spec)
+		if err != nil {
+			return loaded, err
+		}
+		if err := p.Install(rr); err != nil {
+			return loaded, err
+		}
+		loaded = append(loaded, p)
+	}
+	return loaded, nil
+}
@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// Upstream is one server of a proxy's pool.
+type Upstream struct {
+	URL *url.URL
+
+	// downUntil is the UnixNano time until which the upstream is skipped.
+	downUntil atomic.Int64
+}
+
+func (u *Upstream) Healthy() bool {
+	return time.Now().UnixNano() >= u.downUntil.Load()
+}
+
+// Balancer picks the upstream serving each request. Update is called with
+// the healthy upstreams at start and whenever health changes; Pick may be
+// called concurrently with itself and with Update.
+type Balancer interface {
+	Update(upstreams []*Upstream)
+	Pick(r *http.Request) *Upstream
+}
+
+// RoundRobin spreads requests evenly over the upstreams.
+type RoundRobin struct {
+	upstreams atomic.Pointer[[]*Upstream]
+	next      atomic.Uint64
+}
+
+func (b *RoundRobin) Update(upstreams []*Upstream) {
+	b.upstreams.Store(&upstreams)
+}
+
+func (b *RoundRobin) Pick(r *http.Request) *Upstream {
+	list := b.upstreams.Load()
+	if list == nil || len(*list) == 0 {
+		return nil
+	}
+	return (*list)[(b.next.Add(1)-1)%uint64(len(*list))]
+}
+
+// HashKey extracts the value requests are hashed by. An empty key falls
+// back to the client IP.
+type HashKey func(r *http.Request) string
+
+func HashHeader(name string) HashKey {
+	return func(r *http.Request) string { return r.Header.Get(name) }
+}
+
+func HashCookie(name string) HashKey {
+	return func(r *http.Request) string {
+		c, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return c.Value
+	}
+}
+
+// HashClientIP keys requests by router.ClientIP.
+func HashClientIP(r *http.Request) string {
+	if ip := router.ClientIP(r); ip.IsValid() {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
+
+// ringReplicas is how many points each upstream gets on the ring, enough
+// to spread keys within a few percent of evenly.
+const ringReplicas = 160
+
+type ringPoint struct {
+	hash     uint64
+	upstream *Upstream
+}
+
+// ConsistentHash sends requests with the same key to the same upstream.
+// When an upstream leaves or rejoins the pool only the keys it owns move.
+type ConsistentHash struct {
+	key  HashKey
+	ring atomic.Pointer[[]ringPoint]
+}
+
+func NewConsistentHash(key HashKey) *ConsistentHash {
+	return &ConsistentHash{key: key}
+}
+
+func (b *ConsistentHash) Update(upstreams []*Upstream) {
+	ring := make([]ringPoint, 0, len(upstreams)*ringReplicas)
+	for _, u := range upstreams {
+		for i := 0; i < ringReplicas; i++ {
+			ring = append(ring, ringPoint{hash: hashString(u.URL.String() + "#" + strconv.Itoa(i)), upstream: u})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	b.ring.Store(&ring)
+}
+
+func (b *ConsistentHash) Pick(r *http.Request) *Upstream {
+	ring := b.ring.Load()
+	if ring == nil || len(*ring) == 0 {
+		return nil
+	}
+
+	key := b.key(r)
+	if key == "" {
+		key = HashClientIP(r)
+	}
+	h := hashString(key)
+	i := sort.Search(len(*ring), func(i int) bool { return (*ring)[i].hash >= h })
+	if i == len(*ring) {
+		i = 0
+	}
+	return (*ring)[i].upstream
+}
+
+// hashString is FNV-1a followed by the splitmix64 finalizer: FNV alone
+// spreads short, similar strings such as "host:8001#1" poorly on the ring.
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,298 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Discoverer finds the upstreams of a pool. Discover returns their URLs;
+// implementations backed by a watch API block until the set changes.
+type Discoverer interface {
+	Discover(ctx context.Context) ([]string, error)
+}
+
+// Discover keeps the pool in sync with d until ctx is done, calling it
+// again interval after each result. Failed lookups are logged and the pool
+// is left as it was. It is meant to run as a server task.
+func (p *Proxy) Discover(ctx context.Context, d Discoverer, interval time.Duration) error {
+	for {
+		upstreams, err := d.Discover(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == nil {
+			sort.Strings(upstreams)
+			err = p.SetUpstreams(upstreams)
+		}
+		if err != nil {
+			slog.Warn("proxy: discovery failed, keeping the current upstreams", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// DNSSRV discovers upstreams from the SRV records of _service._proto.name.
+type DNSSRV struct {
+	Service, Proto, Name string
+	// Scheme of the upstream URLs, "http" by default.
+	Scheme   string
+	Resolver *net.Resolver
+}
+
+func (d *DNSSRV) Discover(ctx context.Context) ([]string, error) {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	_, records, err := resolver.LookupSRV(ctx, d.Service, d.Proto, d.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	upstreams := make([]string, 0, len(records))
+	for _, srv := range records {
+		host := strings.TrimSuffix(srv.Target, ".")
+		upstreams = append(upstreams, upstreamURL(d.Scheme, host, int(srv.Port)))
+	}
+	return upstreams, nil
+}
+
+// Consul discovers the healthy instances of a Consul service, using
+// blocking queries so changes are picked up as soon as they happen.
+type Consul struct {
+	// Addr is the agent's address, http://127.0.0.1:8500 by default.
+	Addr    string
+	Service string
+	Token   string
+	Scheme  string
+	Client  *http.Client
+
+	index string
+}
+
+func (c *Consul) Discover(ctx context.Context) ([]string, error) {
+	addr := c.Addr
+	if addr == "" {
+		addr = "http://127.0.0.1:8500"
+	}
+	q := url.Values{"passing": {"1"}, "wait": {"5m"}}
+	if c.index != "" {
+		q.Set("index", c.index)
+	}
+	u := strings.TrimSuffix(addr, "/") + "/v1/health/service/" + url.PathEscape(c.Service) + "?" + q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("X-Consul-Token", c.Token)
+	}
+	res, err := client(c.Client).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("consul: %s: %s", c.Service, res.Status)
+	}
+
+	var entries []struct {
+		Node    struct{ Address string }
+		Service struct {
+			Address string
+			Port    int
+		}
+	}
+	if err := json.NewDecoder(res.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("consul: %w", err)
+	}
+	c.index = res.Header.Get("X-Consul-Index")
+
+	upstreams := make([]string, 0, len(entries))
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		upstreams = append(upstreams, upstreamURL(c.Scheme, host, e.Service.Port))
+	}
+	return upstreams, nil
+}
+
+const serviceAccount = "/var/run/secrets/kubernetes.io/serviceaccount/"
+
+// Kubernetes discovers the ready addresses of a Service from its Endpoints,
+// watching them through the API server. It must run inside the cluster,
+// with a service account allowed to get and watch endpoints.
+type Kubernetes struct {
+	Namespace string
+	Service   string
+	// Port is the name of the endpoint port to use; the first port when
+	// empty.
+	Port   string
+	Scheme string
+
+	client          *http.Client
+	resourceVersion string
+}
+
+type endpoints struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Subsets []struct {
+		Addresses []struct {
+			IP string `json:"ip"`
+		} `json:"addresses"`
+		Ports []struct {
+			Name string `json:"name"`
+			Port int    `json:"port"`
+		} `json:"ports"`
+	} `json:"subsets"`
+}
+
+func (k *Kubernetes) Discover(ctx context.Context) ([]string, error) {
+	if k.client == nil {
+		c, err := inClusterClient()
+		if err != nil {
+			return nil, err
+		}
+		k.client = c
+	}
+
+	namespace := k.Namespace
+	if namespace == "" {
+		ns, err := os.ReadFile(serviceAccount + "namespace")
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes: %w", err)
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+	base := "https://" + net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")) +
+		"/api/v1/namespaces/" + url.PathEscape(namespace) + "/endpoints"
+
+	// The first call lists the endpoints; later calls watch for the next
+	// change after the version already seen.
+	var u string
+	if k.resourceVersion == "" {
+		u = base + "/" + url.PathEscape(k.Service)
+	} else {
+		u = base + "?" + url.Values{
+			"watch":           {"1"},
+			"fieldSelector":   {"metadata.name=" + k.Service},
+			"resourceVersion": {k.resourceVersion},
+			"timeoutSeconds":  {"300"},
+		}.Encode()
+	}
+
+	body, err := k.get(ctx, u)
+	if err != nil {
+		k.resourceVersion = ""
+		return nil, err
+	}
+	defer body.Close()
+
+	var ep endpoints
+	if k.resourceVersion == "" {
+		if err := json.NewDecoder(body).Decode(&ep); err != nil {
+			return nil, fmt.Errorf("kubernetes: %w", err)
+		}
+	} else {
+		var event struct {
+			Type   string    `json:"type"`
+			Object endpoints `json:"object"`
+		}
+		if err := json.NewDecoder(body).Decode(&event); err != nil || event.Type == "ERROR" {
+			// The watch timed out or its version expired: list again.
+			k.resourceVersion = ""
+			return k.Discover(ctx)
+		}
+		ep = event.Object
+	}
+	k.resourceVersion = ep.Metadata.ResourceVersion
+
+	var upstreams []string
+	for _, subset := range ep.Subsets {
+		port := 0
+		for _, p := range subset.Ports {
+			if k.Port == "" || p.Name == k.Port {
+				port = p.Port
+				break
+			}
+		}
+		if port == 0 {
+			continue
+		}
+		for _, a := range subset.Addresses {
+			upstreams = append(upstreams, upstreamURL(k.Scheme, a.IP, port))
+		}
+	}
+	return upstreams, nil
+}
+
+func (k *Kubernetes) get(ctx context.Context, u string) (io.ReadCloser, error) {
+	token, err := os.ReadFile(serviceAccount + "token")
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+
+	res, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("kubernetes: endpoints %s: %s", k.Service, res.Status)
+	}
+	return res.Body, nil
+}
+
+func inClusterClient() (*http.Client, error) {
+	ca, err := os.ReadFile(serviceAccount + "ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes: not running in a cluster: %w", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+	}}, nil
+}
+
+func client(c *http.Client) *http.Client {
+	if c != nil {
+		return c
+	}
+	return http.DefaultClient
+}
+
+func upstreamURL(scheme, host string, port int) string {
+	if scheme == "" {
+		scheme = "http"
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(port))
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// DefaultStrip are the headers upstreams commonly trust because only a
+// front proxy is expected to set them. Clients setting them could spoof
+// their address, identity or the URL that was authorised.
+var DefaultStrip = []string{
+	"Forwarded",
+	"X-Real-Ip",
+	"X-Client-Ip",
+	"True-Client-Ip",
+	"Cf-Connecting-Ip",
+	"X-Original-Url",
+	"X-Rewrite-Url",
+	"X-Original-Uri",
+	"X-Internal-*",
+	"X-Auth-*",
+	"X-User-*",
+}
+
+// HeaderPolicy decides which headers of the client's request reach an
+// upstream. X-Forwarded-For, -Host and -Proto are always replaced and
+// hop-by-hop headers always removed.
+type HeaderPolicy struct {
+	// Allow, when not empty, lists the only client headers forwarded.
+	// Names ending in "*" match a prefix, e.g. "X-Api-*". Tracing headers
+	// (traceparent, tracestate, baggage, b3) should be included.
+	Allow []string
+	// Strip lists client headers removed, in the same syntax; nil
+	// means DefaultStrip.
+	Strip []string
+	// Set generates headers after filtering, overriding the client's.
+	// Values may contain {request_id}, {client_ip}, {host} and {scheme}.
+	Set map[string]string
+}
+
+// DefaultHeaderPolicy strips DefaultStrip and passes the router's request
+// ID on, so upstream logs can be joined with the router's.
+var DefaultHeaderPolicy = HeaderPolicy{
+	Set: map[string]string{router.RequestIDHeader: "{request_id}"},
+}
+
+// WithHeaderPolicy replaces DefaultHeaderPolicy.
+func WithHeaderPolicy(policy HeaderPolicy) Option {
+	return func(c *config) { c.headers = policy }
+}
+
+func (p HeaderPolicy) apply(out, in *http.Request) {
+	strip := p.Strip
+	if strip == nil {
+		strip = DefaultStrip
+	}
+	for name := range out.Header {
+		if (len(p.Allow) > 0 && !matchHeader(p.Allow, name)) || matchHeader(strip, name) {
+			delete(out.Header, name)
+		}
+	}
+
+	if len(p.Set) == 0 {
+		return
+	}
+	scheme := "http"
+	if in.TLS != nil {
+		scheme = "https"
+	}
+	vars := strings.NewReplacer(
+		"{request_id}", router.RequestID(in),
+		"{client_ip}", HashClientIP(in),
+		"{host}", in.Host,
+		"{scheme}", scheme,
+	)
+	for name, value := range p.Set {
+		out.Header.Set(name, vars.Replace(value))
+	}
+}
+
+// matchHeader reports whether name, in canonical form, is in list.
+func matchHeader(list []string, name string) bool {
+	for _, pattern := range list {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+				return true
+			}
+		} else if strings.EqualFold(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,263 @@
+// Package proxy forwards requests to a pool of upstream servers. Responses
+// are streamed as they arrive, so server-sent events and chunked responses
+// reach the client without buffering, and WebSocket (and other Upgrade)
+// connections are tunnelled in both directions.
+//
+// Streaming relies on every middleware between the server and the proxy
+// passing writes straight through and exposing the underlying writer via
+// Unwrap, so http.ResponseController can flush and hijack it. Middleware
+// that buffers whole responses, like middleware.Coalesce, must not wrap
+// streaming routes.
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+var (
+	ErrNoUpstream       = errors.New("proxy: no upstream available")
+	ErrStickyRoundRobin = errors.New("proxy: a sticky cookie has no effect with round robin balancing")
+)
+
+type config struct {
+	transport http.RoundTripper
+	balancer  Balancer
+	cooldown  time.Duration
+	sticky    string
+	stickyTTL time.Duration
+	headers   HeaderPolicy
+}
+
+type Option func(*config)
+
+// WithTransport sets the round tripper used to reach the upstreams. The
+// default is a NewTransport with default TransportOptions.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *config) { c.transport = rt }
+}
+
+// WithBalancer sets how upstreams are picked. The default is RoundRobin,
+// or with a sticky cookie a ConsistentHash keyed by it.
+func WithBalancer(b Balancer) Option {
+	return func(c *config) { c.balancer = b }
+}
+
+// WithCooldown sets how long an upstream that failed a request is left out
+// of the pool. The default is 10 seconds.
+func WithCooldown(d time.Duration) Option {
+	return func(c *config) { c.cooldown = d }
+}
+
+// WithStickyCookie gives clients without the named cookie a random one,
+// valid for ttl, before the upstream is picked. Unless WithBalancer sets
+// another ConsistentHash, requests are hashed by the cookie, pinning each
+// client to one upstream for as long as that upstream stays healthy. New
+// fails with ErrStickyRoundRobin when the balancer is a RoundRobin.
+func WithStickyCookie(name string, ttl time.Duration) Option {
+	return func(c *config) { c.sticky, c.stickyTTL = name, ttl }
+}
+
+type Proxy struct {
+	config    *config
+	upstreams []*Upstream
+	reverse   *httputil.ReverseProxy
+
+	mu sync.Mutex
+	// revive is the UnixNano time the next upstream left out of the pool
+	// comes back, or 0.
+	revive atomic.Int64
+}
+
+type upstreamKey struct{}
+
+// New returns a proxy to upstreams, absolute http or https URLs. Request
+// paths are appended to the upstream's path, X-Forwarded-For, -Host and
+// -Proto are set from the incoming request, and other headers filtered by
+// DefaultHeaderPolicy.
+func New(upstreams []string, options ...Option) (*Proxy, error) {
+	c := &config{cooldown: 10 * time.Second, headers: DefaultHeaderPolicy}
+	for _, o := range options {
+		o(c)
+	}
+	if c.transport == nil {
+		t, err := NewTransport(TransportOptions{})
+		if err != nil {
+			return nil, err
+		}
+		c.transport = t
+	}
+	if c.balancer == nil {
+		c.balancer = &RoundRobin{}
+		if c.sticky != "" {
+			c.balancer = NewConsistentHash(HashCookie(c.sticky))
+		}
+	}
+	if _, ok := c.balancer.(*RoundRobin); ok && c.sticky != "" {
+		return nil, ErrStickyRoundRobin
+	}
+	p := &Proxy{config: c}
+	if err := p.SetUpstreams(upstreams); err != nil {
+		return nil, err
+	}
+
+	p.reverse = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(pr.In.Context().Value(upstreamKey{}).(*Upstream).URL)
+			c.headers.apply(pr.Out, pr.In)
+			pr.SetXForwarded()
+		},
+		// Flush every write, so streamed responses are not held back.
+		FlushInterval: -1,
+		Transport:     c.transport,
+		ErrorHandler:  p.serveError,
+	}
+	return p, nil
+}
+
+// SetUpstreams replaces the pool, keeping the health of upstreams already
+// in it. An empty pool is refused so a failed discovery cannot drop all
+// traffic.
+func (p *Proxy) SetUpstreams(upstreams []string) error {
+	if len(upstreams) == 0 {
+		return ErrNoUpstream
+	}
+
+	p.mu.Lock()
+	current := make(map[string]*Upstream, len(p.upstreams))
+	for _, u := range p.upstreams {
+		current[u.URL.String()] = u
+	}
+
+	pool := make([]*Upstream, 0, len(upstreams))
+	for _, upstream := range upstreams {
+		u, err := url.Parse(upstream)
+		if err != nil {
+			p.mu.Unlock()
+			return fmt.Errorf("proxy: %w", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			p.mu.Unlock()
+			return fmt.Errorf("proxy: upstream %q must be an absolute http or https URL", upstream)
+		}
+		if existing, ok := current[u.String()]; ok {
+			pool = append(pool, existing)
+			continue
+		}
+		pool = append(pool, &Upstream{URL: u})
+	}
+	p.upstreams = pool
+	p.mu.Unlock()
+
+	p.refresh()
+	return nil
+}
+
+func (p *Proxy) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if at := p.revive.Load(); at != 0 && time.Now().UnixNano() >= at {
+		p.refresh()
+	}
+
+	if p.config.sticky != "" {
+		if _, err := r.Cookie(p.config.sticky); err != nil {
+			c := &http.Cookie{
+				Name:     p.config.sticky,
+				Value:    newStickyID(),
+				Path:     "/",
+				MaxAge:   int(p.config.stickyTTL / time.Second),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			}
+			http.SetCookie(rw, c)
+			r = r.Clone(r.Context())
+			r.AddCookie(c)
+		}
+	}
+
+	u := p.config.balancer.Pick(r)
+	if u == nil {
+		router.Logger(r).Error("proxy: no upstream available")
+		router.ServeError(rw, r, http.StatusServiceUnavailable, ErrNoUpstream)
+		return
+	}
+	p.reverse.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), upstreamKey{}, u)))
+}
+
+// Upstreams returns the pool, healthy or not.
+func (p *Proxy) Upstreams() []*Upstream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]*Upstream(nil), p.upstreams...)
+}
+
+// SetHealthy puts an upstream back in the pool, or takes it out until it is
+// marked healthy again, for use by external health checks.
+func (p *Proxy) SetHealthy(u *Upstream, healthy bool) {
+	if healthy {
+		u.downUntil.Store(0)
+	} else {
+		u.downUntil.Store(1<<63 - 1)
+	}
+	p.refresh()
+}
+
+// refresh hands the healthy upstreams to the balancer. With none healthy
+// every upstream is used, since refusing all traffic helps nobody.
+func (p *Proxy) refresh() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now().UnixNano()
+	var healthy []*Upstream
+	var revive int64
+	for _, u := range p.upstreams {
+		down := u.downUntil.Load()
+		if now >= down {
+			healthy = append(healthy, u)
+			continue
+		}
+		if down < 1<<63-1 && (revive == 0 || down < revive) {
+			revive = down
+		}
+	}
+	if len(healthy) == 0 {
+		healthy = p.upstreams
+	}
+	p.revive.Store(revive)
+	p.config.balancer.Update(healthy)
+}
+
+func (p *Proxy) serveError(rw http.ResponseWriter, r *http.Request, err error) {
+	// A client that went away needs no response, and its upstream is not
+	// to blame.
+	if errors.Is(err, context.Canceled) && router.ClientGone(r) {
+		router.Logger(r).Debug("proxy: client closed the request", "upstream", r.URL.Host)
+		return
+	}
+
+	u := r.Context().Value(upstreamKey{}).(*Upstream)
+	router.Logger(r).Error("proxy: upstream request failed", "upstream", u.URL.Host, "err", err)
+	if p.config.cooldown > 0 && len(p.Upstreams()) > 1 {
+		u.downUntil.Store(time.Now().Add(p.config.cooldown).UnixNano())
+		p.refresh()
+	}
+	router.ServeError(rw, r, http.StatusBadGateway, fmt.Errorf("proxy: upstream %s: %w", u.URL.Host, err))
+}
+
+func newStickyID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestProxy(t *testing.T, upstreams []string, options ...Option) *httptest.Server {
+	t.Helper()
+	p, err := New(upstreams, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestServerSentEventsStream(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(rw, "data: first\n\n")
+		rw.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(rw, "data: second\n\n")
+	}))
+	defer upstream.Close()
+	defer close(release)
+	srv := newTestProxy(t, []string{upstream.URL})
+
+	res, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	// The first event must arrive while the upstream is still writing.
+	line := make(chan string, 1)
+	go func() {
+		l, _ := bufio.NewReader(res.Body).ReadString('\n')
+		line <- l
+	}()
+	select {
+	case l := <-line:
+		if l != "data: first\n" {
+			t.Errorf("first line = %q", l)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first event was held back")
+	}
+}
+
+func TestWebSocketTunnel(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			http.Error(rw, "want an upgrade", http.StatusBadRequest)
+			return
+		}
+		conn, brw, err := http.NewResponseController(rw).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+		// Echo every line back.
+		for {
+			line, err := brw.ReadString('\n')
+			if err != nil {
+				return
+			}
+			brw.WriteString("echo " + line)
+			brw.Flush()
+		}
+	}))
+	defer upstream.Close()
+	srv := newTestProxy(t, []string{upstream.URL})
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprint(conn, "GET /ws HTTP/1.1\r\nHost: example.com\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", res.StatusCode)
+	}
+	for _, msg := range []string{"hello\n", "again\n"} {
+		io.WriteString(conn, msg)
+		got, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "echo "+msg {
+			t.Errorf("got %q, want %q", got, "echo "+msg)
+		}
+	}
+}
+
+func TestStickyCookiePinsClients(t *testing.T) {
+	var upstreams []string
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprint("upstream-", i)
+		u := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			io.WriteString(rw, name)
+		}))
+		defer u.Close()
+		upstreams = append(upstreams, u.URL)
+	}
+	srv := newTestProxy(t, upstreams, WithStickyCookie("backend", time.Hour))
+
+	get := func(cookie *http.Cookie) (string, *http.Response) {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return string(body), res
+	}
+
+	first, res := get(nil)
+	var cookie *http.Cookie
+	for _, c := range res.Cookies() {
+		if c.Name == "backend" {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("no sticky cookie set")
+	}
+	for i := 0; i < 10; i++ {
+		if got, _ := get(cookie); got != first {
+			t.Fatalf("request %d went to %s, the first to %s", i, got, first)
+		}
+	}
+}
+
+func TestStickyCookieRefusesRoundRobin(t *testing.T) {
+	_, err := New([]string{"http://localhost:1"}, WithBalancer(&RoundRobin{}), WithStickyCookie("backend", 0))
+	if !errors.Is(err, ErrStickyRoundRobin) {
+		t.Errorf("err = %v, want ErrStickyRoundRobin", err)
+	}
+}
@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// TransportOptions tune the connections a proxy keeps to its upstream. The
+// zero value of a field keeps its default, which suits a proxy fanning out
+// at high rates better than http.DefaultTransport's two idle connections
+// per host.
+type TransportOptions struct {
+	MaxIdleConns          int           `mapstructure:"max_idle_conns"`
+	MaxIdleConnsPerHost   int           `mapstructure:"max_idle_conns_per_host"`
+	MaxConnsPerHost       int           `mapstructure:"max_conns_per_host"`
+	IdleConnTimeout       time.Duration `mapstructure:"idle_conn_timeout"`
+	DialTimeout           time.Duration `mapstructure:"dial_timeout"`
+	KeepAlive             time.Duration `mapstructure:"keep_alive"`
+	TLSHandshakeTimeout   time.Duration `mapstructure:"tls_handshake_timeout"`
+	ResponseHeaderTimeout time.Duration `mapstructure:"response_header_timeout"`
+	// HTTP/2 is negotiated with TLS upstreams unless DisableHTTP2 is set.
+	// H2C speaks cleartext HTTP/2 to plain http upstreams, which must
+	// support it; Upgrade requests such as WebSockets then fail.
+	DisableHTTP2 bool `mapstructure:"disable_http2"`
+	H2C          bool `mapstructure:"h2c"`
+
+	TLS TLSOptions `mapstructure:"tls"`
+}
+
+// TLSOptions configure how a proxy verifies and authenticates to a TLS
+// upstream.
+type TLSOptions struct {
+	// CAFile is a PEM bundle trusted instead of the system roots.
+	CAFile string `mapstructure:"ca_file"`
+	// CertFile and KeyFile hold the client certificate presented for
+	// mutual TLS.
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// ServerName overrides the name sent in SNI and checked against the
+	// upstream's certificate.
+	ServerName string `mapstructure:"server_name"`
+	// InsecureSkipVerify disables certificate verification. Never use it
+	// outside development.
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify"`
+}
+
+func (o TLSOptions) config() (*tls.Config, error) {
+	c := &tls.Config{
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: reading CA bundle: %w", err)
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("proxy: no certificates found in %s", o.CAFile)
+		}
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: loading client certificate: %w", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+var defaultTransport = TransportOptions{
+	MaxIdleConns:        1024,
+	MaxIdleConnsPerHost: 256,
+	IdleConnTimeout:     90 * time.Second,
+	DialTimeout:         5 * time.Second,
+	KeepAlive:           30 * time.Second,
+	TLSHandshakeTimeout: 5 * time.Second,
+}
+
+// NewTransport returns a transport configured by o. It fails when the TLS
+// files cannot be loaded.
+func NewTransport(o TransportOptions) (*http.Transport, error) {
+	d := defaultTransport
+	if o.MaxIdleConns == 0 {
+		o.MaxIdleConns = d.MaxIdleConns
+	}
+	if o.MaxIdleConnsPerHost == 0 {
+		o.MaxIdleConnsPerHost = d.MaxIdleConnsPerHost
+	}
+	if o.IdleConnTimeout == 0 {
+		o.IdleConnTimeout = d.IdleConnTimeout
+	}
+	if o.DialTimeout == 0 {
+		o.DialTimeout = d.DialTimeout
+	}
+	if o.KeepAlive == 0 {
+		o.KeepAlive = d.KeepAlive
+	}
+	if o.TLSHandshakeTimeout == 0 {
+		o.TLSHandshakeTimeout = d.TLSHandshakeTimeout
+	}
+
+	tlsConfig, err := o.TLS.config()
+	if err != nil {
+		return nil, err
+	}
+	if o.TLS.InsecureSkipVerify {
+		slog.Warn("proxy: TLS certificate verification is DISABLED for an upstream; connections can be intercepted", "server_name", o.TLS.ServerName)
+	}
+
+	dialer := &net.Dialer{Timeout: o.DialTimeout, KeepAlive: o.KeepAlive}
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          o.MaxIdleConns,
+		MaxIdleConnsPerHost:   o.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       o.MaxConnsPerHost,
+		IdleConnTimeout:       o.IdleConnTimeout,
+		TLSHandshakeTimeout:   o.TLSHandshakeTimeout,
+		TLSClientConfig:       tlsConfig,
+		ResponseHeaderTimeout: o.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     !o.DisableHTTP2,
+	}
+	if o.H2C {
+		t.Protocols = new(http.Protocols)
+		t.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return t, nil
+}
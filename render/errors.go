@@ -0,0 +1,116 @@
+package render
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ritego/build-a-router-with-go/i18n"
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+//go:embed templates/error.html
+var defaultTemplates embed.FS
+
+// ErrorPages renders error responses: an HTML page for browsers and an
+// application/problem+json body for API clients, chosen from the Accept
+// header. Errors are described with ProblemFor, so a registered mapping may
+// change the status. A template named after the status ("404.html") is
+// preferred over the generic "error.html". Under i18n.Middleware titles are
+// translated and "404.fr.html" is preferred over "404.html".
+type ErrorPages struct {
+	templates *template.Template
+}
+
+// NewErrorPages loads templates matching glob on top of the built-in
+// "error.html". An empty glob uses the built-in page only.
+func NewErrorPages(glob string) (*ErrorPages, error) {
+	t, err := template.ParseFS(defaultTemplates, "templates/error.html")
+	if err != nil {
+		return nil, err
+	}
+	if glob != "" {
+		files, err := filepath.Glob(glob)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) > 0 {
+			if t, err = t.ParseFiles(files...); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &ErrorPages{templates: t}, nil
+}
+
+func (p *ErrorPages) ServeError(rw http.ResponseWriter, r *http.Request, status int, err error) {
+	page := problem(r, status, err)
+
+	rw.Header().Add("Vary", "Accept")
+	if !prefersHTML(r.Header.Get("Accept")) {
+		WriteProblem(rw, page)
+		return
+	}
+
+	locale := i18n.Locale(r)
+	t := p.template(strconv.Itoa(page.Status), locale)
+	if t == nil {
+		t = p.template("error", locale)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, page); err != nil {
+		router.Logger(r).Error("render: error page", "status", page.Status, "err", err)
+		http.Error(rw, page.Title, page.Status)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(page.Status)
+	rw.Write(buf.Bytes())
+}
+
+// Problems answers every error with an application/problem+json body,
+// whatever the Accept header, e.g. for the API group of a site otherwise
+// served by ErrorPages.
+var Problems router.ErrorHandler = router.ErrorHandlerFunc(func(rw http.ResponseWriter, r *http.Request, status int, err error) {
+	WriteProblem(rw, problem(r, status, err))
+})
+
+// problem describes err for r, translated under i18n.Middleware. The
+// problem is a copy, as ProblemFor may return one from err's chain that
+// other requests share.
+func problem(r *http.Request, status int, err error) *Problem {
+	page := *ProblemFor(err, status)
+	if page.Instance == "" {
+		page.Instance = r.URL.Path
+	}
+	if i18n.Locale(r) != "" {
+		page.Title = i18n.T(r, page.Title)
+		page.Detail = i18n.T(r, page.Detail)
+	}
+	return &page
+}
+
+// template returns the page for name in locale ("404.fr.html"), else the
+// page for name ("404.html"), or nil.
+func (p *ErrorPages) template(name, locale string) *template.Template {
+	if locale != "" {
+		if t := p.templates.Lookup(name + "." + locale + ".html"); t != nil {
+			return t
+		}
+	}
+	return p.templates.Lookup(name + ".html")
+}
+
+func prefersHTML(accept string) bool {
+	html := strings.Index(accept, "text/html")
+	if html < 0 {
+		return false
+	}
+	json := strings.Index(accept, "application/json")
+	return json < 0 || html < json
+}
@@ -0,0 +1,131 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ritego/build-a-router-with-go/middleware"
+)
+
+var ErrFileNotFound = errors.New("file not found")
+
+// FileOptions configure File. The zero value serves the file inline with a
+// type guessed from its name.
+type FileOptions struct {
+	// Name is the file name offered to the user, the base name of the path
+	// by default.
+	Name string
+	// Attachment asks browsers to download the file instead of showing it.
+	Attachment bool
+	// ContentType overrides the type detection from the extension and
+	// content.
+	ContentType string
+	// Rate limits the download to bytes per second, 0 for no limit.
+	Rate int
+	// Accel hands the transfer over to the front proxy instead of sending
+	// the bytes from Go: "nginx" sets X-Accel-Redirect to AccelPrefix plus
+	// the path relative to AccelRoot, "sendfile" sets X-Sendfile (Apache,
+	// lighttpd) to the absolute path.
+	Accel       string
+	AccelRoot   string
+	AccelPrefix string
+}
+
+// File serves the file at path as a resumable download: byte ranges,
+// If-Range and conditional requests are answered from an ETag built from
+// the file's size and modification time. A missing file fails with
+// ErrFileNotFound, which error pages answer with 404.
+func File(rw http.ResponseWriter, r *http.Request, path string, opts FileOptions) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%w: %s is a directory", ErrFileNotFound, path)
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = filepath.Base(path)
+	}
+	h := rw.Header()
+	h.Set("Content-Disposition", contentDisposition(name, opts.Attachment))
+	if opts.ContentType != "" {
+		h.Set("Content-Type", opts.ContentType)
+	} else if t := mime.TypeByExtension(filepath.Ext(name)); t != "" {
+		h.Set("Content-Type", t)
+	}
+	if h.Get("ETag") == "" {
+		h.Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	}
+
+	switch opts.Accel {
+	case "":
+	case "nginx":
+		rel, err := filepath.Rel(opts.AccelRoot, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("render: %s is outside AccelRoot %s", path, opts.AccelRoot)
+		}
+		u := url.URL{Path: strings.TrimSuffix(opts.AccelPrefix, "/") + "/" + filepath.ToSlash(rel)}
+		h.Set("X-Accel-Redirect", u.EscapedPath())
+		return nil
+	case "sendfile":
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		h.Set("X-Sendfile", abs)
+		return nil
+	default:
+		return fmt.Errorf("render: unknown Accel %q", opts.Accel)
+	}
+
+	serve := http.Handler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		http.ServeContent(rw, r, name, info.ModTime(), f)
+	}))
+	if opts.Rate > 0 {
+		serve = middleware.Throttle(middleware.ThrottleOptions{Rate: opts.Rate, Burst: min(opts.Rate, 32<<10)})(serve)
+	}
+	serve.ServeHTTP(rw, r)
+	return nil
+}
+
+// contentDisposition quotes ASCII names and adds the RFC 6266 filename*
+// form for others.
+func contentDisposition(name string, attachment bool) string {
+	disposition := "inline"
+	if attachment {
+		disposition = "attachment"
+	}
+	ascii := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+	header := fmt.Sprintf(`%s; filename="%s"`, disposition, ascii)
+	if ascii != name {
+		header += "; filename*=UTF-8''" + url.PathEscape(name)
+	}
+	return header
+}
+
+func init() {
+	RegisterProblem(ErrFileNotFound, http.StatusNotFound, "Not Found", "")
+}
@@ -0,0 +1,131 @@
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrPreconditionFailed means the client's copy of the resource is out
+	// of date: someone else changed it since the client read it.
+	ErrPreconditionFailed = errors.New("the resource has changed since it was read")
+	// ErrPreconditionRequired means a write was attempted without
+	// If-Match or If-Unmodified-Since.
+	ErrPreconditionRequired = errors.New("the request must be conditional: send If-Match or If-Unmodified-Since")
+)
+
+func init() {
+	RegisterProblem(ErrPreconditionFailed, http.StatusPreconditionFailed, "Precondition Failed", "")
+	RegisterProblem(ErrPreconditionRequired, http.StatusPreconditionRequired, "Precondition Required", "")
+}
+
+// Version identifies the current state of a resource for conditional
+// requests. Either field may be empty; a zero Version is a resource that does
+// not exist.
+type Version struct {
+	// ETag is a quoted entity tag, e.g. from ETagOf; a W/ prefix makes it
+	// weak, which never satisfies If-Match.
+	ETag         string
+	LastModified time.Time
+}
+
+func (v Version) exists() bool {
+	return v.ETag != "" || !v.LastModified.IsZero()
+}
+
+// ETagOf returns a strong entity tag for a representation.
+func ETagOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// SetVersion sets the ETag and Last-Modified headers, so clients can send
+// them back with their next write.
+func SetVersion(rw http.ResponseWriter, v Version) {
+	if v.ETag != "" {
+		rw.Header().Set("ETag", v.ETag)
+	}
+	if !v.LastModified.IsZero() {
+		rw.Header().Set("Last-Modified", v.LastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// CheckPreconditions evaluates If-Match and If-Unmodified-Since against the
+// current version of the resource a write targets, returning
+// ErrPreconditionFailed when the write must not proceed. Handlers return the
+// error so ErrorPages answers 412. Requests without preconditions pass.
+func CheckPreconditions(r *http.Request, current Version) error {
+	if im := r.Header.Get("If-Match"); im != "" {
+		// If-Unmodified-Since is ignored when If-Match is present.
+		if !matchesETag(im, current, false) {
+			return ErrPreconditionFailed
+		}
+		return nil
+	}
+	if ius := r.Header.Get("If-Unmodified-Since"); ius != "" && !current.LastModified.IsZero() {
+		since, err := http.ParseTime(ius)
+		if err == nil && current.LastModified.Truncate(time.Second).After(since) {
+			return ErrPreconditionFailed
+		}
+	}
+	return nil
+}
+
+// RequirePreconditions is CheckPreconditions for endpoints using optimistic
+// concurrency: a write without preconditions fails with
+// ErrPreconditionRequired (428), so clients cannot blindly overwrite changes.
+func RequirePreconditions(r *http.Request, current Version) error {
+	if r.Header.Get("If-Match") == "" && r.Header.Get("If-Unmodified-Since") == "" {
+		return ErrPreconditionRequired
+	}
+	return CheckPreconditions(r, current)
+}
+
+// NotModified evaluates If-None-Match and If-Modified-Since for a GET or
+// HEAD. When the client's copy is current it sets the version headers,
+// answers 304 and returns true; the handler then writes nothing more.
+func NotModified(rw http.ResponseWriter, r *http.Request, current Version) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	fresh := false
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		fresh = matchesETag(inm, current, true)
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !current.LastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		fresh = err == nil && !current.LastModified.Truncate(time.Second).After(since)
+	}
+	if !fresh {
+		return false
+	}
+	SetVersion(rw, current)
+	rw.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// matchesETag reports whether a list of entity tags, or "*", matches the
+// current version. If-Match compares strongly and If-None-Match weakly.
+func matchesETag(list string, current Version, weak bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return current.exists()
+	}
+	if current.ETag == "" || (!weak && strings.HasPrefix(current.ETag, "W/")) {
+		return false
+	}
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			if strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(current.ETag, "W/") {
+				return true
+			}
+		} else if tag == current.ETag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package render
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/ritego/build-a-router-with-go/bind"
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object. Extensions are serialized
+// as additional top-level members.
+type Problem struct {
+	Type       string                 `json:"type,omitempty"`
+	Title      string                 `json:"title"`
+	Status     int                    `json:"status"`
+	Detail     string                 `json:"detail,omitempty"`
+	Instance   string                 `json:"instance,omitempty"`
+	Extensions map[string]interface{} `json:"-"`
+}
+
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return p.Title + ": " + p.Detail
+}
+
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	base, err := json.Marshal((*problem)(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return base, err
+	}
+
+	members := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(base, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range fields {
+		members[k] = v
+	}
+	return json.Marshal(members)
+}
+
+var (
+	mappersMu sync.RWMutex
+	mappers   []func(error) *Problem
+)
+
+func init() {
+	RegisterProblem(bind.ErrUnsupportedMediaType, http.StatusUnsupportedMediaType, "Unsupported Media Type", "")
+	RegisterProblem(bind.ErrBodyTooLarge, http.StatusRequestEntityTooLarge, "Request Entity Too Large", "")
+	RegisterProblem(bind.ErrEmptyBody, http.StatusBadRequest, "Bad Request", "")
+	RegisterProblem(router.ErrBodyTooLarge, http.StatusRequestEntityTooLarge, "Request Entity Too Large", "")
+
+	RegisterProblemFunc(func(err error) *Problem {
+		var ferr *bind.FieldError
+		if !errors.As(err, &ferr) {
+			return nil
+		}
+		p := NewProblem(http.StatusBadRequest, ferr.Error())
+		p.Extensions = map[string]interface{}{"source": ferr.Source, "name": ferr.Name}
+		return p
+	})
+	RegisterProblemFunc(func(err error) *Problem {
+		var perr *router.PermissionError
+		if !errors.As(err, &perr) {
+			return nil
+		}
+		p := NewProblem(http.StatusForbidden, perr.Error())
+		p.Extensions = map[string]interface{}{"required": perr.Required, "missing": perr.Missing}
+		return p
+	})
+}
+
+// RegisterProblem maps errors matching target (by errors.Is) to a problem
+// with the given status, title and type URI.
+func RegisterProblem(target error, status int, title, typ string) {
+	RegisterProblemFunc(func(err error) *Problem {
+		if !errors.Is(err, target) {
+			return nil
+		}
+		return &Problem{Type: typ, Title: title, Status: status, Detail: err.Error()}
+	})
+}
+
+// RegisterProblemFunc adds a mapping from errors to problems. fn returns nil
+// for errors it does not handle. Later registrations take precedence.
+func RegisterProblemFunc(fn func(error) *Problem) {
+	mappersMu.Lock()
+	defer mappersMu.Unlock()
+
+	mappers = append(mappers, fn)
+}
+
+// ProblemFor describes err as a problem. A *Problem in err's chain is used
+// as is, then the registered mappings are tried; otherwise a generic problem
+// for status is returned, whose detail is withheld for server errors so
+// internals do not leak to clients.
+func ProblemFor(err error, status int) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+
+	mappersMu.RLock()
+	defer mappersMu.RUnlock()
+
+	for i := len(mappers) - 1; i >= 0 && err != nil; i-- {
+		if p := mappers[i](err); p != nil {
+			return p
+		}
+	}
+
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	p = NewProblem(status, "")
+	if err != nil && status < http.StatusInternalServerError {
+		p.Detail = err.Error()
+	}
+	return p
+}
+
+func WriteProblem(rw http.ResponseWriter, p *Problem) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	rw.Header().Set("Content-Type", ProblemContentType)
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.WriteHeader(p.Status)
+	_, err = rw.Write(data)
+	return err
+}
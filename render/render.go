@@ -0,0 +1,36 @@
+package render
+
+import (
+	"net/http"
+
+	"github.com/ritego/build-a-router-with-go/codec"
+)
+
+// Render writes v with status in the format the client asked for in its
+// Accept header, answering 406 Not Acceptable when no codec matches.
+func Render(rw http.ResponseWriter, r *http.Request, status int, v interface{}) error {
+	c, ok := codec.Negotiate(r.Header.Get("Accept"))
+	if !ok {
+		http.Error(rw, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+		return nil
+	}
+	rw.Header().Add("Vary", "Accept")
+	return Write(rw, c, status, v)
+}
+
+// Write encodes v with c. Encoding happens before anything is sent, so a
+// failure leaves the response untouched.
+func Write(rw http.ResponseWriter, c codec.Codec, status int, v interface{}) error {
+	data, err := c.Marshal(v)
+	if err != nil {
+		return err
+	}
+	rw.Header().Set("Content-Type", c.ContentType())
+	rw.WriteHeader(status)
+	_, err = rw.Write(data)
+	return err
+}
+
+func JSON(rw http.ResponseWriter, status int, v interface{}) error {
+	return Write(rw, codec.JSON{}, status, v)
+}
@@ -0,0 +1,93 @@
+package render
+
+import (
+	"encoding/base64"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+// Streamer writes a chunked response whose trailers are sent after the
+// body, e.g. a checksum computed while streaming or a final status such as
+// Grpc-Status. Trailers must be declared before the first write.
+type Streamer struct {
+	rw          http.ResponseWriter
+	status      int
+	trailers    []string
+	hashes      []streamHash
+	wroteHeader bool
+}
+
+type streamHash struct {
+	trailer string
+	h       hash.Hash
+}
+
+// Stream starts a streamed response with status, declaring the given
+// trailers. The status and headers are sent with the first Write or Flush.
+func Stream(rw http.ResponseWriter, status int, trailers ...string) *Streamer {
+	s := &Streamer{rw: rw, status: status}
+	for _, t := range trailers {
+		s.Declare(t)
+	}
+	return s
+}
+
+// Declare announces a trailer the response will carry.
+func (s *Streamer) Declare(trailer string) *Streamer {
+	s.trailers = append(s.trailers, http.CanonicalHeaderKey(trailer))
+	return s
+}
+
+// Hash feeds everything written to h and sends its base64 sum as trailer
+// when the stream is closed, e.g. Hash("Content-Sha256", sha256.New()).
+func (s *Streamer) Hash(trailer string, h hash.Hash) *Streamer {
+	s.hashes = append(s.hashes, streamHash{trailer: http.CanonicalHeaderKey(trailer), h: h})
+	return s.Declare(trailer)
+}
+
+func (s *Streamer) writeHeader() {
+	if s.wroteHeader {
+		return
+	}
+	s.wroteHeader = true
+	h := s.rw.Header()
+	// A length would stop the body from being chunked, and trailers can only
+	// follow a chunked body.
+	h.Del("Content-Length")
+	if len(s.trailers) > 0 {
+		h.Set("Trailer", strings.Join(s.trailers, ", "))
+	}
+	s.rw.WriteHeader(s.status)
+}
+
+func (s *Streamer) Write(p []byte) (int, error) {
+	s.writeHeader()
+	for _, sh := range s.hashes {
+		sh.h.Write(p)
+	}
+	return s.rw.Write(p)
+}
+
+// Flush sends what has been written so far to the client.
+func (s *Streamer) Flush() error {
+	s.writeHeader()
+	return http.NewResponseController(s.rw).Flush()
+}
+
+// SetTrailer sets the value of a declared trailer. It can be called at any
+// point before Close.
+func (s *Streamer) SetTrailer(key, value string) {
+	s.writeHeader()
+	s.rw.Header().Set(key, value)
+}
+
+// Close sets the checksum trailers. The trailers are sent when the handler
+// returns.
+func (s *Streamer) Close() error {
+	s.writeHeader()
+	for _, sh := range s.hashes {
+		s.rw.Header().Set(sh.trailer, base64.StdEncoding.EncodeToString(sh.h.Sum(nil)))
+	}
+	return nil
+}
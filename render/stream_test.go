@@ -0,0 +1,89 @@
+package render_test
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ritego/build-a-router-with-go/middleware"
+	"github.com/ritego/build-a-router-with-go/render"
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+func streamHandler(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	s := render.Stream(rw, http.StatusOK, "Grpc-Status").Hash("Content-Sha256", sha256.New())
+	for i := 0; i < 8; i++ {
+		io.WriteString(s, strings.Repeat("chunk ", 100))
+		s.Flush()
+	}
+	s.SetTrailer("Grpc-Status", "0")
+	s.Close()
+}
+
+// TestStreamTrailers checks the trailers survive the middleware wrapping
+// streamed responses.
+func TestStreamTrailers(t *testing.T) {
+	compressor, err := middleware.NewCompressor(middleware.CompressOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logged := router.New()
+	logged.Use(router.AccessLog(router.AccessLogOptions{Sample: 1, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}))
+	logged.HandleFunc("GET:/", streamHandler)
+
+	for name, handler := range map[string]http.Handler{
+		"bare":     http.HandlerFunc(streamHandler),
+		"compress": compressor.Middleware(http.HandlerFunc(streamHandler)),
+		"log":      logged,
+		"coalesce": middleware.Coalesce()(http.HandlerFunc(streamHandler)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(handler)
+			defer srv.Close()
+
+			req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+			// Set explicitly, so the client leaves the body compressed.
+			req.Header.Set("Accept-Encoding", "gzip")
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if name == "compress" && res.Header.Get("Content-Encoding") != "gzip" {
+				t.Errorf("Content-Encoding = %q, want gzip", res.Header.Get("Content-Encoding"))
+			}
+			var body io.Reader = res.Body
+			if res.Header.Get("Content-Encoding") == "gzip" {
+				if body, err = gzip.NewReader(res.Body); err != nil {
+					t.Fatal(err)
+				}
+			}
+			b, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Trailers are only known once the body has been read to the
+			// end.
+			io.Copy(io.Discard, res.Body)
+
+			if len(b) != 8*600 {
+				t.Errorf("read %d bytes, want %d", len(b), 8*600)
+			}
+			if got := res.Trailer.Get("Grpc-Status"); got != "0" {
+				t.Errorf("Grpc-Status trailer = %q, want 0", got)
+			}
+			sum := sha256.Sum256(b)
+			if got, want := res.Trailer.Get("Content-Sha256"), base64.StdEncoding.EncodeToString(sum[:]); got != want {
+				t.Errorf("Content-Sha256 trailer = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+// Package replay records the requests a server receives to a file and
+// feeds them back through a handler, usually the router, at a controlled
+// rate, for load tests and for comparing the responses of two builds.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// Exchange is one recorded request, with enough of its response to tell
+// whether a replay answered the same. The file format is one JSON Exchange
+// per line.
+type Exchange struct {
+	Time       time.Time   `json:"time"`
+	Method     string      `json:"method"`
+	Target     string      `json:"target"`
+	Host       string      `json:"host"`
+	RemoteAddr string      `json:"remote_addr,omitempty"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body,omitempty"`
+	// Truncated reports that Body is only the first RecordOptions.MaxBody
+	// bytes; replays send it as is and do not compare the response body.
+	Truncated bool `json:"truncated,omitempty"`
+
+	Status       int    `json:"status"`
+	ResponseSize int64  `json:"response_size"`
+	ResponseHash string `json:"response_hash"`
+}
+
+// RecordOptions configure a Recorder. Zero values pick the defaults.
+type RecordOptions struct {
+	// MaxBody is how many bytes of each request body are recorded, 1 MB by
+	// default.
+	MaxBody int
+	// Redact lists request headers recorded as "[redacted]", DefaultRedact
+	// when nil. Replays then send the placeholder.
+	Redact []string
+	// Exclude lists path prefixes that are not recorded.
+	Exclude []string
+}
+
+// DefaultRedact are the credentials headers redacted unless
+// RecordOptions.Redact says otherwise.
+var DefaultRedact = []string{"Authorization", "Cookie", "Proxy-Authorization", "X-Api-Key"}
+
+// Recorder appends the requests it serves to a file.
+type Recorder struct {
+	opts RecordOptions
+
+	mu   sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+	err  error
+}
+
+// Create opens the file at path for appending, creating it if needed.
+func Create(path string, opts RecordOptions) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxBody <= 0 {
+		opts.MaxBody = 1 << 20
+	}
+	if opts.Redact == nil {
+		opts.Redact = DefaultRedact
+	}
+	// Canonicalised into a copy, leaving the caller's slice alone.
+	redact := make([]string, 0, len(opts.Redact))
+	for _, name := range opts.Redact {
+		redact = append(redact, http.CanonicalHeaderKey(name))
+	}
+	opts.Redact = redact
+	return &Recorder{opts: opts, file: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (rec *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		for _, prefix := range rec.opts.Exclude {
+			if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, strings.TrimSuffix(prefix, "/")+"/") {
+				next.ServeHTTP(rw, r)
+				return
+			}
+		}
+
+		x := Exchange{
+			Time:       time.Now(),
+			Method:     r.Method,
+			Target:     r.URL.RequestURI(),
+			Host:       r.Host,
+			RemoteAddr: r.RemoteAddr,
+			Header:     r.Header.Clone(),
+		}
+		for _, name := range rec.opts.Redact {
+			if _, ok := x.Header[name]; ok {
+				x.Header[name] = []string{"[redacted]"}
+			}
+		}
+		// The start of the body is read ahead and put back, so the handler
+		// sees all of it whether or not it reads it.
+		if r.Body != nil && r.Body != http.NoBody {
+			head, _ := io.ReadAll(io.LimitReader(r.Body, int64(rec.opts.MaxBody)+1))
+			x.Body, x.Truncated = head, len(head) > rec.opts.MaxBody
+			if x.Truncated {
+				x.Body = head[:rec.opts.MaxBody]
+			}
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+		}
+
+		w := &hashWriter{ResponseWriter: rw, hash: sha256.New()}
+		next.ServeHTTP(w, r)
+
+		x.Status = w.status
+		if router.ClientGone(r) {
+			x.Status = router.StatusClientClosedRequest
+		} else if x.Status == 0 {
+			x.Status = http.StatusOK
+		}
+		x.ResponseSize, x.ResponseHash = w.size, hex.EncodeToString(w.hash.Sum(nil))
+		if err := rec.write(x); err != nil {
+			router.Logger(r).Error("replay: recording failed", "err", err)
+		}
+	})
+}
+
+func (rec *Recorder) write(x Exchange) error {
+	line, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.err != nil {
+		return rec.err
+	}
+	rec.w.Write(append(line, '\n'))
+	// Lines are handed to the file as they come, so a crash loses at most
+	// the one being written.
+	rec.err = rec.w.Flush()
+	return rec.err
+}
+
+func (rec *Recorder) Close() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if err := rec.w.Flush(); err != nil {
+		rec.file.Close()
+		return err
+	}
+	return rec.file.Close()
+}
+
+// Read decodes the exchanges of a recording.
+func Read(r io.Reader) ([]Exchange, error) {
+	var exchanges []Exchange
+	dec := json.NewDecoder(r)
+	for {
+		var x Exchange
+		if err := dec.Decode(&x); err == io.EOF {
+			return exchanges, nil
+		} else if err != nil {
+			return exchanges, err
+		}
+		exchanges = append(exchanges, x)
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// hashWriter hashes the response body on its way to the client.
+type hashWriter struct {
+	http.ResponseWriter
+	hash   hash.Hash
+	status int
+	size   int64
+}
+
+func (w *hashWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= 200 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *hashWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.hash.Write(b)
+	w.size += int64(len(b))
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *hashWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *hashWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
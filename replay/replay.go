@@ -0,0 +1,218 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxMismatches bounds the mismatches a Report lists.
+const maxMismatches = 100
+
+// Options control the pace of a replay. Without Rate or Speed, exchanges
+// are replayed as fast as Concurrency allows.
+type Options struct {
+	// Rate is the requests started per second.
+	Rate float64
+	// Speed replays the recorded gaps between requests, 2 meaning twice
+	// as fast. Rate wins when both are set.
+	Speed float64
+	// Concurrency bounds the requests in flight, 8 by default.
+	Concurrency int
+}
+
+// Report summarises a replay.
+type Report struct {
+	Requests int `json:"requests"`
+	// Errors counts the exchanges that could not be sent, e.g. with a
+	// malformed target.
+	Errors   int           `json:"errors,omitempty"`
+	Statuses map[int]int   `json:"statuses"`
+	Duration time.Duration `json:"duration"`
+	P50      time.Duration `json:"p50"`
+	P95      time.Duration `json:"p95"`
+	P99      time.Duration `json:"p99"`
+	Max      time.Duration `json:"max"`
+	// StatusChanged and BodyChanged count the responses that differ from
+	// the recording; Mismatches lists the first of them.
+	StatusChanged int        `json:"status_changed"`
+	BodyChanged   int        `json:"body_changed"`
+	Mismatches    []Mismatch `json:"mismatches,omitempty"`
+}
+
+type Mismatch struct {
+	Method     string `json:"method"`
+	Target     string `json:"target"`
+	Recorded   int    `json:"recorded"`
+	Status     int    `json:"status"`
+	BodyChange bool   `json:"body_changed,omitempty"`
+}
+
+// Replay sends the exchanges through h in order, paced as opts say, and
+// compares each response with the recorded one. It stops early, with the
+// requests sent so far, when ctx is done.
+func Replay(ctx context.Context, h http.Handler, exchanges []Exchange, opts Options) (Report, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 8
+	}
+	if opts.Rate < 0 || opts.Speed < 0 {
+		return Report{}, errors.New("replay: rate and speed cannot be negative")
+	}
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		report    = Report{Statuses: make(map[int]int)}
+		latencies = make([]time.Duration, 0, len(exchanges))
+		slots     = make(chan struct{}, opts.Concurrency)
+	)
+	start := time.Now()
+	for i, x := range exchanges {
+		if err := wait(ctx, start, i, x, exchanges, opts); err != nil {
+			break
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			status, sum, latency, err := send(ctx, h, x)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				report.Errors++
+				return
+			}
+			report.Requests++
+			report.Statuses[status]++
+			latencies = append(latencies, latency)
+
+			m := Mismatch{Method: x.Method, Target: x.Target, Recorded: x.Status, Status: status}
+			switch {
+			case status != x.Status:
+				report.StatusChanged++
+			case !x.Truncated && x.ResponseHash != "" && sum != x.ResponseHash:
+				report.BodyChanged++
+				m.BodyChange = true
+			default:
+				return
+			}
+			if len(report.Mismatches) < maxMismatches {
+				report.Mismatches = append(report.Mismatches, m)
+			}
+		}()
+	}
+	wg.Wait()
+
+	report.Duration = time.Since(start)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	if n := len(latencies); n > 0 {
+		report.P50 = latencies[n*50/100]
+		report.P95 = latencies[n*95/100]
+		report.P99 = latencies[n*99/100]
+		report.Max = latencies[n-1]
+	}
+	return report, ctx.Err()
+}
+
+// wait blocks until exchange i is due.
+func wait(ctx context.Context, start time.Time, i int, x Exchange, exchanges []Exchange, opts Options) error {
+	var due time.Time
+	switch {
+	case opts.Rate > 0:
+		due = start.Add(time.Duration(float64(i) / opts.Rate * float64(time.Second)))
+	case opts.Speed > 0:
+		due = start.Add(time.Duration(float64(x.Time.Sub(exchanges[0].Time)) / opts.Speed))
+	default:
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(time.Until(due))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func send(ctx context.Context, h http.Handler, x Exchange) (status int, sum string, latency time.Duration, err error) {
+	r, err := http.NewRequestWithContext(ctx, x.Method, x.Target, bytes.NewReader(x.Body))
+	if err != nil {
+		return 0, "", 0, fmt.Errorf("replay: %s %s: %w", x.Method, x.Target, err)
+	}
+	r.RequestURI = x.Target
+	r.Host = x.Host
+	r.RemoteAddr = x.RemoteAddr
+	if r.RemoteAddr == "" {
+		r.RemoteAddr = "192.0.2.1:1234"
+	}
+	r.Header = x.Header.Clone()
+	if r.Header == nil {
+		r.Header = make(http.Header)
+	}
+	r.ContentLength = int64(len(x.Body))
+	if len(x.Body) == 0 {
+		r.Body = http.NoBody
+	}
+
+	w := &discardWriter{header: make(http.Header), hash: sha256.New()}
+	begin := time.Now()
+	func() {
+		// Handlers may abort the response, as they would a real connection.
+		defer func() {
+			if v := recover(); v != nil && v != http.ErrAbortHandler {
+				panic(v)
+			}
+		}()
+		h.ServeHTTP(w, r)
+	}()
+	latency = time.Since(begin)
+
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.status, hex.EncodeToString(w.hash.Sum(nil)), latency, nil
+}
+
+// discardWriter keeps only the status and a hash of the response body.
+type discardWriter struct {
+	header http.Header
+	hash   hash.Hash
+	status int
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= 200 {
+		w.status = status
+	}
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.hash.Write(b)
+}
+
+func (w *discardWriter) Flush() {}
@@ -0,0 +1,102 @@
+package router
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// AccessLogOptions control which requests AccessLog records.
+type AccessLogOptions struct {
+	// Sample is the fraction, from 0 to 1, of successful (< 400) requests
+	// logged.
+	Sample float64
+	// ErrorSample is the fraction of failed (>= 400) requests logged.
+	ErrorSample float64
+	// Exclude lists path prefixes that are never logged, e.g. "/healthz".
+	Exclude []string
+	// Logger, if set, writes the lines instead of the request's logger, e.g.
+	// to a dedicated access log file. The request ID, method and path are
+	// added to them.
+	Logger *slog.Logger
+}
+
+// AccessLog logs one line per request through the request's logger, once
+// the response is complete.
+func AccessLog(opts AccessLogOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, rr *http.Request) {
+			for _, prefix := range opts.Exclude {
+				if hasPathPrefix(rr.URL.Path, prefix) {
+					next.ServeHTTP(rw, rr)
+					return
+				}
+			}
+
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: rw}
+			next.ServeHTTP(sw, rr)
+
+			status := responseStatus(rr, sw.status)
+			rate := opts.Sample
+			if status >= 400 {
+				rate = opts.ErrorSample
+			}
+			if rate < 1 && rand.Float64() >= rate {
+				return
+			}
+
+			attrs := []any{
+				"status", status,
+				"bytes", sw.bytes,
+				"duration", time.Since(start),
+				"client_ip", clientAddr(rr),
+			}
+			if err := RequestError(rr); err != nil {
+				attrs = append(attrs, "err", err)
+			}
+			if opts.Logger != nil {
+				attrs = append([]any{"request_id", RequestID(rr), "method", rr.Method, "path", OriginalPath(rr)}, attrs...)
+				opts.Logger.Info("request", attrs...)
+				return
+			}
+			Logger(rr).Info("request", attrs...)
+		})
+	}
+}
+
+// statusWriter records the status and size of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	// Informational responses such as 103 Early Hints precede the real one.
+	if w.status == 0 && (status >= 200 || status == http.StatusSwitchingProtocols) {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
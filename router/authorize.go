@@ -0,0 +1,113 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var ErrNoAuthorizer = errors.New("route requires permissions but no authorizer is configured")
+
+// Authorizer decides whether a request may reach a route that declared
+// required permissions with Route.Require. A nil error grants access; any
+// other error is reported to the client with 403 Forbidden.
+type Authorizer interface {
+	Authorize(r *http.Request, permissions []string) error
+}
+
+type AuthorizerFunc func(r *http.Request, permissions []string) error
+
+func (f AuthorizerFunc) Authorize(r *http.Request, permissions []string) error {
+	return f(r, permissions)
+}
+
+// SetAuthorizer sets the Authorizer consulted for routes with required
+// permissions. Without one, such routes deny every request.
+func (r *Router) SetAuthorizer(a Authorizer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.authorizer = a
+}
+
+// AccessPolicy decides, once a request matched its route, whether it may
+// reach it regardless of the permissions the route requires, e.g. access
+// control lists kept in configuration. A nil error grants access; any other
+// error is reported to the client with 403 Forbidden.
+type AccessPolicy interface {
+	Allow(route *Route, r *http.Request) error
+}
+
+// SetAccessPolicy sets the AccessPolicy consulted before serving every
+// matched route, after its permissions are checked.
+func (r *Router) SetAccessPolicy(p AccessPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.access = p
+}
+
+func (r *Router) authorize(route *Route, rr *http.Request) error {
+	if len(route.permissions) > 0 {
+		if r.authorizer == nil {
+			return ErrNoAuthorizer
+		}
+		if err := r.authorizer.Authorize(rr, route.permissions); err != nil {
+			return err
+		}
+	}
+	if r.access != nil {
+		return r.access.Allow(route, rr)
+	}
+	return nil
+}
+
+// PermissionError lists the permissions a caller was missing.
+type PermissionError struct {
+	Required []string
+	Missing  []string
+}
+
+func (e *PermissionError) Error() string {
+	return "missing permissions: " + strings.Join(e.Missing, ", ")
+}
+
+// RoleAuthorizer grants permissions through roles. Grants returns the roles
+// or raw permissions held by the caller, usually read from claims an
+// authentication middleware stored on the request context. A permission of
+// the form "orders:*" covers every "orders:" permission and "*" covers all.
+type RoleAuthorizer struct {
+	Roles  map[string][]string
+	Grants func(r *http.Request) []string
+}
+
+func (a *RoleAuthorizer) Authorize(r *http.Request, permissions []string) error {
+	var held []string
+	for _, grant := range a.Grants(r) {
+		held = append(held, grant)
+		held = append(held, a.Roles[grant]...)
+	}
+
+	var missing []string
+	for _, p := range permissions {
+		if !grants(held, p) {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		return &PermissionError{Required: permissions, Missing: missing}
+	}
+	return nil
+}
+
+func grants(held []string, permission string) bool {
+	for _, h := range held {
+		if h == permission || h == "*" {
+			return true
+		}
+		if strings.HasSuffix(h, ":*") && strings.HasPrefix(permission, strings.TrimSuffix(h, "*")) {
+			return true
+		}
+	}
+	return false
+}
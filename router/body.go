@@ -0,0 +1,52 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ErrBodyTooLarge is returned by PreserveBody for bodies over its limit.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// preservedBody is a request body held in memory by PreserveBody.
+type preservedBody struct {
+	*bytes.Reader
+	data []byte
+}
+
+func (b *preservedBody) Close() error { return nil }
+
+// PreserveBody reads the body of rr into memory, up to limit bytes, and
+// replaces it with a copy, so middleware verifying a signature and the
+// handler after it each read the whole body. Later calls return the same
+// bytes and rewind rr.Body, whoever read it in between. A body over limit
+// fails with ErrBodyTooLarge and cannot be read again.
+func PreserveBody(rr *http.Request, limit int64) ([]byte, error) {
+	if b, ok := rr.Body.(*preservedBody); ok {
+		if int64(len(b.data)) > limit {
+			return nil, ErrBodyTooLarge
+		}
+		b.Reset(b.data)
+		return b.data, nil
+	}
+	if rr.Body == nil || rr.Body == http.NoBody {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(rr.Body, limit+1))
+	rr.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+
+	rr.Body = &preservedBody{Reader: bytes.NewReader(data), data: data}
+	rr.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return data, nil
+}
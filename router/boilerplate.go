@@ -0,0 +1,76 @@
+package router
+
+import (
+	"bytes"
+	_ "embed"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//go:embed static/favicon.ico
+var defaultFavicon []byte
+
+// Boilerplate holds the routes every site answers, for HandleBoilerplate.
+type Boilerplate struct {
+	// Robots is the body of /robots.txt; empty allows every crawler.
+	Robots string
+	// Favicon is the content of /favicon.ico; nil serves a built-in icon.
+	Favicon []byte
+	// WellKnown serves /.well-known/<name> with the handler of its name,
+	// e.g. "security.txt" or "openid-configuration". A name ending in "/"
+	// receives everything below it, e.g. "acme-challenge/".
+	WellKnown map[string]http.Handler
+}
+
+// HandleBoilerplate registers /robots.txt, /favicon.ico and, when there are
+// any, the /.well-known handlers. Other /.well-known paths answer 404.
+func (r *Router) HandleBoilerplate(b Boilerplate) {
+	robots := b.Robots
+	if robots == "" {
+		robots = "User-agent: *\nAllow: /\n"
+	}
+	r.Handle("GET:/robots.txt", staticContent("text/plain; charset=utf-8", []byte(robots)))
+
+	favicon := b.Favicon
+	if favicon == nil {
+		favicon = defaultFavicon
+	}
+	r.Handle("GET:/favicon.ico", staticContent("image/x-icon", favicon))
+
+	if len(b.WellKnown) > 0 {
+		r.Mount("/.well-known", r.wellKnown(b.WellKnown))
+	}
+}
+
+func staticContent(contentType string, content []byte) http.Handler {
+	modTime := time.Now()
+	return http.HandlerFunc(func(rw http.ResponseWriter, rr *http.Request) {
+		rw.Header().Set("Content-Type", contentType)
+		rw.Header().Set("Cache-Control", "public, max-age=86400")
+		http.ServeContent(rw, rr, "", modTime, bytes.NewReader(content))
+	})
+}
+
+func (r *Router) wellKnown(handlers map[string]http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, rr *http.Request) {
+		name := strings.TrimPrefix(rr.URL.Path, "/.well-known/")
+		if h, ok := handlers[name]; ok && !strings.HasSuffix(name, "/") {
+			h.ServeHTTP(rw, rr)
+			return
+		}
+
+		// The longest delegated directory containing the path.
+		var match string
+		for prefix := range handlers {
+			if strings.HasSuffix(prefix, "/") && strings.HasPrefix(name, prefix) && len(prefix) > len(match) {
+				match = prefix
+			}
+		}
+		if match == "" {
+			r.serveError(rw, rr, http.StatusNotFound, ErrNotFound)
+			return
+		}
+		handlers[match].ServeHTTP(rw, rr)
+	})
+}
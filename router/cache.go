@@ -0,0 +1,51 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CachePolicy is the caching a route asks of browsers and CDNs.
+type CachePolicy struct {
+	// CacheControl is sent to browsers and any cache, e.g.
+	// "public, max-age=60".
+	CacheControl string
+	// SurrogateControl is honoured and stripped by the CDN, e.g.
+	// "max-age=86400", so edges can keep responses longer than browsers.
+	SurrogateControl string
+	// SurrogateKeys tag the response so it can be purged by key. They are
+	// sent as Surrogate-Key (Fastly) and Cache-Tag (Cloudflare).
+	SurrogateKeys []string
+}
+
+// Cache sets the caching headers of the route's responses. Handlers can
+// still override them, and add keys with AddSurrogateKeys.
+func (rt *Route) Cache(policy CachePolicy) *Route {
+	rt.cache = &policy
+	return rt
+}
+
+func (p *CachePolicy) apply(rw http.ResponseWriter) {
+	h := rw.Header()
+	if p.CacheControl != "" {
+		h.Set("Cache-Control", p.CacheControl)
+	}
+	if p.SurrogateControl != "" {
+		h.Set("Surrogate-Control", p.SurrogateControl)
+	}
+	AddSurrogateKeys(rw, p.SurrogateKeys...)
+}
+
+// AddSurrogateKeys tags the response with more surrogate keys, e.g. the IDs
+// of the records it was rendered from.
+func AddSurrogateKeys(rw http.ResponseWriter, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	h := rw.Header()
+	if v := h.Get("Surrogate-Key"); v != "" {
+		keys = append(strings.Fields(v), keys...)
+	}
+	h.Set("Surrogate-Key", strings.Join(keys, " "))
+	h.Set("Cache-Tag", strings.Join(keys, ","))
+}
@@ -0,0 +1,81 @@
+package router
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustProxies lists the load balancers and proxies, as addresses or CIDR
+// prefixes, whose X-Forwarded-For headers ClientIP believes. It is not
+// safe to call while serving requests.
+func (r *Router) TrustProxies(proxies ...string) error {
+	trusted := make([]netip.Prefix, 0, len(proxies))
+	for _, p := range proxies {
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(p)
+			if aerr != nil {
+				return fmt.Errorf("router: trusted proxy %q: %w", p, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		trusted = append(trusted, prefix.Masked())
+	}
+	r.trusted = trusted
+	return nil
+}
+
+func (r *Router) trusts(addr netip.Addr) bool {
+	for _, p := range r.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client making the request. When the
+// connection comes from a proxy trusted with TrustProxies, X-Forwarded-For is
+// read from the right, skipping trusted hops, so clients cannot spoof it by
+// sending their own. It is the zero Addr when RemoteAddr is not an IP, e.g.
+// on a Unix socket.
+func ClientIP(rr *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(rr.RemoteAddr)
+	if err != nil {
+		host = rr.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	addr = addr.Unmap()
+
+	s, ok := rr.Context().Value(stateKey{}).(*requestState)
+	if !ok || len(s.router.trusted) == 0 || !s.router.trusts(addr) {
+		return addr
+	}
+	hops := strings.Split(strings.Join(rr.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !s.router.trusts(addr) {
+			break
+		}
+	}
+	return addr
+}
+
+// clientAddr is ClientIP for logs, falling back to RemoteAddr when it is not
+// an IP.
+func clientAddr(rr *http.Request) string {
+	if addr := ClientIP(rr); addr.IsValid() {
+		return addr.String()
+	}
+	return rr.RemoteAddr
+}
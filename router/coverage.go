@@ -0,0 +1,213 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxUnmatched bounds the distinct unmatched requests Coverage keeps, so
+// scanners cannot grow it without limit.
+const maxUnmatched = 1000
+
+// Coverage counts which registered routes requests reach and which requests
+// reach none, to find dead routes and missing registrations. Feed it live
+// or test traffic with Middleware, or recorded traffic with Observe.
+type Coverage struct {
+	router *Router
+
+	mu        sync.RWMutex
+	hits      map[*Route]int64
+	unmatched map[unmatchedKey]int64
+	dropped   int64
+}
+
+type unmatchedKey struct {
+	method, path string
+	status       int
+}
+
+// CoverageReport is a snapshot of a Coverage.
+type CoverageReport struct {
+	Routes  int `json:"routes"`
+	Covered int `json:"covered"`
+	// Hits counts the requests each route pattern served.
+	Hits map[string]int64 `json:"hits"`
+	// Unused lists the routes no request reached.
+	Unused []RouteInfo `json:"unused"`
+	// Unmatched lists the requests that reached no route, most frequent
+	// first, with the 404 or 405 they got.
+	Unmatched []UnmatchedRequest `json:"unmatched"`
+	// Dropped counts unmatched requests not listed once the list was full.
+	Dropped int64 `json:"dropped,omitempty"`
+}
+
+type UnmatchedRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	Count  int64  `json:"count"`
+}
+
+func NewCoverage(r *Router) *Coverage {
+	return &Coverage{
+		router:    r,
+		hits:      make(map[*Route]int64),
+		unmatched: make(map[unmatchedKey]int64),
+	}
+}
+
+// Middleware records the route of every request it passes on, as the
+// router matched it, so it can wrap the router as well as be passed to Use.
+// Requests the router turned away before matching, e.g. with 421 for an
+// unknown host, are not counted.
+func (c *Coverage) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, rr *http.Request) {
+		rr = c.router.withState(rw, rr)
+		next.ServeHTTP(rw, rr)
+
+		if route := MatchedRoute(rr); route != nil {
+			c.hit(route)
+			return
+		}
+		err := RequestError(rr)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			c.miss(rr, http.StatusNotFound)
+		case errors.Is(err, ErrMethodNotAllowed):
+			c.miss(rr, http.StatusMethodNotAllowed)
+		case errors.Is(err, ErrMalformedPath):
+			c.miss(rr, http.StatusBadRequest)
+		}
+	})
+}
+
+// Observe records a request from recorded traffic, e.g. the method and path
+// of an access log line or of /admin/requests.
+func (c *Coverage) Observe(method, target string) error {
+	rr, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return fmt.Errorf("router: coverage: %w", err)
+	}
+	c.ObserveRequest(rr)
+	return nil
+}
+
+// ObserveRequest matches rr as the router would and records the result.
+func (c *Coverage) ObserveRequest(rr *http.Request) {
+	if _, err := c.router.checkHost(rr); err != nil {
+		return
+	}
+	route, allowed, ok := c.router.match(rr)
+	switch {
+	case route != nil:
+		c.hit(route)
+	case !ok:
+		c.miss(rr, http.StatusBadRequest)
+	case len(allowed) > 0:
+		c.miss(rr, http.StatusMethodNotAllowed)
+	default:
+		c.miss(rr, http.StatusNotFound)
+	}
+}
+
+func (c *Coverage) hit(route *Route) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.hits[route]++
+}
+
+func (c *Coverage) miss(rr *http.Request, status int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := unmatchedKey{method: rr.Method, path: OriginalPath(rr), status: status}
+	if _, seen := c.unmatched[key]; !seen && len(c.unmatched) >= maxUnmatched {
+		c.dropped++
+		return
+	}
+	c.unmatched[key]++
+}
+
+// Report returns the routes covered so far and the requests left unmatched.
+func (c *Coverage) Report() CoverageReport {
+	c.router.mu.RLock()
+	routes := append([]*Route(nil), c.router.routes...)
+	c.router.mu.RUnlock()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	report := CoverageReport{
+		Routes:    len(routes),
+		Hits:      make(map[string]int64, len(c.hits)),
+		Unused:    []RouteInfo{},
+		Unmatched: make([]UnmatchedRequest, 0, len(c.unmatched)),
+		Dropped:   c.dropped,
+	}
+	for _, route := range routes {
+		if n := c.hits[route]; n > 0 {
+			report.Covered++
+			report.Hits[route.Pattern()] += n
+			continue
+		}
+		report.Unused = append(report.Unused, route.info())
+	}
+	sort.Slice(report.Unused, func(i, j int) bool {
+		return report.Unused[i].Pattern < report.Unused[j].Pattern
+	})
+
+	for key, n := range c.unmatched {
+		report.Unmatched = append(report.Unmatched, UnmatchedRequest{
+			Method: key.method, Path: key.path, Status: key.status, Count: n,
+		})
+	}
+	sort.Slice(report.Unmatched, func(i, j int) bool {
+		a, b := report.Unmatched[i], report.Unmatched[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Method < b.Method
+	})
+	return report
+}
+
+// ServeHTTP serves the report as JSON.
+func (c *Coverage) ServeHTTP(rw http.ResponseWriter, rr *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(c.Report())
+}
+
+// WriteText writes the report for a terminal or a CI log:
+//
+//	routes covered: 12/14
+//	unused  DELETE:/users/{id}   (users.go:42)
+//	404     GET /user/1          3
+func (r CoverageReport) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "routes covered: %d/%d\n", r.Covered, r.Routes)
+	for _, route := range r.Unused {
+		fmt.Fprintf(&b, "unused  %s", route.Pattern)
+		if route.Source != "" {
+			fmt.Fprintf(&b, "   (%s)", route.Source)
+		}
+		b.WriteString("\n")
+	}
+	for _, u := range r.Unmatched {
+		fmt.Fprintf(&b, "%-7d %s %s   %d\n", u.Status, u.Method, u.Path, u.Count)
+	}
+	if r.Dropped > 0 {
+		fmt.Fprintf(&b, "%d more unmatched requests not listed\n", r.Dropped)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,107 @@
+package router
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// RouteDiff lists what changed between two route tables.
+type RouteDiff struct {
+	Added   []RouteInfo   `json:"added"`
+	Removed []RouteInfo   `json:"removed"`
+	Changed []RouteChange `json:"changed"`
+}
+
+// RouteChange is a route registered in both tables whose permissions or
+// tags differ. Where it is registered is not a change.
+type RouteChange struct {
+	Old    RouteInfo `json:"old"`
+	New    RouteInfo `json:"new"`
+	Fields []string  `json:"fields"`
+}
+
+// Diff compares two route tables, such as the Routes of the previous
+// release kept as JSON and those of the current build. Routes are matched
+// by pattern.
+func Diff(old, new []RouteInfo) RouteDiff {
+	before := make(map[string]RouteInfo, len(old))
+	for _, route := range old {
+		before[route.Pattern] = route
+	}
+	after := make(map[string]bool, len(new))
+
+	diff := RouteDiff{Added: []RouteInfo{}, Removed: []RouteInfo{}, Changed: []RouteChange{}}
+	for _, route := range new {
+		after[route.Pattern] = true
+		prev, ok := before[route.Pattern]
+		if !ok {
+			diff.Added = append(diff.Added, route)
+			continue
+		}
+		var fields []string
+		if !sameSet(prev.Permissions, route.Permissions) {
+			fields = append(fields, "permissions")
+		}
+		if !sameSet(prev.Tags, route.Tags) {
+			fields = append(fields, "tags")
+		}
+		if len(fields) > 0 {
+			diff.Changed = append(diff.Changed, RouteChange{Old: prev, New: route, Fields: fields})
+		}
+	}
+	for _, route := range old {
+		if !after[route.Pattern] {
+			diff.Removed = append(diff.Removed, route)
+		}
+	}
+
+	byPattern := func(routes []RouteInfo) {
+		sort.Slice(routes, func(i, j int) bool { return routes[i].Pattern < routes[j].Pattern })
+	}
+	byPattern(diff.Added)
+	byPattern(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].New.Pattern < diff.Changed[j].New.Pattern })
+	return diff
+}
+
+func sameSet(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
+
+// Empty reports whether the tables compared were the same.
+func (d RouteDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// WriteText writes the diff one route per line, for release notes: added
+// routes are prefixed with "+", removed ones with "-" and changed ones with
+// "~", followed by the old and new values of what changed.
+func (d RouteDiff) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, route := range d.Added {
+		fmt.Fprintf(&b, "+ %s\n", route.Pattern)
+	}
+	for _, route := range d.Removed {
+		fmt.Fprintf(&b, "- %s\n", route.Pattern)
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(&b, "~ %s ", c.New.Pattern)
+		for _, field := range c.Fields {
+			switch field {
+			case "permissions":
+				fmt.Fprintf(&b, " permissions: %v -> %v", c.Old.Permissions, c.New.Permissions)
+			case "tags":
+				fmt.Fprintf(&b, " tags: %v -> %v", c.Old.Tags, c.New.Tags)
+			}
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,30 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// StatusClientClosedRequest is recorded, as nginx does, for requests whose
+// client went away before the response was complete. It is never sent.
+const StatusClientClosedRequest = 499
+
+// ClientGone reports whether the client of rr has disconnected. The server
+// cancels the request context when it does, so handlers blocked on
+// rr.Context() return as soon as that happens.
+func ClientGone(rr *http.Request) bool {
+	return errors.Is(rr.Context().Err(), context.Canceled)
+}
+
+// responseStatus is the status to record for a served request, given the
+// one written, if any.
+func responseStatus(rr *http.Request, written int) int {
+	switch {
+	case ClientGone(rr):
+		return StatusClientClosedRequest
+	case written == 0:
+		return http.StatusOK
+	}
+	return written
+}
@@ -0,0 +1,283 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+var ErrNotFound = errors.New("no route matches the request")
+
+// ErrorHandler writes the response for requests that failed: unmatched
+// paths (404), unmatched methods (405), denied permissions (403), errors
+// returned by HandlerFuncE handlers and panics (500).
+type ErrorHandler interface {
+	ServeError(rw http.ResponseWriter, rr *http.Request, status int, err error)
+}
+
+type ErrorHandlerFunc func(rw http.ResponseWriter, rr *http.Request, status int, err error)
+
+func (f ErrorHandlerFunc) ServeError(rw http.ResponseWriter, rr *http.Request, status int, err error) {
+	f(rw, rr, status, err)
+}
+
+// HandlerFuncE is a handler that reports failure by returning an error
+// instead of writing the error response itself.
+type HandlerFuncE func(rw http.ResponseWriter, rr *http.Request) error
+
+// PanicError is the error a recovered panic is converted into.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// requestState is shared by everything serving one request, so middleware
+// wrapping the router can tell whether the request failed.
+type requestState struct {
+	err error
+	id  string
+	// logger and route are set once matched, while watchdogs such as the
+	// slow request one may read them.
+	logger atomic.Pointer[slog.Logger]
+	route  atomic.Pointer[Route]
+	router *Router
+	path   string
+	params Params
+}
+
+type stateKey struct{}
+
+func (r *Router) withState(rw http.ResponseWriter, rr *http.Request) *http.Request {
+	if _, ok := rr.Context().Value(stateKey{}).(*requestState); ok {
+		return rr
+	}
+
+	id := rr.Header.Get(RequestIDHeader)
+	if id == "" || len(id) > 128 {
+		id = newRequestID()
+	}
+	rw.Header().Set(RequestIDHeader, id)
+
+	s := &requestState{
+		router: r,
+		id:     id,
+		path:   rr.URL.Path,
+	}
+	s.logger.Store(r.baseLogger().With("request_id", id, "method", rr.Method, "path", rr.URL.Path))
+	return rr.WithContext(context.WithValue(rr.Context(), stateKey{}, s))
+}
+
+// MatchedRoute returns the route serving the request, or nil before routing
+// or when no route matched.
+func MatchedRoute(rr *http.Request) *Route {
+	if s, ok := rr.Context().Value(stateKey{}).(*requestState); ok {
+		return s.route.Load()
+	}
+	return nil
+}
+
+// RequestError returns the error the request failed with, or nil. It is
+// meant for middleware passed to Use, after the router has served the
+// request.
+func RequestError(rr *http.Request) error {
+	if s, ok := rr.Context().Value(stateKey{}).(*requestState); ok {
+		return s.err
+	}
+	return nil
+}
+
+func (r *Router) SetErrorHandler(h ErrorHandler) {
+	r.updateErrors(func(c *errorConfig) { c.handler = h })
+}
+
+// errorConfig holds the error handlers of the router and its groups.
+type errorConfig struct {
+	handler ErrorHandler
+	// scopes are sorted by prefix, the longest first.
+	scopes []errorScope
+}
+
+// errorScope holds the error handlers of a group, for the requests below
+// its prefix.
+type errorScope struct {
+	prefix           string
+	handler          ErrorHandler
+	notFound         http.Handler
+	methodNotAllowed http.Handler
+}
+
+// updateErrors publishes a changed copy of the error handlers, leaving
+// the one requests being served may hold alone.
+func (r *Router) updateErrors(change func(c *errorConfig)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var c errorConfig
+	if old := r.errorHandlers.Load(); old != nil {
+		c.handler, c.scopes = old.handler, slices.Clone(old.scopes)
+	}
+	change(&c)
+	r.errorHandlers.Store(&c)
+}
+
+// SetErrorHandler overrides the router's ErrorHandler for requests below
+// the group's prefix, whether or not they match one of its routes: "/api"
+// can answer JSON problems while the site around it renders pages. The
+// group with the longest matching prefix wins.
+func (g *Group) SetErrorHandler(h ErrorHandler) *Group {
+	g.updateScope(func(s *errorScope) { s.handler = h })
+	return g
+}
+
+// NotFound serves unmatched requests below the group's prefix. It takes
+// precedence over ErrorHandlers, and writes its own status.
+func (g *Group) NotFound(h http.Handler) *Group {
+	g.updateScope(func(s *errorScope) { s.notFound = h })
+	return g
+}
+
+// MethodNotAllowed serves requests below the group's prefix whose method
+// no route accepts. The Allow header is already set.
+func (g *Group) MethodNotAllowed(h http.Handler) *Group {
+	g.updateScope(func(s *errorScope) { s.methodNotAllowed = h })
+	return g
+}
+
+func (g *Group) updateScope(change func(s *errorScope)) {
+	prefix := strings.Trim(g.prefix, "/")
+	g.router.updateErrors(func(c *errorConfig) {
+		i := slices.IndexFunc(c.scopes, func(s errorScope) bool { return s.prefix == prefix })
+		if i < 0 {
+			i = sort.Search(len(c.scopes), func(i int) bool { return len(c.scopes[i].prefix) < len(prefix) })
+			c.scopes = slices.Insert(c.scopes, i, errorScope{prefix: prefix})
+		}
+		change(&c.scopes[i])
+	})
+}
+
+// errorHandlerFor returns what writes the error response for rr, looking
+// through the groups whose prefix holds the request path from the longest
+// prefix to the shortest, then at the router.
+func (r *Router) errorHandlerFor(rr *http.Request, status int) ErrorHandler {
+	c := r.errorHandlers.Load()
+	if c == nil {
+		return nil
+	}
+	path := strings.Trim(OriginalPath(rr), "/")
+	for _, scope := range c.scopes {
+		if scope.prefix != "" && path != scope.prefix && !strings.HasPrefix(path, scope.prefix+"/") {
+			continue
+		}
+		switch {
+		case status == http.StatusNotFound && scope.notFound != nil:
+			return serveHandler(scope.notFound)
+		case status == http.StatusMethodNotAllowed && scope.methodNotAllowed != nil:
+			return serveHandler(scope.methodNotAllowed)
+		case scope.handler != nil:
+			return scope.handler
+		}
+	}
+	return c.handler
+}
+
+// ServeError fails rr with status through the router serving it, as if a
+// HandlerFuncE had returned err: the ErrorHandler of the request's group
+// or router writes the response, the ErrorReporter sees 5xx errors and
+// RequestError returns err. It is for handlers and middleware that fail
+// without returning an error, e.g. a proxy whose upstream is down. Outside
+// a router it writes a plain text response.
+func ServeError(rw http.ResponseWriter, rr *http.Request, status int, err error) {
+	if s, ok := rr.Context().Value(stateKey{}).(*requestState); ok {
+		s.router.serveError(rw, rr, status, err)
+		return
+	}
+	http.Error(rw, http.StatusText(status), status)
+}
+
+func serveHandler(h http.Handler) ErrorHandler {
+	return ErrorHandlerFunc(func(rw http.ResponseWriter, rr *http.Request, status int, err error) {
+		h.ServeHTTP(rw, rr)
+	})
+}
+
+// serveError is the single failure path of the router.
+func (r *Router) serveError(rw http.ResponseWriter, rr *http.Request, status int, err error) {
+	if s, ok := rr.Context().Value(stateKey{}).(*requestState); ok {
+		s.err = err
+	}
+
+	var perr *PanicError
+	if errors.As(err, &perr) {
+		Logger(rr).Error("router: handler panicked", "panic", perr.Value, "stack", string(perr.Stack))
+	}
+	r.report(rr, status, err)
+	// Nobody is left to read the response.
+	if ClientGone(rr) {
+		return
+	}
+
+	if h := r.errorHandlerFor(rr, status); h != nil {
+		h.ServeError(rw, rr, status, err)
+		return
+	}
+	if status == http.StatusNotFound {
+		http.NotFound(rw, rr)
+		return
+	}
+	http.Error(rw, http.StatusText(status), status)
+}
+
+// recoverPanic turns a handler panic into a 500 response. http.ErrAbortHandler
+// is re-raised so the server can abort the connection as intended.
+func (r *Router) recoverPanic(rw http.ResponseWriter, rr *http.Request) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+	r.serveError(rw, rr, http.StatusInternalServerError, &PanicError{Value: v, Stack: debug.Stack()})
+}
+
+// adapt converts a HandlerFuncE into an http.Handler whose errors and panics
+// both end up in serveError.
+func (r *Router) adapt(handler HandlerFuncE) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, rr *http.Request) {
+		defer r.recoverPanic(rw, rr)
+
+		if err := handler(rw, rr); err != nil {
+			r.serveError(rw, rr, http.StatusInternalServerError, err)
+		}
+	})
+}
+
+func (r *Router) HandleFuncE(path string, handler HandlerFuncE) *Route {
+	if handler == nil {
+		panic(ErrNilHandler)
+	}
+	return r.Handle(path, r.adapt(handler))
+}
+
+func (g *Group) HandleFuncE(path string, handler HandlerFuncE) *Route {
+	if handler == nil {
+		panic(ErrNilHandler)
+	}
+	return g.Handle(path, g.router.adapt(handler))
+}
@@ -0,0 +1,134 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+var ErrNotBuilt = errors.New("route handler has not been built, call Router.Build")
+
+// Deps resolves the services a handler factory depends on. Lookups that
+// fail are reported together by Build.
+type Deps struct {
+	router *Router
+	errs   *[]error
+}
+
+// Service returns the service registered under name with Provide, or nil
+// after recording the failure.
+func (d Deps) Service(name string) any {
+	v, ok := d.router.Service(name)
+	if !ok {
+		*d.errs = append(*d.errs, fmt.Errorf("no service named %q", name))
+	}
+	return v
+}
+
+// Dep returns the service registered under name as a T, or the zero T
+// after recording the failure.
+func Dep[T any](d Deps, name string) T {
+	v, ok := d.router.Service(name)
+	t, isT := v.(T)
+	switch {
+	case !ok:
+		*d.errs = append(*d.errs, fmt.Errorf("no service named %q", name))
+	case !isT:
+		*d.errs = append(*d.errs, fmt.Errorf("service %q is a %T, not a %T", name, v, t))
+	}
+	return t
+}
+
+// Factory builds a route's handler from its dependencies.
+type Factory func(deps Deps) http.Handler
+
+// factoryHandler serves the handler built for a factory route.
+type factoryHandler struct {
+	router  *Router
+	pattern string
+	factory Factory
+	handler atomic.Pointer[http.Handler]
+}
+
+func (f *factoryHandler) ServeHTTP(rw http.ResponseWriter, rr *http.Request) {
+	h := f.handler.Load()
+	if h == nil {
+		f.router.serveError(rw, rr, http.StatusInternalServerError, ErrNotBuilt)
+		return
+	}
+	(*h).ServeHTTP(rw, rr)
+}
+
+// HandleF registers a route whose handler is made by factory when Build
+// runs, so handlers receive their dependencies instead of reaching for
+// globals, and tests can wire them with fakes.
+func (r *Router) HandleF(pattern string, factory Factory) *Route {
+	return r.Handle(pattern, r.factoryHandler(pattern, factory))
+}
+
+func (r *Router) GetF(path string, factory Factory) *Route {
+	return r.HandleF(http.MethodGet+":"+path, factory)
+}
+
+func (r *Router) PostF(path string, factory Factory) *Route {
+	return r.HandleF(http.MethodPost+":"+path, factory)
+}
+
+func (r *Router) PutF(path string, factory Factory) *Route {
+	return r.HandleF(http.MethodPut+":"+path, factory)
+}
+
+func (r *Router) PatchF(path string, factory Factory) *Route {
+	return r.HandleF(http.MethodPatch+":"+path, factory)
+}
+
+func (r *Router) DeleteF(path string, factory Factory) *Route {
+	return r.HandleF(http.MethodDelete+":"+path, factory)
+}
+
+func (g *Group) HandleF(pattern string, factory Factory) *Route {
+	return g.Handle(pattern, g.router.factoryHandler(pattern, factory))
+}
+
+func (r *Router) factoryHandler(pattern string, factory Factory) http.Handler {
+	if factory == nil {
+		return nil
+	}
+	f := &factoryHandler{router: r, pattern: pattern, factory: factory}
+	r.mu.Lock()
+	r.factories = append(r.factories, f)
+	r.mu.Unlock()
+	return f
+}
+
+// Build calls the factories of the routes registered with HandleF since the
+// last Build, returning every dependency that could not be resolved.
+// Handlers implementing io.Closer are closed when the router stops. Start
+// builds the router if it has not been.
+func (r *Router) Build() error {
+	r.mu.Lock()
+	pending := r.factories
+	r.factories = nil
+	r.mu.Unlock()
+
+	var errs []error
+	for _, f := range pending {
+		var failed []error
+		h := f.factory(Deps{router: r, errs: &failed})
+		if h == nil && len(failed) == 0 {
+			failed = append(failed, errors.New("factory returned a nil handler"))
+		}
+		if len(failed) > 0 {
+			errs = append(errs, fmt.Errorf("router: %q: %w", f.pattern, errors.Join(failed...)))
+			continue
+		}
+		f.handler.Store(&h)
+		if c, ok := h.(io.Closer); ok {
+			r.OnShutdown(func(ctx context.Context) error { return c.Close() })
+		}
+	}
+	return errors.Join(errs...)
+}
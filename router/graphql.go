@@ -0,0 +1,106 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type graphqlConfig struct {
+	maxBody    int64
+	maxBatch   int
+	playground bool
+}
+
+type GraphQLOption func(*graphqlConfig)
+
+// GraphQLMaxBody limits the size of POST bodies. The default is 1 MB.
+func GraphQLMaxBody(n int64) GraphQLOption {
+	return func(c *graphqlConfig) { c.maxBody = n }
+}
+
+// GraphQLMaxBatch limits the number of operations in a batched request. The
+// default is 10.
+func GraphQLMaxBatch(n int) GraphQLOption {
+	return func(c *graphqlConfig) { c.maxBatch = n }
+}
+
+// GraphQLPlayground serves a GraphiQL page to browsers that GET the endpoint
+// without a query. Only enable it in development.
+func GraphQLPlayground(enabled bool) GraphQLOption {
+	return func(c *graphqlConfig) { c.playground = enabled }
+}
+
+// GraphQL mounts a GraphQL endpoint at path, answering POST requests and GET
+// requests carrying a query (or persisted query extension) in the URL.
+// Bodies and batches are bounded before the schema handler sees them.
+func (r *Router) GraphQL(path string, handler http.Handler, options ...GraphQLOption) {
+	c := &graphqlConfig{maxBody: 1 << 20, maxBatch: 10}
+	for _, o := range options {
+		o(c)
+	}
+
+	r.Handle("POST:"+path, http.HandlerFunc(func(rw http.ResponseWriter, rr *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(rr.Body, c.maxBody+1))
+		rr.Body.Close()
+		if err != nil {
+			http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		if int64(len(body)) > c.maxBody {
+			http.Error(rw, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+			var batch []json.RawMessage
+			if err := json.Unmarshal(trimmed, &batch); err != nil {
+				http.Error(rw, "invalid batch", http.StatusBadRequest)
+				return
+			}
+			if len(batch) > c.maxBatch {
+				http.Error(rw, "too many operations in batch", http.StatusRequestEntityTooLarge)
+				return
+			}
+		}
+
+		rr.Body = io.NopCloser(bytes.NewReader(body))
+		handler.ServeHTTP(rw, rr)
+	}))
+
+	r.Handle("GET:"+path, http.HandlerFunc(func(rw http.ResponseWriter, rr *http.Request) {
+		q := rr.URL.Query()
+		if q.Get("query") == "" && q.Get("extensions") == "" {
+			if c.playground && strings.Contains(rr.Header.Get("Accept"), "text/html") {
+				rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+				io.WriteString(rw, graphiql)
+				return
+			}
+			http.Error(rw, "missing query", http.StatusBadRequest)
+			return
+		}
+		handler.ServeHTTP(rw, rr)
+	}))
+}
+
+const graphiql = `<!DOCTYPE html>
+<html>
+<head>
+<title>GraphiQL</title>
+<link rel="stylesheet" href="https://unpkg.com/graphiql/graphiql.min.css">
+</head>
+<body style="margin:0">
+<div id="graphiql" style="height:100vh"></div>
+<script src="https://unpkg.com/react/umd/react.production.min.js"></script>
+<script src="https://unpkg.com/react-dom/umd/react-dom.production.min.js"></script>
+<script src="https://unpkg.com/graphiql/graphiql.min.js"></script>
+<script>
+ReactDOM.render(
+	React.createElement(GraphiQL, {fetcher: GraphiQL.createFetcher({url: window.location.pathname})}),
+	document.getElementById("graphiql"));
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,46 @@
+package router
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type headerRule struct {
+	prefix string
+	header http.Header
+}
+
+// SetHeaders replaces the static response headers applied by the router.
+// Rules are keyed by path prefix; a request receives the headers of every
+// prefix its path falls under, the most specific prefix winning. Handlers can
+// still override them. It is safe to call while serving requests.
+func (r *Router) SetHeaders(rules map[string]http.Header) {
+	table := make([]headerRule, 0, len(rules))
+	for prefix, header := range rules {
+		table = append(table, headerRule{joinPath(prefix, ""), header.Clone()})
+	}
+	sort.Slice(table, func(i, j int) bool {
+		return len(table[i].prefix) < len(table[j].prefix)
+	})
+	r.headers.Store(table)
+}
+
+func (r *Router) applyHeaders(rw http.ResponseWriter, path string) {
+	table, _ := r.headers.Load().([]headerRule)
+	for _, rule := range table {
+		if !hasPathPrefix(path, rule.prefix) {
+			continue
+		}
+		for k, v := range rule.header {
+			rw.Header()[k] = append([]string(nil), v...)
+		}
+	}
+}
+
+func hasPathPrefix(path, prefix string) bool {
+	if prefix == "/" {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
@@ -0,0 +1,48 @@
+package router
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// NormalizeHost returns host in the form hosts are compared in: without
+// its port or trailing dot, lower-cased, and with internationalized labels
+// in their ASCII "xn--" form, so "Bücher.example." and
+// "xn--bcher-kva.example:8080" are the same host. Labels are mapped as
+// IDNA lookups do (UTS #46), so full-width letters and ideographic full
+// stops read as their ASCII counterparts. A leading "*." wildcard is kept.
+// Hosts IDNA refuses come back lower-cased when they are ASCII, e.g. names
+// with underscores, and empty otherwise.
+func NormalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if addr, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		return addr.String()
+	}
+	wildcard, name := "", host
+	if rest, ok := strings.CutPrefix(host, "*."); ok {
+		wildcard, name = "*.", rest
+	}
+	ascii, err := idna.Lookup.ToASCII(name)
+	if err != nil {
+		if !isASCII(name) {
+			return ""
+		}
+		ascii = strings.ToLower(name)
+	}
+	return wildcard + strings.TrimSuffix(ascii, ".")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -2,18 +2,21 @@ package router
 
 import (
 	"errors"
+	"net/http"
 	"net/url"
 	"strings"
+	"unicode/utf8"
 )
 
 var (
 	ErrMethodNotAllowed = errors.New("method is not allowed for this router")
 	ErrBadPath          = errors.New("every path definition must conform to [Method]:[Url]")
 	ErrNilHandler       = errors.New("nill handler provided")
+	ErrMalformedPath    = errors.New("request path is malformed")
 )
 
 func isValidMethod(method string) bool {
-	for _, m := range []string{"GET", "POST", "PUT", "DELETE", "HEAD", "OPTIONS"} {
+	for _, m := range []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"} {
 		if strings.EqualFold(m, method) {
 			return true
 		}
@@ -21,26 +24,43 @@ func isValidMethod(method string) bool {
 	return false
 }
 
+// tokenize splits a "METHOD:/path" pattern into its method, host and path.
+// Matching relies on these invariants:
+//
+//   - the method is upper-cased, so "get:/a" and "GET:/a" are one route;
+//   - the leading slash and every trailing slash are dropped, so "GET:/a",
+//     "GET:/a/" and "GET:/a//" are one route, and "/" alone stays "/";
+//   - the path is percent-decoded, like http.Request.URL.Path;
+//   - only one leading slash is dropped, so "GET://a" is the route for
+//     the request path "//a", but a path starting with three slashes reads
+//     as "///host/path", a route for that host;
+//   - slashes are trimmed before decoding, so a %2F at either end stays,
+//     matching only with PreserveEncodedSlashes.
+//
+// The only colon allowed after the method's is that of a {name:conv}
+// parameter.
+//
+// Patterns are also checked by Handle, which rejects queries and fragments;
+// see validPattern.
 func tokenize(path string) (string, string, string) {
-	paths := strings.Split(path, ":")
-	if len(paths) != 2 {
+	method, pathUrl, ok := cutMethod(path)
+	if !ok {
 		panic(ErrBadPath)
 	}
 
-	pathMethod := paths[0]
+	pathMethod := strings.ToUpper(method)
 	if !isValidMethod(pathMethod) {
 		panic(ErrMethodNotAllowed)
 	}
 
-	pathUrl := paths[1]
 	pathUrl = strings.TrimPrefix(pathUrl, "/")
-	pathUrl = strings.TrimSuffix(pathUrl, "/")
+	pathUrl = strings.TrimRight(pathUrl, "/")
 
 	if pathUrl == "" {
 		pathUrl = "/"
 	}
 
-	u, err := url.Parse(pathUrl)
+	u, err := url.Parse(escapeParams(pathUrl))
 	if err != nil {
 		panic(err)
 	}
@@ -48,6 +68,53 @@ func tokenize(path string) (string, string, string) {
 	return pathMethod, u.Host, u.Path
 }
 
-func New() *Router {
-	return &Router{}
+// requestPath normalises a request path the way tokenize normalises
+// patterns, so the two can be compared. It never panics: a path that is not
+// absolute, or holds a NUL byte or invalid UTF-8, is reported as malformed.
+// URL.Path is already decoded, so it is not decoded again.
+func requestPath(rr *http.Request) (string, bool) {
+	path := rr.URL.Path
+	if !strings.HasPrefix(path, "/") || strings.IndexByte(path, 0) >= 0 || !utf8.ValidString(path) {
+		return "", false
+	}
+
+	path = strings.TrimRight(strings.TrimPrefix(path, "/"), "/")
+	if path == "" {
+		path = "/"
+	}
+	return path, true
+}
+
+// validPattern reports whether a route pattern can be matched at all: a "?"
+// or "#" would be parsed as a query or fragment and silently dropped. The
+// "?" closing an optional {name?} segment is allowed.
+func validPattern(pattern string) bool {
+	method, path, ok := cutMethod(pattern)
+	return ok && method != "" && !strings.ContainsAny(strings.ReplaceAll(path, "?}", "}"), "?#")
+}
+
+// New returns a router configured by opts, applied in order, e.g.
+//
+//	router.New(router.WithMatcher(router.NewTrieMatcher()), router.StrictSlash())
+func New(opts ...Option) *Router {
+	r := &Router{matcher: newBucketMatcher()}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// NewWithMatcher returns a router matching requests with m, e.g.
+// NewTrieMatcher() for path parameters or NewRegexMatcher() for regular
+// expression paths. It is New(WithMatcher(m)).
+func NewWithMatcher(m Matcher) *Router {
+	return New(WithMatcher(m))
+}
+
+// RequestPath returns the request path normalised like route paths (see
+// Route.Path), for Matcher implementations. It is false when the path is
+// malformed; the router answers those requests with 400 without calling
+// the matcher.
+func RequestPath(rr *http.Request) (string, bool) {
+	return requestPath(rr)
 }
@@ -0,0 +1,88 @@
+package router
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrStarted = errors.New("routes and middleware cannot be added once the router serves requests, see MutableAfterStart")
+
+type Hook func(ctx context.Context) error
+
+// MutableAfterStart lets routes and middleware be added while the router
+// serves requests, e.g. by plugins loaded at run time, at the cost of a
+// read lock around every match. Without it, the route table is read
+// without locking and adding to it after the first request is an error:
+// Handle, Mount and Use panic, in strict mode too.
+func MutableAfterStart() Option {
+	return func(r *Router) { r.mutable = true }
+}
+
+// checkMutable returns ErrStarted when the router can no longer be changed.
+// r.mu must be held.
+func (r *Router) checkMutable() error {
+	if r.served.Load() && !r.mutable {
+		return ErrStarted
+	}
+	return nil
+}
+
+// readLock guards a read of the route table of a MutableAfterStart router,
+// returning the unlock function.
+func (r *Router) readLock() func() {
+	if !r.mutable {
+		return func() {}
+	}
+	r.mu.RLock()
+	return r.mu.RUnlock
+}
+
+// OnStart registers a hook the server runs before accepting requests. A
+// failing hook aborts startup.
+func (r *Router) OnStart(hook Hook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onStart = append(r.onStart, hook)
+}
+
+// OnShutdown registers a hook the server runs once in-flight requests have
+// drained. Hooks run in reverse registration order, so resources are
+// released before the ones they depend on.
+func (r *Router) OnShutdown(hook Hook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onShutdown = append(r.onShutdown, hook)
+}
+
+// Start runs the OnStart hooks in order, stopping at the first error. A
+// Strict router first refuses to start with invalid routes, and handler
+// factories are built before any hook runs.
+func (r *Router) Start(ctx context.Context) error {
+	if r.strict {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := r.Build(); err != nil {
+		return err
+	}
+	for _, hook := range r.onStart {
+		if err := hook(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop runs every OnShutdown hook and returns their combined errors.
+func (r *Router) Stop(ctx context.Context) error {
+	var errs []error
+	for i := len(r.onShutdown) - 1; i >= 0; i-- {
+		if err := r.onShutdown[i](ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,51 @@
+package router
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+// RequestIDHeader carries the request ID. An incoming value is kept so IDs
+// can be followed across services; otherwise one is generated.
+const RequestIDHeader = "X-Request-Id"
+
+// SetLogger sets the logger the router logs with and derives per-request
+// loggers from. It defaults to slog.Default().
+func (r *Router) SetLogger(l *slog.Logger) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.logger = l
+}
+
+func (r *Router) baseLogger() *slog.Logger {
+	if r.logger != nil {
+		return r.logger
+	}
+	return slog.Default()
+}
+
+// Logger returns the logger of the request being served, carrying its
+// request ID, method and path. Outside of a router it returns slog.Default().
+func Logger(rr *http.Request) *slog.Logger {
+	if s, ok := rr.Context().Value(stateKey{}).(*requestState); ok {
+		return s.logger.Load()
+	}
+	return slog.Default()
+}
+
+// RequestID returns the ID assigned to the request by the router.
+func RequestID(rr *http.Request) string {
+	if s, ok := rr.Context().Value(stateKey{}).(*requestState); ok {
+		return s.id
+	}
+	return ""
+}
+
+func newRequestID() string {
+	var b [12]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
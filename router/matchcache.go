@@ -0,0 +1,81 @@
+package router
+
+import (
+	"container/list"
+	"sync"
+)
+
+// matchCache is a bounded LRU of the routes matched for method and path
+// pairs. Only matches of routes registered with Handle are kept, so scans
+// of unknown paths, or of the endless paths below a mount, cannot evict the
+// hot ones.
+type matchCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[matchKey]*list.Element
+	order   list.List
+}
+
+type matchKey struct {
+	method, path string
+}
+
+type matchEntry struct {
+	key   matchKey
+	route *Route
+}
+
+// CacheMatches keeps the routes matched for the size most recently
+// requested method and path pairs, for workloads dominated by a few URLs
+// where scanning the route table shows up in profiles. The cache is cleared
+// whenever a route is registered. It only applies to the built-in matchers,
+// as custom ones may match on more than the method and path. Zero disables
+// it.
+func (r *Router) CacheMatches(size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if size <= 0 {
+		r.matches = nil
+		return
+	}
+	r.matches = &matchCache{size: size, entries: make(map[matchKey]*list.Element, size)}
+}
+
+func (c *matchCache) get(method, path string) *Route {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[matchKey{method, path}]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*matchEntry).route
+}
+
+func (c *matchCache) put(method, path string, route *Route) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := matchKey{method, path}
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*matchEntry).route = route
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&matchEntry{key: key, route: route})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*matchEntry).key)
+	}
+}
+
+func (c *matchCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.entries)
+	c.order.Init()
+}
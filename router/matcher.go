@@ -0,0 +1,161 @@
+package router
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// MatchResult is the outcome of matching a request.
+type MatchResult struct {
+	Route *Route
+	// Allowed lists, when Route is nil, the methods the path accepts; the
+	// router then answers 405 instead of 404.
+	Allowed []string
+}
+
+// Matcher finds the route for a request. Routes registered with a host are
+// passed to Add too; matchers that do not support them ignore them. Exact
+// routes must win over mounted ones, and the longest mount over shorter
+// ones. Add is called with the router locked, Match concurrently.
+type Matcher interface {
+	Add(route *Route) error
+	Match(rr *http.Request) MatchResult
+}
+
+// pathMatcher is implemented by the built-in matchers to reuse the path
+// the router has already normalised.
+type pathMatcher interface {
+	matchPath(method, path string) MatchResult
+}
+
+// linearMatcher scans every route in registration order. It is the
+// simplest and slowest matcher.
+type linearMatcher struct {
+	routes []*Route
+}
+
+// NewLinearMatcher returns a matcher that compares the request with every
+// route in turn, cheap for a handful of routes.
+func NewLinearMatcher() Matcher {
+	return &linearMatcher{}
+}
+
+func (m *linearMatcher) Add(route *Route) error {
+	if route.hasParams() {
+		return ErrParamsUnsupported
+	}
+	if route.host == "" {
+		m.routes = append(m.routes, route)
+	}
+	return nil
+}
+
+func (m *linearMatcher) Match(rr *http.Request) MatchResult {
+	path, _ := requestPath(rr)
+	return m.matchPath(rr.Method, path)
+}
+
+func (m *linearMatcher) matchPath(method, path string) MatchResult {
+	var mounted *Route
+	var allowed []string
+	for _, route := range m.routes {
+		if route.mount {
+			if route.mounts(path) && route.outmounts(mounted) {
+				mounted = route
+			}
+			continue
+		}
+		if route.path != path {
+			continue
+		}
+		if route.method == method {
+			return MatchResult{Route: route}
+		}
+		allowed = append(allowed, route.method)
+	}
+	if mounted != nil {
+		return MatchResult{Route: mounted}
+	}
+	sort.Strings(allowed)
+	return MatchResult{Allowed: allowed}
+}
+
+// bucketMatcher, the default, buckets exact routes by method, then by
+// first path segment, so a request only scans the routes that could share
+// its path.
+type bucketMatcher struct {
+	buckets map[string]map[string][]*Route
+	mounts  []*Route
+}
+
+func newBucketMatcher() *bucketMatcher {
+	return &bucketMatcher{buckets: make(map[string]map[string][]*Route)}
+}
+
+func (m *bucketMatcher) Add(route *Route) error {
+	if route.hasParams() {
+		return ErrParamsUnsupported
+	}
+	if route.host != "" {
+		return nil
+	}
+	if route.mount {
+		m.mounts = append(m.mounts, route)
+		return nil
+	}
+	buckets := m.buckets[route.method]
+	if buckets == nil {
+		buckets = make(map[string][]*Route)
+		m.buckets[route.method] = buckets
+	}
+	segment := firstSegment(route.path)
+	buckets[segment] = append(buckets[segment], route)
+	return nil
+}
+
+func (m *bucketMatcher) Match(rr *http.Request) MatchResult {
+	path, _ := requestPath(rr)
+	return m.matchPath(rr.Method, path)
+}
+
+func (m *bucketMatcher) matchPath(method, path string) MatchResult {
+	segment := firstSegment(path)
+	for _, route := range m.buckets[method][segment] {
+		if route.path == path {
+			return MatchResult{Route: route}
+		}
+	}
+
+	var mounted *Route
+	for _, route := range m.mounts {
+		if route.mounts(path) && route.outmounts(mounted) {
+			mounted = route
+		}
+	}
+	if mounted != nil {
+		return MatchResult{Route: mounted}
+	}
+
+	var allowed []string
+	for other, buckets := range m.buckets {
+		if other == method {
+			continue
+		}
+		for _, route := range buckets[segment] {
+			if route.path == path {
+				allowed = append(allowed, other)
+				break
+			}
+		}
+	}
+	sort.Strings(allowed)
+	return MatchResult{Allowed: allowed}
+}
+
+func firstSegment(path string) string {
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
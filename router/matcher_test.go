@@ -0,0 +1,49 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMethodNotAllowedAcrossBuckets(t *testing.T) {
+	ok := func(rw http.ResponseWriter, r *http.Request) {}
+	for name, matcher := range map[string]func() Matcher{
+		"bucket": func() Matcher { return newBucketMatcher() },
+		"linear": NewLinearMatcher,
+		"trie":   NewTrieMatcher,
+	} {
+		r := New(WithMatcher(matcher()))
+		r.HandleFunc("GET:/users", ok)
+		r.HandleFunc("POST:/users", ok)
+		r.HandleFunc("DELETE:/users/admin", ok)
+		r.HandleFunc("PUT:/users/admin", ok)
+		r.HandleFunc("GET:/orders", ok)
+		r.HandleFunc("GET:/", ok)
+		// Same first segment, other path, other methods.
+		r.HandleFunc("PUT:/users/me/settings", ok)
+
+		for _, tt := range []struct {
+			method, path string
+			status       int
+			allow        string
+		}{
+			{"GET", "/users", http.StatusOK, ""},
+			{"PUT", "/users", http.StatusMethodNotAllowed, "GET, POST"},
+			{"DELETE", "/orders", http.StatusMethodNotAllowed, "GET"},
+			{"POST", "/", http.StatusMethodNotAllowed, "GET"},
+			{"GET", "/users/admin", http.StatusMethodNotAllowed, "DELETE, PUT"},
+			{"GET", "/users/me/settings", http.StatusMethodNotAllowed, "PUT"},
+			// Routes sharing the first segment but not the path do not
+			// count.
+			{"GET", "/users/me", http.StatusNotFound, ""},
+			{"GET", "/accounts", http.StatusNotFound, ""},
+		} {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.status || rec.Header().Get("Allow") != tt.allow {
+				t.Errorf("%s: %s %s = %d, Allow %q; want %d, Allow %q", name, tt.method, tt.path, rec.Code, rec.Header().Get("Allow"), tt.status, tt.allow)
+			}
+		}
+	}
+}
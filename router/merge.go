@@ -0,0 +1,95 @@
+package router
+
+import (
+	"errors"
+	"strings"
+)
+
+// Merge registers the routes of other on r, so packages can each build a
+// Router of their own and the main program compose them. See Group.Merge.
+func (r *Router) Merge(other *Router) error {
+	return r.Group("/").Merge(other)
+}
+
+// Merge registers the routes of other below the group's prefix, wrapped in
+// the group's middleware and given its values and tags, like routes
+// registered on the group. Each keeps its permissions, values, tags and
+// where it was registered. Middleware added to other with Use wraps its
+// routes; its other settings, such as its error handler, stay with it.
+//
+// If a route would take a pattern already registered, or registered twice
+// by the merge, nothing is merged and the conflicts are returned, each a
+// *PatternError.
+func (g *Group) Merge(other *Router) error {
+	other.mu.RLock()
+	routes := append([]*Route(nil), other.routes...)
+	middleware := append([]Middleware(nil), other.middleware...)
+	other.mu.RUnlock()
+
+	r := g.router
+	r.mu.RLock()
+	seen := make(map[string]*Route, len(r.routes)+len(routes))
+	for _, route := range r.routes {
+		seen[route.Pattern()] = route
+	}
+	var errs []error
+	for _, route := range routes {
+		key := g.mergedPattern(route)
+		if first, ok := seen[key]; ok {
+			errs = append(errs, route.errorf(key, "%w, first at %s", ErrDuplicateRoute, first.site))
+			continue
+		}
+		seen[key] = route
+	}
+	r.mu.RUnlock()
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	for _, src := range routes {
+		path := "/" + strings.TrimPrefix(src.path, "/")
+		handler := chain(middleware, src.handler)
+		var route *Route
+		if src.mount {
+			route = g.Mount(path, handler)
+		} else {
+			route = g.Handle(src.method+":"+path, handler)
+		}
+		route.permissions = append(route.permissions, src.permissions...)
+		route.tags = append(route.tags, src.tags...)
+		for k, v := range src.values {
+			route.WithValue(k, v)
+		}
+		for k, v := range src.defaults {
+			route.Default(k, v)
+		}
+		for k, v := range src.metricLabels {
+			route.MetricLabel(k, v)
+		}
+		if src.buckets != nil {
+			route.buckets = src.buckets
+		}
+		route.cache = src.cache
+		route.audit = route.audit || src.audit
+		if src.strip != "" {
+			route.strip = joinPath(g.prefix, src.strip)
+		}
+		route.site = src.site
+	}
+	return nil
+}
+
+// mergedPattern is the pattern route takes when merged into the group.
+func (g *Group) mergedPattern(route *Route) string {
+	path := strings.TrimPrefix(joinPath(g.prefix, route.path), "/")
+	if g.router.caseInsensitive {
+		path = foldCase(path)
+	}
+	if route.mount {
+		if path == "" {
+			return "*:/*"
+		}
+		return "*:/" + path + "/*"
+	}
+	return route.method + ":/" + path
+}
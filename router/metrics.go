@@ -0,0 +1,293 @@
+package router
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the latency histogram bounds, in seconds, of routes
+// declaring none.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Unmatched is the route label of requests no route served, whatever their
+// path, so probes and scanners cannot grow the number of series.
+const Unmatched = "unmatched"
+
+// MetricLabel adds a label to the route's metrics, e.g. the service or team
+// owning it. The method, route and status labels are reserved.
+func (rt *Route) MetricLabel(name, value string) *Route {
+	if rt.metricLabels == nil {
+		rt.metricLabels = make(map[string]string)
+	}
+	rt.metricLabels[name] = value
+	return rt
+}
+
+// LatencyBuckets replaces the router's latency histogram bounds for the
+// route, in seconds, e.g. longer ones for a report export.
+func (rt *Route) LatencyBuckets(buckets ...float64) *Route {
+	rt.buckets = slices.Sorted(slices.Values(buckets))
+	return rt
+}
+
+// MetricLabel labels the metrics of the routes registered on the group from
+// now on, and on its subgroups. Routes can override it.
+func (g *Group) MetricLabel(name, value string) *Group {
+	labels := make(map[string]string, len(g.metricLabels)+1)
+	for k, v := range g.metricLabels {
+		labels[k] = v
+	}
+	labels[name] = value
+	g.metricLabels = labels
+	return g
+}
+
+// MetricLabels returns the labels declared with MetricLabel, which must not
+// be modified.
+func (rt *Route) MetricLabels() map[string]string {
+	return rt.metricLabels
+}
+
+// RequestMetric is one served request, as recorded by RecordMetrics.
+type RequestMetric struct {
+	// Route served the request, or is nil when none matched.
+	Route *Route
+	// Method is the request method, or "OTHER" when it is neither standard
+	// nor the method of Route, so clients cannot grow the number of series.
+	Method   string
+	Status   int
+	Duration time.Duration
+	// Buckets are the route's LatencyBuckets, or nil for the sink's own.
+	Buckets []float64
+}
+
+// RouteLabel returns the pattern of the route, or Unmatched.
+func (m RequestMetric) RouteLabel() string {
+	if m.Route == nil {
+		return Unmatched
+	}
+	return m.Route.Pattern()
+}
+
+// MetricsSink receives the requests recorded by RecordMetrics, e.g. to
+// aggregate them for scraping like Metrics or to send them on to a
+// collector. Record is called concurrently and must not block.
+type MetricsSink interface {
+	Record(m RequestMetric)
+}
+
+// RecordMetrics passes every request it serves to each sink once its
+// response is complete. Pass it to Router.Use.
+func RecordMetrics(sinks ...MetricsSink) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, rr *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: rw}
+			next.ServeHTTP(sw, rr)
+
+			route := MatchedRoute(rr)
+			m := RequestMetric{
+				Route:    route,
+				Method:   rr.Method,
+				Status:   responseStatus(rr, sw.status),
+				Duration: time.Since(start),
+			}
+			if route != nil {
+				m.Buckets = route.buckets
+			}
+			if !isStandardMethod(m.Method) && (route == nil || route.mount || route.method != m.Method) {
+				m.Method = "OTHER"
+			}
+			for _, sink := range sinks {
+				sink.Record(m)
+			}
+		})
+	}
+}
+
+// MetricsOptions configure Metrics.
+type MetricsOptions struct {
+	// Buckets are the latency histogram bounds in seconds, DefaultBuckets
+	// when empty.
+	Buckets []float64
+}
+
+// Metrics is a MetricsSink counting requests and their latency by method,
+// route and status, and serves them in the Prometheus text format. Series
+// are per route pattern rather than per path.
+type Metrics struct {
+	buckets []float64
+
+	mu        sync.Mutex
+	requests  map[requestSeries]uint64
+	latencies map[latencySeries]*histogram
+}
+
+type requestSeries struct {
+	route  *Route
+	method string
+	status int
+}
+
+type latencySeries struct {
+	route  *Route
+	method string
+}
+
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func NewMetrics(opts MetricsOptions) *Metrics {
+	buckets := opts.Buckets
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return &Metrics{
+		buckets:   slices.Sorted(slices.Values(buckets)),
+		requests:  make(map[requestSeries]uint64),
+		latencies: make(map[latencySeries]*histogram),
+	}
+}
+
+// Middleware records every request it serves, like RecordMetrics(m). Pass
+// it to Router.Use.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return RecordMetrics(m)(next)
+}
+
+func (m *Metrics) Record(rm RequestMetric) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestSeries{rm.Route, rm.Method, rm.Status}]++
+	key := latencySeries{rm.Route, rm.Method}
+	h := m.latencies[key]
+	if h == nil {
+		bounds := m.buckets
+		if len(rm.Buckets) > 0 {
+			bounds = rm.Buckets
+		}
+		h = &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+		m.latencies[key] = h
+	}
+	secs := rm.Duration.Seconds()
+	if i, _ := slices.BinarySearch(h.bounds, secs); i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.sum += secs
+	h.count++
+}
+
+func isStandardMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(rw http.ResponseWriter, rr *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteText(rw)
+}
+
+// WriteText writes the metrics in the Prometheus text format.
+func (m *Metrics) WriteText(w io.Writer) error {
+	m.mu.Lock()
+	var requests, latencies []string
+	for s, n := range m.requests {
+		labels := seriesLabels(s.route, s.method, "status", strconv.Itoa(s.status))
+		requests = append(requests, fmt.Sprintf("router_requests_total{%s} %d\n", labels, n))
+	}
+	for s, h := range m.latencies {
+		var b strings.Builder
+		labels := seriesLabels(s.route, s.method)
+		var cumulative uint64
+		for i, bound := range h.bounds {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "router_request_duration_seconds_bucket{%s,le=%q} %d\n", labels, formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(&b, "router_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(&b, "router_request_duration_seconds_sum{%s} %s\n", labels, formatFloat(h.sum))
+		fmt.Fprintf(&b, "router_request_duration_seconds_count{%s} %d\n", labels, h.count)
+		latencies = append(latencies, b.String())
+	}
+	m.mu.Unlock()
+	sort.Strings(requests)
+	sort.Strings(latencies)
+
+	var b strings.Builder
+	b.WriteString("# HELP router_requests_total Requests served, by route and status.\n")
+	b.WriteString("# TYPE router_requests_total counter\n")
+	for _, line := range requests {
+		b.WriteString(line)
+	}
+	b.WriteString("# HELP router_request_duration_seconds Time to serve requests, by route.\n")
+	b.WriteString("# TYPE router_request_duration_seconds histogram\n")
+	for _, lines := range latencies {
+		b.WriteString(lines)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// seriesLabels formats the labels of a series: the method and route, the
+// extra pairs, then the route's own labels in name order.
+func seriesLabels(route *Route, method string, extra ...string) string {
+	pattern := Unmatched
+	if route != nil {
+		pattern = route.Pattern()
+	}
+	pairs := append([]string{"method", method, "route", pattern}, extra...)
+	if route != nil {
+		names := make([]string, 0, len(route.metricLabels))
+		for name := range route.metricLabels {
+			if name != "method" && name != "route" && name != "status" && name != "le" {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			pairs = append(pairs, name, route.metricLabels[name])
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", metricName(pairs[i]), labelValue.Replace(pairs[i+1]))
+	}
+	return b.String()
+}
+
+var labelValue = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricName replaces the characters Prometheus does not allow in label
+// names with "_".
+func metricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
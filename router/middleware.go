@@ -0,0 +1,69 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+)
+
+type Middleware func(http.Handler) http.Handler
+
+// chain wraps handler so that the first middleware is the outermost.
+func chain(middleware []Middleware, handler http.Handler) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// Group registers routes under a shared path prefix and middleware stack.
+// Middleware only applies to routes registered after Use is called.
+type Group struct {
+	router     *Router
+	prefix     string
+	middleware []Middleware
+	values     map[string]any
+	tags       []string
+	strip      bool
+
+	metricLabels map[string]string
+}
+
+func (g *Group) Use(middleware ...Middleware) {
+	g.middleware = append(g.middleware, middleware...)
+}
+
+func (g *Group) Group(prefix string) *Group {
+	return &Group{
+		router:     g.router,
+		prefix:     joinPath(g.prefix, prefix),
+		middleware: append([]Middleware(nil), g.middleware...),
+		values:     g.values,
+		tags:       g.tags,
+		strip:      g.strip,
+
+		metricLabels: g.metricLabels,
+	}
+}
+
+func (g *Group) Handle(path string, handler http.Handler) *Route {
+	method, url, ok := cutMethod(path)
+	if !ok {
+		return g.router.Handle(path, handler)
+	}
+	path = method + ":" + joinPath(g.prefix, url)
+	if handler == nil {
+		return g.router.Handle(path, nil)
+	}
+	return g.register(g.router.Handle(path, chain(g.middleware, handler)))
+}
+
+func (g *Group) HandleFunc(path string, handler func(rw http.ResponseWriter, rr *http.Request)) *Route {
+	if handler == nil {
+		panic(ErrNilHandler)
+	}
+	return g.Handle(path, http.HandlerFunc(handler))
+}
+
+func joinPath(prefix, path string) string {
+	return "/" + strings.Trim(strings.TrimSuffix(prefix, "/")+"/"+strings.TrimPrefix(path, "/"), "/")
+}
@@ -0,0 +1,24 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUseBuildsChainOnce(t *testing.T) {
+	built := 0
+	count := func(next http.Handler) http.Handler {
+		built++
+		return next
+	}
+	r := New()
+	r.HandleFunc("GET:/", func(rw http.ResponseWriter, rr *http.Request) {})
+	r.Use(count)
+	for range 3 {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	if built != 1 {
+		t.Errorf("middleware built %d times for 3 requests, want once", built)
+	}
+}
@@ -0,0 +1,66 @@
+package router
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Mount routes every request whose path is prefix or below it to handler,
+// whatever its method. Routes registered with Handle take precedence, and
+// among mounts the longest prefix wins. The handler sees the full path
+// unless the route is marked with StripPrefix.
+func (r *Router) Mount(prefix string, handler http.Handler) *Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Panics in strict mode too, as Handle does.
+	if err := r.checkMutable(); err != nil {
+		panic(patternError(prefix, err))
+	}
+	if handler == nil {
+		return r.reject(prefix, ErrNilHandler)
+	}
+	if !validPattern("GET:" + prefix) {
+		return r.reject(prefix, ErrBadPath)
+	}
+	if r.strict {
+		if err := checkPattern("GET:" + prefix); err != nil {
+			return r.reject(prefix, err)
+		}
+	}
+
+	_, host, path := tokenize("GET:" + prefix)
+
+	route := &Route{host: host, path: path, handler: handler, mount: true, segments: parseSegments(path), site: caller()}
+	if err := checkSegments(route.segments); err != nil {
+		return r.reject(route.Pattern(), err)
+	}
+	// Everything below a mount is already its own.
+	if slices.ContainsFunc(route.segments, func(seg segment) bool { return seg.greedy }) {
+		return r.reject(route.Pattern(), ErrGreedySegment)
+	}
+	if err := r.index(route); err != nil {
+		return r.reject(route.Pattern(), err)
+	}
+	r.routes = append(r.routes, route)
+	return route
+}
+
+func (g *Group) Mount(prefix string, handler http.Handler) *Route {
+	if handler == nil {
+		return g.router.Mount(joinPath(g.prefix, prefix), nil)
+	}
+	return g.register(g.router.Mount(joinPath(g.prefix, prefix), chain(g.middleware, handler)))
+}
+
+// mounts reports whether a mounted route covers the normalised path.
+func (rt *Route) mounts(path string) bool {
+	return rt.path == "/" || path == rt.path || strings.HasPrefix(path, rt.path+"/")
+}
+
+// outmounts reports whether the mounted route is more specific than other,
+// which may be nil. The root mount "/" is the least specific of all.
+func (rt *Route) outmounts(other *Route) bool {
+	return other == nil || len(trimRoot(rt.path)) > len(trimRoot(other.path))
+}
@@ -0,0 +1,26 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestMountRejectsBadPrefixes(t *testing.T) {
+	for _, tt := range []struct {
+		prefix string
+		want   error
+	}{
+		{"/a?b", ErrBadPath},
+		{"/a#b", ErrBadPath},
+		{"/a:b", ErrBadPath},
+		{"/a/*", ErrWildcard},
+		{"/{id}/{id}", ErrDuplicateParam},
+	} {
+		r := New(WithStrict())
+		r.Mount(tt.prefix, http.NotFoundHandler())
+		if err := r.Validate(); !errors.Is(err, tt.want) {
+			t.Errorf("Mount(%q): %v, want %v", tt.prefix, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package router
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Option configures a Router built by New. Each has a setter counterpart
+// where the setting can also change later, e.g. SetLogger for WithLogger.
+type Option func(*Router)
+
+// WithMatcher matches requests with m instead of the default matcher, which
+// does not match path parameters; see Matcher.
+func WithMatcher(m Matcher) Option {
+	return func(r *Router) { r.matcher = m }
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(r *Router) { r.logger = l }
+}
+
+func WithErrorHandler(h ErrorHandler) Option {
+	return func(r *Router) { r.SetErrorHandler(h) }
+}
+
+// WithNotFound serves the requests no route matches, anywhere a group's
+// handlers do not apply (see Group.NotFound). h writes its own status.
+func WithNotFound(h http.Handler) Option {
+	return func(r *Router) { r.Group("/").NotFound(h) }
+}
+
+// WithStrict is Strict at construction.
+func WithStrict() Option {
+	return func(r *Router) { r.strict = true }
+}
+
+// StrictSlash redirects requests whose path has a trailing slash to the
+// path without it, where they would otherwise be served as if it had none.
+// GET and HEAD are redirected with 301, other methods with 308 so they are
+// resent as they were. Mounted routes, such as file servers, see the path
+// unchanged.
+func StrictSlash() Option {
+	return func(r *Router) { r.strictSlash = true }
+}
+
+// CaseInsensitive matches the literal segments of route paths regardless
+// of case, so "GET:/Users/{id}" serves /users/Ab and /USERS/Ab alike.
+// Parameters keep the case of the request. Route paths are lower-cased at
+// registration, and matchers see the request path lower-cased.
+func CaseInsensitive() Option {
+	return func(r *Router) { r.caseInsensitive = true }
+}
+
+// FoldsCase reports whether the router serving rr is CaseInsensitive, so
+// its route paths are lower-cased.
+func FoldsCase(rr *http.Request) bool {
+	s, ok := rr.Context().Value(stateKey{}).(*requestState)
+	return ok && s.router.caseInsensitive
+}
+
+// foldCase lower-cases the literal segments of a route path.
+func foldCase(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if !parseSegment(s).param {
+			segments[i] = strings.ToLower(s)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// redirectSlash redirects rr to its path without trailing slashes when the
+// router is StrictSlash, reporting whether it did.
+func (r *Router) redirectSlash(rw http.ResponseWriter, rr *http.Request, route *Route) bool {
+	path := rr.URL.Path
+	if !r.strictSlash || route.mount || path == "/" || !strings.HasSuffix(path, "/") {
+		return false
+	}
+
+	u := *rr.URL
+	u.Path = "/" + strings.Trim(path, "/")
+	u.RawPath = ""
+	status := http.StatusPermanentRedirect
+	if rr.Method == http.MethodGet || rr.Method == http.MethodHead {
+		status = http.StatusMovedPermanently
+	}
+	http.Redirect(rw, rr, u.RequestURI(), status)
+	return true
+}
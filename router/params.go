@@ -0,0 +1,12 @@
+package router
+
+import (
+	"net/http"
+)
+
+// Param returns the request's value for the {name} segment of the matched
+// route's path, or "" when the route has no such segment. Parameters are
+// matched by NewTrieMatcher. See PathParams for typed parameters.
+func Param(rr *http.Request, name string) string {
+	return PathParams(rr).String(name)
+}
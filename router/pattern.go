@@ -0,0 +1,407 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownConverter  = errors.New("unknown path parameter converter")
+	ErrOptionalSegment   = errors.New("only the last path segments can be optional")
+	ErrGreedySegment     = errors.New("a pattern can hold one {name...} segment, and no optional ones with it")
+	errParamMismatch     = errors.New("value does not fit the converter")
+	ErrNoOptionalSegment = errors.New("default set for no optional path segment")
+	ErrParamsUnsupported = errors.New("path parameters need the trie matcher, see NewTrieMatcher")
+)
+
+// Converter checks and converts a typed path parameter, such as {id:int}.
+type Converter struct {
+	// Match reports whether a segment has the shape of the parameter.
+	// Segments that do not are not matched by the route, so the request
+	// falls through to other routes or gets a 404.
+	Match func(segment string) bool
+	// Parse converts a matching segment. An error fails the request with
+	// 400 Bad Request, e.g. for an int segment too large to hold.
+	Parse func(segment string) (any, error)
+}
+
+var (
+	convertersMu sync.RWMutex
+	converters   = map[string]Converter{
+		"int":  {Match: isInt, Parse: func(s string) (any, error) { return strconv.Atoi(s) }},
+		"date": {Match: isDate, Parse: func(s string) (any, error) { return time.Parse(time.DateOnly, s) }},
+		"uuid": {Match: isUUID, Parse: func(s string) (any, error) { return strings.ToLower(s), nil }},
+	}
+)
+
+// RegisterConverter makes {name:conv} path parameters available, on top of
+// the built-in int, date (2006-01-02) and uuid. Register converters before
+// the routes using them.
+func RegisterConverter(conv string, c Converter) {
+	convertersMu.Lock()
+	defer convertersMu.Unlock()
+
+	converters[conv] = c
+}
+
+func converter(conv string) (Converter, bool) {
+	convertersMu.RLock()
+	defer convertersMu.RUnlock()
+
+	c, ok := converters[conv]
+	return c, ok
+}
+
+func isInt(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isDate(s string) bool {
+	if len(s) != len(time.DateOnly) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if i == 4 || i == 7 {
+			if s[i] != '-' {
+				return false
+			}
+		} else if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case i == 8 || i == 13 || i == 18 || i == 23:
+			if c != '-' {
+				return false
+			}
+		case '0' <= c && c <= '9', 'a' <= c && c <= 'f', 'A' <= c && c <= 'F':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// segment is one segment of a route path: a literal, or a {name} or
+// {name:conv} parameter. Parameters ending in "?", {name?} or
+// {name:conv?}, are optional, and {name...} ones greedy: they capture one
+// or more segments, slashes included.
+type segment struct {
+	literal  string
+	param    bool
+	name     string
+	conv     string
+	optional bool
+	greedy   bool
+}
+
+// parseSegments splits a normalised route path into segments, or returns
+// nil when it has no parameters.
+func parseSegments(path string) []segment {
+	if !strings.Contains(path, "{") {
+		return nil
+	}
+	parts := strings.Split(trimRoot(path), "/")
+	segments := make([]segment, len(parts))
+	for i, part := range parts {
+		segments[i] = parseSegment(part)
+	}
+	return segments
+}
+
+// checkSegments reports a {name:conv} segment naming no registered
+// converter, an optional segment followed by a required one, or greedy
+// segments matching ambiguously.
+func checkSegments(segments []segment) error {
+	optional, greedy := false, 0
+	for _, seg := range segments {
+		if _, ok := converter(seg.conv); seg.conv != "" && !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownConverter, seg.conv)
+		}
+		if optional && !seg.optional {
+			return ErrOptionalSegment
+		}
+		optional = optional || seg.optional
+		if seg.greedy {
+			greedy++
+		}
+	}
+	if greedy > 1 || greedy == 1 && optional {
+		return ErrGreedySegment
+	}
+	return nil
+}
+
+// escapeParams percent-encodes the colons of {name:conv} segments and the
+// question marks of optional ones so url.Parse, which would otherwise take
+// them for a scheme or a query, decodes them back into the path.
+func escapeParams(path string) string {
+	if !strings.Contains(path, "{") {
+		return path
+	}
+	return strings.NewReplacer(":", "%3A", "?", "%3F").Replace(path)
+}
+
+func parseSegment(s string) segment {
+	inner, ok := strings.CutPrefix(s, "{")
+	if !ok || !strings.HasSuffix(inner, "}") {
+		return segment{literal: s}
+	}
+	inner, optional := strings.CutSuffix(strings.TrimSuffix(inner, "}"), "?")
+	inner, greedy := strings.CutSuffix(inner, "...")
+	name, conv, _ := strings.Cut(inner, ":")
+	return segment{param: true, name: name, conv: conv, optional: optional, greedy: greedy}
+}
+
+// rank orders parameters by how much they match: typed, untyped, greedy.
+func (s segment) rank() int {
+	switch {
+	case s.greedy:
+		return 2
+	case s.conv == "":
+		return 1
+	}
+	return 0
+}
+
+// match reports whether a request segment fits the parameter.
+func (s segment) match(value string) bool {
+	if s.conv == "" {
+		return true
+	}
+	c, ok := converter(s.conv)
+	return ok && c.Match(value)
+}
+
+// Default sets the value of the optional {name?} segment for requests
+// without it, so "GET:/reports/{year}/{month?}" with Default("month", "1")
+// serves /reports/2024 as /reports/2024/1. A default must fit the
+// parameter's converter: one naming no optional segment, or not fitting,
+// fails like a bad pattern given to Handle.
+func (rt *Route) Default(name, value string) *Route {
+	if rt.router == nil {
+		return rt
+	}
+	if err := rt.checkDefault(name, value); err != nil {
+		rt.router.mu.Lock()
+		defer rt.router.mu.Unlock()
+
+		rt.router.reject(rt.Pattern(), err)
+		return rt
+	}
+	if rt.defaults == nil {
+		rt.defaults = make(map[string]string)
+	}
+	rt.defaults[name] = value
+	return rt
+}
+
+func (rt *Route) checkDefault(name, value string) error {
+	i := slices.IndexFunc(rt.segments, func(seg segment) bool { return seg.optional && seg.name == name })
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrNoOptionalSegment, name)
+	}
+	seg := rt.segments[i]
+	if seg.conv == "" {
+		return nil
+	}
+	c, ok := converter(seg.conv)
+	if !ok {
+		return &ParamError{Name: name, Value: value, Err: ErrUnknownConverter}
+	}
+	if !c.Match(value) {
+		return &ParamError{Name: name, Value: value, Err: errParamMismatch}
+	}
+	if _, err := c.Parse(value); err != nil {
+		return &ParamError{Name: name, Value: value, Err: err}
+	}
+	return nil
+}
+
+// cutMethod splits a pattern at the colon ending its method. Colons are
+// only allowed after it inside {name:conv} parameters.
+func cutMethod(pattern string) (method, path string, ok bool) {
+	method, path, ok = strings.Cut(pattern, ":")
+	if !ok {
+		return "", "", false
+	}
+	depth := 0
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ':':
+			if depth != 1 {
+				return "", "", false
+			}
+		}
+	}
+	return method, path, true
+}
+
+// ParamError is a path parameter that matched its converter's shape but
+// could not be converted.
+type ParamError struct {
+	Name  string
+	Value string
+	Err   error
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("path parameter %s: invalid value %q", e.Name, e.Value)
+}
+
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// Params are the path parameters of the route serving a request, by name.
+type Params struct {
+	raw   map[string]string
+	typed map[string]any
+}
+
+// PathParams returns the path parameters of the route serving rr.
+// Parameters are matched by NewTrieMatcher; the other matchers refuse
+// routes with them.
+func PathParams(rr *http.Request) Params {
+	if s, ok := rr.Context().Value(stateKey{}).(*requestState); ok {
+		return s.params
+	}
+	return Params{}
+}
+
+// String returns the parameter as it appeared in the path, the default of
+// an absent optional one, or "".
+func (p Params) String(name string) string {
+	return p.raw[name]
+}
+
+// Value returns the converted {name:conv} parameter, or the raw string of
+// an untyped one, or nil.
+func (p Params) Value(name string) any {
+	if v, ok := p.typed[name]; ok {
+		return v
+	}
+	if v, ok := p.raw[name]; ok {
+		return v
+	}
+	return nil
+}
+
+// Int returns the {name:int} parameter, or 0.
+func (p Params) Int(name string) int {
+	n, _ := p.typed[name].(int)
+	return n
+}
+
+// Time returns the {name:date} parameter, or the zero time.
+func (p Params) Time(name string) time.Time {
+	t, _ := p.typed[name].(time.Time)
+	return t
+}
+
+// hasParams reports whether the route's path holds {name} segments, which
+// only the trie matcher matches; the others refuse such routes with
+// ErrParamsUnsupported.
+func (rt *Route) hasParams() bool {
+	for _, seg := range rt.segments {
+		if seg.param {
+			return true
+		}
+	}
+	return false
+}
+
+// bindParams reads the values of the route's parameters from the
+// normalised request path and converts the typed ones. encoded is set for
+// paths from rawRequestPath, whose segments are decoded here.
+func (rt *Route) bindParams(path string, encoded bool) (Params, error) {
+	if rt.segments == nil {
+		return Params{}, nil
+	}
+	p := Params{raw: make(map[string]string)}
+	var values []string
+	if path = trimRoot(path); path != "" {
+		values = strings.Split(path, "/")
+	}
+	decode := func(s string) string {
+		if encoded {
+			return unescapeSegment.Replace(s)
+		}
+		return s
+	}
+	// A greedy segment takes what the segments around it leave over, so
+	// those after it are counted from the end of the path.
+	greedy := slices.IndexFunc(rt.segments, func(seg segment) bool { return seg.greedy })
+	for i, seg := range rt.segments {
+		if !seg.param {
+			continue
+		}
+		var value string
+		switch end := len(values) - (len(rt.segments) - 1 - i); {
+		case greedy >= 0 && i >= greedy:
+			start := end - 1
+			if i == greedy {
+				start = greedy
+			}
+			if start < 0 || start >= end {
+				continue
+			}
+			value = decode(strings.Join(values[start:end], "/"))
+		case i < len(values):
+			value = decode(values[i])
+		default:
+			def, ok := rt.defaults[seg.name]
+			if !ok {
+				continue
+			}
+			value = def
+		}
+		p.raw[seg.name] = value
+		if seg.conv == "" {
+			continue
+		}
+		c, ok := converter(seg.conv)
+		if !ok {
+			return p, &ParamError{Name: seg.name, Value: value, Err: ErrUnknownConverter}
+		}
+		if !c.Match(value) {
+			return p, &ParamError{Name: seg.name, Value: value, Err: errParamMismatch}
+		}
+		v, err := c.Parse(value)
+		if err != nil {
+			return p, &ParamError{Name: seg.name, Value: value, Err: err}
+		}
+		if p.typed == nil {
+			p.typed = make(map[string]any)
+		}
+		p.typed[seg.name] = v
+	}
+	return p, nil
+}
@@ -0,0 +1,184 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func FuzzTokenize(f *testing.F) {
+	for _, pattern := range []string{
+		"GET:/", "get:/a", "GET:/a/", "GET://a//", "POST:/a/{id}", "GET:/a/{id:int}",
+		"GET:/a/{rest...}/b", "GET:/a/{id?}", "GET:/%61%2Fb", "GET:/a?b", "GET:/a#b",
+		"GET:a:b", "PATCH:/a", ":/a", "GET", "GET:/{a:b:c}", "GET:/%zz",
+	} {
+		f.Add(pattern)
+	}
+	f.Fuzz(func(t *testing.T, pattern string) {
+		err := checkPattern(pattern)
+		method, host, path, panicked := tryTokenize(pattern)
+		if panicked != nil {
+			if err == nil {
+				t.Fatalf("checkPattern(%q) = nil, but tokenize panics: %v", pattern, panicked)
+			}
+			return
+		}
+		if err != nil {
+			return
+		}
+		if method != strings.ToUpper(method) || !isValidMethod(method) {
+			t.Errorf("tokenize(%q) method = %q", pattern, method)
+		}
+		if host != "" {
+			return
+		}
+		if path == "" || path != "/" && strings.HasSuffix(path, "/") && !strings.Contains(strings.ToUpper(pattern), "%2F") {
+			t.Errorf("tokenize(%q) path = %q, want it trimmed or /", pattern, path)
+		}
+
+		// The trailing slashes and the method's case do not make a
+		// different route.
+		m2, h2, p2, panicked := tryTokenize(strings.ToLower(pattern[:strings.IndexByte(pattern, ':')]) + pattern[strings.IndexByte(pattern, ':'):] + "/")
+		if panicked != nil || m2 != method || h2 != host || p2 != path {
+			t.Errorf("tokenize(%q) = %q %q %q, but with a trailing slash %q %q %q (%v)", pattern, method, host, path, m2, h2, p2, panicked)
+		}
+	})
+}
+
+func tryTokenize(pattern string) (method, host, path string, panicked any) {
+	defer func() { panicked = recover() }()
+	method, host, path = tokenize(pattern)
+	return
+}
+
+func FuzzRequestPath(f *testing.F) {
+	for _, path := range []string{"/", "//", "/a", "/a/", "/a//b/", "a", "/\x00", "/\xff", "/é/"} {
+		f.Add(path)
+	}
+	f.Fuzz(func(t *testing.T, path string) {
+		rr := httptest.NewRequest(http.MethodGet, "/", nil)
+		rr.URL.Path = path
+		got, ok := requestPath(rr)
+		if !ok {
+			return
+		}
+		if got == "" || got != "/" && strings.HasSuffix(got, "/") {
+			t.Errorf("requestPath(%q) = %q, want it trimmed or /", path, got)
+		}
+		// A route registered for the request path must match it, unless
+		// the route reads as one for a host.
+		if strings.HasPrefix(got, "//") {
+			return
+		}
+		if _, _, p, panicked := tryTokenize("GET:/" + escapeSegments(got)); panicked == nil && p != got {
+			t.Errorf("requestPath(%q) = %q, but the route for it has path %q", path, got, p)
+		}
+	})
+}
+
+// escapeSegments percent-encodes what tokenize would otherwise read as
+// URL syntax or parameters.
+func escapeSegments(path string) string {
+	return strings.NewReplacer("%", "%25", "?", "%3F", "#", "%23", "{", "%7B", "}", "%7D", ":", "%3A", "*", "%2A").Replace(path)
+}
+
+// FuzzMatchers registers the same static routes with every built-in matcher
+// and checks they agree on each request.
+func FuzzMatchers(f *testing.F) {
+	f.Add("GET /a;POST /a;GET /a/b;* /a", "GET", "/a/b/c")
+	f.Add("GET /;DELETE /x/y;* /x", "PUT", "/x/y")
+	f.Add("GET /a/b;GET /a/c;* /", "POST", "/a/b")
+	f.Add("PUT /a/b/c;* /a/b;* /a", "GET", "/a/b/c/d")
+	f.Fuzz(func(t *testing.T, table, method, path string) {
+		if !isValidMethod(method) || !strings.HasPrefix(path, "/") {
+			return
+		}
+		method = strings.ToUpper(method)
+
+		matchers := map[string]Matcher{
+			"linear": NewLinearMatcher(),
+			"bucket": newBucketMatcher(),
+			"trie":   NewTrieMatcher(),
+		}
+		seen := make(map[string]bool)
+		for _, entry := range strings.Split(table, ";") {
+			m, p, ok := strings.Cut(entry, " ")
+			if !ok || strings.ContainsFunc(p, func(c rune) bool { return c != '/' && (c < 'a' || c > 'z') }) {
+				continue
+			}
+			route := &Route{mount: m == "*"}
+			if route.mount {
+				_, route.host, route.path = tokenize("GET:" + p)
+			} else if isValidMethod(m) {
+				route.method, route.host, route.path = tokenize(m + ":" + p)
+			} else {
+				continue
+			}
+			if key := route.method + " " + route.path; seen[key] {
+				continue
+			} else {
+				seen[key] = true
+			}
+			for _, matcher := range matchers {
+				if err := matcher.Add(route); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		rr := httptest.NewRequest(http.MethodGet, "/", nil)
+		rr.Method, rr.URL.Path = method, path
+		normalised, ok := requestPath(rr)
+		if !ok {
+			return
+		}
+		want := matchers["linear"].(pathMatcher).matchPath(method, normalised)
+		for name, matcher := range matchers {
+			got := matcher.Match(rr)
+			if got.Route != want.Route || got.Route == nil && !slices.Equal(got.Allowed, want.Allowed) {
+				t.Errorf("%s %s: %s matched %v %v, linear %v %v", method, path, name, got.Route, got.Allowed, want.Route, want.Allowed)
+			}
+		}
+	})
+}
+
+func TestTokenizeErrors(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		want    error
+	}{
+		{"/a", ErrBadPath},
+		{"GET:/a:b", ErrBadPath},
+		{"FETCH:/a", ErrMethodNotAllowed},
+	} {
+		_, _, _, panicked := tryTokenize(tt.pattern)
+		if err, _ := panicked.(error); !errors.Is(err, tt.want) {
+			t.Errorf("tokenize(%q) panics with %v, want %v", tt.pattern, panicked, tt.want)
+		}
+	}
+}
+
+func TestParamsNeedTrie(t *testing.T) {
+	for name, matcher := range map[string]func() Matcher{
+		"bucket": func() Matcher { return newBucketMatcher() },
+		"linear": NewLinearMatcher,
+		"regex":  NewRegexMatcher,
+		"trie":   NewTrieMatcher,
+	} {
+		r := New(WithMatcher(matcher()), WithStrict())
+		for _, pattern := range []string{"GET:/users/{id:int}", "GET:/files/{path...}", "GET:/reports/{year?}"} {
+			r.HandleFunc(pattern, func(rw http.ResponseWriter, rr *http.Request) {})
+		}
+		r.HandleFunc("GET:/literal{brace", func(rw http.ResponseWriter, rr *http.Request) {})
+		err := r.Validate()
+		if want := name != "trie"; errors.Is(err, ErrParamsUnsupported) != want {
+			t.Errorf("%s: Validate() = %v, want ErrParamsUnsupported %v", name, err, want)
+		}
+		if name != "trie" && len(r.Routes()) != 1 {
+			t.Errorf("%s: %d routes registered, want only the literal one", name, len(r.Routes()))
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package router
+
+import "net/http"
+
+// RouteSpec declares a route for Register.
+type RouteSpec struct {
+	// Pattern is "METHOD:/path" as for Handle, or the prefix of a Mount.
+	Pattern string
+	Handler http.Handler
+	Mount   bool
+	// Middleware wraps Handler, the first being the outermost.
+	Middleware  []Middleware
+	Permissions []string
+	Tags        []string
+	Values      map[string]any
+	Audit       bool
+	Cache       *CachePolicy
+	// MetricLabels and LatencyBuckets are set with Route.MetricLabel and
+	// Route.LatencyBuckets.
+	MetricLabels   map[string]string
+	LatencyBuckets []float64
+}
+
+// RouteProvider is a feature describing its own routes, e.g. an admin or
+// authentication module, so the main program assembles features instead of
+// registering their routes one by one.
+type RouteProvider interface {
+	Routes() []RouteSpec
+}
+
+// MiddlewareProvider is a RouteProvider with middleware wrapping all of its
+// routes.
+type MiddlewareProvider interface {
+	RouteProvider
+	Middleware() []Middleware
+}
+
+// RouteSpecs is a RouteProvider of fixed routes.
+type RouteSpecs []RouteSpec
+
+func (s RouteSpecs) Routes() []RouteSpec {
+	return s
+}
+
+// Register registers the routes of every provider, in order. Invalid
+// routes fail as they would with Handle.
+func (r *Router) Register(providers ...RouteProvider) {
+	r.Group("/").Register(providers...)
+}
+
+// Register registers the routes of every provider below the group's
+// prefix, as if registered on the group.
+func (g *Group) Register(providers ...RouteProvider) {
+	for _, p := range providers {
+		pg := g.Group("")
+		if mp, ok := p.(MiddlewareProvider); ok {
+			pg.Use(mp.Middleware()...)
+		}
+		for _, spec := range p.Routes() {
+			pg.registerSpec(spec)
+		}
+	}
+}
+
+func (g *Group) registerSpec(spec RouteSpec) *Route {
+	var handler http.Handler
+	if spec.Handler != nil {
+		handler = chain(spec.Middleware, spec.Handler)
+	}
+	var route *Route
+	if spec.Mount {
+		route = g.Mount(spec.Pattern, handler)
+	} else {
+		route = g.Handle(spec.Pattern, handler)
+	}
+	route.Require(spec.Permissions...).Tag(spec.Tags...)
+	for k, v := range spec.Values {
+		route.WithValue(k, v)
+	}
+	if spec.Audit {
+		route.Audit()
+	}
+	if spec.Cache != nil {
+		route.Cache(*spec.Cache)
+	}
+	for k, v := range spec.MetricLabels {
+		route.MetricLabel(k, v)
+	}
+	if len(spec.LatencyBuckets) > 0 {
+		route.LatencyBuckets(spec.LatencyBuckets...)
+	}
+	return route
+}
@@ -0,0 +1,61 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// PreserveEncodedSlashes makes routes match the request path as sent, so a
+// %2F stays within its segment: "GET:/objects/{key}" then captures
+// "a/b.txt" from /objects/a%2Fb.txt, where it would otherwise see the
+// path /objects/a/b.txt. Parameters are decoded when bound. It applies to
+// the built-in matchers; custom ones match the request themselves and keep
+// seeing the decoded path. Call it before serving.
+func (r *Router) PreserveEncodedSlashes() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.encodedSlashes = true
+	if r.matches != nil {
+		r.matches.clear()
+	}
+}
+
+var (
+	escapeSegment   = strings.NewReplacer("%", "%25", "/", "%2F")
+	unescapeSegment = strings.NewReplacer("%2F", "/", "%25", "%")
+)
+
+// routingPath is the normalised request path routes are matched against.
+func (r *Router) routingPath(rr *http.Request) (string, bool) {
+	if r.encodedSlashes {
+		return rawRequestPath(rr)
+	}
+	return requestPath(rr)
+}
+
+// rawRequestPath normalises the request path like requestPath, but splits
+// it into segments before decoding them, re-encoding the slashes and
+// percent signs they hold.
+func rawRequestPath(rr *http.Request) (string, bool) {
+	raw := rr.URL.EscapedPath()
+	if !strings.HasPrefix(raw, "/") {
+		return "", false
+	}
+
+	raw = strings.TrimRight(strings.TrimPrefix(raw, "/"), "/")
+	if raw == "" {
+		return "/", true
+	}
+	segments := strings.Split(raw, "/")
+	for i, s := range segments {
+		s, err := url.PathUnescape(s)
+		if err != nil || strings.IndexByte(s, 0) >= 0 || !utf8.ValidString(s) {
+			return "", false
+		}
+		segments[i] = escapeSegment.Replace(s)
+	}
+	return strings.Join(segments, "/"), true
+}
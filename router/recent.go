@@ -0,0 +1,118 @@
+package router
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// RequestRecord summarises one served request.
+type RequestRecord struct {
+	Time    time.Time     `json:"time"`
+	ID      string        `json:"id"`
+	Method  string        `json:"method"`
+	Path    string        `json:"path"`
+	Route   string        `json:"route,omitempty"`
+	Status  int           `json:"status"`
+	Latency time.Duration `json:"latency"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// Recent keeps the last requests served in a fixed-size ring. Writers never
+// block each other: each claims a slot with an atomic counter and replaces
+// the record in it.
+type Recent struct {
+	slots []atomic.Pointer[RequestRecord]
+	next  atomic.Uint64
+}
+
+func NewRecent(size int) *Recent {
+	if size <= 0 {
+		size = 200
+	}
+	return &Recent{slots: make([]atomic.Pointer[RequestRecord], size)}
+}
+
+// Middleware records every request it serves. Pass it to Router.Use.
+func (r *Recent) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, rr *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: rw}
+		next.ServeHTTP(sw, rr)
+
+		rec := &RequestRecord{
+			Time:    start,
+			ID:      RequestID(rr),
+			Method:  rr.Method,
+			Path:    rr.URL.Path,
+			Route:   routePattern(rr),
+			Status:  responseStatus(rr, sw.status),
+			Latency: time.Since(start),
+		}
+		if err := RequestError(rr); err != nil {
+			rec.Error = err.Error()
+		}
+
+		i := r.next.Add(1) - 1
+		r.slots[i%uint64(len(r.slots))].Store(rec)
+	})
+}
+
+// Snapshot returns the recorded requests, newest first.
+func (r *Recent) Snapshot() []RequestRecord {
+	n := r.next.Load()
+	size := uint64(len(r.slots))
+
+	out := make([]RequestRecord, 0, min(n, size))
+	for i := uint64(0); i < n && i < size; i++ {
+		// A slot may still be empty if its writer has claimed it but not
+		// stored the record yet.
+		if rec := r.slots[(n-1-i)%size].Load(); rec != nil {
+			out = append(out, *rec)
+		}
+	}
+	return out
+}
+
+// ServeHTTP serves Snapshot as JSON.
+func (r *Recent) ServeHTTP(rw http.ResponseWriter, rr *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(r.Snapshot())
+}
+
+// Dashboard serves Snapshot as a self-refreshing HTML table.
+func (r *Recent) Dashboard() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, rr *http.Request) {
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		rw.Header().Set("Cache-Control", "no-store")
+		dashboard.Execute(rw, r.Snapshot())
+	})
+}
+
+var dashboard = template.Must(template.New("recent").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>Recent requests</title>
+<style>
+body { font: 13px monospace; margin: 1em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 2px 8px; border-bottom: 1px solid #ddd; }
+.err { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Recent requests</h1>
+<table>
+<tr><th>Time</th><th>Method</th><th>Path</th><th>Route</th><th>Status</th><th>Latency</th><th>Error</th><th>ID</th></tr>
+{{range .}}<tr{{if ge .Status 500}} class="err"{{end}}>
+<td>{{.Time.Format "15:04:05.000"}}</td><td>{{.Method}}</td><td>{{.Path}}</td><td>{{.Route}}</td><td>{{.Status}}</td><td>{{.Latency}}</td><td>{{.Error}}</td><td>{{.ID}}</td>
+</tr>
+{{else}}<tr><td colspan="8">No requests yet.</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
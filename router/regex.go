@@ -0,0 +1,79 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+)
+
+// regexMatcher treats route paths as regular expressions over the
+// normalised request path, e.g. "GET:/files/[0-9]+\.txt". It is the most
+// flexible matcher and, scanning every route, the slowest.
+type regexMatcher struct {
+	routes []regexRoute
+}
+
+type regexRoute struct {
+	re    *regexp.Regexp
+	route *Route
+}
+
+// NewRegexMatcher returns a matcher whose route paths are regular
+// expressions. Patterns cannot hold "?" or ":", and Strict rejects "*", so
+// write "+" or "{0,}" instead.
+func NewRegexMatcher() Matcher {
+	return &regexMatcher{}
+}
+
+func (m *regexMatcher) Add(route *Route) error {
+	if route.hasParams() {
+		return ErrParamsUnsupported
+	}
+	if route.host != "" {
+		return nil
+	}
+	expr := "^(?:" + route.path + ")$"
+	switch {
+	case route.mount && route.path == "/":
+		expr = "^"
+	case route.mount:
+		expr = "^(?:" + route.path + ")(?:/|$)"
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("router: %w", err)
+	}
+	m.routes = append(m.routes, regexRoute{re: re, route: route})
+	return nil
+}
+
+func (m *regexMatcher) Match(rr *http.Request) MatchResult {
+	path, _ := requestPath(rr)
+	return m.matchPath(rr.Method, path)
+}
+
+func (m *regexMatcher) matchPath(method, path string) MatchResult {
+	var mounted *Route
+	var allowed []string
+	for _, r := range m.routes {
+		if !r.re.MatchString(path) {
+			continue
+		}
+		switch {
+		case r.route.mount:
+			if r.route.outmounts(mounted) {
+				mounted = r.route
+			}
+		case r.route.method == method:
+			return MatchResult{Route: r.route}
+		default:
+			allowed = append(allowed, r.route.method)
+		}
+	}
+	if mounted != nil {
+		return MatchResult{Route: mounted}
+	}
+	sort.Strings(allowed)
+	return MatchResult{Allowed: allowed}
+}
@@ -0,0 +1,76 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrorReport is a request that failed with a server error or a panic, as
+// passed to an ErrorReporter.
+type ErrorReport struct {
+	Err    error
+	Status int
+	// Panic is set when the handler panicked; Err then wraps it.
+	Panic     *PanicError
+	RequestID string
+	// Route is the pattern of the route serving the request, or "" when
+	// none matched.
+	Route   string
+	Params  map[string]string
+	Request *http.Request
+}
+
+// ErrorReporter sends failed requests to an error tracker, e.g. Sentry. It
+// is called on the request's goroutine before the error response is
+// written, so it must not block.
+type ErrorReporter interface {
+	Report(ctx context.Context, report ErrorReport)
+}
+
+// ErrorReporterFunc adapts a function to an ErrorReporter.
+type ErrorReporterFunc func(ctx context.Context, report ErrorReport)
+
+func (f ErrorReporterFunc) Report(ctx context.Context, report ErrorReport) {
+	f(ctx, report)
+}
+
+// SetErrorReporter reports every request failing with a 5xx status or a
+// panic, whichever ErrorHandler writes the response.
+func (r *Router) SetErrorReporter(rep ErrorReporter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reporter = rep
+}
+
+func WithErrorReporter(rep ErrorReporter) Option {
+	return func(r *Router) { r.reporter = rep }
+}
+
+// report passes a failed request to the ErrorReporter, if it is one worth
+// reporting.
+func (r *Router) report(rr *http.Request, status int, err error) {
+	var perr *PanicError
+	isPanic := errors.As(err, &perr)
+	// Server errors of clients gone away are mostly their cancellation.
+	if r.reporter == nil || !isPanic && (status < 500 || ClientGone(rr)) {
+		return
+	}
+
+	rep := ErrorReport{
+		Err:       err,
+		Status:    status,
+		Panic:     perr,
+		RequestID: RequestID(rr),
+		Route:     routePattern(rr),
+		Request:   rr,
+	}
+	if params := PathParams(rr).raw; len(params) > 0 {
+		rep.Params = make(map[string]string, len(params))
+		for k, v := range params {
+			rep.Params[k] = v
+		}
+	}
+	r.reporter.Report(rr.Context(), rep)
+}
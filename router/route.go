@@ -2,6 +2,7 @@ package router
 
 import (
 	"net/http"
+	"strings"
 )
 
 type Route struct {
@@ -9,4 +10,77 @@ type Route struct {
 	host    string
 	path    string
 	handler http.Handler
+	// segments are those of path when it has parameters.
+	segments []segment
+	defaults map[string]string
+
+	// mount routes match every method and every path below path.
+	mount bool
+
+	permissions []string
+	cache       *CachePolicy
+	audit       bool
+	values      map[string]any
+	tags        []string
+	// metricLabels and buckets shape the route's series in Metrics.
+	metricLabels map[string]string
+	buckets      []float64
+	// strip is the path prefix removed before calling handler.
+	strip string
+
+	// site is where the route was registered.
+	site callSite
+	// router is the one the route was registered on, nil for a rejected
+	// route.
+	router *Router
+}
+
+func (rt *Route) Method() string {
+	return rt.method
+}
+
+func (rt *Route) Host() string {
+	return rt.host
+}
+
+// Path is the normalised path of the route, without its leading and
+// trailing slashes, e.g. "path-one/path-two"; the root is "/".
+func (rt *Route) Path() string {
+	return rt.path
+}
+
+// Mounted reports whether the route was registered with Mount, matching
+// every method and every path below Path.
+func (rt *Route) Mounted() bool {
+	return rt.mount
+}
+
+// Require restricts the route to callers holding every given permission, as
+// decided by the router's Authorizer.
+func (rt *Route) Require(permissions ...string) *Route {
+	rt.permissions = append(rt.permissions, permissions...)
+	return rt
+}
+
+// Tag labels the route, e.g. for access control lists to select it by.
+func (rt *Route) Tag(tags ...string) *Route {
+	rt.tags = append(rt.tags, tags...)
+	return rt
+}
+
+func (rt *Route) Tags() []string {
+	return rt.tags
+}
+
+// Pattern returns the route as registered, e.g. "GET:/path-one/path-two".
+// Mounted routes read "*:/prefix/*".
+func (rt *Route) Pattern() string {
+	path := rt.path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if rt.mount {
+		return "*:" + rt.host + strings.TrimSuffix(path, "/") + "/*"
+	}
+	return rt.method + ":" + rt.host + path
 }
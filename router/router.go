@@ -1,56 +1,218 @@
 package router
 
 import (
-	"fmt"
+	"log/slog"
 	"net/http"
+	"net/netip"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 type Router struct {
-	mu     sync.Mutex
-	routes []Route
+	mu         sync.RWMutex
+	routes     []*Route
+	matcher    Matcher
+	matches    *matchCache
+	middleware []Middleware
+	// chained is the middleware wrapped around dispatch, an http.Handler
+	// built by Use so middleware keeps its state across requests.
+	chained    atomic.Value
+	headers    atomic.Value
+	hosts      atomic.Value
+	trusted    []netip.Prefix
+	authorizer Authorizer
+	access     AccessPolicy
+	logger     *slog.Logger
+	strict     bool
+	problems   []error
+	services   sync.Map
+	factories  []*factoryHandler
+
+	// encodedSlashes keeps %2F within path segments when matching.
+	encodedSlashes  bool
+	strictSlash     bool
+	caseInsensitive bool
+	// mutable routers lock the route table while matching; others refuse
+	// changes once served is set by the first request.
+	mutable bool
+	served  atomic.Bool
+
+	// errors is replaced whole on every change, so serveError reads it
+	// without the lock.
+	errorHandlers atomic.Pointer[errorConfig]
+	reporter      ErrorReporter
+
+	onStart    []Hook
+	onShutdown []Hook
+}
+
+// Use adds middleware that wraps every request served by the router,
+// including requests that do not match any route.
+func (r *Router) Use(middleware ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkMutable(); err != nil {
+		panic(err)
+	}
+	r.middleware = append(r.middleware, middleware...)
+	r.chained.Store(chain(r.middleware, http.HandlerFunc(r.dispatch)))
+}
+
+func (r *Router) Group(prefix string) *Group {
+	return &Group{router: r, prefix: prefix}
 }
 
-func (r *Router) Handle(path string, handler http.Handler) {
+func (r *Router) Handle(path string, handler http.Handler) *Route {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	// Validate has had its say by the time requests are served, so even in
+	// strict mode this cannot go unnoticed among the problems.
+	if err := r.checkMutable(); err != nil {
+		panic(patternError(path, err))
+	}
 	if handler == nil {
-		panic(ErrNilHandler)
+		return r.reject(path, ErrNilHandler)
+	}
+	if !validPattern(path) {
+		return r.reject(path, ErrBadPath)
+	}
+	if r.strict {
+		if err := checkPattern(path); err != nil {
+			return r.reject(path, err)
+		}
 	}
 
 	method, host, path := tokenize(path)
+	if r.caseInsensitive {
+		path = foldCase(path)
+	}
 
-	r.routes = append(r.routes, Route{method, host, path, handler})
+	route := &Route{method: method, host: host, path: path, handler: handler, segments: parseSegments(path), site: caller(), router: r}
+	if err := checkSegments(route.segments); err != nil {
+		return r.reject(route.Pattern(), err)
+	}
+	if err := r.index(route); err != nil {
+		return r.reject(route.Pattern(), err)
+	}
+	r.routes = append(r.routes, route)
+	return route
 }
 
-func (r *Router) HandleFunc(path string, handler func(rw http.ResponseWriter, rr *http.Request)) {
+func (r *Router) HandleFunc(path string, handler func(rw http.ResponseWriter, rr *http.Request)) *Route {
 	if handler == nil {
 		panic("router: nill handler provided")
 	}
-	r.Handle(path, http.HandlerFunc(handler))
+	return r.Handle(path, http.HandlerFunc(handler))
 }
 
 func (r *Router) ServeHTTP(rw http.ResponseWriter, rr *http.Request) {
-	handler := r.match(rr)
-	handler.ServeHTTP(rw, rr)
+	if !r.served.Load() {
+		r.served.Store(true)
+	}
+	handler, ok := r.chained.Load().(http.Handler)
+	if !ok {
+		handler = http.HandlerFunc(r.dispatch)
+	}
+	handler.ServeHTTP(rw, r.withState(rw, rr))
+}
+
+func (r *Router) dispatch(rw http.ResponseWriter, rr *http.Request) {
+	defer r.recoverPanic(rw, rr)
+
+	if status, err := r.checkHost(rr); err != nil {
+		r.serveError(rw, rr, status, err)
+		return
+	}
+	r.applyHeaders(rw, rr.URL.Path)
+
+	route, allowed, ok := r.match(rr)
+	if !ok {
+		r.serveError(rw, rr, http.StatusBadRequest, ErrMalformedPath)
+		return
+	}
+	if route == nil {
+		r.debugUnmatched(rr)
+	}
+	if route == nil && len(allowed) > 0 {
+		rw.Header().Set("Allow", strings.Join(allowed, ", "))
+		r.serveError(rw, rr, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		return
+	}
+	if route == nil {
+		r.serveError(rw, rr, http.StatusNotFound, ErrNotFound)
+		return
+	}
+	if r.redirectSlash(rw, rr, route) {
+		return
+	}
+
+	path, _ := r.routingPath(rr)
+	params, err := route.bindParams(path, r.encodedSlashes)
+	if s, ok := rr.Context().Value(stateKey{}).(*requestState); ok {
+		s.route.Store(route)
+		s.params = params
+		if len(route.values) > 0 {
+			s.logger.Store(s.logger.Load().With(route.logAttrs()...))
+		}
+	}
+	if err != nil {
+		r.serveError(rw, rr, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := r.authorize(route, rr); err != nil {
+		r.serveError(rw, rr, http.StatusForbidden, err)
+		return
+	}
+	if route.cache != nil {
+		route.cache.apply(rw)
+	}
+
+	route.handler.ServeHTTP(rw, stripped(rr, route.strip))
 }
 
-func (r *Router) match(rr *http.Request) http.Handler {
-	method, host, path := tokenize(rr.Method + ":" + rr.URL.Path)
+// match returns the route for the request or, when only the method differs,
+// the methods the path does accept. ok is false when the request path is
+// malformed.
+func (r *Router) match(rr *http.Request) (route *Route, allowed []string, ok bool) {
+	path, ok := r.routingPath(rr)
+	if !ok {
+		return nil, nil, false
+	}
+	if r.caseInsensitive {
+		path = strings.ToLower(path)
+	}
 
-	var handler http.Handler
-	for _, route := range r.routes {
-		fmt.Println(route)
-		if route.method == method && route.host == host && route.path == path {
-			handler = route.handler
-			break
+	unlock := r.readLock()
+	defer unlock()
+	m, builtin := r.matcher.(pathMatcher)
+	if !builtin {
+		// Custom matchers may look at more than the method and path the
+		// cache is keyed by.
+		res := r.matcher.Match(rr)
+		return res.Route, res.Allowed, true
+	}
+	cache := r.matches
+	if cache != nil {
+		if route := cache.get(rr.Method, path); route != nil {
+			return route, nil, true
 		}
 	}
 
-	if handler == nil {
-		return http.NotFoundHandler()
+	res := m.matchPath(rr.Method, path)
+	if res.Route != nil && !res.Route.mount && cache != nil {
+		cache.put(rr.Method, path, res.Route)
 	}
+	return res.Route, res.Allowed, true
+}
 
-	return handler
+// index adds a route to the matcher. r.mu must be held.
+func (r *Router) index(route *Route) error {
+	if r.matches != nil {
+		r.matches.clear()
+	}
+	return r.matcher.Add(route)
 }
@@ -0,0 +1,86 @@
+package router
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	Method      string   `json:"method"`
+	Host        string   `json:"host,omitempty"`
+	Path        string   `json:"path"`
+	Pattern     string   `json:"pattern"`
+	Permissions []string `json:"permissions,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// Source is the file:line of the call that registered the route.
+	Source string `json:"source,omitempty"`
+}
+
+// Routes returns the registered routes sorted by path, then method, so the
+// result is stable across runs and registration order.
+func (r *Router) Routes() []RouteInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	routes := make([]RouteInfo, 0, len(r.routes))
+	for _, route := range r.routes {
+		routes = append(routes, route.info())
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		a, b := routes[i], routes[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Method < b.Method
+	})
+	return routes
+}
+
+func (rt *Route) info() RouteInfo {
+	pattern := rt.Pattern()
+	method, path, _ := strings.Cut(pattern, ":")
+	return RouteInfo{
+		Method:      method,
+		Host:        rt.host,
+		Path:        strings.TrimPrefix(path, rt.host),
+		Pattern:     pattern,
+		Permissions: append([]string(nil), rt.permissions...),
+		Tags:        append([]string(nil), rt.tags...),
+		Source:      rt.site.String(),
+	}
+}
+
+// debugUnmatched logs, at debug level, the routes closest to a request no
+// route matched: those for its path under other methods or hosts, else
+// those sharing its first segment, with where they were registered.
+func (r *Router) debugUnmatched(rr *http.Request) {
+	logger := Logger(rr)
+	if !logger.Enabled(rr.Context(), slog.LevelDebug) {
+		return
+	}
+	path, _ := requestPath(rr)
+	first, _, _ := strings.Cut(path, "/")
+	unlock := r.readLock()
+	defer unlock()
+
+	var same, near []string
+	for _, route := range r.routes {
+		candidate := route.Pattern() + " at " + route.site.String()
+		switch {
+		case route.path == path:
+			same = append(same, candidate)
+		case len(near) < 5 && strings.SplitN(route.path, "/", 2)[0] == first:
+			near = append(near, candidate)
+		}
+	}
+	if len(same) == 0 {
+		same = near
+	}
+	logger.Debug("router: no route matched", "candidates", same)
+}
@@ -0,0 +1,45 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Provide registers a service, such as a database pool or a cache client,
+// that handlers reach through Service instead of package-level variables.
+// Providing a name again replaces the service for later requests.
+func (r *Router) Provide(name string, service any) {
+	r.services.Store(name, service)
+}
+
+// Service returns the service registered under name.
+func (r *Router) Service(name string) (any, bool) {
+	return r.services.Load(name)
+}
+
+// Service returns the service registered under name on the router serving
+// rr, as a T. It is false when there is none, or it is not a T.
+func Service[T any](rr *http.Request, name string) (T, bool) {
+	var zero T
+	s, ok := rr.Context().Value(stateKey{}).(*requestState)
+	if !ok {
+		return zero, false
+	}
+	v, ok := s.router.Service(name)
+	if !ok {
+		return zero, false
+	}
+	t, ok := v.(T)
+	return t, ok
+}
+
+// MustService is Service for services the handler cannot work without. It
+// panics, which the router reports as a 500, when the service is missing.
+func MustService[T any](rr *http.Request, name string) T {
+	t, ok := Service[T](rr, name)
+	if !ok {
+		var zero T
+		panic(fmt.Sprintf("router: no %T service named %q", zero, name))
+	}
+	return t
+}
@@ -0,0 +1,142 @@
+package router
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"runtime/trace"
+	"sync"
+	"time"
+)
+
+// SlowRequestOptions configure SlowRequests.
+type SlowRequestOptions struct {
+	// Threshold is the duration after which a request counts as slow.
+	Threshold time.Duration
+	// Goroutines logs a dump of every goroutine's stack when a request
+	// crosses the threshold, showing where it is stuck.
+	Goroutines bool
+	// TraceDir, when set, receives a runtime execution trace covering the
+	// rest of a slow request, named after a hash of its request ID, which
+	// clients may supply. Only one trace runs at a time; slow requests
+	// overlapping it are not traced.
+	TraceDir string
+}
+
+// SlowRequests logs requests still running after opts.Threshold, with their
+// matched route, and logs their total duration once they complete.
+func SlowRequests(opts SlowRequestOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, rr *http.Request) {
+			start := time.Now()
+			w := &watch{}
+			timer := time.AfterFunc(opts.Threshold, func() { w.fire(rr, opts) })
+
+			next.ServeHTTP(rw, rr)
+
+			if timer.Stop() {
+				return
+			}
+			w.finish(rr, time.Since(start))
+		})
+	}
+}
+
+type watch struct {
+	mu      sync.Mutex
+	fired   bool
+	done    bool
+	tracing bool
+}
+
+func (w *watch) fire(rr *http.Request, opts SlowRequestOptions) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.done {
+		return
+	}
+	w.fired = true
+	attrs := []any{"route", routePattern(rr), "query", rr.URL.RawQuery, "threshold", opts.Threshold}
+	if opts.Goroutines {
+		var buf bytes.Buffer
+		pprof.Lookup("goroutine").WriteTo(&buf, 2)
+		attrs = append(attrs, "goroutines", buf.String())
+	}
+	if opts.TraceDir != "" {
+		file, err := startTrace(opts.TraceDir, RequestID(rr))
+		if err != nil {
+			attrs = append(attrs, "trace_err", err)
+		} else {
+			w.tracing = true
+			attrs = append(attrs, "trace", file)
+		}
+	}
+	Logger(rr).Warn("router: slow request", attrs...)
+}
+
+func (w *watch) finish(rr *http.Request, elapsed time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.done = true
+	if !w.fired {
+		return
+	}
+	if w.tracing {
+		stopTrace()
+	}
+	Logger(rr).Warn("router: slow request finished", "route", routePattern(rr), "duration", elapsed)
+}
+
+var traceOut struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func startTrace(dir, id string) (string, error) {
+	traceOut.mu.Lock()
+	defer traceOut.mu.Unlock()
+
+	if traceOut.file != nil {
+		return "", fmt.Errorf("a trace is already running")
+	}
+	sum := sha256.Sum256([]byte(id))
+	base := "slow-" + hex.EncodeToString(sum[:8]) + ".trace"
+	if filepath.Base(base) != base {
+		return "", fmt.Errorf("invalid trace file name %q", base)
+	}
+	name := filepath.Join(dir, base)
+	f, err := os.Create(name)
+	if err != nil {
+		return "", err
+	}
+	if err := trace.Start(f); err != nil {
+		f.Close()
+		os.Remove(name)
+		return "", err
+	}
+	traceOut.file = f
+	return name, nil
+}
+
+func stopTrace() {
+	traceOut.mu.Lock()
+	defer traceOut.mu.Unlock()
+
+	trace.Stop()
+	traceOut.file.Close()
+	traceOut.file = nil
+}
+
+func routePattern(rr *http.Request) string {
+	if route := MatchedRoute(rr); route != nil {
+		return route.Pattern()
+	}
+	return ""
+}
@@ -0,0 +1,154 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var (
+	ErrDuplicateRoute = errors.New("route is already registered")
+	ErrDuplicateParam = errors.New("path parameter name is used twice")
+	ErrWildcard       = errors.New("wildcards are not supported by Handle, use Mount")
+)
+
+// PatternError is a problem with a route registration, located at the
+// Handle call that made it.
+type PatternError struct {
+	Pattern string
+	File    string
+	Line    int
+	Err     error
+}
+
+func (e *PatternError) Error() string {
+	return fmt.Sprintf("%s:%d: %q: %v", e.File, e.Line, e.Pattern, e.Err)
+}
+
+func (e *PatternError) Unwrap() error {
+	return e.Err
+}
+
+// callSite is the file and line of the innermost caller outside this
+// package, i.e. the code that registered a route.
+type callSite struct {
+	file string
+	line int
+}
+
+func caller() callSite {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "github.com/ritego/build-a-router-with-go/router.") {
+			return callSite{file: relativePath(frame.File), line: frame.Line}
+		}
+		if !more {
+			return callSite{}
+		}
+	}
+}
+
+func (s callSite) String() string {
+	if s.file == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", s.file, s.line)
+}
+
+var workDir, _ = os.Getwd()
+
+// relativePath shortens file to a path relative to the working directory,
+// as the go tool prints them, when it lies below it.
+func relativePath(file string) string {
+	if rel, err := filepath.Rel(workDir, file); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return file
+}
+
+// Strict makes route registration collect problems instead of panicking on
+// the first one, and adds checks for mistakes that are otherwise silent,
+// such as a route registered twice. Validate reports them all, and so does
+// Start, refusing to serve. Call it before registering routes.
+func (r *Router) Strict() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.strict = true
+}
+
+// Validate returns every problem found with the registered routes, each a
+// *PatternError, or nil.
+func (r *Router) Validate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	errs := append([]error(nil), r.problems...)
+	seen := make(map[string]*Route, len(r.routes))
+	for _, route := range r.routes {
+		key := route.Pattern()
+		if first, ok := seen[key]; ok {
+			errs = append(errs, route.errorf(key, "%w, first at %s", ErrDuplicateRoute, first.site))
+			continue
+		}
+		seen[key] = route
+	}
+	return errors.Join(errs...)
+}
+
+func (rt *Route) errorf(pattern, format string, args ...interface{}) error {
+	return &PatternError{Pattern: pattern, File: rt.site.file, Line: rt.site.line, Err: fmt.Errorf(format, args...)}
+}
+
+// reject fails a registration: with a panic, or in strict mode by recording
+// the problem and returning a route that is never matched, so chained calls
+// such as Require still work. r.mu must be held.
+func (r *Router) reject(pattern string, err error) *Route {
+	if !r.strict {
+		panic(err)
+	}
+	perr := patternError(pattern, err)
+	r.problems = append(r.problems, perr)
+	return &Route{site: callSite{file: perr.File, line: perr.Line}}
+}
+
+// patternError blames err on the code registering pattern.
+func patternError(pattern string, err error) *PatternError {
+	site := caller()
+	return &PatternError{Pattern: pattern, File: site.file, Line: site.line, Err: err}
+}
+
+// checkPattern returns what is wrong with a Handle pattern, checking
+// everything tokenize would panic on.
+func checkPattern(pattern string) error {
+	if !validPattern(pattern) {
+		return ErrBadPath
+	}
+	method, path, _ := cutMethod(pattern)
+	if !isValidMethod(method) {
+		return ErrMethodNotAllowed
+	}
+	if _, err := url.Parse(escapeParams(strings.TrimRight(strings.TrimPrefix(path, "/"), "/"))); err != nil {
+		return err
+	}
+
+	params := make(map[string]bool)
+	for _, segment := range strings.Split(path, "/") {
+		if strings.Contains(segment, "*") {
+			return ErrWildcard
+		}
+		if seg := parseSegment(segment); seg.param {
+			if params[seg.name] {
+				return fmt.Errorf("%w: %s", ErrDuplicateParam, seg.name)
+			}
+			params[seg.name] = true
+		}
+	}
+	return nil
+}
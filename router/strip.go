@@ -0,0 +1,54 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// StripPrefix makes a mounted route's handler see paths relative to the
+// mount point: "/api/users" mounted at "/api" reaches it as "/users".
+// OriginalPath still returns the full path.
+func (rt *Route) StripPrefix() *Route {
+	rt.strip = "/" + strings.TrimPrefix(rt.path, "/")
+	return rt
+}
+
+// StripPrefix makes the handlers of routes registered on the group from now
+// on see paths relative to the group's prefix.
+func (g *Group) StripPrefix() *Group {
+	g.strip = true
+	return g
+}
+
+// OriginalPath returns the request path as received, before any prefix was
+// stripped for the handler.
+func OriginalPath(rr *http.Request) string {
+	if s, ok := rr.Context().Value(stateKey{}).(*requestState); ok && s.path != "" {
+		return s.path
+	}
+	return rr.URL.Path
+}
+
+// stripped returns rr with prefix removed from its path, like
+// http.StripPrefix, or rr itself when the path is not below prefix.
+func stripped(rr *http.Request, prefix string) *http.Request {
+	if prefix == "" || prefix == "/" {
+		return rr
+	}
+	path, ok := strings.CutPrefix(rr.URL.Path, prefix)
+	if !ok || (path != "" && path[0] != '/') {
+		return rr
+	}
+
+	r2 := new(http.Request)
+	*r2 = *rr
+	r2.URL = new(url.URL)
+	*r2.URL = *rr.URL
+	r2.URL.Path = "/" + strings.TrimPrefix(path, "/")
+	r2.URL.RawPath = ""
+	if raw, ok := strings.CutPrefix(rr.URL.RawPath, prefix); ok {
+		r2.URL.RawPath = "/" + strings.TrimPrefix(raw, "/")
+	}
+	return r2
+}
@@ -0,0 +1,180 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+type TreeFormat int
+
+const (
+	TreeText TreeFormat = iota
+	TreeJSON
+	// TreeDOT is the Graphviz format, e.g. for `dot -Tsvg`.
+	TreeDOT
+)
+
+// TreeNode is one path segment of the route tree.
+type TreeNode struct {
+	Segment string `json:"segment"`
+	// Kind is "static", "param" for a {name} segment or "wildcard" for the
+	// rest of the path below a Mount.
+	Kind string `json:"kind"`
+	// Routes are the patterns ending at this node, with their call sites.
+	Routes   []string    `json:"routes,omitempty"`
+	Children []*TreeNode `json:"children,omitempty"`
+}
+
+var kindOrder = map[string]int{"static": 0, "param": 1, "wildcard": 2}
+
+// Tree returns the registered routes as a tree of path segments, one root
+// per host. Children are in match priority: static segments, then
+// parameters, then wildcards.
+func (r *Router) Tree() []*TreeNode {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	roots := make(map[string]*TreeNode)
+	for _, route := range r.routes {
+		root, ok := roots[route.host]
+		if !ok {
+			root = &TreeNode{Segment: route.host + "/", Kind: "static"}
+			roots[route.host] = root
+		}
+
+		node := root
+		if route.path != "/" {
+			for _, segment := range strings.Split(route.path, "/") {
+				node = node.child(segment, segmentKind(segment))
+			}
+		}
+		label := route.method
+		if route.mount {
+			node = node.child("*", "wildcard")
+			label = "*"
+		}
+		if site := route.site.String(); site != "" {
+			label += " " + site
+		}
+		node.Routes = append(node.Routes, label)
+	}
+
+	hosts := make([]string, 0, len(roots))
+	for host := range roots {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	tree := make([]*TreeNode, 0, len(hosts))
+	for _, host := range hosts {
+		roots[host].sort()
+		tree = append(tree, roots[host])
+	}
+	return tree
+}
+
+func segmentKind(segment string) string {
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return "param"
+	}
+	return "static"
+}
+
+func (n *TreeNode) child(segment, kind string) *TreeNode {
+	for _, c := range n.Children {
+		if c.Segment == segment && c.Kind == kind {
+			return c
+		}
+	}
+	c := &TreeNode{Segment: segment, Kind: kind}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+func (n *TreeNode) sort() {
+	sort.Slice(n.Children, func(i, j int) bool {
+		a, b := n.Children[i], n.Children[j]
+		if a.Kind != b.Kind {
+			return kindOrder[a.Kind] < kindOrder[b.Kind]
+		}
+		return a.Segment < b.Segment
+	})
+	for _, c := range n.Children {
+		c.sort()
+	}
+}
+
+// DumpTree writes the route tree to w, to debug which route a path
+// reaches or to include in documentation.
+func (r *Router) DumpTree(w io.Writer, format TreeFormat) error {
+	tree := r.Tree()
+	switch format {
+	case TreeText:
+		var b strings.Builder
+		for _, root := range tree {
+			root.text(&b, 0)
+		}
+		_, err := io.WriteString(w, b.String())
+		return err
+	case TreeJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(tree)
+	case TreeDOT:
+		var b strings.Builder
+		b.WriteString("digraph routes {\n\trankdir=LR;\n\tnode [shape=box, fontname=monospace];\n")
+		id := 0
+		for _, root := range tree {
+			root.dot(&b, &id)
+		}
+		b.WriteString("}\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	return fmt.Errorf("router: unknown tree format %d", format)
+}
+
+func (n *TreeNode) text(b *strings.Builder, depth int) {
+	b.WriteString(strings.Repeat("  ", depth))
+	b.WriteString(n.Segment)
+	if n.Kind != "static" {
+		b.WriteString(" (" + n.Kind + ")")
+	}
+	if len(n.Routes) > 0 {
+		b.WriteString("  [" + strings.Join(n.Routes, ", ") + "]")
+	}
+	b.WriteString("\n")
+	for _, c := range n.Children {
+		c.text(b, depth+1)
+	}
+}
+
+// dot writes the node and its subtree, returning the node's ID.
+func (n *TreeNode) dot(b *strings.Builder, id *int) int {
+	self := *id
+	*id++
+
+	label := n.Segment
+	for _, route := range n.Routes {
+		label += "\n" + route
+	}
+	style := ""
+	switch n.Kind {
+	case "param":
+		style = ", style=rounded"
+	case "wildcard":
+		style = ", style=dashed"
+	}
+	if len(n.Routes) > 0 {
+		style += ", penwidth=2"
+	}
+	fmt.Fprintf(b, "\tn%d [label=%q%s];\n", self, label, style)
+
+	for _, c := range n.Children {
+		child := c.dot(b, id)
+		fmt.Fprintf(b, "\tn%d -> n%d;\n", self, child)
+	}
+	return self
+}
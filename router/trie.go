@@ -0,0 +1,201 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// trieMatcher walks a tree of path segments, so lookups cost the depth of
+// the path rather than the number of routes. A {name} segment matches any
+// single segment and a {name:conv} one the segments its converter matches;
+// optional {name?} segments may also be absent, and a greedy {name...} one
+// matches one or more segments. Static segments are tried first, then typed
+// parameters, then untyped ones, then greedy ones.
+type trieMatcher struct {
+	root trieNode
+}
+
+// trieParam is a parameter edge. Parameters with the same converter share
+// an edge whatever their names.
+type trieParam struct {
+	segment segment
+	node    *trieNode
+}
+
+type trieNode struct {
+	static map[string]*trieNode
+	params []trieParam
+	routes map[string]*Route
+	mount  *Route
+}
+
+// NewTrieMatcher returns a matcher for large route tables, which also
+// matches {name} and {name:conv} path segments.
+func NewTrieMatcher() Matcher {
+	return &trieMatcher{}
+}
+
+func (m *trieMatcher) Add(route *Route) error {
+	if route.host != "" {
+		return nil
+	}
+
+	node := &m.root
+	// ends are the nodes the route ends at, several with optional segments.
+	var ends []*trieNode
+	for rest := trimRoot(route.path); rest != ""; {
+		var segment string
+		segment, rest, _ = strings.Cut(rest, "/")
+		// Routes with optional segments also end where they start.
+		if !route.mount && parseSegment(segment).optional {
+			ends = append(ends, node)
+		}
+		node = node.child(segment)
+	}
+	if route.mount {
+		if node.mount != nil {
+			return fmt.Errorf("%w as %s", ErrDuplicateRoute, node.mount.Pattern())
+		}
+		node.mount = route
+		return nil
+	}
+	ends = append(ends, node)
+	// A route already ending at one of them for the method is refused
+	// before any is changed, e.g. "GET:/a/{b}" after "GET:/a/{c}", or
+	// "GET:/a/{b?}" after "GET:/a".
+	for _, n := range ends {
+		if other := n.routes[route.method]; other != nil {
+			return fmt.Errorf("%w as %s", ErrDuplicateRoute, other.Pattern())
+		}
+	}
+	for _, n := range ends {
+		if n.routes == nil {
+			n.routes = make(map[string]*Route)
+		}
+		n.routes[route.method] = route
+	}
+	return nil
+}
+
+func (n *trieNode) child(segment string) *trieNode {
+	if seg := parseSegment(segment); seg.param {
+		for _, p := range n.params {
+			if p.segment.conv == seg.conv && p.segment.greedy == seg.greedy {
+				return p.node
+			}
+		}
+		c := &trieNode{}
+		// The more a parameter matches, the later it is tried.
+		i := len(n.params)
+		for i > 0 && n.params[i-1].segment.rank() > seg.rank() {
+			i--
+		}
+		n.params = slices.Insert(n.params, i, trieParam{segment: seg, node: c})
+		return c
+	}
+	if n.static == nil {
+		n.static = make(map[string]*trieNode)
+	}
+	c := n.static[segment]
+	if c == nil {
+		c = &trieNode{}
+		n.static[segment] = c
+	}
+	return c
+}
+
+func (m *trieMatcher) Match(rr *http.Request) MatchResult {
+	path, _ := requestPath(rr)
+	return m.matchPath(rr.Method, path)
+}
+
+func (m *trieMatcher) matchPath(method, path string) MatchResult {
+	var mounted *Route
+	depth := -1
+	node := m.root.find(trimRoot(path), 0, &mounted, &depth)
+	if node != nil {
+		if route := node.routes[method]; route != nil {
+			return MatchResult{Route: route}
+		}
+	}
+	if mounted != nil {
+		return MatchResult{Route: mounted}
+	}
+	if node == nil {
+		return MatchResult{}
+	}
+
+	allowed := make([]string, 0, len(node.routes))
+	for method := range node.routes {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	return MatchResult{Allowed: allowed}
+}
+
+// find returns the node holding routes for rest, backtracking from static
+// to parameter segments, and records the deepest mount passed on the way.
+func (n *trieNode) find(rest string, depth int, mounted **Route, best *int) *trieNode {
+	if n.mount != nil && depth > *best {
+		*mounted, *best = n.mount, depth
+	}
+	if rest == "" {
+		if len(n.routes) > 0 {
+			return n
+		}
+		return nil
+	}
+
+	segment, next, _ := strings.Cut(rest, "/")
+	if c := n.static[segment]; c != nil {
+		if found := c.find(next, depth+1, mounted, best); found != nil {
+			return found
+		}
+	}
+	for _, p := range n.params {
+		if p.segment.greedy {
+			if found := p.findGreedy(rest, depth, mounted, best); found != nil {
+				return found
+			}
+			continue
+		}
+		if !p.segment.match(segment) {
+			continue
+		}
+		if found := p.node.find(next, depth+1, mounted, best); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findGreedy lets a {name...} parameter take the fewest segments of rest
+// that leave the route after it something to match, so in
+// "GET:/files/{path...}/edit" it stops before the last "edit".
+func (p trieParam) findGreedy(rest string, depth int, mounted **Route, best *int) *trieNode {
+	for end := 0; end < len(rest); {
+		if i := strings.IndexByte(rest[end+1:], '/'); i >= 0 {
+			end += 1 + i
+		} else {
+			end = len(rest)
+		}
+		if !p.segment.match(rest[:end]) {
+			continue
+		}
+		if found := p.node.find(strings.TrimPrefix(rest[end:], "/"), depth+1, mounted, best); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// trimRoot maps the root path "/" to no segments at all.
+func trimRoot(path string) string {
+	if path == "/" {
+		return ""
+	}
+	return path
+}
@@ -0,0 +1,79 @@
+package router
+
+import (
+	"net/http"
+	"sort"
+)
+
+// WithValue attaches a static value to the route, e.g. the feature it
+// belongs to, readable with Value while it serves a request and added to
+// the request's logger.
+func (rt *Route) WithValue(key string, value any) *Route {
+	if rt.values == nil {
+		rt.values = make(map[string]any)
+	}
+	rt.values[key] = value
+	return rt
+}
+
+// WithValue sets a default value for the routes registered on the group
+// from now on, and on its subgroups. Routes can override it.
+func (g *Group) WithValue(key string, value any) *Group {
+	values := make(map[string]any, len(g.values)+1)
+	for k, v := range g.values {
+		values[k] = v
+	}
+	values[key] = value
+	g.values = values
+	return g
+}
+
+// Tag labels the routes registered on the group from now on, and on its
+// subgroups, on top of their own tags.
+func (g *Group) Tag(tags ...string) *Group {
+	g.tags = append(append([]string(nil), g.tags...), tags...)
+	return g
+}
+
+// register gives a route registered through the group its default values,
+// tags, metric labels and prefix stripping.
+func (g *Group) register(route *Route) *Route {
+	if g.strip && route.strip == "" {
+		route.strip = joinPath(g.prefix, "")
+	}
+	route.tags = append(append([]string(nil), g.tags...), route.tags...)
+	for k, v := range g.values {
+		if _, ok := route.values[k]; !ok {
+			route.WithValue(k, v)
+		}
+	}
+	for k, v := range g.metricLabels {
+		if _, ok := route.metricLabels[k]; !ok {
+			route.MetricLabel(k, v)
+		}
+	}
+	return route
+}
+
+// Value returns the value the route serving rr, or its group, declared
+// under key, or nil.
+func Value(rr *http.Request, key string) any {
+	if route := MatchedRoute(rr); route != nil {
+		return route.values[key]
+	}
+	return nil
+}
+
+// logAttrs returns the route's values as logger attributes, in key order.
+func (rt *Route) logAttrs() []any {
+	keys := make([]string, 0, len(rt.values))
+	for k := range rt.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]any, 0, 2*len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, k, rt.values[k])
+	}
+	return attrs
+}
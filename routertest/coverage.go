@@ -0,0 +1,41 @@
+package routertest
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// Cover returns a client whose requests are counted against the routes of
+// rr, for CheckCoverage to report at the end of the test run:
+//
+//	c, cov := routertest.Cover(rr)
+//	t.Run("users", func(t *testing.T) { c.Get("/users").Expect(t).Status(200) })
+//	routertest.CheckCoverage(t, cov, "GET:/healthz")
+func Cover(rr *router.Router) (*Client, *router.Coverage) {
+	cov := router.NewCoverage(rr)
+	return New(cov.Middleware(rr)), cov
+}
+
+// CheckCoverage fails the test listing the routes no request reached,
+// except the patterns in ignore, and logs the requests that reached none.
+func CheckCoverage(t testing.TB, cov *router.Coverage, ignore ...string) {
+	t.Helper()
+
+	report := cov.Report()
+	for _, u := range report.Unmatched {
+		t.Logf("routertest: %s %s matched no route (%d), %d times", u.Method, u.Path, u.Status, u.Count)
+	}
+
+	var unused []string
+	for _, route := range report.Unused {
+		if !slices.Contains(ignore, route.Pattern) {
+			unused = append(unused, route.Pattern+"   ("+route.Source+")")
+		}
+	}
+	if len(unused) > 0 {
+		t.Errorf("routertest: %d of %d routes never exercised:\n  %s", len(unused), report.Routes, strings.Join(unused, "\n  "))
+	}
+}
@@ -0,0 +1,223 @@
+// Package routertest drives an http.Handler, usually a *router.Router,
+// in-process for handler tests:
+//
+//	c := routertest.New(rr)
+//	c.Post("/users").WithJSON(user).Expect(t).Status(201).JSONPath("id", 1)
+//
+// Failed expectations are reported with t.Errorf, so one test can check
+// several things about a response.
+package routertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type Client struct {
+	handler http.Handler
+	header  http.Header
+}
+
+func New(handler http.Handler) *Client {
+	return &Client{handler: handler, header: make(http.Header)}
+}
+
+// WithHeader sets a header sent with every request of the client.
+func (c *Client) WithHeader(key, value string) *Client {
+	c.header.Set(key, value)
+	return c
+}
+
+func (c *Client) Get(target string) *Request     { return c.Do(http.MethodGet, target) }
+func (c *Client) Post(target string) *Request    { return c.Do(http.MethodPost, target) }
+func (c *Client) Put(target string) *Request     { return c.Do(http.MethodPut, target) }
+func (c *Client) Patch(target string) *Request   { return c.Do(http.MethodPatch, target) }
+func (c *Client) Delete(target string) *Request  { return c.Do(http.MethodDelete, target) }
+func (c *Client) Head(target string) *Request    { return c.Do(http.MethodHead, target) }
+func (c *Client) Options(target string) *Request { return c.Do(http.MethodOptions, target) }
+
+func (c *Client) Do(method, target string) *Request {
+	return &Request{client: c, method: method, target: target, header: c.header.Clone()}
+}
+
+// Request is built up fluently and sent by Expect.
+type Request struct {
+	client *Client
+	method string
+	target string
+	header http.Header
+	body   []byte
+	err    error
+}
+
+func (r *Request) WithHeader(key, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+func (r *Request) WithBearer(token string) *Request {
+	return r.WithHeader("Authorization", "Bearer "+token)
+}
+
+func (r *Request) WithBody(contentType string, body []byte) *Request {
+	r.body = body
+	return r.WithHeader("Content-Type", contentType)
+}
+
+// WithJSON sends v encoded as JSON.
+func (r *Request) WithJSON(v interface{}) *Request {
+	body, err := json.Marshal(v)
+	if err != nil {
+		r.err = fmt.Errorf("routertest: encoding request body: %w", err)
+	}
+	return r.WithBody("application/json", body)
+}
+
+// Expect sends the request and returns its response for checking.
+func (r *Request) Expect(t testing.TB) *Response {
+	t.Helper()
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+	req := httptest.NewRequest(r.method, r.target, body)
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+
+	rec := httptest.NewRecorder()
+	r.client.handler.ServeHTTP(rec, req)
+	return &Response{t: t, Recorder: rec, req: req}
+}
+
+// Response checks the outcome of a request. Every check returns the
+// response, so checks can be chained.
+type Response struct {
+	t        testing.TB
+	Recorder *httptest.ResponseRecorder
+
+	req     *http.Request
+	decoded interface{}
+	parsed  bool
+}
+
+func (r *Response) Status(want int) *Response {
+	r.t.Helper()
+	if got := r.Recorder.Code; got != want {
+		r.t.Errorf("%s: status = %d, want %d", r.describe(), got, want)
+	}
+	return r
+}
+
+func (r *Response) Header(key, want string) *Response {
+	r.t.Helper()
+	if got := r.Recorder.Header().Get(key); got != want {
+		r.t.Errorf("%s: header %s = %q, want %q", r.describe(), key, got, want)
+	}
+	return r
+}
+
+func (r *Response) Body(want string) *Response {
+	r.t.Helper()
+	if got := r.Recorder.Body.String(); got != want {
+		r.t.Errorf("%s: body = %q, want %q", r.describe(), got, want)
+	}
+	return r
+}
+
+func (r *Response) BodyContains(want string) *Response {
+	r.t.Helper()
+	if got := r.Recorder.Body.String(); !strings.Contains(got, want) {
+		r.t.Errorf("%s: body %q does not contain %q", r.describe(), got, want)
+	}
+	return r
+}
+
+// JSON decodes the body into v.
+func (r *Response) JSON(v interface{}) *Response {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Recorder.Body.Bytes(), v); err != nil {
+		r.t.Errorf("%s: decoding body: %v", r.describe(), err)
+	}
+	return r
+}
+
+// JSONPath checks the value at a dot-separated path of the JSON body, where
+// numeric segments index arrays: "items.0.id". want is compared after a
+// JSON round trip, so JSONPath("count", 2) matches a body of {"count": 2}.
+func (r *Response) JSONPath(path string, want interface{}) *Response {
+	r.t.Helper()
+	if !r.parsed {
+		r.parsed = true
+		if err := json.Unmarshal(r.Recorder.Body.Bytes(), &r.decoded); err != nil {
+			r.t.Errorf("%s: body is not JSON: %v", r.describe(), err)
+			return r
+		}
+	}
+
+	got, err := lookup(r.decoded, path)
+	if err != nil {
+		r.t.Errorf("%s: %s: %v", r.describe(), path, err)
+		return r
+	}
+	normalized, err := normalize(want)
+	if err != nil {
+		r.t.Errorf("%s: %s: encoding expected value: %v", r.describe(), path, err)
+		return r
+	}
+	if !reflect.DeepEqual(got, normalized) {
+		r.t.Errorf("%s: %s = %v, want %v", r.describe(), path, got, normalized)
+	}
+	return r
+}
+
+func (r *Response) describe() string {
+	return r.req.Method + " " + r.req.URL.String()
+}
+
+func lookup(v interface{}, path string) (interface{}, error) {
+	if path == "" {
+		return v, nil
+	}
+	for _, segment := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			next, ok := node[segment]
+			if !ok {
+				return nil, fmt.Errorf("no field %q", segment)
+			}
+			v = next
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("no index %q in array of %d", segment, len(node))
+			}
+			v = node[i]
+		default:
+			return nil, fmt.Errorf("cannot descend into %v with %q", v, segment)
+		}
+	}
+	return v, nil
+}
+
+func normalize(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	err = json.Unmarshal(b, &out)
+	return out, err
+}
@@ -0,0 +1,94 @@
+package routertest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// UpdateEnv names the environment variable that makes MatchRoutes rewrite
+// golden files instead of comparing against them.
+const UpdateEnv = "ROUTERTEST_UPDATE"
+
+// RouteTable renders the routes of rr one per line, sorted, in the form
+//
+//	GET     /admin/config [admin]
+//
+// It only depends on what is registered, not on registration order, and
+// adding a route only adds a line.
+func RouteTable(rr *router.Router) string {
+	var b strings.Builder
+	for _, route := range rr.Routes() {
+		fmt.Fprintf(&b, "%-7s %s", route.Method, route.Host+route.Path)
+		if len(route.Permissions) > 0 {
+			b.WriteString(" [" + strings.Join(route.Permissions, " ") + "]")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// MatchRoutes compares the route table of rr with the golden file at path,
+// failing the test with the lines added and removed. Running the tests with
+// ROUTERTEST_UPDATE=1 writes the current table to the file instead.
+func MatchRoutes(t testing.TB, rr *router.Router, path string) {
+	t.Helper()
+
+	got := RouteTable(rr)
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("routertest: %v (run with %s=1 to create it)", err, UpdateEnv)
+	}
+	if bytes.Equal(want, []byte(got)) {
+		return
+	}
+
+	removed, added := diffLines(string(want), got)
+	var b strings.Builder
+	fmt.Fprintf(&b, "route table differs from %s (run with %s=1 to accept):\n", path, UpdateEnv)
+	for _, line := range removed {
+		b.WriteString("- " + line + "\n")
+	}
+	for _, line := range added {
+		b.WriteString("+ " + line + "\n")
+	}
+	t.Error(b.String())
+}
+
+// diffLines returns the lines only in want and those only in got. Route
+// tables are sorted sets, so this is all the diff they need.
+func diffLines(want, got string) (removed, added []string) {
+	count := make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(want), "\n") {
+		count[line]++
+	}
+	for _, line := range strings.Split(strings.TrimSpace(got), "\n") {
+		if count[line] > 0 {
+			count[line]--
+			continue
+		}
+		added = append(added, line)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(want), "\n") {
+		if count[line] > 0 {
+			count[line]--
+			removed = append(removed, line)
+		}
+	}
+	return removed, added
+}
@@ -0,0 +1,299 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrSyntax = errors.New("script: syntax error")
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type parser struct {
+	src    string
+	pos    int
+	tok    token
+	nodes  int
+	limits Limits
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w at offset %d of %q: %s", ErrSyntax, p.tok.pos, p.src, fmt.Sprintf(format, args...))
+}
+
+// add counts a node against MaxNodes.
+func (p *parser) add(n node) (node, error) {
+	p.nodes++
+	if p.nodes > p.limits.MaxNodes {
+		return nil, fmt.Errorf("%w: %q has more than %d nodes", ErrLimit, p.src, p.limits.MaxNodes)
+	}
+	return n, nil
+}
+
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "(", ")", ","}
+
+func (p *parser) next() error {
+	for p.pos < len(p.src) && strings.ContainsRune(" \t\r\n", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	p.tok = token{pos: start}
+	if p.pos >= len(p.src) {
+		p.tok.kind = tokEOF
+		return nil
+	}
+
+	switch c := p.src[p.pos]; {
+	case c == '"' || c == '\'':
+		end := p.pos + 1
+		for end < len(p.src) && p.src[end] != c {
+			if p.src[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(p.src) {
+			return p.errorf("unterminated string")
+		}
+		text := p.src[p.pos : end+1]
+		if c == '\'' {
+			text = `"` + strings.ReplaceAll(text[1:len(text)-1], `"`, `\"`) + `"`
+		}
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return p.errorf("invalid string %s", p.src[p.pos:end+1])
+		}
+		p.tok.kind, p.tok.text, p.pos = tokString, s, end+1
+	case c >= '0' && c <= '9':
+		end := p.pos
+		for end < len(p.src) && (p.src[end] >= '0' && p.src[end] <= '9' || p.src[end] == '.') {
+			end++
+		}
+		p.tok.kind, p.tok.text, p.pos = tokNumber, p.src[p.pos:end], end
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		end := p.pos
+		for end < len(p.src) && (p.src[end] == '_' || p.src[end] >= 'a' && p.src[end] <= 'z' || p.src[end] >= 'A' && p.src[end] <= 'Z' || p.src[end] >= '0' && p.src[end] <= '9') {
+			end++
+		}
+		p.tok.kind, p.tok.text, p.pos = tokIdent, p.src[p.pos:end], end
+	default:
+		for _, op := range operators {
+			if strings.HasPrefix(p.src[p.pos:], op) {
+				p.tok.kind, p.tok.text, p.pos = tokOp, op, p.pos+len(op)
+				return nil
+			}
+		}
+		return p.errorf("unexpected %q", p.src[p.pos:p.pos+1])
+	}
+	return nil
+}
+
+func (p *parser) accept(op string) (bool, error) {
+	if p.tok.kind != tokOp || p.tok.text != op {
+		return false, nil
+	}
+	return true, p.next()
+}
+
+// or, and, cmp and sum parse the levels of binary operators, loosest
+// first.
+func (p *parser) or() (node, error) {
+	return p.binary([]string{"||"}, p.and)
+}
+
+func (p *parser) and() (node, error) {
+	return p.binary([]string{"&&"}, p.cmp)
+}
+
+func (p *parser) cmp() (node, error) {
+	x, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		ok, err := p.accept(op)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			y, err := p.sum()
+			if err != nil {
+				return nil, err
+			}
+			return p.add(binary{op: op, x: x, y: y})
+		}
+	}
+	return x, nil
+}
+
+func (p *parser) sum() (node, error) {
+	return p.binary([]string{"+"}, p.unary)
+}
+
+func (p *parser) binary(ops []string, operand func() (node, error)) (node, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		matched := ""
+		for _, op := range ops {
+			ok, err := p.accept(op)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				matched = op
+				break
+			}
+		}
+		if matched == "" {
+			return x, nil
+		}
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if x, err = p.add(binary{op: matched, x: x, y: y}); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	for _, op := range []string{"!", "-"} {
+		ok, err := p.accept(op)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			x, err := p.unary()
+			if err != nil {
+				return nil, err
+			}
+			return p.add(unary{op: op, x: x})
+		}
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokString:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return p.add(literal{v: tok.text})
+	case tokNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", tok.text)
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return p.add(literal{v: f})
+	case tokIdent:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		switch tok.text {
+		case "true", "false":
+			return p.add(literal{v: tok.text == "true"})
+		}
+		if ok, err := p.accept("("); err != nil || ok {
+			if err != nil {
+				return nil, err
+			}
+			return p.call(tok)
+		}
+		if _, ok := variables[tok.text]; !ok {
+			return nil, fmt.Errorf("%w: unknown variable %s in %q", ErrSyntax, tok.text, p.src)
+		}
+		return p.add(variable{name: tok.text})
+	case tokOp:
+		if tok.text == "(" {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			x, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if ok, err := p.accept(")"); err != nil || !ok {
+				if err != nil {
+					return nil, err
+				}
+				return nil, p.errorf("missing )")
+			}
+			return x, nil
+		}
+	}
+	if tok.kind == tokEOF {
+		return nil, p.errorf("unexpected end")
+	}
+	return nil, p.errorf("unexpected %q", tok.text)
+}
+
+func (p *parser) call(name token) (node, error) {
+	arity, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown function %s in %q", ErrSyntax, name.text, p.src)
+	}
+	n := call{name: name.text}
+	for {
+		if ok, err := p.accept(")"); err != nil || ok {
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		if len(n.args) > 0 {
+			if ok, err := p.accept(","); err != nil || !ok {
+				if err != nil {
+					return nil, err
+				}
+				return nil, p.errorf("want , or ) in the arguments of %s", name.text)
+			}
+		}
+		arg, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		n.args = append(n.args, arg)
+	}
+	if len(n.args) != arity {
+		return nil, fmt.Errorf("%w: %s takes %d arguments, got %d in %q", ErrSyntax, name.text, arity, len(n.args), p.src)
+	}
+	if n.name == "matches" {
+		lit, ok := n.args[1].(literal)
+		expr, _ := lit.v.(string)
+		if !ok || expr == "" {
+			return nil, fmt.Errorf("%w: matches takes a literal regular expression in %q", ErrSyntax, p.src)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w in %q", ErrSyntax, err, p.src)
+		}
+		n.re = re
+	}
+	return p.add(n)
+}
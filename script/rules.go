@@ -0,0 +1,111 @@
+package script
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// Rule sends the requests When holds for to Handler.
+type Rule struct {
+	When    *Program
+	Handler http.Handler
+}
+
+// Switch serves each request with the handler of the first rule holding
+// for it, or with fallback, e.g. to send beta testers to a beta upstream.
+// A rule failing to evaluate is logged and does not hold.
+func Switch(rules []Rule, fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		for _, rule := range rules {
+			if holds(rule.When, r) {
+				rule.Handler.ServeHTTP(rw, r)
+				return
+			}
+		}
+		fallback.ServeHTTP(rw, r)
+	})
+}
+
+func holds(when *Program, r *http.Request) bool {
+	if when == nil {
+		return true
+	}
+	ok, err := when.Bool(r)
+	if err != nil {
+		router.Logger(r).Warn("script failed", "script", when.String(), "error", err)
+		return false
+	}
+	return ok
+}
+
+// Transform rewrites the headers of the requests When holds for, or of
+// every request when When is nil, before they reach their routes.
+type Transform struct {
+	When *Program
+	// SetHeaders are evaluated against the request as it arrived, so one
+	// may read a header another replaces.
+	SetHeaders map[string]*Program
+	// RemoveHeaders are deleted after SetHeaders are set.
+	RemoveHeaders []string
+}
+
+// NewTransform compiles a Transform from its source expressions; when may
+// be empty.
+func NewTransform(when string, set map[string]string, remove []string) (Transform, error) {
+	t := Transform{SetHeaders: make(map[string]*Program, len(set)), RemoveHeaders: remove}
+	if when != "" {
+		p, err := Compile(when)
+		if err != nil {
+			return Transform{}, err
+		}
+		t.When = p
+	}
+	for name, src := range set {
+		p, err := Compile(src)
+		if err != nil {
+			return Transform{}, fmt.Errorf("header %s: %w", name, err)
+		}
+		t.SetHeaders[http.CanonicalHeaderKey(name)] = p
+	}
+	return t, nil
+}
+
+// Transforms applies each transform in order. A header expression failing
+// to evaluate is logged and the header left alone.
+func Transforms(transforms ...Transform) router.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			cloned := false
+			for _, t := range transforms {
+				if !holds(t.When, r) {
+					continue
+				}
+				values := make(map[string]string, len(t.SetHeaders))
+				for name, p := range t.SetHeaders {
+					v, err := p.EvalString(r)
+					if err != nil {
+						router.Logger(r).Warn("script failed", "script", p.String(), "header", name, "error", err)
+						continue
+					}
+					values[name] = v
+				}
+				if len(values) == 0 && len(t.RemoveHeaders) == 0 {
+					continue
+				}
+				if !cloned {
+					r = r.Clone(r.Context())
+					cloned = true
+				}
+				for name, v := range values {
+					r.Header.Set(name, v)
+				}
+				for _, name := range t.RemoveHeaders {
+					r.Header.Del(name)
+				}
+			}
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
@@ -0,0 +1,385 @@
+// Package script evaluates small expressions over requests, so config can
+// describe predicates and header values without a plugin, e.g.
+//
+//	header("X-Beta") == "1" && starts_with(path, "api/")
+//
+// Expressions hold strings, numbers and booleans, the operators
+// ! && || == != < <= > >= + (sum or concatenation) and parentheses, the
+// variables method, path (normalised like route paths), host, scheme and
+// client_ip, and the functions header, query, cookie, param, lower, upper,
+// trim, len, number, contains, starts_with, ends_with and matches (with a
+// literal regular expression). There are no loops or assignments, and
+// Limits bounds the size of programs, of the strings they build and the
+// time they run, so config cannot stall or exhaust the router.
+package script
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+var (
+	ErrLimit = errors.New("script: limit exceeded")
+	ErrType  = errors.New("script: type mismatch")
+)
+
+// Limits bound what a program may cost.
+type Limits struct {
+	// MaxNodes bounds the size of a program, and so its evaluation steps.
+	MaxNodes int
+	// MaxString bounds the strings a program handles: those read from the
+	// request, returned by functions or built by concatenation.
+	MaxString int
+	// Timeout bounds one evaluation; 0 leaves it to MaxNodes. It guards
+	// against a slow request or regular expression rather than paces the
+	// program, so leave room for a busy machine.
+	Timeout time.Duration
+}
+
+var DefaultLimits = Limits{MaxNodes: 256, MaxString: 8 << 10, Timeout: 100 * time.Millisecond}
+
+// Program is a compiled expression, safe for concurrent use.
+type Program struct {
+	src    string
+	root   node
+	limits Limits
+}
+
+// Compile parses src with DefaultLimits.
+func Compile(src string) (*Program, error) {
+	return CompileWithLimits(src, DefaultLimits)
+}
+
+// CompileWithLimits parses src, failing when it exceeds limits.MaxNodes.
+func CompileWithLimits(src string, limits Limits) (*Program, error) {
+	p := &parser{src: src, limits: limits}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+	return &Program{src: src, root: root, limits: limits}, nil
+}
+
+// String returns the source of the program.
+func (p *Program) String() string {
+	return p.src
+}
+
+// Eval evaluates the program for r, returning a string, float64 or bool.
+func (p *Program) Eval(r *http.Request) (any, error) {
+	e := &env{r: r, limits: p.limits}
+	if p.limits.Timeout > 0 {
+		e.deadline = time.Now().Add(p.limits.Timeout)
+	}
+	return p.root.eval(e)
+}
+
+// Bool evaluates a predicate.
+func (p *Program) Bool(r *http.Request) (bool, error) {
+	v, err := p.Eval(r)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: %q is a %s, want a boolean", ErrType, p.src, typeName(v))
+	}
+	return b, nil
+}
+
+// EvalString evaluates the program to a string, formatting numbers and booleans.
+func (p *Program) EvalString(r *http.Request) (string, error) {
+	v, err := p.Eval(r)
+	if err != nil {
+		return "", err
+	}
+	return format(v), nil
+}
+
+type env struct {
+	r        *http.Request
+	limits   Limits
+	deadline time.Time
+	steps    int
+}
+
+// step charges one evaluation step, checking the deadline now and then.
+func (e *env) step() error {
+	e.steps++
+	if e.steps%16 == 0 && !e.deadline.IsZero() && time.Now().After(e.deadline) {
+		return fmt.Errorf("%w: evaluation took longer than %s", ErrLimit, e.limits.Timeout)
+	}
+	return nil
+}
+
+// str checks a string against MaxString.
+func (e *env) str(s string) (any, error) {
+	if len(s) > e.limits.MaxString {
+		return nil, fmt.Errorf("%w: string longer than %d bytes", ErrLimit, e.limits.MaxString)
+	}
+	return s, nil
+}
+
+type node interface {
+	eval(e *env) (any, error)
+}
+
+type literal struct{ v any }
+
+func (n literal) eval(e *env) (any, error) { return n.v, e.step() }
+
+type variable struct{ name string }
+
+var variables = map[string]func(r *http.Request) string{
+	"method": func(r *http.Request) string { return r.Method },
+	"path": func(r *http.Request) string {
+		path, _ := router.RequestPath(r)
+		return path
+	},
+	"host": func(r *http.Request) string { return router.NormalizeHost(r.Host) },
+	"scheme": func(r *http.Request) string {
+		if r.TLS != nil {
+			return "https"
+		}
+		return "http"
+	},
+	"client_ip": func(r *http.Request) string {
+		if ip := router.ClientIP(r); ip.IsValid() {
+			return ip.String()
+		}
+		return ""
+	},
+}
+
+func (n variable) eval(e *env) (any, error) {
+	if err := e.step(); err != nil {
+		return nil, err
+	}
+	return e.str(variables[n.name](e.r))
+}
+
+type unary struct {
+	op string
+	x  node
+}
+
+func (n unary) eval(e *env) (any, error) {
+	if err := e.step(); err != nil {
+		return nil, err
+	}
+	v, err := n.x.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "!":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%w: ! of a %s", ErrType, typeName(v))
+		}
+		return !b, nil
+	default:
+		f, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%w: - of a %s", ErrType, typeName(v))
+		}
+		return -f, nil
+	}
+}
+
+type binary struct {
+	op   string
+	x, y node
+}
+
+func (n binary) eval(e *env) (any, error) {
+	if err := e.step(); err != nil {
+		return nil, err
+	}
+	x, err := n.x.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	// && and || only evaluate what they need.
+	if n.op == "&&" || n.op == "||" {
+		b, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s of a %s", ErrType, n.op, typeName(x))
+		}
+		if b == (n.op == "||") {
+			return b, nil
+		}
+		y, err := n.y.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok = y.(bool); !ok {
+			return nil, fmt.Errorf("%w: %s of a %s", ErrType, n.op, typeName(y))
+		}
+		return b, nil
+	}
+
+	y, err := n.y.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return x == y, nil
+	case "!=":
+		return x != y, nil
+	case "+":
+		if xs, ok := x.(string); ok {
+			ys, ok := y.(string)
+			if !ok {
+				break
+			}
+			if len(xs)+len(ys) > e.limits.MaxString {
+				return nil, fmt.Errorf("%w: string longer than %d bytes", ErrLimit, e.limits.MaxString)
+			}
+			return xs + ys, nil
+		}
+		xf, xok := x.(float64)
+		yf, yok := y.(float64)
+		if xok && yok {
+			return xf + yf, nil
+		}
+	default:
+		if c, ok := compare(x, y); ok {
+			switch n.op {
+			case "<":
+				return c < 0, nil
+			case "<=":
+				return c <= 0, nil
+			case ">":
+				return c > 0, nil
+			case ">=":
+				return c >= 0, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %s %s %s", ErrType, typeName(x), n.op, typeName(y))
+}
+
+func compare(x, y any) (int, bool) {
+	switch x := x.(type) {
+	case string:
+		if y, ok := y.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case float64:
+		if y, ok := y.(float64); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+type call struct {
+	name string
+	args []node
+	re   *regexp.Regexp
+}
+
+// functions maps each function to its arity.
+var functions = map[string]int{
+	"header": 1, "query": 1, "cookie": 1, "param": 1,
+	"lower": 1, "upper": 1, "trim": 1, "len": 1, "number": 1,
+	"contains": 2, "starts_with": 2, "ends_with": 2, "matches": 2,
+}
+
+func (n call) eval(e *env) (any, error) {
+	if err := e.step(); err != nil {
+		return nil, err
+	}
+	args := make([]string, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s of a %s", ErrType, n.name, typeName(v))
+		}
+		args[i] = s
+	}
+
+	switch n.name {
+	case "header":
+		return e.str(e.r.Header.Get(args[0]))
+	case "query":
+		return e.str(e.r.URL.Query().Get(args[0]))
+	case "cookie":
+		if c, err := e.r.Cookie(args[0]); err == nil {
+			return e.str(c.Value)
+		}
+		return "", nil
+	case "param":
+		return e.str(router.Param(e.r, args[0]))
+	case "lower":
+		// Case mapping can lengthen a string.
+		return e.str(strings.ToLower(args[0]))
+	case "upper":
+		return e.str(strings.ToUpper(args[0]))
+	case "trim":
+		return strings.TrimSpace(args[0]), nil
+	case "len":
+		return float64(len(args[0])), nil
+	case "number":
+		f, err := strconv.ParseFloat(strings.TrimSpace(args[0]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: number of %q", ErrType, args[0])
+		}
+		return f, nil
+	case "contains":
+		return strings.Contains(args[0], args[1]), nil
+	case "starts_with":
+		return strings.HasPrefix(args[0], args[1]), nil
+	case "ends_with":
+		return strings.HasSuffix(args[0], args[1]), nil
+	default: // matches
+		return n.re.MatchString(args[0]), nil
+	}
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func format(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,146 @@
+package script
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompileErrors(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"1 +",
+		"(true",
+		"1 2",
+		"a @ b",
+		"'unterminated",
+		`"bad \q escape"`,
+		"nope == 1",
+		"nope(path)",
+		"header()",
+		"contains(path)",
+		"lower(path, path)",
+		"matches(path, header('X'))",
+		"matches(path, '')",
+		"matches(path, '(')",
+		// Comparisons do not chain.
+		"1 < 2 == true",
+	} {
+		if _, err := Compile(src); !errors.Is(err, ErrSyntax) {
+			t.Errorf("Compile(%q) = %v, want ErrSyntax", src, err)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://example.com/api/users?page=2", nil)
+	r.Header.Set("X-Beta", "1")
+	r.Header.Set("X-Name", "  Ada ")
+
+	for _, tt := range []struct {
+		src  string
+		want any
+	}{
+		{"1 + 2 * 0 == 3", nil},
+		{"1 + 2 == 3", true},
+		{"-1 + 2", 1.0},
+		{"--1", 1.0},
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"!false && false", false},
+		{"!(false && false)", true},
+		{"'a' + 'b' + 'c' == 'abc'", true},
+		{"2 >= 2 && 'b' > 'a'", true},
+		// && and || stop at the first operand deciding them, so the
+		// mistyped header call never runs.
+		{"false && header(1) == ''", false},
+		{"true || number('x') > 1", true},
+		{`method == "GET" && starts_with(path, "api/")`, true},
+		{"header('x-beta') == '1'", true},
+		{"trim(header('X-Name'))", "Ada"},
+		{"upper(query('page')) + lower('ABC')", "2abc"},
+		{"number(query('page')) + 1", 3.0},
+		{"len(host)", 11.0},
+		{"contains(path, 'users') && ends_with(path, 'users')", true},
+		{"matches(path, '^api/[a-z]+$')", true},
+	} {
+		p, err := Compile(tt.src)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("Compile(%q) succeeded, want an error", tt.src)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.src, err)
+			continue
+		}
+		if got, err := p.Eval(r); err != nil || got != tt.want {
+			t.Errorf("%q = %v, %v; want %v", tt.src, got, err, tt.want)
+		}
+	}
+}
+
+func TestEvalTypeErrors(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, src := range []string{"!'a'", "-'a'", "1 + 'a'", "'a' < 1", "1 && true", "lower(1)", "number('x')"} {
+		p, err := Compile(src)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", src, err)
+			continue
+		}
+		if _, err := p.Eval(r); !errors.Is(err, ErrType) {
+			t.Errorf("%q: err = %v, want ErrType", src, err)
+		}
+	}
+	if p, _ := Compile("'a'"); p != nil {
+		if _, err := p.Bool(r); !errors.Is(err, ErrType) {
+			t.Errorf("Bool of a string: err = %v, want ErrType", err)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{MaxNodes: 64, MaxString: 16}
+
+	if _, err := CompileWithLimits(strings.Repeat("1 + ", 64)+"1", limits); !errors.Is(err, ErrLimit) {
+		t.Errorf("a program of 129 nodes: err = %v, want ErrLimit", err)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Long", strings.Repeat("a", 17))
+	r.Header.Set("X-Short", strings.Repeat("a", 16))
+	for _, tt := range []struct {
+		src string
+		err bool
+	}{
+		{"header('X-Short')", false},
+		{"header('X-Long')", true},
+		{"len(header('X-Long')) > 0", true},
+		{"upper(header('X-Long'))", true},
+		{"lower(header('X-Long'))", true},
+		{"header('X-Short') + 'a'", true},
+		// Ⱥ takes two bytes and its lower case three.
+		{"len(lower('ȺȺȺȺȺȺ'))", true},
+		{"len(lower('ȺȺȺȺȺ'))", false},
+	} {
+		p, err := CompileWithLimits(tt.src, limits)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.src, err)
+			continue
+		}
+		if _, err := p.Eval(r); errors.Is(err, ErrLimit) != tt.err {
+			t.Errorf("%q: err = %v, want a limit error %v", tt.src, err, tt.err)
+		}
+	}
+
+	// No Timeout is no deadline, however many steps the program takes.
+	p, err := CompileWithLimits(strings.Repeat("1 + ", 30)+"1 == 31", limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := p.Bool(r); err != nil || !ok {
+		t.Errorf("without a Timeout: %v, %v; want true", ok, err)
+	}
+}
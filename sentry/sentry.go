@@ -0,0 +1,278 @@
+// Package sentry reports failed requests to Sentry, as a
+// router.ErrorReporter, through the envelope endpoint of the DSN's project.
+package sentry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// Options configure a Client.
+type Options struct {
+	// DSN is the project's client key URL,
+	// https://<key>@<host>/<project id>.
+	DSN         string
+	Environment string
+	Release     string
+	// Queue bounds the events waiting to be sent, 100 by default; events
+	// beyond it are dropped.
+	Queue int
+	// Client sends the events, with a 10s timeout by default.
+	Client *http.Client
+}
+
+// Client queues the reports of failed requests and sends them to Sentry
+// while Run runs, so reporting never holds up a response.
+type Client struct {
+	opts     Options
+	endpoint string
+	auth     string
+	events   chan event
+}
+
+func New(opts Options) (*Client, error) {
+	u, err := url.Parse(opts.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("sentry: DSN: %w", err)
+	}
+	project := strings.TrimPrefix(u.Path, "/")
+	prefix := ""
+	if i := strings.LastIndexByte(project, '/'); i >= 0 {
+		prefix, project = "/"+project[:i], project[i+1:]
+	}
+	if u.User == nil || u.User.Username() == "" || project == "" {
+		return nil, fmt.Errorf("sentry: DSN %q: want https://<key>@<host>/<project id>", opts.DSN)
+	}
+	if opts.Queue <= 0 {
+		opts.Queue = 100
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Client{
+		opts:     opts,
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefix, project),
+		auth:     "Sentry sentry_version=7, sentry_client=router/1.0, sentry_key=" + u.User.Username(),
+		events:   make(chan event, opts.Queue),
+	}, nil
+}
+
+// Report queues an event for the failed request, tagged with its route,
+// status and request ID. The values of the request headers and query
+// parameters whose names mark a credential, such as Authorization, Cookie
+// or access_token, are sent as "[redacted]".
+func (c *Client) Report(ctx context.Context, rep router.ErrorReport) {
+	ev := c.event(rep)
+	select {
+	case c.events <- ev:
+	default:
+		router.Logger(rep.Request).Warn("sentry: queue full, event dropped", "event_id", ev.EventID)
+	}
+}
+
+func (c *Client) event(rep router.ErrorReport) event {
+	ev := event{
+		EventID:     newEventID(),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
+		Level:       "error",
+		Platform:    "go",
+		Logger:      "router",
+		Environment: c.opts.Environment,
+		Release:     c.opts.Release,
+		Tags: map[string]string{
+			"status":     fmt.Sprint(rep.Status),
+			"request_id": rep.RequestID,
+		},
+		Extra: map[string]any{},
+	}
+	if host, err := os.Hostname(); err == nil {
+		ev.ServerName = host
+	}
+	if rep.Route != "" {
+		ev.Tags["route"] = rep.Route
+		ev.Transaction = rep.Route
+	}
+	if len(rep.Params) > 0 {
+		ev.Extra["params"] = rep.Params
+	}
+
+	typ := fmt.Sprintf("%T", rep.Err)
+	if rep.Panic != nil {
+		typ = fmt.Sprintf("panic(%T)", rep.Panic.Value)
+		ev.Level = "fatal"
+		ev.Extra["stack"] = string(rep.Panic.Stack)
+	}
+	ev.Exception = &exceptions{Values: []exception{{Type: typ, Value: rep.Err.Error()}}}
+
+	if r := rep.Request; r != nil {
+		u := *r.URL
+		u.Scheme, u.Host = "http", r.Host
+		if r.TLS != nil {
+			u.Scheme = "https"
+		}
+		u.RawQuery = ""
+		ev.Request = &request{
+			Method:      r.Method,
+			URL:         u.String(),
+			QueryString: redactQuery(r.URL.RawQuery),
+			Headers:     make(map[string]string),
+		}
+		for name, values := range r.Header {
+			value := strings.Join(values, ", ")
+			if sensitive(name) {
+				value = redacted
+			}
+			ev.Request.Headers[name] = value
+		}
+	}
+	return ev
+}
+
+const redacted = "[redacted]"
+
+// secretWords are the parts of header and query parameter names that mark
+// a credential: Authorization, Cookie, X-Api-Key, access_token,
+// X-Amz-Signature, password and the like.
+var secretWords = []string{"auth", "cookie", "key", "token", "secret", "passw", "session", "signature", "credential"}
+
+func sensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, w := range secretWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactQuery replaces the values of the sensitive parameters of a raw
+// query. A query that does not parse is redacted whole.
+func redactQuery(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	q, err := url.ParseQuery(raw)
+	if err != nil {
+		return redacted
+	}
+	for name, values := range q {
+		if sensitive(name) {
+			for i := range values {
+				values[i] = redacted
+			}
+		}
+	}
+	return q.Encode()
+}
+
+// Run sends queued events until ctx is done, then sends those left within
+// the client's timeout. Run it as a server task.
+func (c *Client) Run(ctx context.Context) error {
+	for {
+		select {
+		case ev := <-c.events:
+			c.send(ctx, ev)
+		case <-ctx.Done():
+			ctx, cancel := context.WithTimeout(context.Background(), c.opts.Client.Timeout)
+			defer cancel()
+			for {
+				select {
+				case ev := <-c.events:
+					c.send(ctx, ev)
+				default:
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// send posts one event in an envelope, logging failures: a report that
+// cannot be sent must not fail anything else.
+func (c *Client) send(ctx context.Context, ev event) {
+	if err := c.post(ctx, ev); err != nil {
+		slog.Warn("Sentry Report Failed", "event_id", ev.EventID, "err", err)
+	}
+}
+
+func (c *Client) post(ctx context.Context, ev event) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, `{"event_id":%q,"sent_at":%q}`+"\n", ev.EventID, time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&body, `{"type":"event","length":%d}`+"\n", len(payload))
+	body.Write(payload)
+	body.WriteByte('\n')
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", c.auth)
+	res, err := c.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("sentry: %s", res.Status)
+	}
+	return nil
+}
+
+func newEventID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// event is the subset of the Sentry event payload sent, see
+// https://develop.sentry.dev/sdk/data-model/event-payloads/.
+type event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Transaction string            `json:"transaction,omitempty"`
+	Tags        map[string]string `json:"tags"`
+	Extra       map[string]any    `json:"extra,omitempty"`
+	Exception   *exceptions       `json:"exception,omitempty"`
+	Request     *request          `json:"request,omitempty"`
+}
+
+type exceptions struct {
+	Values []exception `json:"values"`
+}
+
+type exception struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type request struct {
+	Method      string            `json:"method"`
+	URL         string            `json:"url"`
+	QueryString string            `json:"query_string,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+}
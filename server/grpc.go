@@ -0,0 +1,31 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Multiplex sends gRPC calls, HTTP/2 requests with an application/grpc
+// content type, to grpcHandler (typically a *grpc.Server) and every other
+// request to handler. gRPC needs HTTP/2, so the server must either use TLS
+// or have unencrypted HTTP/2 enabled (see EnableH2C).
+func Multiplex(grpcHandler, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcHandler.ServeHTTP(rw, r)
+			return
+		}
+		handler.ServeHTTP(rw, r)
+	})
+}
+
+// EnableH2C lets srv accept HTTP/2 over cleartext connections alongside
+// HTTP/1, as gRPC clients without TLS require.
+func EnableH2C(srv *http.Server) {
+	if srv.Protocols == nil {
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetHTTP2(true)
+	}
+	srv.Protocols.SetUnencryptedHTTP2(true)
+}
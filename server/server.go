@@ -0,0 +1,267 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	envListenFD = "ROUTER_LISTEN_FD"
+	envReadyFD  = "ROUTER_READY_FD"
+)
+
+var (
+	ErrUpgradeTimeout    = errors.New("server: timed out waiting for the new process to become ready")
+	ErrUpgradeNotAllowed = errors.New("server: listener cannot be passed to a new process")
+)
+
+// Lifecycle is implemented by handlers that hold resources tied to the
+// server's lifetime, such as *router.Router. Start runs before requests are
+// accepted and Stop after in-flight requests have drained.
+type Lifecycle interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// Server wraps http.Server with graceful shutdown on SIGINT/SIGTERM and
+// zero-downtime restarts on SIGHUP: the listening socket is handed over to a
+// freshly started copy of the binary and this process only stops once the new
+// one reports it is serving. Sockets passed by systemd socket activation are
+// used instead of binding Addr.
+type Server struct {
+	*http.Server
+	// ShutdownTimeout bounds how long in-flight requests get to drain.
+	ShutdownTimeout time.Duration
+	// StopTimeout bounds, once requests have drained, how long background
+	// tasks get to stop, and then the Lifecycle Stop hooks, each on a
+	// budget of its own.
+	StopTimeout    time.Duration
+	UpgradeTimeout time.Duration
+	MaxConnections int
+	ClientLimits   ClientLimits
+	Logger         *slog.Logger
+
+	listener net.Listener
+	tasks    tasks
+}
+
+func New(srv *http.Server) *Server {
+	return &Server{
+		Server:          srv,
+		ShutdownTimeout: 15 * time.Second,
+		StopTimeout:     10 * time.Second,
+		UpgradeTimeout:  30 * time.Second,
+	}
+}
+
+func (s *Server) logger() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return slog.Default()
+}
+
+func (s *Server) ListenAndServe() error {
+	ln, err := s.listen()
+	if err != nil {
+		return err
+	}
+	s.listener = ln
+
+	if lc, ok := s.Handler.(Lifecycle); ok {
+		if err := lc.Start(context.Background()); err != nil {
+			ln.Close()
+			return err
+		}
+	}
+
+	if s.ClientLimits != (ClientLimits{}) {
+		ln = ProtectListener(ln, s.ClientLimits, s.logger())
+	}
+	if s.MaxConnections > 0 {
+		ln = LimitListener(ln, s.MaxConnections)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.Serve(ln)
+	}()
+	s.tasks.start(s.logger())
+
+	if err := notifyReady(); err != nil {
+		s.logger().Warn("server: readiness notification failed", "err", err)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sig)
+
+	for {
+		select {
+		case err := <-errc:
+			if errors.Is(err, http.ErrServerClosed) {
+				return nil
+			}
+			s.tasks.stop(context.Background())
+			if lc, ok := s.Handler.(Lifecycle); ok {
+				err = errors.Join(err, lc.Stop(context.Background()))
+			}
+			return err
+		case received := <-sig:
+			if received == syscall.SIGHUP {
+				if err := s.upgrade(); err != nil {
+					s.logger().Error("server: restart aborted", "err", err)
+					continue
+				}
+				s.logger().Info("server: new process ready, draining connections")
+			} else if err := sdNotify("STOPPING=1"); err != nil {
+				s.logger().Warn("server: stop notification failed", "err", err)
+			}
+			return s.shutdown()
+		}
+	}
+}
+
+func (s *Server) shutdown() error {
+	// Requests drain first, as they still record to background tasks such
+	// as metrics and log shippers. The tasks then flush what they hold, and
+	// the lifecycle hooks run last, as tasks may be using their resources.
+	ctx, cancel := withTimeout(s.ShutdownTimeout)
+	err := s.Shutdown(ctx)
+	cancel()
+
+	ctx, cancel = withTimeout(s.StopTimeout)
+	s.tasks.stop(ctx)
+	cancel()
+
+	if lc, ok := s.Handler.(Lifecycle); ok {
+		ctx, cancel = withTimeout(s.StopTimeout)
+		err = errors.Join(err, lc.Stop(ctx))
+		cancel()
+	}
+	return err
+}
+
+// withTimeout returns a context ending after d, or never when d is 0.
+func withTimeout(d time.Duration) (context.Context, context.CancelFunc) {
+	if d > 0 {
+		return context.WithTimeout(context.Background(), d)
+	}
+	return context.WithCancel(context.Background())
+}
+
+func (s *Server) listen() (net.Listener, error) {
+	if fd := os.Getenv(envListenFD); fd != "" {
+		os.Unsetenv(envListenFD)
+		f, err := inheritedFile(fd, "listener")
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return net.FileListener(f)
+	}
+
+	if ln, ok, err := systemdListener(s.logger()); ok {
+		return ln, err
+	}
+
+	addr := s.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	return net.Listen("tcp", addr)
+}
+
+func (s *Server) upgrade() error {
+	fl, ok := s.listener.(interface{ File() (*os.File, error) })
+	if !ok {
+		return ErrUpgradeNotAllowed
+	}
+	lf, err := fl.File()
+	if err != nil {
+		return err
+	}
+	defer lf.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// ExtraFiles start at fd 3 in the child.
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = []*os.File{lf, w}
+	cmd.Env = append(os.Environ(), envListenFD+"=3", envReadyFD+"=4")
+
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return err
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 1))
+		ready <- err
+	}()
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			cmd.Wait()
+			return fmt.Errorf("server: new process exited before becoming ready: %w", err)
+		}
+		return cmd.Process.Release()
+	case <-time.After(s.UpgradeTimeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		return ErrUpgradeTimeout
+	}
+}
+
+func notifyReady() error {
+	// MAINPID lets systemd follow the process across SIGHUP restarts.
+	err := sdNotify(fmt.Sprintf("READY=1\nMAINPID=%d", os.Getpid()))
+
+	fd := os.Getenv(envReadyFD)
+	if fd == "" {
+		return err
+	}
+	os.Unsetenv(envReadyFD)
+
+	f, ferr := inheritedFile(fd, "ready")
+	if ferr != nil {
+		return ferr
+	}
+	defer f.Close()
+
+	if _, werr := f.Write([]byte{1}); werr != nil {
+		return werr
+	}
+	return err
+}
+
+func inheritedFile(fd, name string) (*os.File, error) {
+	n, err := strconv.Atoi(fd)
+	if err != nil {
+		return nil, fmt.Errorf("server: invalid inherited %s descriptor %q", name, fd)
+	}
+	return os.NewFile(uintptr(n), name), nil
+}
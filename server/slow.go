@@ -0,0 +1,204 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+var errSlowClient = errors.New("server: client below the minimum data rate")
+
+// ClientLimits defend the server against clients that hold connections
+// open without using them: slowloris attacks trickling requests, readers
+// draining responses a few bytes at a time, or one address opening
+// hundreds of connections. Zero fields are off.
+type ClientLimits struct {
+	// MinReadRate is the slowest, in bytes per second, a client may send a
+	// request once it has been sending for longer than Grace.
+	MinReadRate int
+	// MinWriteRate is the slowest a client may read a response.
+	MinWriteRate int
+	// Grace is how long a connection may stay below the rates, 10 seconds
+	// by default, so short bursts of latency are forgiven.
+	Grace time.Duration
+	// MaxPerIP caps the connections open at once from one peer address.
+	// Connections over it are closed as soon as they are accepted. The peer
+	// is whoever opened the TCP connection, so behind a load balancer or
+	// proxy it caps them all together.
+	MaxPerIP int
+}
+
+// ProtectListener enforces limits on the connections accepted from l.
+func ProtectListener(l net.Listener, limits ClientLimits, logger *slog.Logger) net.Listener {
+	if limits.Grace <= 0 {
+		limits.Grace = 10 * time.Second
+	}
+	return &protectedListener{Listener: l, limits: limits, logger: logger, perIP: make(map[string]int)}
+}
+
+type protectedListener struct {
+	net.Listener
+	limits ClientLimits
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	perIP map[string]int
+}
+
+func (l *protectedListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip := remoteIP(c)
+		if !l.acquire(ip) {
+			l.logger.Warn("server: too many connections from client", "ip", ip, "limit", l.limits.MaxPerIP)
+			c.Close()
+			continue
+		}
+		return &protectedConn{Conn: c, l: l, ip: ip}, nil
+	}
+}
+
+func (l *protectedListener) acquire(ip string) bool {
+	if l.limits.MaxPerIP <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.perIP[ip] >= l.limits.MaxPerIP {
+		return false
+	}
+	l.perIP[ip]++
+	return true
+}
+
+func (l *protectedListener) release(ip string) {
+	if l.limits.MaxPerIP <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.perIP[ip]--; l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+}
+
+func remoteIP(c net.Conn) string {
+	host, _, err := net.SplitHostPort(c.RemoteAddr().String())
+	if err != nil {
+		return c.RemoteAddr().String()
+	}
+	return host
+}
+
+// writeChunk bounds how much is written under one deadline, so the write
+// rate is checked as a response goes out rather than once for all of it.
+const writeChunk = 16 << 10
+
+// protectedConn measures the rate of reads that return data. A read waiting
+// longer than Grace ends a burst instead: the connection is idle between
+// requests, not slow. The server's own write deadline is kept and tightened
+// for each chunk written.
+type protectedConn struct {
+	net.Conn
+	l  *protectedListener
+	ip string
+
+	mu            sync.Mutex
+	burstStart    time.Time
+	burstBytes    int
+	lastRead      time.Time
+	writeDeadline time.Time
+	closeOnce     sync.Once
+}
+
+func (c *protectedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n == 0 || c.l.limits.MinReadRate <= 0 {
+		return n, err
+	}
+
+	c.mu.Lock()
+	now := time.Now()
+	if c.burstStart.IsZero() || now.Sub(c.lastRead) > c.l.limits.Grace {
+		c.burstStart, c.burstBytes = now, 0
+	}
+	c.lastRead = now
+	c.burstBytes += n
+	elapsed := now.Sub(c.burstStart)
+	slow := elapsed > c.l.limits.Grace && float64(c.burstBytes)/elapsed.Seconds() < float64(c.l.limits.MinReadRate)
+	c.mu.Unlock()
+
+	if slow {
+		c.l.logger.Warn("server: closing slow client", "ip", c.ip, "direction", "read", "bytes", c.burstBytes, "elapsed", elapsed)
+		c.Close()
+		return n, errSlowClient
+	}
+	return n, err
+}
+
+func (c *protectedConn) Write(b []byte) (int, error) {
+	if c.l.limits.MinWriteRate <= 0 {
+		return c.Conn.Write(b)
+	}
+
+	written := 0
+	for len(b) > 0 {
+		chunk := b[:min(len(b), writeChunk)]
+		allowed := max(c.l.limits.Grace, time.Duration(float64(len(chunk))/float64(c.l.limits.MinWriteRate)*float64(time.Second)))
+		deadline := time.Now().Add(allowed)
+
+		c.mu.Lock()
+		if !c.writeDeadline.IsZero() && c.writeDeadline.Before(deadline) {
+			deadline = c.writeDeadline
+		}
+		c.mu.Unlock()
+		c.Conn.SetWriteDeadline(deadline)
+
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) && !deadline.Equal(c.serverWriteDeadline()) {
+				c.l.logger.Warn("server: closing slow client", "ip", c.ip, "direction", "write", "bytes", written)
+				c.Close()
+				return written, errSlowClient
+			}
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+func (c *protectedConn) serverWriteDeadline() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.writeDeadline
+}
+
+func (c *protectedConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *protectedConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *protectedConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() { c.l.release(c.ip) })
+	return err
+}
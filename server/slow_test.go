@@ -0,0 +1,178 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// protectedPair returns both ends of a loopback connection accepted through
+// ProtectListener.
+func protectedPair(t *testing.T, limits ClientLimits) (server, client net.Conn) {
+	t.Helper()
+	l := listen(t, limits)
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	select {
+	case server = <-accepted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not accepted")
+	}
+	t.Cleanup(func() { server.Close() })
+	return server, client
+}
+
+func listen(t *testing.T, limits ClientLimits) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ProtectListener(ln, limits, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestSlowReaderClosed(t *testing.T) {
+	server, client := protectedPair(t, ClientLimits{MinReadRate: 1000, Grace: 100 * time.Millisecond})
+	go func() {
+		// A byte every 20ms is 50 bytes a second.
+		for i := 0; i < 50; i++ {
+			if _, err := client.Write([]byte{'x'}); err != nil {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1)
+	for {
+		_, err := server.Read(buf)
+		if errors.Is(err, errSlowClient) {
+			return
+		}
+		if err != nil {
+			t.Fatalf("read: %v, want errSlowClient", err)
+		}
+	}
+}
+
+func TestIdleIsNotSlow(t *testing.T) {
+	server, client := protectedPair(t, ClientLimits{MinReadRate: 1000, Grace: 50 * time.Millisecond})
+	go func() {
+		// Two quick requests with a pause longer than Grace between them.
+		client.Write(make([]byte, 100))
+		time.Sleep(150 * time.Millisecond)
+		client.Write(make([]byte, 100))
+		client.Close()
+	}()
+
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := io.Copy(io.Discard, server)
+	if err != nil || n != 200 {
+		t.Errorf("read %d bytes: %v, want 200 and no error", n, err)
+	}
+}
+
+func TestSlowWriterClosed(t *testing.T) {
+	// A rate no client reaches: only Grace is allowed per chunk.
+	server, _ := protectedPair(t, ClientLimits{MinWriteRate: 1 << 30, Grace: 100 * time.Millisecond})
+
+	done := make(chan error, 1)
+	go func() {
+		// The client never reads, so the socket buffers fill up.
+		_, err := server.Write(make([]byte, 64<<20))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, errSlowClient) {
+			t.Errorf("write: %v, want errSlowClient", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("write to a client not reading never timed out")
+	}
+}
+
+func TestServerWriteDeadlineKept(t *testing.T) {
+	server, _ := protectedPair(t, ClientLimits{MinWriteRate: 1, Grace: time.Minute})
+	server.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := server.Write(make([]byte, 64<<20))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		// The server's own deadline passing is no fault of the client.
+		if !errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, errSlowClient) {
+			t.Errorf("write: %v, want the deadline exceeded", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the server's write deadline was lost")
+	}
+}
+
+func TestMaxPerIP(t *testing.T) {
+	l := listen(t, ClientLimits{MaxPerIP: 2})
+	accepted := make(chan net.Conn, 10)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	dial := func() net.Conn {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+	closed := func(c net.Conn) bool {
+		c.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		_, err := c.Read(make([]byte, 1))
+		return errors.Is(err, io.EOF)
+	}
+
+	dial()
+	dial()
+	<-accepted
+	first := <-accepted
+	if third := dial(); !closed(third) {
+		t.Error("a third connection from the address was kept open")
+	}
+
+	// Closing one makes room for another.
+	first.Close()
+	fourth := dial()
+	select {
+	case c := <-accepted:
+		defer c.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("no connection accepted after one closed")
+	}
+	if closed(fourth) {
+		t.Error("the connection replacing a closed one was turned away")
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFDsStart is SD_LISTEN_FDS_START, the first descriptor systemd passes
+// to socket-activated services.
+const listenFDsStart = 3
+
+// systemdListener returns the socket passed by systemd socket activation, if
+// any. Only the first socket is used; the router serves a single listener.
+func systemdListener(logger *slog.Logger) (net.Listener, bool, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, false, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, false, nil
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if n > 1 {
+		logger.Warn("server: systemd passed several sockets, serving on the first only", "sockets", n)
+	}
+
+	f := os.NewFile(listenFDsStart, "systemd")
+	defer f.Close()
+
+	ln, err := net.FileListener(f)
+	return ln, true, err
+}
+
+// sdNotify sends a state update to the systemd notification socket. It is a
+// no-op when the process is not supervised by systemd.
+func sdNotify(state string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
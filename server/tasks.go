@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Task is background work tied to the server's lifetime. Its context is
+// cancelled when the server begins shutting down.
+type Task func(ctx context.Context) error
+
+type tasks struct {
+	mu      sync.Mutex
+	pending []Task
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	logger  *slog.Logger
+}
+
+// Go runs task in its own goroutine once the server is listening, or right
+// away if it already is.
+func (s *Server) Go(task Task) {
+	s.tasks.mu.Lock()
+	defer s.tasks.mu.Unlock()
+
+	if s.tasks.ctx == nil {
+		s.tasks.pending = append(s.tasks.pending, task)
+		return
+	}
+	s.tasks.run(task)
+}
+
+// Every runs task each interval until shutdown. Runs never overlap; a slow
+// run delays the next one. The first run happens one interval after start.
+func (s *Server) Every(interval time.Duration, task Task) {
+	s.Go(func(ctx context.Context) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				if err := safely(ctx, s.tasks.logger, task); err != nil {
+					s.tasks.logger.Error("server: periodic task", "err", err)
+				}
+			}
+		}
+	})
+}
+
+func (t *tasks) start(logger *slog.Logger) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.logger = logger
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	for _, task := range t.pending {
+		t.run(task)
+	}
+	t.pending = nil
+}
+
+func (t *tasks) run(task Task) {
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		if err := safely(t.ctx, t.logger, task); err != nil {
+			t.logger.Error("server: task", "err", err)
+		}
+	}()
+}
+
+// stop cancels every task and waits for them to return, or for ctx to end.
+func (t *tasks) stop(ctx context.Context) {
+	t.mu.Lock()
+	if t.cancel != nil {
+		t.cancel()
+	}
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.logger.Warn("server: background tasks did not stop in time")
+	}
+}
+
+// safely keeps a panicking task from taking the whole server down.
+func safely(ctx context.Context, logger *slog.Logger, task Task) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			logger.Error("server: task panicked", "panic", v, "stack", string(debug.Stack()))
+		}
+	}()
+	return task(ctx)
+}
@@ -0,0 +1,211 @@
+// Package statsd sends request metrics to a StatsD or DogStatsD agent over
+// UDP, for deployments that push metrics rather than scrape them.
+package statsd
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// Options configure a Client.
+type Options struct {
+	// Addr is the agent's host:port, localhost:8125 by default.
+	Addr string
+	// Prefix starts every metric name, "router." by default.
+	Prefix string
+	// Tags are added to every metric, e.g. "env:prod".
+	Tags []string
+	// DogStatsD sends tags in the DogStatsD "|#tag:value" extension. Plain
+	// StatsD has no tags, so without it the route and the status class go
+	// into the metric name, e.g. router.GET_users_id.2xx.requests, and other
+	// tags are dropped.
+	DogStatsD bool
+	// SampleRate is the fraction of requests sent, from 0 to 1; agents scale
+	// counts back up. 0 sends every request.
+	SampleRate float64
+	// FlushInterval bounds how long metrics wait to fill a packet, 1s by
+	// default.
+	FlushInterval time.Duration
+	// MaxPacket is the largest datagram sent, 1432 bytes by default to fit
+	// an Ethernet MTU.
+	MaxPacket int
+}
+
+// Client is a router.MetricsSink sending, for every request, a counter
+// (requests) and a timer (request.duration) tagged with the method, route,
+// status and the route's metric labels. Lines are batched into packets,
+// only ever sent by Run, so requests never wait on the network; packets are
+// dropped rather than queued without bound when Run cannot keep up.
+type Client struct {
+	opts Options
+	conn net.Conn
+	// full holds the packets filled before Run's next tick.
+	full chan []byte
+
+	mu     sync.Mutex
+	packet []byte
+}
+
+// maxQueued bounds the full packets waiting for Run.
+const maxQueued = 64
+
+// New returns a client for the agent at opts.Addr. UDP needs no connection,
+// so it only fails when the address does not resolve.
+func New(opts Options) (*Client, error) {
+	if opts.Addr == "" {
+		opts.Addr = "localhost:8125"
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "router."
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.MaxPacket <= 0 {
+		opts.MaxPacket = 1432
+	}
+	if opts.SampleRate < 0 || opts.SampleRate > 1 {
+		return nil, errors.New("statsd: sample rate must be between 0 and 1")
+	}
+	conn, err := net.Dial("udp", opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{opts: opts, conn: conn, full: make(chan []byte, maxQueued)}, nil
+}
+
+func (c *Client) Record(m router.RequestMetric) {
+	rate := c.opts.SampleRate
+	if rate > 0 && rate < 1 && rand.Float64() >= rate {
+		return
+	}
+
+	name, tags := c.opts.Prefix, c.tags(m)
+	if !c.opts.DogStatsD {
+		name += metricName(m.RouteLabel()) + "." + strconv.Itoa(m.Status/100) + "xx."
+	}
+	ms := strconv.FormatFloat(float64(m.Duration)/float64(time.Millisecond), 'f', 3, 64)
+	c.add(name+"requests", "1", "c", rate, tags)
+	c.add(name+"request.duration", ms, "ms", rate, tags)
+}
+
+// tags returns the DogStatsD tags of m, or "".
+func (c *Client) tags(m router.RequestMetric) string {
+	if !c.opts.DogStatsD {
+		return ""
+	}
+	tags := append([]string(nil), c.opts.Tags...)
+	tags = append(tags, "method:"+m.Method, "route:"+m.RouteLabel(), "status:"+strconv.Itoa(m.Status))
+	if m.Route != nil {
+		labels := m.Route.MetricLabels()
+		names := make([]string, 0, len(labels))
+		for name := range labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			tags = append(tags, name+":"+labels[name])
+		}
+	}
+	for i, tag := range tags {
+		tags[i] = tagValue.Replace(tag)
+	}
+	return strings.Join(tags, ",")
+}
+
+// tagValue removes the characters separating lines, fields and tags.
+var tagValue = strings.NewReplacer("\n", "", "|", "_", ",", "_", "#", "_")
+
+// metricName makes a route pattern such as "GET:/users/{id}" usable in a
+// plain StatsD name, "GET_users_id".
+func metricName(s string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range s {
+		if r == '-' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+			b.WriteRune(r)
+			underscore = false
+		} else if !underscore && b.Len() > 0 {
+			b.WriteByte('_')
+			underscore = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
+
+// add appends one line to the packet, handing the packet to Run first when
+// the line would not fit.
+func (c *Client) add(name, value, kind string, rate float64, tags string) {
+	line := name + ":" + value + "|" + kind
+	if rate > 0 && rate < 1 {
+		line += "|@" + strconv.FormatFloat(rate, 'f', -1, 64)
+	}
+	if tags != "" {
+		line += "|#" + tags
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.packet) > 0 && len(c.packet)+1+len(line) > c.opts.MaxPacket {
+		select {
+		case c.full <- c.packet:
+		default:
+			// Run is behind; the packet is lost like any other UDP loss.
+		}
+		c.packet = make([]byte, 0, c.opts.MaxPacket)
+	}
+	if len(c.packet) > 0 {
+		c.packet = append(c.packet, '\n')
+	}
+	c.packet = append(c.packet, line...)
+}
+
+// send writes a packet. Errors, e.g. ICMP port unreachable while the agent
+// restarts, lose the packet like any other UDP loss.
+func (c *Client) send(packet []byte) {
+	if len(packet) > 0 {
+		c.conn.Write(packet)
+	}
+}
+
+// take returns the packet being filled, leaving an empty one.
+func (c *Client) take() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	packet := c.packet
+	c.packet = nil
+	return packet
+}
+
+// Run sends the packets as they fill, and what is buffered every
+// FlushInterval, until ctx is done; it then sends what is left and closes
+// the connection. Run it as a server task: without it nothing is sent.
+func (c *Client) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case packet := <-c.full:
+			c.send(packet)
+		case <-ticker.C:
+			c.send(c.take())
+		case <-ctx.Done():
+			// Only Run receives, so what is queued stays there.
+			for len(c.full) > 0 {
+				c.send(<-c.full)
+			}
+			c.send(c.take())
+			return c.conn.Close()
+		}
+	}
+}
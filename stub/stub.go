@@ -0,0 +1,155 @@
+// Package stub serves canned responses for routes declared in
+// configuration, so clients can be developed against the router before the
+// backends behind it exist.
+package stub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// Stub is one canned route. Body and header values are text/template
+// templates executed with the Request, e.g.
+//
+//	{"id": {{.Param "id" | json}}, "requested_at": "{{.Now.Format "2006-01-02"}}"}
+type Stub struct {
+	// Route is the pattern the stub is registered under, e.g.
+	// "GET:/users/{id}".
+	Route string `mapstructure:"route"`
+	// Status is 200 by default.
+	Status  int               `mapstructure:"status"`
+	Headers map[string]string `mapstructure:"headers"`
+	// Body is the response body, or BodyFile the file holding it. The
+	// Content-Type, unless set in Headers, follows the file extension or
+	// is JSON for bodies starting with { or [.
+	Body     string `mapstructure:"body"`
+	BodyFile string `mapstructure:"body_file"`
+	// Latency delays the response, as a slow backend would.
+	Latency time.Duration `mapstructure:"latency"`
+}
+
+// Request is what the templates of a stub see.
+type Request struct {
+	Method    string
+	Path      string
+	RequestID string
+	Now       time.Time
+
+	r *http.Request
+}
+
+// Param returns the value of the {name} segment of the stub's route, when
+// the router matches parameters (see router.NewTrieMatcher).
+func (r Request) Param(name string) string { return router.Param(r.r, name) }
+
+func (r Request) Query(name string) string { return r.r.URL.Query().Get(name) }
+
+func (r Request) Header(name string) string { return r.r.Header.Get(name) }
+
+var funcs = template.FuncMap{
+	// json quotes a value for a JSON body.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// Routes compiles stubs into routes for router.Register, each with the
+// value "stub" set so logs and route listings tell them apart.
+func Routes(stubs []Stub) (router.RouteSpecs, error) {
+	routes := make(router.RouteSpecs, 0, len(stubs))
+	for _, s := range stubs {
+		handler, err := Handler(s)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, router.RouteSpec{Pattern: s.Route, Handler: handler, Values: map[string]any{"stub": true}})
+	}
+	return routes, nil
+}
+
+// Handler compiles the templates of s into the handler serving it.
+func Handler(s Stub) (http.Handler, error) {
+	if s.Status == 0 {
+		s.Status = http.StatusOK
+	}
+	if s.Status < 100 || s.Status > 599 {
+		return nil, fmt.Errorf("stub %s: invalid status %d", s.Route, s.Status)
+	}
+
+	header := make(http.Header, len(s.Headers))
+	for name, value := range s.Headers {
+		header.Set(name, value)
+	}
+	body := s.Body
+	if s.BodyFile != "" {
+		b, err := os.ReadFile(s.BodyFile)
+		if err != nil {
+			return nil, fmt.Errorf("stub %s: %w", s.Route, err)
+		}
+		body = string(b)
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", mime.TypeByExtension(filepath.Ext(s.BodyFile)))
+		}
+	}
+	if header.Get("Content-Type") == "" {
+		if trimmed := strings.TrimSpace(body); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+			header.Set("Content-Type", "application/json")
+		}
+	}
+
+	bodyTmpl, err := template.New(s.Route).Funcs(funcs).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("stub %s: body: %w", s.Route, err)
+	}
+	headerTmpls := make(map[string]*template.Template, len(header))
+	for name := range header {
+		t, err := template.New(name).Funcs(funcs).Parse(header.Get(name))
+		if err != nil {
+			return nil, fmt.Errorf("stub %s: header %s: %w", s.Route, name, err)
+		}
+		headerTmpls[name] = t
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if s.Latency > 0 {
+			t := time.NewTimer(s.Latency)
+			select {
+			case <-t.C:
+			case <-r.Context().Done():
+				t.Stop()
+				return
+			}
+		}
+
+		data := Request{Method: r.Method, Path: r.URL.Path, RequestID: router.RequestID(r), Now: time.Now(), r: r}
+		var out bytes.Buffer
+		for name, t := range headerTmpls {
+			out.Reset()
+			if err := t.Execute(&out, data); err != nil {
+				router.Logger(r).Error("stub: header template failed", "header", name, "err", err)
+				http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			rw.Header().Set(name, out.String())
+		}
+		out.Reset()
+		if err := bodyTmpl.Execute(&out, data); err != nil {
+			router.Logger(r).Error("stub: body template failed", "err", err)
+			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		rw.WriteHeader(s.Status)
+		rw.Write(out.Bytes())
+	}), nil
+}
@@ -0,0 +1,272 @@
+// Package tenant resolves the tenant a request belongs to and enforces what
+// that tenant may do: its request rate, its quota and the routes it sees.
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ritego/build-a-router-with-go/auth"
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// Tenant is one customer of a multi-tenant deployment.
+type Tenant struct {
+	ID string `mapstructure:"id"`
+	// Rate is the sustained requests per second allowed, with bursts of up
+	// to Burst. Zero means unlimited.
+	Rate  float64 `mapstructure:"rate"`
+	Burst int     `mapstructure:"burst"`
+	// Quota is the number of requests allowed per QuotaPeriod, e.g. a
+	// monthly plan. Zero means unlimited.
+	Quota       int64         `mapstructure:"quota"`
+	QuotaPeriod time.Duration `mapstructure:"quota_period"`
+	// Routes lists the path prefixes the tenant may reach; other paths
+	// answer 404 as if they did not exist, as do paths whose dot segments
+	// lead out of them, in case a handler such as a proxy resolves them.
+	// Empty allows every route.
+	Routes []string `mapstructure:"routes"`
+}
+
+// Resolver returns the ID of the tenant a request belongs to, or "".
+type Resolver func(r *http.Request) string
+
+// FromSubdomain takes the tenant from the first label of hosts below
+// domain: "acme.example.com" is tenant "acme" for domain "example.com".
+// Internationalized labels are in their "xn--" form, see
+// router.NormalizeHost.
+func FromSubdomain(domain string) Resolver {
+	suffix := "." + router.NormalizeHost(strings.Trim(domain, "."))
+	return func(r *http.Request) string {
+		host := router.NormalizeHost(r.Host)
+		sub, ok := strings.CutSuffix(host, suffix)
+		if !ok || strings.Contains(sub, ".") {
+			return ""
+		}
+		return sub
+	}
+}
+
+func FromHeader(name string) Resolver {
+	return func(r *http.Request) string { return r.Header.Get(name) }
+}
+
+// FromClaim takes the tenant from a claim of the signed-in user's token, so
+// it cannot be chosen by the client.
+func FromClaim(name string) Resolver {
+	return func(r *http.Request) string { return auth.ClaimsFrom(r).String(name) }
+}
+
+type tenantKey struct{}
+
+// From returns the tenant of the request, or nil outside of Manager's
+// middleware.
+func From(r *http.Request) *Tenant {
+	t, _ := r.Context().Value(tenantKey{}).(*Tenant)
+	return t
+}
+
+// Stats are the counters kept for each tenant.
+type Stats struct {
+	Requests    int64 `json:"requests"`
+	RateLimited int64 `json:"rate_limited"`
+	OverQuota   int64 `json:"over_quota"`
+	Hidden      int64 `json:"hidden"`
+	QuotaUsed   int64 `json:"quota_used"`
+}
+
+type state struct {
+	tenant *Tenant
+
+	mu          sync.Mutex
+	tokens      float64
+	last        time.Time
+	quotaUsed   int64
+	quotaPeriod time.Time
+
+	requests, rateLimited, overQuota, hidden atomic.Int64
+}
+
+// Manager holds the tenants and enforces their limits.
+type Manager struct {
+	resolve  Resolver
+	required bool
+
+	mu      sync.RWMutex
+	tenants map[string]*state
+}
+
+// NewManager returns a manager resolving tenants with resolve. When
+// required, requests without a known tenant are refused with 404;
+// otherwise they pass through without one.
+func NewManager(resolve Resolver, required bool) *Manager {
+	return &Manager{resolve: resolve, required: required, tenants: make(map[string]*state)}
+}
+
+// SetTenants replaces the tenant list. Counters and quota use of tenants
+// that remain are kept, so it is safe to call on every config reload.
+func (m *Manager) SetTenants(tenants []Tenant) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	next := make(map[string]*state, len(tenants))
+	for i := range tenants {
+		t := tenants[i]
+		s, ok := m.tenants[t.ID]
+		if !ok {
+			s = &state{tokens: float64(t.Burst), last: time.Now()}
+		}
+		s.mu.Lock()
+		s.tenant = &t
+		s.mu.Unlock()
+		next[t.ID] = s
+	}
+	m.tenants = next
+}
+
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		m.mu.RLock()
+		s := m.tenants[m.resolve(r)]
+		m.mu.RUnlock()
+
+		if s == nil {
+			if m.required {
+				http.Error(rw, "unknown tenant", http.StatusNotFound)
+				return
+			}
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		s.requests.Add(1)
+		s.mu.Lock()
+		t := s.tenant
+		s.mu.Unlock()
+
+		if !visible(t, r.URL.Path) || !visible(t, path.Clean("/"+r.URL.Path)) {
+			s.hidden.Add(1)
+			http.NotFound(rw, r)
+			return
+		}
+		if wait, ok := s.allow(); !ok {
+			s.rateLimited.Add(1)
+			rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(rw, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		if !s.useQuota() {
+			s.overQuota.Add(1)
+			http.Error(rw, "quota exhausted", http.StatusTooManyRequests)
+			return
+		}
+
+		router.Logger(r).Debug("tenant resolved", "tenant", t.ID)
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), tenantKey{}, t)))
+	})
+}
+
+// Stats returns the counters of every tenant by ID.
+func (m *Manager) Stats() map[string]Stats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make(map[string]Stats, len(m.tenants))
+	for id, s := range m.tenants {
+		s.mu.Lock()
+		used := s.quotaUsed
+		s.mu.Unlock()
+		out[id] = Stats{
+			Requests:    s.requests.Load(),
+			RateLimited: s.rateLimited.Load(),
+			OverQuota:   s.overQuota.Load(),
+			Hidden:      s.hidden.Load(),
+			QuotaUsed:   used,
+		}
+	}
+	return out
+}
+
+// ServeHTTP serves Stats as JSON, sorted by tenant, for an admin route.
+func (m *Manager) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	stats := m.Stats()
+	ids := make([]string, 0, len(stats))
+	for id := range stats {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	type entry struct {
+		Tenant string `json:"tenant"`
+		Stats
+	}
+	out := make([]entry, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, entry{Tenant: id, Stats: stats[id]})
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(out)
+}
+
+func visible(t *Tenant, path string) bool {
+	if len(t.Routes) == 0 {
+		return true
+	}
+	for _, prefix := range t.Routes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// allow takes a token from the tenant's bucket, or reports how long until
+// one is available.
+func (s *state) allow() (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.tenant
+	if t.Rate <= 0 {
+		return 0, true
+	}
+	burst := float64(max(t.Burst, 1))
+	now := time.Now()
+	s.tokens = math.Min(burst, s.tokens+now.Sub(s.last).Seconds()*t.Rate)
+	s.last = now
+	if s.tokens < 1 {
+		return time.Duration((1 - s.tokens) / t.Rate * float64(time.Second)), false
+	}
+	s.tokens--
+	return 0, true
+}
+
+// useQuota counts the request against the quota of the current period.
+func (s *state) useQuota() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.tenant
+	if t.Quota <= 0 {
+		return true
+	}
+	if t.QuotaPeriod > 0 && time.Since(s.quotaPeriod) >= t.QuotaPeriod {
+		s.quotaPeriod = time.Now().Truncate(t.QuotaPeriod)
+		s.quotaUsed = 0
+	}
+	if s.quotaUsed >= t.Quota {
+		return false
+	}
+	s.quotaUsed++
+	return true
+}
@@ -0,0 +1,138 @@
+package tenant
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ritego/build-a-router-with-go/router"
+)
+
+// serve routes /admin, /billing, /billing/invoices and /billingx behind m.
+func serve(m *Manager) *router.Router {
+	r := router.New()
+	r.Use(m.Middleware)
+	for _, path := range []string{"/admin", "/billing", "/billing/invoices", "/billingx"} {
+		r.HandleFunc("GET:"+path, func(rw http.ResponseWriter, rr *http.Request) {
+			if From(rr) == nil {
+				rw.Header().Set("X-Tenant-Seen", "none")
+				return
+			}
+			rw.Header().Set("X-Tenant-Seen", From(rr).ID)
+		})
+	}
+	return r
+}
+
+func get(h http.Handler, target, tenant string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", target, nil)
+	if tenant != "" {
+		r.Header.Set("X-Tenant", tenant)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestRouteHiding(t *testing.T) {
+	m := NewManager(FromHeader("X-Tenant"), true)
+	m.SetTenants([]Tenant{
+		{ID: "acme", Routes: []string{"/billing/"}},
+		{ID: "root", Routes: []string{"/"}},
+		{ID: "open"},
+	})
+	r := serve(m)
+
+	for _, tt := range []struct {
+		tenant, path string
+		status       int
+	}{
+		{"acme", "/billing", 200},
+		{"acme", "/billing/invoices", 200},
+		{"acme", "/admin", 404},
+		// Sharing a prefix is not being below it.
+		{"acme", "/billingx", 404},
+		// Dot segments do not climb out of the allowed prefix.
+		{"acme", "/billing/../admin", 404},
+		{"acme", "/billing/%2e%2e/admin", 404},
+		{"acme", "//admin", 404},
+		{"root", "/admin", 200},
+		{"open", "/admin", 200},
+		{"unknown", "/billing", 404},
+		{"", "/billing", 404},
+	} {
+		rec := get(r, tt.path, tt.tenant)
+		if rec.Code != tt.status {
+			t.Errorf("tenant %q: GET %s = %d, want %d", tt.tenant, tt.path, rec.Code, tt.status)
+		}
+		if tt.status == 200 && rec.Header().Get("X-Tenant-Seen") != tt.tenant {
+			t.Errorf("tenant %q: handler saw tenant %q", tt.tenant, rec.Header().Get("X-Tenant-Seen"))
+		}
+	}
+
+	if s := m.Stats()["acme"]; s.Hidden != 5 || s.Requests != 7 {
+		t.Errorf("acme stats %+v, want 5 of 7 requests hidden", s)
+	}
+}
+
+func TestUnknownTenantPassesWhenNotRequired(t *testing.T) {
+	m := NewManager(FromHeader("X-Tenant"), false)
+	m.SetTenants([]Tenant{{ID: "acme", Routes: []string{"/billing"}}})
+	rec := get(serve(m), "/admin", "unknown")
+	if rec.Code != 200 || rec.Header().Get("X-Tenant-Seen") != "none" {
+		t.Errorf("unknown tenant: %d, saw %q; want 200 without a tenant", rec.Code, rec.Header().Get("X-Tenant-Seen"))
+	}
+}
+
+func TestFromSubdomain(t *testing.T) {
+	resolve := FromSubdomain("Example.com.")
+	for host, want := range map[string]string{
+		"acme.example.com":      "acme",
+		"ACME.example.com:8443": "acme",
+		"acme.example.com.":     "acme",
+		"bücher.example.com":    "xn--bcher-kva",
+		"example.com":           "",
+		"a.b.example.com":       "",
+		"acme.example.com.evil": "",
+		"acme-example.com":      "",
+		"acme.notexample.com":   "",
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = host
+		if got := resolve(r); got != want {
+			t.Errorf("FromSubdomain(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestRateAndQuota(t *testing.T) {
+	m := NewManager(FromHeader("X-Tenant"), true)
+	m.SetTenants([]Tenant{
+		{ID: "burst", Rate: 0.001, Burst: 2},
+		{ID: "plan", Quota: 3, QuotaPeriod: time.Hour},
+	})
+	r := serve(m)
+
+	for i, want := range []int{200, 200, 429} {
+		if rec := get(r, "/admin", "burst"); rec.Code != want {
+			t.Errorf("burst request %d: %d, want %d", i, rec.Code, want)
+		} else if want == 429 && rec.Header().Get("Retry-After") == "" {
+			t.Error("rate limited without Retry-After")
+		}
+	}
+	for i, want := range []int{200, 200, 200, 429} {
+		if code := get(r, "/admin", "plan").Code; code != want {
+			t.Errorf("plan request %d: %d, want %d", i, code, want)
+		}
+	}
+
+	// Reloading the tenants keeps the quota used.
+	m.SetTenants([]Tenant{{ID: "plan", Quota: 3, QuotaPeriod: time.Hour}})
+	if code := get(r, "/admin", "plan").Code; code != 429 {
+		t.Errorf("after a reload: %d, want the quota still exhausted", code)
+	}
+	if s := m.Stats()["plan"]; s.QuotaUsed != 3 || s.OverQuota != 2 {
+		t.Errorf("plan stats %+v, want 3 used and 2 over quota", s)
+	}
+}
@@ -0,0 +1,193 @@
+package upload
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// sniffLen is the number of bytes http.DetectContentType looks at.
+const sniffLen = 512
+
+var (
+	ErrNotMultipart    = errors.New("upload: request is not multipart/form-data")
+	ErrFileTooLarge    = errors.New("upload: file exceeds the size limit")
+	ErrRequestTooLarge = errors.New("upload: request exceeds the size limit")
+	ErrTooManyFiles    = errors.New("upload: too many files")
+	ErrTypeNotAllowed  = errors.New("upload: file type is not allowed")
+)
+
+// Limits bound what a client may upload. Zero values mean no limit.
+type Limits struct {
+	MaxFileSize  int64
+	MaxTotalSize int64
+	MaxFiles     int
+	AllowedTypes []string // sniffed MIME types, e.g. "image/png"; "image/*" allowed
+}
+
+// Part is a file being streamed out of a multipart request. ContentType is
+// sniffed from the content, not taken from the client.
+type Part struct {
+	io.Reader
+	Field       string
+	Filename    string
+	ContentType string
+}
+
+// File is an upload saved to disk by Save.
+type File struct {
+	Field       string
+	Filename    string
+	ContentType string
+	Size        int64
+	Path        string
+}
+
+// Stream reads a multipart/form-data request part by part without buffering
+// files in memory, calling fn for each file. Reads from a Part fail with
+// ErrFileTooLarge or ErrRequestTooLarge once a limit is crossed. Plain form
+// fields are collected and returned.
+func Stream(r *http.Request, limits Limits, fn func(*Part) error) (url.Values, error) {
+	total := &limitedReader{r: r.Body, n: limits.MaxTotalSize, err: ErrRequestTooLarge}
+	r.Body = readCloser{total, r.Body}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, ErrNotMultipart
+	}
+
+	fields := make(url.Values)
+	files := 0
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return fields, nil
+		}
+		if err != nil {
+			if total.exceeded {
+				return nil, ErrRequestTooLarge
+			}
+			return nil, err
+		}
+
+		if p.FileName() == "" {
+			var b strings.Builder
+			if _, err := io.Copy(&b, p); err != nil {
+				return nil, err
+			}
+			fields.Add(p.FormName(), b.String())
+			continue
+		}
+
+		files++
+		if limits.MaxFiles > 0 && files > limits.MaxFiles {
+			return nil, ErrTooManyFiles
+		}
+
+		br := bufio.NewReaderSize(&limitedReader{r: p, n: limits.MaxFileSize, err: ErrFileTooLarge}, sniffLen)
+		head, err := br.Peek(sniffLen)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return nil, err
+		}
+		contentType := http.DetectContentType(head)
+		if !allowed(limits.AllowedTypes, contentType) {
+			return nil, ErrTypeNotAllowed
+		}
+
+		if err := fn(&Part{Reader: br, Field: p.FormName(), Filename: p.FileName(), ContentType: contentType}); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Save streams every file of the request into its own temporary file in dir
+// (os.TempDir() when empty). The files are removed once the request's
+// context is done, i.e. when the handler returns, so handlers that want to
+// keep an upload must move it elsewhere first.
+func Save(r *http.Request, dir string, limits Limits) ([]*File, url.Values, error) {
+	var files []*File
+	cleanup := func() {
+		for _, f := range files {
+			os.Remove(f.Path)
+		}
+	}
+
+	fields, err := Stream(r, limits, func(p *Part) error {
+		tmp, err := os.CreateTemp(dir, "upload-*")
+		if err != nil {
+			return err
+		}
+		files = append(files, &File{Field: p.Field, Filename: p.Filename, ContentType: p.ContentType, Path: tmp.Name()})
+
+		n, err := io.Copy(tmp, p)
+		files[len(files)-1].Size = n
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	})
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	go func() {
+		<-r.Context().Done()
+		cleanup()
+	}()
+	return files, fields, nil
+}
+
+// Status maps upload errors to the response status a handler should send.
+func Status(err error) int {
+	switch {
+	case errors.Is(err, ErrFileTooLarge), errors.Is(err, ErrRequestTooLarge), errors.Is(err, ErrTooManyFiles):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrTypeNotAllowed), errors.Is(err, ErrNotMultipart):
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusBadRequest
+}
+
+func allowed(types []string, contentType string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, t := range types {
+		if t == mediaType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// limitedReader fails with err instead of silently truncating once more
+// than n bytes have been read. n <= 0 disables the limit.
+type limitedReader struct {
+	r        io.Reader
+	n        int64
+	read     int64
+	err      error
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.n > 0 && l.read > l.n {
+		l.exceeded = true
+		return 0, l.err
+	}
+	return n, err
+}